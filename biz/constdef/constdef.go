@@ -11,6 +11,18 @@ const (
 	DataTypeTrade      = "trade"
 	DataTypeOrder      = "order"
 	DataTypeOrderQueue = "orderqueue"
+	DataTypeBar        = "bar"
+	DataTypeDaily      = "daily"
+
+	DataTypeOrderLifecycle = "order_lifecycle"
+	DataTypeTick           = "tick"       // 快照、成交、委托、委托队列交错的统一事件流
+	DataTypeInstrument     = "instrument" // 当天的证券主数据，输出到 reference 目录
+)
+
+// tick 事件流的排序时间
+const (
+	TickOrderLocal    = "local"    // 默认，采集端本地接收时间，与其他数据类型的排序一致
+	TickOrderExchange = "exchange" // 交易所时间
 )
 
 // 委托类型常量
@@ -19,8 +31,139 @@ const (
 	OrderTypeCancel = "cancel" // 撤单
 )
 
+// 委托价格类型常量
+const (
+	PriceTypeLimit   = "limit"    // 限价
+	PriceTypeMarket  = "market"   // 市价
+	PriceTypeBestOwn = "best_own" // 本方最优
+	PriceTypeUnknown = "unknown"
+)
+
+// 委托最终状态
+const (
+	OrderStateFilled          = "filled"           // 全部成交
+	OrderStatePartiallyFilled = "partially_filled" // 部分成交，收盘时仍有剩余
+	OrderStateCancelled       = "cancelled"        // 已撤单（可能撤单前有部分成交）
+	OrderStateLive            = "live"             // 未成交，收盘时仍挂单
+)
+
 // 输出模式常量
 const (
-	OutputModePerStock = "per_stock" // 每天每个票一个文件
-	OutputModePerDay   = "per_day"   // 每天所有票一个文件
+	OutputModePerStock        = "per_stock"         // 每天每个票一个文件
+	OutputModePerDay          = "per_day"           // 每天所有票一个文件
+	OutputModePerDayClustered = "per_day_clustered" // 每天所有票一个文件，按 (票, 时间) 排序，行组按票对齐，附带 sidecar 索引
+)
+
+// 输出目录结构
+const (
+	OutputLayoutLegacy = "legacy" // 默认，按 output_mode 输出 dst/<type>/<date>/... 或 dst/<type>/<date>_<type>.parquet
+	OutputLayoutHive   = "hive"   // dst/<type>/date=YYYYMMDD/market=SH|SZ[/bucket=N]/part-00000.parquet
+)
+
+// 内置 schema profile，见 config.SchemaProfile
+const (
+	SchemaProfileFull     = "full"     // 默认，输出全部列，10 档盘口
+	SchemaProfileStandard = "standard" // 去掉接收端字段 SeqNo/LocalTimestamp，10 档盘口
+	SchemaProfileMinimal  = "minimal"  // 再去掉交易所原生序号字段，5 档盘口
+)
+
+// 输出文件格式
+const (
+	OutputFormatParquet = "parquet" // 默认
+	OutputFormatArrow   = "arrow"   // Arrow IPC 文件（Feather v2），列与 parquet 相同
+	OutputFormatCsvGz   = "csv.gz"  // gzip 压缩的 CSV，列表列展开为 BidPrice1..10 这样的多列
+	OutputFormatBoth    = "both"    // 同时输出 parquet 和 csv.gz
+)
+
+// K 线空档填充方式
+const (
+	BarFillNone    = "none"    // 无成交的区间不输出
+	BarFillEmpty   = "empty"   // 无成交的区间输出空 bar（价格为 0）
+	BarFillForward = "forward" // 无成交的区间沿用上一根 bar 的收盘价，当天第一笔成交之前的区间不输出
+)
+
+// 交易时段
+const (
+	TradingPhaseOpenAuction  = "open_auction"  // 开盘集合竞价（09:25 撮合）
+	TradingPhaseContinuous   = "continuous"    // 连续竞价
+	TradingPhaseCloseAuction = "close_auction" // 收盘集合竞价（14:57-15:00）
+	TradingPhaseAfterHours   = "after_hours"   // 盘后固定价格交易（科创板 15:05-15:30）
+)
+
+// 市场
+const (
+	MarketSH = "SH"
+	MarketSZ = "SZ"
+)
+
+// 逐笔序号完整性问题类型
+const (
+	SequenceIssueGap        = "gap"          // 序号缺失
+	SequenceIssueDuplicate  = "duplicate"    // 序号重复
+	SequenceIssueOutOfOrder = "out_of_order" // 序号乱序（小于此前已出现的最大序号）
+)
+
+// 子命令
+const (
+	CommandRun      = "run"      // 默认，按 data_type_list 清洗
+	CommandValidate = "validate" // 只做逐笔序号完整性检查
+	CommandQuery    = "query"    // 从清洗输出做多日、多票合并查询，见 config.Query*
+	CommandServe    = "serve"    // 只读 HTTP 接口，浏览和读取 dst_dir 的清洗输出
+	CommandReplay   = "replay"   // 按本地接收时间回放历史行情，见 config.Replay*
+)
+
+// 时间戳输出编码
+const (
+	TimestampEncodingUtcNanos   = "utc_nanos"   // 默认，UTC 纪元纳秒，parquet 标记为 TIMESTAMP(NANOS, isAdjustedToUTC=true)
+	TimestampEncodingLocalNanos = "local_nanos" // 交易所本地时间（UTC+8）当作纪元纳秒，parquet 标记为 TIMESTAMP(NANOS, isAdjustedToUTC=false)
+	TimestampEncodingHHMMSSmmm  = "hhmmssmmm"   // 交易所本地时间整数 HHMMSSmmm，如 93000000，不带逻辑类型
+)
+
+// 价格列编码
+const (
+	PriceEncodingFloat64 = "float64" // 默认
+	PriceEncodingInt64   = "int64"   // 价格×10^price_scale 的整数，scale 记录在文件元数据中
+	PriceEncodingDecimal = "decimal" // parquet_decimal_price 开启时的 INT64 DECIMAL，只出现在元数据中
+)
+
+// parquet 压缩算法
+const (
+	ParquetCompressionSnappy = "snappy" // 默认
+	ParquetCompressionZstd   = "zstd"
+	ParquetCompressionGzip   = "gzip"
+	ParquetCompressionNone   = "none"
+)
+
+// parquet 文件 key/value 元数据
+const (
+	// 输出 schema 变更（增删列、改类型、改列的含义）时递增
+	// 3: 沪市 Order.OrderId 由 BizIndex 改为交易所委托号；Trade.TradeId 深市由 SeqNo 改为 ApplSeqNum，沪市旧格式由 BizIndex 改为 TradeIndex
+	ParquetSchemaVersion = "3"
+
+	ParquetMetaProducer      = "data_scrubber.producer"
+	ParquetMetaSchemaVersion = "data_scrubber.schema_version"
+	ParquetMetaSourceFiles   = "data_scrubber.source_files"
+	ParquetMetaPriceScale    = "data_scrubber.price_scale"    // 价格小数位数，实际价格 = 整数值 / 10^scale
+	ParquetMetaPriceEncoding = "data_scrubber.price_encoding" // int64 或 decimal，float64 价格不写
+)
+
+// 复权方式，复权因子取自 tushare adj_factor
+const (
+	AdjustTypeNone     = "none" // 默认，不复权
+	AdjustTypeForward  = "qfq"  // 前复权：价格 × 当日因子 / 基准日因子，基准日价格不变
+	AdjustTypeBackward = "hfq"  // 后复权：价格 × 当日因子，tushare 的因子以上市首日为 1
+)
+
+// 停牌类型，取自 tushare suspend_d
+const (
+	SuspendTypeNone     = ""         // 未停牌
+	SuspendTypeFull     = "full"     // 全天停牌
+	SuspendTypeIntraday = "intraday" // 盘中临时停牌，停牌时段见 SuspendTiming
+)
+
+// ST 状态，按当天的证券简称判断
+const (
+	StStatusNone   = ""
+	StStatusST     = "ST"
+	StStatusStarST = "*ST"
 )
@@ -0,0 +1,116 @@
+// Package layout 清洗输出的目录和文件命名，service 写出、reader 读取都用这里的拼法，两边不各自拼路径
+//
+//	per_stock          dst/<type>/<date>/<date>_<type>_<InstrumentId>.parquet
+//	per_day(_clustered) dst/<type>/<date>_<type>.parquet（clustered 另有 <file>.index.json 索引）
+//	hive               dst/<type>/date=<date>/market=SH|SZ[/bucket=N]/part-00000.parquet
+//
+// 没有单独的 manifest 文件：reader 只按目录结构和文件名识别布局、列出文件，不读 run report；
+// per_day_clustered 的 sidecar 索引只用来按票定位行组，不记录文件列表
+package layout
+
+import (
+	"fmt"
+	"hash/fnv"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	ParquetFileSuffix    = ".parquet"
+	ClusteredIndexSuffix = ".index.json"
+	HivePartFileName     = "part-00000.parquet"
+
+	hiveDatePrefix   = "date="
+	hiveMarketPrefix = "market="
+	hiveBucketPrefix = "bucket="
+	unknownMarket    = "unknown"
+)
+
+// GetPerDayFileName per_day(_clustered) 单日文件名，name 一般为数据类型，如 20240115_trade.parquet
+func GetPerDayFileName(date string, name string) string {
+	return fmt.Sprintf("%s_%s%s", date, name, ParquetFileSuffix)
+}
+
+// ParsePerDayFileName GetPerDayFileName 的逆运算，fileName 不是 name 的单日文件时 ok 为 false
+func ParsePerDayFileName(fileName string, name string) (date string, ok bool) {
+	if date, ok = strings.CutSuffix(fileName, "_"+name+ParquetFileSuffix); !ok {
+		return "", false
+	}
+	return date, true
+}
+
+// GetPerStockFileName per_stock 单票文件名，如 20240115_trade_600000.SH.parquet
+func GetPerStockFileName(date string, name string, instrumentId string) string {
+	return getPerStockFilePrefix(date, name) + instrumentId + ParquetFileSuffix
+}
+
+// GetPerStockFilePattern per_stock 当天所有单票文件的 glob 模式
+func GetPerStockFilePattern(date string, name string) string {
+	return getPerStockFilePrefix(date, name) + "*" + ParquetFileSuffix
+}
+
+// ParsePerStockFileName GetPerStockFileName 的逆运算，返回票代码
+func ParsePerStockFileName(fileName string, date string, name string) (instrumentId string, ok bool) {
+	id, ok := strings.CutPrefix(fileName, getPerStockFilePrefix(date, name))
+	if !ok {
+		return "", false
+	}
+	if instrumentId, ok = strings.CutSuffix(id, ParquetFileSuffix); !ok {
+		return "", false
+	}
+	return instrumentId, true
+}
+
+func getPerStockFilePrefix(date string, name string) string {
+	return fmt.Sprintf("%s_%s_", date, name)
+}
+
+// GetClusteredIndexPath parquet 文件对应的 sidecar 索引路径
+func GetClusteredIndexPath(filePath string) string {
+	return filePath + ClusteredIndexSuffix
+}
+
+// GetHiveDateDir typeDir 下某天的分区目录
+func GetHiveDateDir(typeDir string, date string) string {
+	return filepath.Join(typeDir, hiveDatePrefix+date)
+}
+
+// ParseHiveDateDir 分区目录名 date=YYYYMMDD 中的日期
+func ParseHiveDateDir(dirName string) (date string, ok bool) {
+	if date, ok = strings.CutPrefix(dirName, hiveDatePrefix); !ok {
+		return "", false
+	}
+	return date, true
+}
+
+// GetHivePartitionDir bucketCount<=0 时不分桶
+func GetHivePartitionDir(typeDir string, date string, market string, bucket int, bucketCount int) string {
+	dir := filepath.Join(GetHiveDateDir(typeDir, date), hiveMarketPrefix+market)
+	if bucketCount > 0 {
+		dir = filepath.Join(dir, fmt.Sprintf("%s%d", hiveBucketPrefix, bucket))
+	}
+	return dir
+}
+
+// ParseHiveMarketDir 分区目录名 market=XX 中的市场
+func ParseHiveMarketDir(dirName string) (market string, ok bool) {
+	if market, ok = strings.CutPrefix(dirName, hiveMarketPrefix); !ok {
+		return "", false
+	}
+	return market, true
+}
+
+// GetInstrumentMarket 取 InstrumentId 的市场后缀，如 600000.SH -> SH，即 hive 的 market 分区
+func GetInstrumentMarket(instrumentId string) string {
+	if i := strings.LastIndex(instrumentId, "."); i >= 0 && i < len(instrumentId)-1 {
+		return instrumentId[i+1:]
+	}
+	return unknownMarket
+}
+
+// GetInstrumentBucket 按 InstrumentId 的 FNV-1a 哈希分桶，同一个票在不同日期落在同一个桶
+func GetInstrumentBucket(instrumentId string, bucketCount int) int {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(instrumentId))
+	return int(h.Sum32() % uint32(bucketCount))
+}
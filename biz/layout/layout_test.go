@@ -0,0 +1,41 @@
+package layout
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+// 拼出来的文件名和目录名都能解析回去
+func TestLayoutRoundTrip(t *testing.T) {
+	name := GetPerDayFileName("20240115", "trade")
+	if name != "20240115_trade.parquet" {
+		t.Errorf("GetPerDayFileName=%s", name)
+	}
+	if date, ok := ParsePerDayFileName(name, "trade"); !ok || date != "20240115" {
+		t.Errorf("ParsePerDayFileName(%s)=%s %v", name, date, ok)
+	}
+	if _, ok := ParsePerDayFileName(name, "order"); ok {
+		t.Errorf("ParsePerDayFileName(%s, order) 应不匹配", name)
+	}
+
+	name = GetPerStockFileName("20240115", "trade", "600000.SH")
+	if matched, _ := filepath.Match(GetPerStockFilePattern("20240115", "trade"), name); !matched {
+		t.Errorf("GetPerStockFilePattern 不匹配 %s", name)
+	}
+	if id, ok := ParsePerStockFileName(name, "20240115", "trade"); !ok || id != "600000.SH" {
+		t.Errorf("ParsePerStockFileName(%s)=%s %v", name, id, ok)
+	}
+	dir := GetHivePartitionDir("dst/trade", "20240115", GetInstrumentMarket("600000.SH"), 3, 4)
+	if dir != filepath.Join("dst/trade", "date=20240115", "market=SH", "bucket=3") {
+		t.Errorf("GetHivePartitionDir=%s", dir)
+	}
+	if date, ok := ParseHiveDateDir(filepath.Base(GetHiveDateDir("dst/trade", "20240115"))); !ok || date != "20240115" {
+		t.Errorf("ParseHiveDateDir=%s %v", date, ok)
+	}
+	if market, ok := ParseHiveMarketDir("market=SZ"); !ok || market != "SZ" {
+		t.Errorf("ParseHiveMarketDir=%s %v", market, ok)
+	}
+	if GetInstrumentMarket("600000") != "unknown" {
+		t.Errorf("没有市场后缀时应为 unknown")
+	}
+}
@@ -0,0 +1,18 @@
+package model
+
+// ClusteredIndex per_day_clustered 文件的 sidecar 索引（<file>.index.json），记录每个票所在的行组范围
+// 文件内按 (InstrumentId, 时间) 排序，行组边界和票的边界对齐，读单个票只需读 [RowGroupBegin, RowGroupEnd) 的行组
+type ClusteredIndex struct {
+	FileName       string                 `json:"file_name"`
+	RowGroupCount  int                    `json:"row_group_count"`
+	RowCount       int64                  `json:"row_count"`
+	InstrumentList []*ClusteredIndexEntry `json:"instrument_list"` // 按 InstrumentId 升序
+}
+
+type ClusteredIndexEntry struct {
+	InstrumentId  string `json:"instrument_id"`
+	RowGroupBegin int    `json:"row_group_begin"` // 包含
+	RowGroupEnd   int    `json:"row_group_end"`   // 不包含
+	RowBegin      int64  `json:"row_begin"`       // 文件内的起始行号
+	RowCount      int64  `json:"row_count"`
+}
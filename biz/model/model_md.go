@@ -2,6 +2,15 @@ package model
 
 // ==== 合并数据格式
 
+// 价格的精确值：原始价格文本精确解析成 价格×10^PriceE4Scale 的整数，存在 <价格列名>E4 字段中（如 Price -> PriceE4），
+// int64 / DECIMAL 价格列和 tick size 检查都用这个整数换算，不从 float64 反推。E4 字段没有 parquet tag，不是输出列。
+// 由价格计算出来的列（Vwap、复权价）和只来自 tushare 的价格（Instrument 的昨收、涨跌停价）没有 E4 字段，只有 float64；
+// 沪市快照的涨跌停价来自 tushare，E4 由两位小数的 float64 四舍五入得到
+const (
+	PriceE4Suffix = "E4"
+	PriceE4Scale  = 4
+)
+
 //type Trade struct {
 //	InstrumentId   string  `parquet:"name=InstrumentId, type=BYTE_ARRAY, convertedtype=UTF8"`
 //	TradeTimestamp int64   `parquet:"name=TradeTimestamp, type=INT64"`
@@ -16,45 +25,62 @@ package model
 //}
 
 type Trade struct {
-	InstrumentId   string  `parquet:"name=InstrumentId, type=BYTE_ARRAY, convertedtype=UTF8"`
+	InstrumentId   string  `parquet:"name=InstrumentId, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
 	TradeTimestamp int64   `parquet:"name=TradeTimestamp, type=INT64"`
-	TradeId        int64   `parquet:"name=TradeId, type=INT64"`
+	TradeId        int64   `parquet:"name=TradeId, type=INT64"` // 同一 (市场, Channel) 内唯一：沪市新格式 BizIndex，沪市旧格式 TradeIndex，深市 ApplSeqNum
 	Price          float64 `parquet:"name=Price, type=DOUBLE"`
 	Volume         int64   `parquet:"name=Volume, type=INT64"`
 	Turnover       float64 `parquet:"name=Turnover, type=DOUBLE"`
-	Direction      string  `parquet:"name=Direction, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Direction      string  `parquet:"name=Direction, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
 	BuyOrderId     int64   `parquet:"name=BuyOrderId, type=INT64"`
 	SellOrderId    int64   `parquet:"name=SellOrderId, type=INT64"`
+	Channel        int64   `parquet:"name=Channel, type=INT64"`                                                      // 沪市 Channel/TradeChan，深市 ChannelNo
+	BizIndex       int64   `parquet:"name=BizIndex, type=INT64"`                                                     // 沪市逐笔业务序号（同一通道内成交与委托共用），深市为 0
+	ApplSeqNum     int64   `parquet:"name=ApplSeqNum, type=INT64"`                                                   // 深市消息记录号（同一通道内成交与委托共用），沪市为 0
+	ExecType       string  `parquet:"name=ExecType, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"` // 原始记录类型：深市 ExecType（F/4），沪市新格式 Type（T/A/D），沪市旧格式成交为 T、委托为 OrderType（A/D）
 	SeqNo          int64   `parquet:"name=SeqNo, type=INT64"`
 	LocalTimestamp int64   `parquet:"name=LocalTimestamp, type=INT64"`
+
+	PriceE4 int64 `json:"-"`
 }
 
 type Order struct {
-	InstrumentId   string  `parquet:"name=InstrumentId, type=BYTE_ARRAY, convertedtype=UTF8"`
+	InstrumentId   string  `parquet:"name=InstrumentId, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
 	OrderTimestamp int64   `parquet:"name=OrderTimestamp, type=INT64"`
-	OrderId        int64   `parquet:"name=OrderId, type=INT64"`
-	OrderType      string  `parquet:"name=OrderType, type=BYTE_ARRAY, convertedtype=UTF8"` // "add" 或 "cancel"
-	Direction      string  `parquet:"name=Direction, type=BYTE_ARRAY, convertedtype=UTF8"`  // "buy"/"sell"/"unknown"
+	OrderId        int64   `parquet:"name=OrderId, type=INT64"`                                                       // 交易所委托号，与 Trade 的 BuyOrderId/SellOrderId 对应；沪市 schema_version 3 之前为 BizIndex
+	OrderType      string  `parquet:"name=OrderType, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"` // "add" 或 "cancel"
+	Direction      string  `parquet:"name=Direction, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"` // "buy"/"sell"/"unknown"
 	Price          float64 `parquet:"name=Price, type=DOUBLE"`
+	PriceType      string  `parquet:"name=PriceType, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"` // "limit"/"market"/"best_own"/"unknown"
+	EffectivePrice float64 `parquet:"name=EffectivePrice, type=DOUBLE"`                                               // 限价单始终为委托价；市价/本方最优取首笔成交价或盘口价，需开启 order_effective_price，未开启时为 0
 	Volume         int64   `parquet:"name=Volume, type=INT64"`
+	Channel        int64   `parquet:"name=Channel, type=INT64"`                                                      // 含义同 Trade
+	BizIndex       int64   `parquet:"name=BizIndex, type=INT64"`                                                     // 含义同 Trade
+	ApplSeqNum     int64   `parquet:"name=ApplSeqNum, type=INT64"`                                                   // 含义同 Trade，深市撤单为撤单记录自身的 ApplSeqNum
+	ExecType       string  `parquet:"name=ExecType, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"` // 含义同 Trade，深市新增委托为空
 	SeqNo          int64   `parquet:"name=SeqNo, type=INT64"`
 	LocalTimestamp int64   `parquet:"name=LocalTimestamp, type=INT64"`
+
+	PriceE4          int64 `json:"-"`
+	EffectivePriceE4 int64 `json:"-"`
 }
 
 type OrderQueue struct {
-	InstrumentId   string  `parquet:"name=InstrumentId, type=BYTE_ARRAY, convertedtype=UTF8"`
+	InstrumentId    string  `parquet:"name=InstrumentId, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
 	UpdateTimestamp int64   `parquet:"name=UpdateTimestamp, type=INT64"`
-	Direction      string  `parquet:"name=Direction, type=BYTE_ARRAY, convertedtype=UTF8"` // "buy"/"sell"
-	Price          float64 `parquet:"name=Price, type=DOUBLE"`
-	Volume         int64   `parquet:"name=Volume, type=INT64"`
-	NumOrders      int64   `parquet:"name=NumOrders, type=INT64"`
-	OrderQtyList   []int64 `parquet:"name=OrderQtyList, type=MAP, convertedtype=LIST, valuetype=INT64"`
-	SeqNo          int64   `parquet:"name=SeqNo, type=INT64"`
-	LocalTimestamp int64   `parquet:"name=LocalTimestamp, type=INT64"`
+	Direction       string  `parquet:"name=Direction, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"` // "buy"/"sell"
+	Price           float64 `parquet:"name=Price, type=DOUBLE"`
+	Volume          int64   `parquet:"name=Volume, type=INT64"`
+	NumOrders       int64   `parquet:"name=NumOrders, type=INT64"`
+	OrderQtyList    []int64 `parquet:"name=OrderQtyList, type=MAP, convertedtype=LIST, valuetype=INT64"`
+	SeqNo           int64   `parquet:"name=SeqNo, type=INT64"`
+	LocalTimestamp  int64   `parquet:"name=LocalTimestamp, type=INT64"`
+
+	PriceE4 int64 `json:"-"`
 }
 
 type Snapshot struct {
-	InstrumentId    string  `parquet:"name=InstrumentId, type=BYTE_ARRAY, convertedtype=UTF8"`
+	InstrumentId    string  `parquet:"name=InstrumentId, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
 	UpdateTimestamp int64   `parquet:"name=UpdateTimestamp, type=INT64"`
 	Last            float64 `parquet:"name=Last, type=DOUBLE"`
 
@@ -71,7 +97,7 @@ type Snapshot struct {
 	HighLimit float64 `parquet:"name=HighLimit, type=DOUBLE"`
 	LowLimit  float64 `parquet:"name=LowLimit, type=DOUBLE"`
 
-	Status string `parquet:"name=Status, type=BYTE_ARRAY, convertedtype=UTF8"` // 沪:InstruStatus, 深:TradingPhaseCode
+	Status string `parquet:"name=Status, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"` // 沪:InstruStatus, 深:TradingPhaseCode
 
 	BidVolumeList []int64   `parquet:"name=BidVolumeList, type=MAP, convertedtype=LIST, valuetype=INT64"`
 	BidPriceList  []float64 `parquet:"name=BidPriceList, type=MAP, convertedtype=LIST, valuetype=DOUBLE"`
@@ -80,4 +106,220 @@ type Snapshot struct {
 
 	SeqNo          int64 `parquet:"name=SeqNo, type=INT64"`
 	LocalTimestamp int64 `parquet:"name=LocalTimestamp, type=INT64"`
+
+	LastE4         int64   `json:"-"`
+	PreCloseE4     int64   `json:"-"`
+	OpenE4         int64   `json:"-"`
+	HighE4         int64   `json:"-"`
+	LowE4          int64   `json:"-"`
+	CloseE4        int64   `json:"-"`
+	HighLimitE4    int64   `json:"-"`
+	LowLimitE4     int64   `json:"-"`
+	BidPriceListE4 []int64 `json:"-"`
+	AskPriceListE4 []int64 `json:"-"`
+}
+
+// Bar 由逐笔成交聚合得到的 K 线，BarTimestamp 为区间起始时间
+type Bar struct {
+	InstrumentId string  `parquet:"name=InstrumentId, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	BarTimestamp int64   `parquet:"name=BarTimestamp, type=INT64"`
+	Interval     string  `parquet:"name=Interval, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"` // "1s"/"1m"/"5m"...
+	Phase        string  `parquet:"name=Phase, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`    // 交易时段，见 constdef.TradingPhase*
+	Open         float64 `parquet:"name=Open, type=DOUBLE"`
+	High         float64 `parquet:"name=High, type=DOUBLE"`
+	Low          float64 `parquet:"name=Low, type=DOUBLE"`
+	Close        float64 `parquet:"name=Close, type=DOUBLE"`
+	Volume       int64   `parquet:"name=Volume, type=INT64"`
+	Turnover     float64 `parquet:"name=Turnover, type=DOUBLE"`
+	Vwap         float64 `parquet:"name=Vwap, type=DOUBLE"`
+	TradeCount   int64   `parquet:"name=TradeCount, type=INT64"`
+	BuyVolume    int64   `parquet:"name=BuyVolume, type=INT64"`  // 主动买成交量
+	SellVolume   int64   `parquet:"name=SellVolume, type=INT64"` // 主动卖成交量
+
+	OpenE4  int64 `json:"-"`
+	HighE4  int64 `json:"-"`
+	LowE4   int64 `json:"-"`
+	CloseE4 int64 `json:"-"`
+}
+
+// Daily 由逐笔成交和快照汇总得到的日线，不含盘后固定价格交易
+type Daily struct {
+	InstrumentId     string  `parquet:"name=InstrumentId, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	TradeDate        string  `parquet:"name=TradeDate, type=BYTE_ARRAY, convertedtype=UTF8"`
+	PreClose         float64 `parquet:"name=PreClose, type=DOUBLE"` // 取自快照
+	Open             float64 `parquet:"name=Open, type=DOUBLE"`     // 开盘集合竞价成交价，无集合竞价成交时取第一笔成交价
+	High             float64 `parquet:"name=High, type=DOUBLE"`
+	Low              float64 `parquet:"name=Low, type=DOUBLE"`
+	Close            float64 `parquet:"name=Close, type=DOUBLE"`    // 收盘集合竞价成交价，无则取最后一笔成交价
+	Volume           int64   `parquet:"name=Volume, type=INT64"`    // 股
+	Turnover         float64 `parquet:"name=Turnover, type=DOUBLE"` // 元
+	TradeCount       int64   `parquet:"name=TradeCount, type=INT64"`
+	SnapshotVolume   int64   `parquet:"name=SnapshotVolume, type=INT64"`    // 最后一条快照的累计成交量
+	SnapshotTurnover float64 `parquet:"name=SnapshotTurnover, type=DOUBLE"` // 最后一条快照的累计成交额
+
+	SuspendType   string `parquet:"name=SuspendType, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"` // 见 constdef.SuspendType*，未停牌为空
+	SuspendTiming string `parquet:"name=SuspendTiming, type=BYTE_ARRAY, convertedtype=UTF8"`                          // 盘中停牌时段，如 "09:30-10:30"
+
+	PreCloseE4 int64 `json:"-"`
+	OpenE4     int64 `json:"-"`
+	HighE4     int64 `json:"-"`
+	LowE4      int64 `json:"-"`
+	CloseE4    int64 `json:"-"`
+}
+
+// DailyReconcile 日线与 tushare daily 的对账差异，每个字段一行
+type DailyReconcile struct {
+	InstrumentId string  `parquet:"name=InstrumentId, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	TradeDate    string  `parquet:"name=TradeDate, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Field        string  `parquet:"name=Field, type=BYTE_ARRAY, convertedtype=UTF8"` // open/high/low/close/pre_close/volume/turnover/missing_tick
+	TickValue    float64 `parquet:"name=TickValue, type=DOUBLE"`
+	TuShareValue float64 `parquet:"name=TuShareValue, type=DOUBLE"` // 已换算为股/元
+	Diff         float64 `parquet:"name=Diff, type=DOUBLE"`
+}
+
+// OrderLifecycle 单笔委托当天的完整生命周期，由委托（新增/撤单）和成交关联得到
+type OrderLifecycle struct {
+	InstrumentId       string  `parquet:"name=InstrumentId, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	OrderId            int64   `parquet:"name=OrderId, type=INT64"`
+	Direction          string  `parquet:"name=Direction, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	AddTimestamp       int64   `parquet:"name=AddTimestamp, type=INT64"`
+	Price              float64 `parquet:"name=Price, type=DOUBLE"`
+	OrderQty           int64   `parquet:"name=OrderQty, type=INT64"` // 新增委托的数量
+	FilledQty          int64   `parquet:"name=FilledQty, type=INT64"`
+	FillCount          int64   `parquet:"name=FillCount, type=INT64"`
+	FirstFillTimestamp int64   `parquet:"name=FirstFillTimestamp, type=INT64"`
+	LastFillTimestamp  int64   `parquet:"name=LastFillTimestamp, type=INT64"`
+	CancelTimestamp    int64   `parquet:"name=CancelTimestamp, type=INT64"`
+	CancelQty          int64   `parquet:"name=CancelQty, type=INT64"`
+	RemainingQty       int64   `parquet:"name=RemainingQty, type=INT64"`                                              // 收盘时剩余未成交未撤销数量
+	State              string  `parquet:"name=State, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"` // 见 constdef.OrderState*
+
+	PriceE4 int64 `json:"-"`
+}
+
+// SequenceIssue 逐笔序号完整性问题，序号为沪市 BizIndex / 深市 ApplSeqNum，同一 (Market, Channel) 内连续
+type SequenceIssue struct {
+	TradeDate        string `parquet:"name=TradeDate, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Market           string `parquet:"name=Market, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Channel          int64  `parquet:"name=Channel, type=INT64"`
+	IssueType        string `parquet:"name=IssueType, type=BYTE_ARRAY, convertedtype=UTF8"` // 见 constdef.SequenceIssue*
+	BeginSeq         int64  `parquet:"name=BeginSeq, type=INT64"`
+	EndSeq           int64  `parquet:"name=EndSeq, type=INT64"`
+	Count            int64  `parquet:"name=Count, type=INT64"`                                     // 缺失/重复/乱序的记录数
+	InstrumentIdList string `parquet:"name=InstrumentIdList, type=BYTE_ARRAY, convertedtype=UTF8"` // 受影响的票，逗号分隔；缺失时为缺口前后两条记录的票
+}
+
+// Tick 单票的统一事件流：快照、成交、委托、委托队列按时间交错成一个序列，EventType 区分事件类型，
+// 字段为四种类型的并集，不属于该事件类型的字段为零值
+type Tick struct {
+	InstrumentId   string `parquet:"name=InstrumentId, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	EventTimestamp int64  `parquet:"name=EventTimestamp, type=INT64"`                                                // 成交/委托时间，快照/委托队列的行情时间
+	EventType      string `parquet:"name=EventType, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"` // constdef.DataTypeSnapshot/Trade/Order/OrderQueue
+	Channel        int64  `parquet:"name=Channel, type=INT64"`                                                       // 成交/委托的通道号，快照/委托队列为 0
+	ChannelSeq     int64  `parquet:"name=ChannelSeq, type=INT64"`                                                    // 通道内序号：沪市 BizIndex，深市 ApplSeqNum，没有时为 0
+	SeqNo          int64  `parquet:"name=SeqNo, type=INT64"`
+	LocalTimestamp int64  `parquet:"name=LocalTimestamp, type=INT64"`
+
+	// 成交、委托、委托队列
+	Price     float64 `parquet:"name=Price, type=DOUBLE"`                                                        // 成交价 / 委托价 / 委托队列价位
+	Volume    int64   `parquet:"name=Volume, type=INT64"`                                                        // 成交量 / 委托量 / 委托队列总量
+	Direction string  `parquet:"name=Direction, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"` // 含义同各自的 model
+	ExecType  string  `parquet:"name=ExecType, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+
+	// 成交
+	TradeId     int64   `parquet:"name=TradeId, type=INT64"`
+	Turnover    float64 `parquet:"name=Turnover, type=DOUBLE"`
+	BuyOrderId  int64   `parquet:"name=BuyOrderId, type=INT64"`
+	SellOrderId int64   `parquet:"name=SellOrderId, type=INT64"`
+
+	// 委托
+	OrderId        int64   `parquet:"name=OrderId, type=INT64"`
+	OrderType      string  `parquet:"name=OrderType, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	PriceType      string  `parquet:"name=PriceType, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	EffectivePrice float64 `parquet:"name=EffectivePrice, type=DOUBLE"`
+
+	// 委托队列
+	NumOrders    int64   `parquet:"name=NumOrders, type=INT64"`
+	OrderQtyList []int64 `parquet:"name=OrderQtyList, type=MAP, convertedtype=LIST, valuetype=INT64"`
+
+	// 快照
+	Last          float64   `parquet:"name=Last, type=DOUBLE"`
+	PreClose      float64   `parquet:"name=PreClose, type=DOUBLE"`
+	Open          float64   `parquet:"name=Open, type=DOUBLE"`
+	High          float64   `parquet:"name=High, type=DOUBLE"`
+	Low           float64   `parquet:"name=Low, type=DOUBLE"`
+	Close         float64   `parquet:"name=Close, type=DOUBLE"`
+	TradeNumber   int64     `parquet:"name=TradeNumber, type=INT64"`
+	TradeVolume   int64     `parquet:"name=TradeVolume, type=INT64"`
+	TradeTurnover float64   `parquet:"name=TradeTurnover, type=DOUBLE"`
+	HighLimit     float64   `parquet:"name=HighLimit, type=DOUBLE"`
+	LowLimit      float64   `parquet:"name=LowLimit, type=DOUBLE"`
+	Status        string    `parquet:"name=Status, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	BidVolumeList []int64   `parquet:"name=BidVolumeList, type=MAP, convertedtype=LIST, valuetype=INT64"`
+	BidPriceList  []float64 `parquet:"name=BidPriceList, type=MAP, convertedtype=LIST, valuetype=DOUBLE"`
+	AskVolumeList []int64   `parquet:"name=AskVolumeList, type=MAP, convertedtype=LIST, valuetype=INT64"`
+	AskPriceList  []float64 `parquet:"name=AskPriceList, type=MAP, convertedtype=LIST, valuetype=DOUBLE"`
+
+	PriceE4          int64   `json:"-"`
+	EffectivePriceE4 int64   `json:"-"`
+	LastE4           int64   `json:"-"`
+	PreCloseE4       int64   `json:"-"`
+	OpenE4           int64   `json:"-"`
+	HighE4           int64   `json:"-"`
+	LowE4            int64   `json:"-"`
+	CloseE4          int64   `json:"-"`
+	HighLimitE4      int64   `json:"-"`
+	LowLimitE4       int64   `json:"-"`
+	BidPriceListE4   []int64 `json:"-"`
+	AskPriceListE4   []int64 `json:"-"`
+}
+
+// AdjustedTrade adjust_price_column 开启时 trade 的输出格式：Trade 的全部列，末尾加上复权列
+// 写出时经 schema profile 投影展开成平铺的列，不能直接作为 parquet schema
+type AdjustedTrade struct {
+	Trade
+
+	AdjFactor float64 `parquet:"name=AdjFactor, type=DOUBLE"` // 复权比例：前复权为 当日因子/基准日因子，后复权为当日因子；缺少因子时为 0
+	AdjPrice  float64 `parquet:"name=AdjPrice, type=DOUBLE"`  // Price × AdjFactor
+}
+
+// AdjustedSnapshot adjust_price_column 开启时 snapshot 的输出格式：Snapshot 的全部列，末尾加上复权列，盘口价格不复权
+// 同 AdjustedTrade，写出时展开成平铺的列
+type AdjustedSnapshot struct {
+	Snapshot
+
+	AdjFactor   float64 `parquet:"name=AdjFactor, type=DOUBLE"` // 同 AdjustedTrade.AdjFactor
+	AdjLast     float64 `parquet:"name=AdjLast, type=DOUBLE"`
+	AdjPreClose float64 `parquet:"name=AdjPreClose, type=DOUBLE"`
+	AdjOpen     float64 `parquet:"name=AdjOpen, type=DOUBLE"`
+	AdjHigh     float64 `parquet:"name=AdjHigh, type=DOUBLE"`
+	AdjLow      float64 `parquet:"name=AdjLow, type=DOUBLE"`
+	AdjClose    float64 `parquet:"name=AdjClose, type=DOUBLE"`
+}
+
+// Instrument 当天的证券主数据（point-in-time），每个票一行
+// 证券范围为当天已上市未退市的股票，加上当天快照或成交中出现过的其他证券（如 ETF、可转债）
+type Instrument struct {
+	InstrumentId   string  `parquet:"name=InstrumentId, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	TradeDate      string  `parquet:"name=TradeDate, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Name           string  `parquet:"name=Name, type=BYTE_ARRAY, convertedtype=UTF8"`                                // 当天的证券简称，取自 namechange，没有记录时取 stock_basic
+	Exchange       string  `parquet:"name=Exchange, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"` // SSE/SZSE/BSE
+	Market         string  `parquet:"name=Market, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`   // 板块：主板/创业板/科创板/北交所/CDR
+	Industry       string  `parquet:"name=Industry, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	ListDate       string  `parquet:"name=ListDate, type=BYTE_ARRAY, convertedtype=UTF8"`
+	DelistDate     string  `parquet:"name=DelistDate, type=BYTE_ARRAY, convertedtype=UTF8"`
+	StStatus       string  `parquet:"name=StStatus, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"` // 见 constdef.StStatus*
+	PreClose       float64 `parquet:"name=PreClose, type=DOUBLE"`                                                    // tushare stk_limit 的昨收
+	HighLimit      float64 `parquet:"name=HighLimit, type=DOUBLE"`
+	LowLimit       float64 `parquet:"name=LowLimit, type=DOUBLE"`
+	TotalShare     float64 `parquet:"name=TotalShare, type=DOUBLE"`                                                     // 总股本，股
+	FloatShare     float64 `parquet:"name=FloatShare, type=DOUBLE"`                                                     // 流通股本，股
+	MarginEligible bool    `parquet:"name=MarginEligible, type=BOOLEAN"`                                                // 当天在融资融券明细中
+	SuspendType    string  `parquet:"name=SuspendType, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"` // 见 constdef.SuspendType*
+	SuspendTiming  string  `parquet:"name=SuspendTiming, type=BYTE_ARRAY, convertedtype=UTF8"`
+	TickPreClose   float64 `parquet:"name=TickPreClose, type=DOUBLE"` // 当天第一条快照的昨收，没有快照时为 0
+	InSnapshot     bool    `parquet:"name=InSnapshot, type=BOOLEAN"`  // 当天快照中出现过
+	InTrade        bool    `parquet:"name=InTrade, type=BOOLEAN"`     // 当天逐笔成交中出现过
+
+	TickPreCloseE4 int64 `json:"-"`
 }
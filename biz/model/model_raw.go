@@ -2,6 +2,9 @@ package model
 
 // ==== 原生数据格式
 
+// 价格字段（XxxPrice、Price、LastPx、TradPrice）为 价格×10^PriceE4Scale 的整数，由价格文本精确解析，不经过 float64；
+// 均价、IOPV 等不输出的字段仍为 float64
+
 /*
 *
 exp 上海的快照是 MarketData.csv.zip
@@ -13,12 +16,12 @@ type ShRawSnapshot struct {
 	UpdateTime    string
 	SecurityID    string
 	ImageStatus   int
-	PreCloPrice   float64
-	OpenPrice     float64
-	HighPrice     float64
-	LowPrice      float64
-	LastPrice     float64
-	ClosePrice    float64
+	PreCloPrice   int64
+	OpenPrice     int64
+	HighPrice     int64
+	LowPrice      int64
+	LastPrice     int64
+	ClosePrice    int64
 	InstruStatus  string
 	TradNumber    int64
 	TradVolume    float64
@@ -52,45 +55,45 @@ type ShRawSnapshot struct {
 	BidNum        int
 	SellNum       int
 	IOPV          float64
-	AskPrice1     float64
+	AskPrice1     int64
 	AskVolume1    float64
-	AskPrice2     float64
+	AskPrice2     int64
 	AskVolume2    float64
-	AskPrice3     float64
+	AskPrice3     int64
 	AskVolume3    float64
-	AskPrice4     float64
+	AskPrice4     int64
 	AskVolume4    float64
-	AskPrice5     float64
+	AskPrice5     int64
 	AskVolume5    float64
-	AskPrice6     float64
+	AskPrice6     int64
 	AskVolume6    float64
-	AskPrice7     float64
+	AskPrice7     int64
 	AskVolume7    float64
-	AskPrice8     float64
+	AskPrice8     int64
 	AskVolume8    float64
-	AskPrice9     float64
+	AskPrice9     int64
 	AskVolume9    float64
-	AskPrice10    float64
+	AskPrice10    int64
 	AskVolume10   float64
-	BidPrice1     float64
+	BidPrice1     int64
 	BidVolume1    float64
-	BidPrice2     float64
+	BidPrice2     int64
 	BidVolume2    float64
-	BidPrice3     float64
+	BidPrice3     int64
 	BidVolume3    float64
-	BidPrice4     float64
+	BidPrice4     int64
 	BidVolume4    float64
-	BidPrice5     float64
+	BidPrice5     int64
 	BidVolume5    float64
-	BidPrice6     float64
+	BidPrice6     int64
 	BidVolume6    float64
-	BidPrice7     float64
+	BidPrice7     int64
 	BidVolume7    float64
-	BidPrice8     float64
+	BidPrice8     int64
 	BidVolume8    float64
-	BidPrice9     float64
+	BidPrice9     int64
 	BidVolume9    float64
-	BidPrice10    float64
+	BidPrice10    int64
 	BidVolume10   float64
 	//NumOrdersB1   int
 	//NumOrdersB2   int
@@ -129,14 +132,14 @@ type SzRawSnapshot struct {
 	SecurityID         string
 	SecurityIDSource   string
 	TradingPhaseCode   string
-	PreCloPrice        float64
+	PreCloPrice        int64
 	TurnNum            int64
 	Volume             int64
 	Turnover           float64
-	LastPrice          float64
-	OpenPrice          float64
-	HighPrice          float64
-	LowPrice           float64
+	LastPrice          int64
+	OpenPrice          int64
+	HighPrice          int64
+	LowPrice           int64
 	DifPrice1          float64
 	DifPrice2          float64
 	PE1                float64
@@ -147,49 +150,49 @@ type SzRawSnapshot struct {
 	WeightedAvgBidPx   float64
 	TotalOfferQty      int64
 	WeightedAvgOfferPx float64
-	HighLimitPrice     float64
-	LowLimitPrice      float64
+	HighLimitPrice     int64
+	LowLimitPrice      int64
 	OpenInt            int64
 	OptPremiumRatio    float64
-	AskPrice1          float64
+	AskPrice1          int64
 	AskVolume1         int64
-	AskPrice2          float64
+	AskPrice2          int64
 	AskVolume2         int64
-	AskPrice3          float64
+	AskPrice3          int64
 	AskVolume3         int64
-	AskPrice4          float64
+	AskPrice4          int64
 	AskVolume4         int64
-	AskPrice5          float64
+	AskPrice5          int64
 	AskVolume5         int64
-	AskPrice6          float64
+	AskPrice6          int64
 	AskVolume6         int64
-	AskPrice7          float64
+	AskPrice7          int64
 	AskVolume7         int64
-	AskPrice8          float64
+	AskPrice8          int64
 	AskVolume8         int64
-	AskPrice9          float64
+	AskPrice9          int64
 	AskVolume9         int64
-	AskPrice10         float64
+	AskPrice10         int64
 	AskVolume10        int64
-	BidPrice1          float64
+	BidPrice1          int64
 	BidVolume1         int64
-	BidPrice2          float64
+	BidPrice2          int64
 	BidVolume2         int64
-	BidPrice3          float64
+	BidPrice3          int64
 	BidVolume3         int64
-	BidPrice4          float64
+	BidPrice4          int64
 	BidVolume4         int64
-	BidPrice5          float64
+	BidPrice5          int64
 	BidVolume5         int64
-	BidPrice6          float64
+	BidPrice6          int64
 	BidVolume6         int64
-	BidPrice7          float64
+	BidPrice7          int64
 	BidVolume7         int64
-	BidPrice8          float64
+	BidPrice8          int64
 	BidVolume8         int64
-	BidPrice9          float64
+	BidPrice9          int64
 	BidVolume9         int64
-	BidPrice10         float64
+	BidPrice10         int64
 	BidVolume10        int64
 	//NumOrdersB1        int
 	//NumOrdersB2        int
@@ -229,7 +232,7 @@ type ShRawTrade struct {
 	Type        string
 	BuyOrderNo  int64
 	SellOrderNo int64
-	Price       float64
+	Price       int64
 	Qty         int64
 	TradeMoney  float64
 	TickBSFlag  string
@@ -251,7 +254,7 @@ type SzRawTrade struct {
 	OfferApplSeqNum  int64
 	SecurityID       string
 	SecurityIDSource int64
-	LastPx           float64
+	LastPx           int64
 	LastQty          int64
 	ExecType         int
 	TransactTime     string
@@ -284,7 +287,7 @@ type OldShRawOrder struct {
 	OrderTime    string
 	OrderType    string  // A=新增, D=撤单
 	OrderNO      int64
-	OrderPrice   float64
+	OrderPrice   int64
 	Balance      float64 // 委托数量
 	OrderBSFlag  string  // B=买, S=卖
 	BizIndex     int64
@@ -304,11 +307,11 @@ type SzRawOrder struct {
 	MDStreamID       string
 	SecurityID       string
 	SecurityIDSource int64
-	Price            float64
+	Price            int64
 	OrderQty         int64
 	Side             int // 49='1'=买, 50='2'=卖
 	TransactTime     string
-	OrdType          int // 50='2'=限价, 49='1'=市价
+	OrdType          int // 50='2'=限价, 49='1'=市价, 85='U'=本方最优
 	LocalTime        string
 	SeqNo            int64
 }
@@ -329,7 +332,7 @@ type RawOrderQueue struct {
 	Side           string  // B=买, S=卖
 	NoPriceLevel   int
 	PrcLvlOperator int
-	Price          float64
+	Price          int64
 	Volume         float64 // 用 float64 兼容沪市的浮点格式
 	NumOrders      int
 	NoOrders       int
@@ -345,7 +348,7 @@ type OldShRawTrade struct {
 	TradeChan   int     // 交易通道
 	SecurityID  string  // 证券代码
 	TradTime    string  // 交易时间
-	TradPrice   float64 // 交易价格
+	TradPrice   int64   // 交易价格
 	TradVolume  float64 // 交易成交量
 	TradeMoney  float64 // 交易金额
 	TradeBuyNo  int64   // 买方委托号
@@ -0,0 +1,174 @@
+package reader
+
+import (
+	"data-scrubber/biz/constdef"
+	"data-scrubber/biz/errorx"
+	"data-scrubber/biz/layout"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"time"
+
+	"github.com/xitongsys/parquet-go-source/local"
+	"github.com/xitongsys/parquet-go/reader"
+)
+
+// 目录浏览：列出输出中有哪些数据类型、日期和票，布局识别和 resolveFileList 一致
+
+// ReadableDataTypeList Query、serve 和 replay 支持的数据类型（tick 本身已是合并后的事件流，用 Ticks 读取）
+var ReadableDataTypeList = []string{constdef.DataTypeTrade, constdef.DataTypeOrder, constdef.DataTypeSnapshot, constdef.DataTypeOrderQueue}
+
+var outputDataTypeList = []string{
+	constdef.DataTypeSnapshot, constdef.DataTypeTrade, constdef.DataTypeOrder, constdef.DataTypeOrderQueue,
+	constdef.DataTypeBar, constdef.DataTypeDaily, constdef.DataTypeOrderLifecycle, constdef.DataTypeTick,
+}
+
+var instrumentIdRegexp = regexp.MustCompile(`^\d{6}\.(SH|SZ|BJ)$`)
+
+// IsDate 是否为 YYYYMMDD 格式的日期
+func IsDate(s string) bool {
+	_, err := time.Parse("20060102", s)
+	return len(s) == 8 && err == nil
+}
+
+// IsInstrumentId 是否为 600000.SH 格式的证券代码
+func IsInstrumentId(s string) bool {
+	return instrumentIdRegexp.MatchString(s)
+}
+
+// IsOutputDataType 是否为清洗输出的数据类型（根目录下的一级目录名）
+func IsOutputDataType(dataType string) bool {
+	return slices.Contains(outputDataTypeList, dataType)
+}
+
+// DataTypeList 根目录下有输出的数据类型，按名字排序
+func (d *Dataset) DataTypeList() ([]string, error) {
+	entryList, err := os.ReadDir(d.root)
+	if err != nil {
+		return nil, errorx.NewError("ReadDir(%s) error: %v", d.root, err)
+	}
+	res := make([]string, 0)
+	for _, entry := range entryList {
+		if entry.IsDir() && slices.Contains(outputDataTypeList, entry.Name()) {
+			res = append(res, entry.Name())
+		}
+	}
+	return res, nil
+}
+
+// DateList dataType 有输出的日期（YYYYMMDD），升序；dataType 为空时返回所有数据类型的并集
+func (d *Dataset) DateList(dataType string) ([]string, error) {
+	dataTypeList := []string{dataType}
+	if dataType == "" {
+		var err error
+		if dataTypeList, err = d.DataTypeList(); err != nil {
+			return nil, err
+		}
+	}
+
+	res := make([]string, 0)
+	for _, dataType := range dataTypeList {
+		if !IsOutputDataType(dataType) {
+			return nil, errorx.NewError("data type(%s) not supported", dataType)
+		}
+		typeDir := filepath.Join(d.root, dataType)
+		entryList, err := os.ReadDir(typeDir)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, errorx.NewError("ReadDir(%s) error: %v", typeDir, err)
+		}
+		for _, entry := range entryList {
+			name := entry.Name()
+			var date string
+			switch {
+			case entry.IsDir(): // hive 或 per_stock
+				if hiveDate, ok := layout.ParseHiveDateDir(name); ok {
+					date = hiveDate
+				} else {
+					date = name
+				}
+			default: // per_day(_clustered)
+				date, _ = layout.ParsePerDayFileName(name, dataType)
+			}
+			if IsDate(date) {
+				res = append(res, date)
+			}
+		}
+	}
+	slices.Sort(res)
+	return slices.Compact(res), nil
+}
+
+// HasOutput date 当天 dataType 是否有 parquet 输出
+func (d *Dataset) HasOutput(dataType string, date string) (bool, error) {
+	_, ok, err := d.resolveFileList(dataType, date, newFilter(nil, time.Time{}, time.Time{}))
+	return ok, err
+}
+
+// InstrumentList date 当天 dataType 输出中的票，升序；没有输出时返回错误
+// per_stock 取文件名，per_day_clustered 取 sidecar 索引，其余读 InstrumentId 列
+func (d *Dataset) InstrumentList(dataType string, date string) ([]string, error) {
+	fileList, ok, err := d.resolveFileList(dataType, date, newFilter(nil, time.Time{}, time.Time{}))
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, errorx.NewError("%s date(%s) no parquet output under %s", dataType, date, filepath.Join(d.root, dataType))
+	}
+
+	res := make([]string, 0)
+	for _, filePath := range fileList {
+		if id, ok := layout.ParsePerStockFileName(filepath.Base(filePath), date, dataType); ok {
+			res = append(res, id)
+			continue
+		}
+		index, err := readClusteredIndex(filePath)
+		if err != nil {
+			return nil, err
+		}
+		if index != nil {
+			for _, entry := range index.InstrumentList {
+				res = append(res, entry.InstrumentId)
+			}
+			continue
+		}
+		idList, err := readInstrumentColumn(filePath)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, idList...)
+	}
+	slices.Sort(res)
+	return slices.Compact(res), nil
+}
+
+// readInstrumentColumn 只读 InstrumentId 一列，返回去重后的票
+func readInstrumentColumn(filePath string) ([]string, error) {
+	fr, err := local.NewLocalFileReader(filePath)
+	if err != nil {
+		return nil, errorx.NewError("open(%s) error: %v", filePath, err)
+	}
+	defer fr.Close()
+	pr, err := reader.NewParquetReader(fr, nil, 1)
+	if err != nil {
+		return nil, errorx.NewError("NewParquetReader(%s) error: %v", filePath, err)
+	}
+	defer pr.ReadStop()
+
+	valueList, _, _, err := pr.ReadColumnByPath(pr.SchemaHandler.GetRootInName()+"\x01"+instrumentIdColumn, pr.GetNumRows())
+	if err != nil {
+		return nil, errorx.NewError("parquet(%s) read column %s error: %v", filePath, instrumentIdColumn, err)
+	}
+	set := make(map[string]bool)
+	res := make([]string, 0)
+	for _, v := range valueList {
+		if id, ok := v.(string); ok && !set[id] {
+			set[id] = true
+			res = append(res, id)
+		}
+	}
+	return res, nil
+}
@@ -0,0 +1,320 @@
+package reader
+
+import (
+	"data-scrubber/biz/constdef"
+	"data-scrubber/biz/errorx"
+	"data-scrubber/biz/layout"
+	"data-scrubber/biz/model"
+	"data-scrubber/biz/utils"
+	"encoding/binary"
+	"encoding/json"
+	"math"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/xitongsys/parquet-go-source/local"
+	"github.com/xitongsys/parquet-go/parquet"
+	"github.com/xitongsys/parquet-go/reader"
+)
+
+const instrumentIdColumn = "InstrumentId"
+
+// 字段名以 Timestamp 结尾的 int64 字段都是时间戳，与 service 写入时的约定一致
+const timestampFieldSuffix = "Timestamp"
+
+// 每次从行组读取的行数
+const readBatchRows = 8192
+
+// hhmmssmmm 编码的最大值，没有 TIMESTAMP 逻辑类型的旧文件存的是纳秒，大于这个值时原样返回
+const maxHHMMSSmmm = 240000000
+
+// fileSchema 单个文件的列类型、时间戳编码和价格 scale
+type fileSchema struct {
+	date              string
+	timestampEncoding map[string]string // 时间戳列名 -> 编码
+	priceFactor       float64           // 价格为整数时的 10^scale，float64 价格为 0
+	priceScale        int
+}
+
+func newFileSchema(pr *reader.ParquetReader, date string) (*fileSchema, error) {
+	res := &fileSchema{date: date, timestampEncoding: make(map[string]string)}
+	for _, element := range pr.SchemaHandler.SchemaElements {
+		if element.Type == nil || *element.Type != parquet.Type_INT64 || !strings.HasSuffix(element.Name, timestampFieldSuffix) {
+			continue
+		}
+		switch {
+		case element.LogicalType != nil && element.LogicalType.TIMESTAMP != nil && element.LogicalType.TIMESTAMP.IsAdjustedToUTC:
+			res.timestampEncoding[element.Name] = constdef.TimestampEncodingUtcNanos
+		case element.LogicalType != nil && element.LogicalType.TIMESTAMP != nil:
+			res.timestampEncoding[element.Name] = constdef.TimestampEncodingLocalNanos
+		default:
+			res.timestampEncoding[element.Name] = constdef.TimestampEncodingHHMMSSmmm
+		}
+	}
+
+	metadata := make(map[string]string)
+	for _, kv := range pr.Footer.KeyValueMetadata {
+		if kv.Value != nil {
+			metadata[kv.Key] = *kv.Value
+		}
+	}
+	if _, ok := metadata[constdef.ParquetMetaPriceEncoding]; ok || metadata[constdef.ParquetMetaPriceScale] != "" {
+		scale, err := strconv.Atoi(metadata[constdef.ParquetMetaPriceScale])
+		if err != nil {
+			return nil, errorx.NewError("invalid %s(%s)", constdef.ParquetMetaPriceScale, metadata[constdef.ParquetMetaPriceScale])
+		}
+		res.priceFactor = math.Pow10(scale)
+		res.priceScale = scale
+	}
+	return res, nil
+}
+
+func (s *fileSchema) decodeTimestamp(column string, v int64) (int64, error) {
+	encoding := s.timestampEncoding[column]
+	if encoding == constdef.TimestampEncodingHHMMSSmmm && v >= maxHHMMSSmmm {
+		return v, nil
+	}
+	return utils.DecodeTimestamp(v, encoding, s.date)
+}
+
+// fieldConverter 把文件里的一列拷到 model 字段上，类型不同时（int64 价格、非 UTC 时间戳）做转换
+type fieldConverter struct {
+	dst     int
+	src     int
+	convert func(dst reflect.Value, src reflect.Value) error
+}
+
+// newFieldConverterList 按字段名匹配文件列和 model 字段，文件里没有的列（schema profile 投影掉的）保持零值
+func newFieldConverterList(dstType reflect.Type, srcType reflect.Type, schema *fileSchema) ([]*fieldConverter, error) {
+	res := make([]*fieldConverter, 0, dstType.NumField())
+	for i := 0; i < dstType.NumField(); i++ {
+		dstField := dstType.Field(i)
+		srcField, ok := srcType.FieldByName(dstField.Name)
+		if !ok {
+			// 整数价格列同时填到 E4 字段上，再按 int64 / DECIMAL 输出时不经过浮点数；float64 价格列的 E4 保持 0
+			if converter := newPriceE4Converter(i, dstField, srcType, schema); converter != nil {
+				res = append(res, converter)
+			}
+			continue
+		}
+		converter := &fieldConverter{dst: i, src: srcField.Index[0]}
+		name := dstField.Name
+		switch {
+		case dstField.Type == srcField.Type && dstField.Type.Kind() == reflect.Int64 && strings.HasSuffix(name, timestampFieldSuffix):
+			converter.convert = func(dst reflect.Value, src reflect.Value) error {
+				v, err := schema.decodeTimestamp(name, src.Int())
+				dst.SetInt(v)
+				return err
+			}
+		case dstField.Type == srcField.Type:
+			converter.convert = func(dst reflect.Value, src reflect.Value) error {
+				dst.Set(src)
+				return nil
+			}
+		case dstField.Type.Kind() == reflect.Float64 && srcField.Type.Kind() == reflect.Int64 && schema.priceFactor > 0:
+			converter.convert = func(dst reflect.Value, src reflect.Value) error {
+				dst.SetFloat(float64(src.Int()) / schema.priceFactor)
+				return nil
+			}
+		case dstField.Type == reflect.TypeOf([]float64{}) && srcField.Type == reflect.TypeOf([]int64{}) && schema.priceFactor > 0:
+			converter.convert = func(dst reflect.Value, src reflect.Value) error {
+				list := make([]float64, src.Len())
+				for i := range list {
+					list[i] = float64(src.Index(i).Int()) / schema.priceFactor
+				}
+				dst.Set(reflect.ValueOf(list))
+				return nil
+			}
+		default:
+			return nil, errorx.NewError("column(%s) type(%s) can not be read as %s", name, srcField.Type, dstField.Type)
+		}
+		res = append(res, converter)
+	}
+	return res, nil
+}
+
+// newPriceE4Converter dstField 是 E4 字段（见 model.PriceE4Suffix）且文件里对应的价格列是整数时，按 scale 换算成 E4
+func newPriceE4Converter(dst int, dstField reflect.StructField, srcType reflect.Type, schema *fileSchema) *fieldConverter {
+	name, ok := strings.CutSuffix(dstField.Name, model.PriceE4Suffix)
+	if !ok || schema.priceFactor == 0 {
+		return nil
+	}
+	srcField, ok := srcType.FieldByName(name)
+	if !ok || srcField.Type != dstField.Type {
+		return nil
+	}
+	converter := &fieldConverter{dst: dst, src: srcField.Index[0]}
+	if srcField.Type.Kind() == reflect.Int64 {
+		converter.convert = func(dst reflect.Value, src reflect.Value) error {
+			dst.SetInt(utils.ScalePrice(src.Int(), schema.priceScale, model.PriceE4Scale))
+			return nil
+		}
+		return converter
+	}
+	if srcField.Type != reflect.TypeOf([]int64{}) {
+		return nil
+	}
+	converter.convert = func(dst reflect.Value, src reflect.Value) error {
+		list := make([]int64, src.Len())
+		for i := range list {
+			list[i] = utils.ScalePrice(src.Index(i).Int(), schema.priceScale, model.PriceE4Scale)
+		}
+		dst.Set(reflect.ValueOf(list))
+		return nil
+	}
+	return converter
+}
+
+// readClusteredIndex 读取 per_day_clustered 的 sidecar 索引，不存在时返回 nil
+func readClusteredIndex(filePath string) (*model.ClusteredIndex, error) {
+	data, err := os.ReadFile(layout.GetClusteredIndexPath(filePath))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errorx.NewError("read clustered index(%s) error: %v", filePath, err)
+	}
+	res := &model.ClusteredIndex{}
+	if err := json.Unmarshal(data, res); err != nil {
+		return nil, errorx.NewError("unmarshal clustered index(%s) error: %v", filePath, err)
+	}
+	return res, nil
+}
+
+func getColumnStatistics(rowGroup *parquet.RowGroup, column string) *parquet.Statistics {
+	for _, c := range rowGroup.Columns {
+		if c.MetaData != nil && len(c.MetaData.PathInSchema) == 1 && c.MetaData.PathInSchema[0] == column {
+			return c.MetaData.Statistics
+		}
+	}
+	return nil
+}
+
+// selectRowGroupList 用 sidecar 索引和列统计剪掉不需要读的行组
+func selectRowGroupList(pr *reader.ParquetReader, filePath string, timestampColumn string, schema *fileSchema, f *filter) ([]bool, error) {
+	rowGroupList := pr.Footer.RowGroups
+	res := make([]bool, len(rowGroupList))
+	for i := range res {
+		res[i] = true
+	}
+
+	if len(f.instrumentSet) > 0 {
+		index, err := readClusteredIndex(filePath)
+		if err != nil {
+			return nil, err
+		}
+		if index != nil && index.RowGroupCount == len(rowGroupList) {
+			for i := range res {
+				res[i] = false
+			}
+			for _, entry := range index.InstrumentList {
+				if !f.instrumentSet[entry.InstrumentId] {
+					continue
+				}
+				for i := entry.RowGroupBegin; i < entry.RowGroupEnd && i < len(res); i++ {
+					res[i] = true
+				}
+			}
+		}
+	}
+
+	for i, rowGroup := range rowGroupList {
+		if !res[i] {
+			continue
+		}
+		if statistics := getColumnStatistics(rowGroup, instrumentIdColumn); statistics != nil && statistics.MinValue != nil && statistics.MaxValue != nil {
+			res[i] = f.matchInstrumentRange(string(statistics.MinValue), string(statistics.MaxValue))
+		}
+		if !res[i] || (f.from == 0 && f.to == 0) {
+			continue
+		}
+		statistics := getColumnStatistics(rowGroup, timestampColumn)
+		if statistics == nil || len(statistics.MinValue) != 8 || len(statistics.MaxValue) != 8 {
+			continue
+		}
+		min, err := schema.decodeTimestamp(timestampColumn, int64(binary.LittleEndian.Uint64(statistics.MinValue)))
+		if err != nil {
+			return nil, err
+		}
+		max, err := schema.decodeTimestamp(timestampColumn, int64(binary.LittleEndian.Uint64(statistics.MaxValue)))
+		if err != nil {
+			return nil, err
+		}
+		// 缺失的时间戳为 0，不参与剪枝
+		if min > 0 {
+			res[i] = f.matchTimestampRange(min, max)
+		}
+	}
+	return res, nil
+}
+
+// readParquetFile 读取单个文件并按 filter 过滤，yield 返回 false 时返回 false
+func readParquetFile[T any](filePath string, date string, timestampColumn string, f *filter, yield func(*T, error) bool) bool {
+	fr, err := local.NewLocalFileReader(filePath)
+	if err != nil {
+		return yield(nil, errorx.NewError("open(%s) error: %v", filePath, err))
+	}
+	defer fr.Close()
+	pr, err := reader.NewParquetReader(fr, nil, 1)
+	if err != nil {
+		return yield(nil, errorx.NewError("NewParquetReader(%s) error: %v", filePath, err))
+	}
+	defer pr.ReadStop()
+
+	schema, err := newFileSchema(pr, date)
+	if err != nil {
+		return yield(nil, err)
+	}
+	srcType, err := pr.SchemaHandler.GetType(pr.SchemaHandler.GetRootInName())
+	if err != nil {
+		return yield(nil, errorx.NewError("parquet(%s) schema error: %v", filePath, err))
+	}
+	pr.ObjType = srcType
+	dstType := reflect.TypeOf((*T)(nil)).Elem()
+	converterList, err := newFieldConverterList(dstType, srcType, schema)
+	if err != nil {
+		return yield(nil, errorx.NewError("parquet(%s): %v", filePath, err))
+	}
+	instrumentField, _ := dstType.FieldByName(instrumentIdColumn)
+	timestampField, _ := dstType.FieldByName(timestampColumn)
+
+	selectList, err := selectRowGroupList(pr, filePath, timestampColumn, schema, f)
+	if err != nil {
+		return yield(nil, err)
+	}
+	for i, rowGroup := range pr.Footer.RowGroups {
+		if !selectList[i] {
+			if err := pr.SkipRows(rowGroup.NumRows); err != nil {
+				return yield(nil, errorx.NewError("parquet(%s) skip row group(%d) error: %v", filePath, i, err))
+			}
+			continue
+		}
+		// 行组按批读取，Query 同时打开很多文件归并时每个文件只缓存一批行
+		for remain := rowGroup.NumRows; remain > 0; remain -= readBatchRows {
+			rowList, err := pr.ReadByNumber(int(min(remain, readBatchRows)))
+			if err != nil {
+				return yield(nil, errorx.NewError("parquet(%s) read row group(%d) error: %v", filePath, i, err))
+			}
+			for _, row := range rowList {
+				src := reflect.ValueOf(row)
+				res := new(T)
+				dst := reflect.ValueOf(res).Elem()
+				for _, converter := range converterList {
+					if err := converter.convert(dst.Field(converter.dst), src.Field(converter.src)); err != nil {
+						return yield(nil, errorx.NewError("parquet(%s) convert error: %v", filePath, err))
+					}
+				}
+				if !f.matchInstrument(dst.FieldByIndex(instrumentField.Index).String()) ||
+					!f.matchTimestamp(dst.FieldByIndex(timestampField.Index).Int()) {
+					continue
+				}
+				if !yield(res, nil) {
+					return false
+				}
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,373 @@
+package reader
+
+import (
+	"bufio"
+	"cmp"
+	"container/heap"
+	"data-scrubber/biz/constdef"
+	"data-scrubber/biz/errorx"
+	"data-scrubber/biz/model"
+	"data-scrubber/biz/utils"
+	"encoding/gob"
+	"io"
+	"iter"
+	"os"
+	"slices"
+	"strings"
+)
+
+// Query 多日、多票、多数据类型的合并查询
+type Query struct {
+	DataTypeList   []string // trade / order / snapshot / orderqueue
+	InstrumentList []string // 为空表示全部票
+	DateList       []string // YYYYMMDD，按日期升序读取，没有输出的日期（非交易日）跳过
+	TimeStart      string   // 日内时间窗口起点，交易所本地时间 "09:30:00" 或 "09:30:00.000"，包含；空表示不限
+	TimeEnd        string   // 日内时间窗口终点，不包含；空表示不限
+}
+
+// Record 合并流中的一条记录，按 DataType 只有一个指针非空
+type Record struct {
+	DataType       string
+	InstrumentId   string
+	Timestamp      int64 // UTC 纳秒：成交/委托时间，快照/委托队列的行情时间
+	SeqNo          int64
+	LocalTimestamp int64 // 采集端本地接收时间，UTC 纳秒；schema profile 投影掉时为 0
+
+	Trade      *model.Trade
+	Order      *model.Order
+	Snapshot   *model.Snapshot
+	OrderQueue *model.OrderQueue
+}
+
+// Row 返回非空的那个 model 结构体指针
+func (r *Record) Row() interface{} {
+	switch r.DataType {
+	case constdef.DataTypeTrade:
+		return r.Trade
+	case constdef.DataTypeOrder:
+		return r.Order
+	case constdef.DataTypeSnapshot:
+		return r.Snapshot
+	case constdef.DataTypeOrderQueue:
+		return r.OrderQueue
+	}
+	return nil
+}
+
+// 同一时间戳、同一 SeqNo 时各数据类型的先后：快照和委托队列是该时刻之前的状态，排在逐笔之前
+var queryDataTypeOrder = []string{constdef.DataTypeSnapshot, constdef.DataTypeOrderQueue, constdef.DataTypeOrder, constdef.DataTypeTrade}
+
+// Query 返回按 (Timestamp, SeqNo) 归并的单一时间序列，跨日期、跨文件、跨数据类型
+// 日期之间天然有序，逐日读取；同一天内按文件（per_day_clustered 按票）拆成各自按时间有序的 run，
+// 流式做 k-way 归并，每个 run 只缓存一批行。per_day 文件内是原始顺序，只能整个文件读入后排序。
+// run 超过 queryMaxOpenRuns 个时先分组归并到临时文件，同时打开的文件数不超过 queryMaxOpenRuns
+func (d *Dataset) Query(q *Query) iter.Seq2[*Record, error] {
+	return func(yield func(*Record, error) bool) {
+		for _, dataType := range q.DataTypeList {
+			if !slices.Contains(queryDataTypeOrder, dataType) {
+				yield(nil, errorx.NewError("query data type(%s) not supported", dataType))
+				return
+			}
+		}
+		dateList := slices.Clone(q.DateList)
+		slices.Sort(dateList)
+		for _, date := range slices.Compact(dateList) {
+			runList, err := d.getQueryRunList(q, date)
+			if err != nil {
+				yield(nil, err)
+				return
+			}
+			if !mergeRunList(runList, yield) {
+				return
+			}
+		}
+	}
+}
+
+// parseQueryTime "09:30:00" 或 "09:30:00.000"，空返回 0
+func parseQueryTime(date string, timeStr string) (int64, error) {
+	if timeStr == "" {
+		return 0, nil
+	}
+	if !strings.Contains(timeStr, ".") {
+		timeStr += ".000"
+	}
+	return utils.TimeToNano(date, timeStr)
+}
+
+// getQueryRunList date 当天要归并的 run，按 queryDataTypeOrder 和文件名排列，(Timestamp, SeqNo) 相同时排在前面的先输出
+func (d *Dataset) getQueryRunList(q *Query, date string) ([]iter.Seq2[*Record, error], error) {
+	from, err := parseQueryTime(date, q.TimeStart)
+	if err != nil {
+		return nil, errorx.NewError("query time_start(%s) error: %v", q.TimeStart, err)
+	}
+	to, err := parseQueryTime(date, q.TimeEnd)
+	if err != nil {
+		return nil, errorx.NewError("query time_end(%s) error: %v", q.TimeEnd, err)
+	}
+	f := &filter{instrumentSet: make(map[string]bool, len(q.InstrumentList)), from: from, to: to}
+	for _, id := range q.InstrumentList {
+		f.instrumentSet[id] = true
+	}
+
+	res := make([]iter.Seq2[*Record, error], 0)
+	for _, dataType := range queryDataTypeOrder {
+		if !slices.Contains(q.DataTypeList, dataType) {
+			continue
+		}
+		fileList, ok, err := d.resolveFileList(dataType, date, f)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+		for _, filePath := range fileList {
+			index, err := readClusteredIndex(filePath)
+			if err != nil {
+				return nil, err
+			}
+			switch {
+			case index != nil:
+				// 按票聚簇，每个票的行组各自按时间有序
+				for _, entry := range index.InstrumentList {
+					if !f.matchInstrument(entry.InstrumentId) {
+						continue
+					}
+					instrumentFilter := &filter{instrumentSet: map[string]bool{entry.InstrumentId: true}, from: from, to: to}
+					res = append(res, readRecordFile(dataType, filePath, date, instrumentFilter))
+				}
+			case isPerDayFile(filePath, dataType, date):
+				res = append(res, sortRecordSeq(readRecordFile(dataType, filePath, date, f)))
+			default:
+				// per_stock 和 hive 分区文件内按时间排序
+				res = append(res, readRecordFile(dataType, filePath, date, f))
+			}
+		}
+	}
+	return res, nil
+}
+
+// readRecordFile 单个文件读成 Record
+func readRecordFile(dataType string, filePath string, date string, f *filter) iter.Seq2[*Record, error] {
+	switch dataType {
+	case constdef.DataTypeTrade:
+		return recordSeq(readFile[model.Trade](filePath, date, "TradeTimestamp", f), newTradeRecord)
+	case constdef.DataTypeOrder:
+		return recordSeq(readFile[model.Order](filePath, date, "OrderTimestamp", f), newOrderRecord)
+	case constdef.DataTypeSnapshot:
+		return recordSeq(readFile[model.Snapshot](filePath, date, "UpdateTimestamp", f), newSnapshotRecord)
+	default:
+		return recordSeq(readFile[model.OrderQueue](filePath, date, "UpdateTimestamp", f), newOrderQueueRecord)
+	}
+}
+
+func recordSeq[T any](seq iter.Seq2[*T, error], newRecord func(v *T) *Record) iter.Seq2[*Record, error] {
+	return func(yield func(*Record, error) bool) {
+		for v, err := range seq {
+			if err != nil {
+				yield(nil, err)
+				return
+			}
+			if !yield(newRecord(v), nil) {
+				return
+			}
+		}
+	}
+}
+
+// sortRecordSeq 整个读入后稳定排序，用于文件内不按时间排序的 per_day 文件
+func sortRecordSeq(seq iter.Seq2[*Record, error]) iter.Seq2[*Record, error] {
+	return func(yield func(*Record, error) bool) {
+		recordList := make([]*Record, 0)
+		for record, err := range seq {
+			if err != nil {
+				yield(nil, err)
+				return
+			}
+			recordList = append(recordList, record)
+		}
+		slices.SortStableFunc(recordList, compareRecord)
+		for _, record := range recordList {
+			if !yield(record, nil) {
+				return
+			}
+		}
+	}
+}
+
+// mergeRunItem 归并堆中每个 run 当前的第一条记录
+type mergeRunItem struct {
+	record *Record
+	run    int
+}
+
+type mergeRunHeap []*mergeRunItem
+
+func (h mergeRunHeap) Len() int { return len(h) }
+func (h mergeRunHeap) Less(i, j int) bool {
+	if c := compareRecord(h[i].record, h[j].record); c != 0 {
+		return c < 0
+	}
+	return h[i].run < h[j].run
+}
+func (h mergeRunHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *mergeRunHeap) Push(x interface{}) { *h = append(*h, x.(*mergeRunItem)) }
+func (h *mergeRunHeap) Pop() interface{} {
+	old := *h
+	res := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return res
+}
+
+// queryMaxOpenRuns 一次归并同时打开的 run 数上限。每个 run 占一个文件句柄（per_day_clustered 每个票各打开一次），
+// 全市场 per_stock 约 5000 个文件，全部同时打开会超过进程的文件句柄上限。分组归并要求不小于 2
+var queryMaxOpenRuns = 256
+
+// mergeRunList 各 run 内按时间有序，k-way 归并后依次 yield；(Timestamp, SeqNo) 相同时按 run 的先后，
+// 同一 run 内保持原顺序。yield 返回 false 或出错时返回 false
+// run 太多时先按 queryMaxOpenRuns 分组，每组归并到一个临时文件，再归并这些临时文件，输出顺序不变
+func mergeRunList(runList []iter.Seq2[*Record, error], yield func(*Record, error) bool) bool {
+	if len(runList) > queryMaxOpenRuns {
+		tempDir, err := os.MkdirTemp("", "data-scrubber-query-")
+		if err != nil {
+			yield(nil, errorx.NewError("MkdirTemp error: %v", err))
+			return false
+		}
+		defer os.RemoveAll(tempDir)
+		for len(runList) > queryMaxOpenRuns {
+			if runList, err = spillRunList(tempDir, runList); err != nil {
+				yield(nil, err)
+				return false
+			}
+		}
+	}
+
+	nextList := make([]func() (*Record, error, bool), len(runList))
+	for i, run := range runList {
+		next, stop := iter.Pull2(run)
+		defer stop()
+		nextList[i] = next
+	}
+
+	h := make(mergeRunHeap, 0, len(runList))
+	// pull 取 run 的下一条放入堆，run 读完时不放
+	pull := func(run int) bool {
+		record, err, ok := nextList[run]()
+		if !ok {
+			return true
+		}
+		if err != nil {
+			yield(nil, err)
+			return false
+		}
+		heap.Push(&h, &mergeRunItem{record: record, run: run})
+		return true
+	}
+	for i := range nextList {
+		if !pull(i) {
+			return false
+		}
+	}
+	for h.Len() > 0 {
+		item := heap.Pop(&h).(*mergeRunItem)
+		if !yield(item.record, nil) {
+			return false
+		}
+		if !pull(item.run) {
+			return false
+		}
+	}
+	return true
+}
+
+// spillRunList 每 queryMaxOpenRuns 个 run 归并成一个临时文件，返回读临时文件的 run，组的先后即原 run 的先后
+func spillRunList(tempDir string, runList []iter.Seq2[*Record, error]) ([]iter.Seq2[*Record, error], error) {
+	res := make([]iter.Seq2[*Record, error], 0, (len(runList)+queryMaxOpenRuns-1)/queryMaxOpenRuns)
+	for start := 0; start < len(runList); start += queryMaxOpenRuns {
+		filePath, err := spillRun(tempDir, runList[start:min(start+queryMaxOpenRuns, len(runList))])
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, readSpillFile(filePath))
+	}
+	return res, nil
+}
+
+// spillRun 一组 run 归并后用 gob 逐条写到 tempDir 下的临时文件
+func spillRun(tempDir string, runList []iter.Seq2[*Record, error]) (string, error) {
+	file, err := os.CreateTemp(tempDir, "run-*.gob")
+	if err != nil {
+		return "", errorx.NewError("CreateTemp(%s) error: %v", tempDir, err)
+	}
+	defer file.Close()
+
+	w := bufio.NewWriter(file)
+	encoder := gob.NewEncoder(w)
+	var spillErr error
+	mergeRunList(runList, func(record *Record, err error) bool {
+		if err != nil {
+			spillErr = err
+			return false
+		}
+		if err := encoder.Encode(record); err != nil {
+			spillErr = errorx.NewError("encode %s error: %v", file.Name(), err)
+			return false
+		}
+		return true
+	})
+	if spillErr != nil {
+		return "", spillErr
+	}
+	if err := w.Flush(); err != nil {
+		return "", errorx.NewError("write %s error: %v", file.Name(), err)
+	}
+	return file.Name(), nil
+}
+
+func readSpillFile(filePath string) iter.Seq2[*Record, error] {
+	return func(yield func(*Record, error) bool) {
+		file, err := os.Open(filePath)
+		if err != nil {
+			yield(nil, errorx.NewError("open %s error: %v", filePath, err))
+			return
+		}
+		defer file.Close()
+		decoder := gob.NewDecoder(bufio.NewReader(file))
+		for {
+			record := &Record{}
+			if err := decoder.Decode(record); err == io.EOF {
+				return
+			} else if err != nil {
+				yield(nil, errorx.NewError("decode %s error: %v", filePath, err))
+				return
+			}
+			if !yield(record, nil) {
+				return
+			}
+		}
+	}
+}
+
+func newTradeRecord(v *model.Trade) *Record {
+	return &Record{DataType: constdef.DataTypeTrade, InstrumentId: v.InstrumentId, Timestamp: v.TradeTimestamp, SeqNo: v.SeqNo, LocalTimestamp: v.LocalTimestamp, Trade: v}
+}
+
+func newOrderRecord(v *model.Order) *Record {
+	return &Record{DataType: constdef.DataTypeOrder, InstrumentId: v.InstrumentId, Timestamp: v.OrderTimestamp, SeqNo: v.SeqNo, LocalTimestamp: v.LocalTimestamp, Order: v}
+}
+
+func newSnapshotRecord(v *model.Snapshot) *Record {
+	return &Record{DataType: constdef.DataTypeSnapshot, InstrumentId: v.InstrumentId, Timestamp: v.UpdateTimestamp, SeqNo: v.SeqNo, LocalTimestamp: v.LocalTimestamp, Snapshot: v}
+}
+
+func newOrderQueueRecord(v *model.OrderQueue) *Record {
+	return &Record{DataType: constdef.DataTypeOrderQueue, InstrumentId: v.InstrumentId, Timestamp: v.UpdateTimestamp, SeqNo: v.SeqNo, LocalTimestamp: v.LocalTimestamp, OrderQueue: v}
+}
+
+func compareRecord(a *Record, b *Record) int {
+	if a.Timestamp != b.Timestamp {
+		return cmp.Compare(a.Timestamp, b.Timestamp)
+	}
+	return cmp.Compare(a.SeqNo, b.SeqNo)
+}
@@ -0,0 +1,238 @@
+package reader
+
+import (
+	"data-scrubber/biz/constdef"
+	"data-scrubber/biz/errorx"
+	"data-scrubber/biz/layout"
+	"data-scrubber/biz/model"
+	"data-scrubber/biz/utils"
+	"io/fs"
+	"iter"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// reader 包给下游读取清洗输出用，不依赖配置文件：布局（per_stock / per_day / per_day_clustered / hive，路径拼法见 layout 包）、
+// 时间戳编码、int64/DECIMAL 价格都从目录结构和 parquet 元数据中识别，读出来的始终是 model 结构体，
+// 时间戳为 UTC 纳秒，价格为 float64。只支持 parquet 输出（output_format 为 parquet 或 both）
+
+// Dataset 清洗输出根目录（配置中的 dst_dir）的只读句柄
+type Dataset struct {
+	root string
+}
+
+// Open 打开清洗输出根目录
+func Open(dstRoot string) (*Dataset, error) {
+	info, err := os.Stat(dstRoot)
+	if err != nil {
+		return nil, errorx.NewError("stat(%s) error: %v", dstRoot, err)
+	}
+	if !info.IsDir() {
+		return nil, errorx.NewError("dst root(%s) is not a directory", dstRoot)
+	}
+	return &Dataset{root: dstRoot}, nil
+}
+
+// Root 输出根目录
+func (d *Dataset) Root() string {
+	return d.root
+}
+
+// filter 下推到文件、行组和行的过滤条件
+type filter struct {
+	instrumentSet map[string]bool // 为空表示全部
+	from          int64           // UTC 纳秒，包含；0 表示不限
+	to            int64           // UTC 纳秒，不包含；0 表示不限
+}
+
+func newFilter(instrumentList []string, from time.Time, to time.Time) *filter {
+	res := &filter{instrumentSet: make(map[string]bool, len(instrumentList))}
+	for _, id := range instrumentList {
+		res.instrumentSet[id] = true
+	}
+	if !from.IsZero() {
+		res.from = from.UnixNano()
+	}
+	if !to.IsZero() {
+		res.to = to.UnixNano()
+	}
+	return res
+}
+
+func (f *filter) matchInstrument(id string) bool {
+	return len(f.instrumentSet) == 0 || f.instrumentSet[id]
+}
+
+// matchInstrumentRange [min, max] 内是否可能有要读的票
+func (f *filter) matchInstrumentRange(min string, max string) bool {
+	if len(f.instrumentSet) == 0 {
+		return true
+	}
+	for id := range f.instrumentSet {
+		if id >= min && id <= max {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *filter) matchTimestamp(ts int64) bool {
+	return (f.from == 0 || ts >= f.from) && (f.to == 0 || ts < f.to)
+}
+
+// matchTimestampRange [min, max] 和 [from, to) 是否有交集
+func (f *filter) matchTimestampRange(min int64, max int64) bool {
+	return (f.from == 0 || max >= f.from) && (f.to == 0 || min < f.to)
+}
+
+// Trades 读取 date（YYYYMMDD）的逐笔成交，instrumentList 为空表示全部票，时间范围为 [from, to)，零值表示不限
+// 同一文件内按文件中的顺序返回，多个文件（per_stock、hive 分区）依次返回，不做跨文件归并
+func (d *Dataset) Trades(date string, instrumentList []string, from time.Time, to time.Time) iter.Seq2[*model.Trade, error] {
+	return readDataType[model.Trade](d, constdef.DataTypeTrade, date, "TradeTimestamp", newFilter(instrumentList, from, to))
+}
+
+// Orders 读取逐笔委托，参数同 Trades
+func (d *Dataset) Orders(date string, instrumentList []string, from time.Time, to time.Time) iter.Seq2[*model.Order, error] {
+	return readDataType[model.Order](d, constdef.DataTypeOrder, date, "OrderTimestamp", newFilter(instrumentList, from, to))
+}
+
+// Snapshots 读取快照，参数同 Trades
+func (d *Dataset) Snapshots(date string, instrumentList []string, from time.Time, to time.Time) iter.Seq2[*model.Snapshot, error] {
+	return readDataType[model.Snapshot](d, constdef.DataTypeSnapshot, date, "UpdateTimestamp", newFilter(instrumentList, from, to))
+}
+
+// OrderQueues 读取委托队列，参数同 Trades
+func (d *Dataset) OrderQueues(date string, instrumentList []string, from time.Time, to time.Time) iter.Seq2[*model.OrderQueue, error] {
+	return readDataType[model.OrderQueue](d, constdef.DataTypeOrderQueue, date, "UpdateTimestamp", newFilter(instrumentList, from, to))
+}
+
+// Ticks 读取统一事件流，文件内已按事件顺序排列，参数同 Trades，时间范围按 EventTimestamp 过滤
+func (d *Dataset) Ticks(date string, instrumentList []string, from time.Time, to time.Time) iter.Seq2[*model.Tick, error] {
+	return readDataType[model.Tick](d, constdef.DataTypeTick, date, "EventTimestamp", newFilter(instrumentList, from, to))
+}
+
+func readDataType[T any](d *Dataset, dataType string, date string, timestampColumn string, f *filter) iter.Seq2[*T, error] {
+	return func(yield func(*T, error) bool) {
+		fileList, ok, err := d.resolveFileList(dataType, date, f)
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+		if !ok {
+			yield(nil, errorx.NewError("%s date(%s) no parquet output under %s", dataType, date, filepath.Join(d.root, dataType)))
+			return
+		}
+		for _, filePath := range fileList {
+			if !readParquetFile(filePath, date, timestampColumn, f, yield) {
+				return
+			}
+		}
+	}
+}
+
+// readFile 单个文件的迭代器
+func readFile[T any](filePath string, date string, timestampColumn string, f *filter) iter.Seq2[*T, error] {
+	return func(yield func(*T, error) bool) {
+		readParquetFile(filePath, date, timestampColumn, f, yield)
+	}
+}
+
+func isDir(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
+
+// resolveFileList 找出 date 的输出文件，按 hive、per_day(_clustered)、per_stock 的顺序识别布局，都没有时 ok 为 false；
+// 能按票剪掉的文件（hive 的 market 分区、per_stock 的单票文件）直接不返回
+func (d *Dataset) resolveFileList(dataType string, date string, f *filter) (fileList []string, ok bool, err error) {
+	typeDir := filepath.Join(d.root, dataType)
+	hiveDir := layout.GetHiveDateDir(typeDir, date)
+	perDayPath := filepath.Join(typeDir, layout.GetPerDayFileName(date, dataType))
+	perStockDir := filepath.Join(typeDir, date)
+	for _, path := range []string{typeDir, hiveDir, perDayPath, perStockDir} {
+		if err := d.checkPath(path); err != nil {
+			return nil, false, err
+		}
+	}
+
+	if isDir(hiveDir) {
+		fileList, err := resolveHiveFileList(hiveDir, f)
+		return fileList, true, err
+	}
+
+	if utils.Exists(perDayPath) {
+		return []string{perDayPath}, true, nil
+	}
+
+	if isDir(perStockDir) {
+		if len(f.instrumentSet) == 0 {
+			res, err := filepath.Glob(filepath.Join(perStockDir, layout.GetPerStockFilePattern(date, dataType)))
+			if err != nil {
+				return nil, true, errorx.NewError("glob(%s) error: %v", perStockDir, err)
+			}
+			sort.Strings(res)
+			return res, true, nil
+		}
+		res := make([]string, 0, len(f.instrumentSet))
+		for id := range f.instrumentSet {
+			filePath := filepath.Join(perStockDir, layout.GetPerStockFileName(date, dataType, id))
+			if err := d.checkPath(filePath); err != nil {
+				return nil, true, err
+			}
+			if utils.Exists(filePath) {
+				res = append(res, filePath)
+			}
+		}
+		sort.Strings(res)
+		return res, true, nil
+	}
+	return nil, false, nil
+}
+
+// checkPath 由参数拼出的路径必须在根目录下，date、票代码里带 ".." 时不能读到根目录以外的文件
+func (d *Dataset) checkPath(path string) error {
+	rel, err := filepath.Rel(d.root, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return errorx.NewError("path(%s) is outside %s", path, d.root)
+	}
+	return nil
+}
+
+// isPerDayFile filePath 是否为 per_day(_clustered) 布局的单日文件
+func isPerDayFile(filePath string, dataType string, date string) bool {
+	return filepath.Base(filePath) == layout.GetPerDayFileName(date, dataType)
+}
+
+// resolveHiveFileList date=YYYYMMDD 目录下 market=XX[/bucket=N] 分区的 parquet 文件
+func resolveHiveFileList(hiveDir string, f *filter) ([]string, error) {
+	marketSet := make(map[string]bool)
+	for id := range f.instrumentSet {
+		marketSet[layout.GetInstrumentMarket(id)] = true
+	}
+
+	res := make([]string, 0)
+	err := filepath.WalkDir(hiveDir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			market, ok := layout.ParseHiveMarketDir(entry.Name())
+			if ok && len(marketSet) > 0 && !marketSet[market] {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if strings.HasSuffix(entry.Name(), layout.ParquetFileSuffix) {
+			res = append(res, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errorx.NewError("walk(%s) error: %v", hiveDir, err)
+	}
+	sort.Strings(res)
+	return res, nil
+}
@@ -0,0 +1,292 @@
+package reader
+
+import (
+	"data-scrubber/biz/constdef"
+	"data-scrubber/biz/layout"
+	"data-scrubber/biz/model"
+	"data-scrubber/biz/service"
+	"data-scrubber/biz/utils"
+	"data-scrubber/config"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func collect[T any](t *testing.T, seq func(yield func(*T, error) bool)) []*T {
+	res := make([]*T, 0)
+	for v, err := range seq {
+		if err != nil {
+			t.Fatalf("read error: %v", err)
+		}
+		res = append(res, v)
+	}
+	return res
+}
+
+func TestReaderLayout(t *testing.T) {
+	oldCfg := config.Cfg
+	defer func() { config.Cfg = oldCfg }()
+	config.Cfg = &config.Config{
+		PriceEncoding:     constdef.PriceEncodingInt64,
+		TimestampEncoding: constdef.TimestampEncodingLocalNanos,
+		OutputBucketCount: 2,
+	}
+
+	date := "20240115"
+	ts := func(timeStr string) int64 {
+		ns, err := utils.TimeToNano(date, timeStr)
+		if err != nil {
+			t.Fatalf("TimeToNano error: %v", err)
+		}
+		return ns
+	}
+	root := t.TempDir()
+
+	// per_day_clustered：成交，带 sidecar 索引
+	tradeList := []*model.Trade{
+		{InstrumentId: "600000.SH", TradeTimestamp: ts("09:30:00.000"), Price: 10.18},
+		{InstrumentId: "000001.SZ", TradeTimestamp: ts("09:30:01.000"), Price: 35.01},
+		{InstrumentId: "600000.SH", TradeTimestamp: ts("10:00:00.000"), Price: 10.19},
+	}
+	if err := os.MkdirAll(filepath.Join(root, constdef.DataTypeTrade), 0755); err != nil {
+		t.Fatal(err)
+	}
+	err := service.WriteClusteredOutputFile(filepath.Join(root, constdef.DataTypeTrade, date+"_trade.parquet"), tradeList, nil,
+		func(v *model.Trade) string { return v.InstrumentId }, func(v *model.Trade) int64 { return v.TradeTimestamp })
+	if err != nil {
+		t.Fatalf("WriteClusteredOutputFile error: %v", err)
+	}
+
+	// per_stock：快照
+	snapshotDir := filepath.Join(root, constdef.DataTypeSnapshot, date)
+	if err := os.MkdirAll(snapshotDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"600000.SH", "000001.SZ"} {
+		snapshotList := []*model.Snapshot{{InstrumentId: id, UpdateTimestamp: ts("09:30:03.000"), BidPriceList: []float64{10.17, 10.16}}}
+		if err := service.WriteOutputFile(filepath.Join(snapshotDir, date+"_snapshot_"+id+".parquet"), snapshotList, nil); err != nil {
+			t.Fatalf("WriteOutputFile error: %v", err)
+		}
+	}
+
+	// hive：委托
+	orderList := []*model.Order{
+		{InstrumentId: "600000.SH", OrderTimestamp: ts("09:30:00.000"), Price: 10.18},
+		{InstrumentId: "000001.SZ", OrderTimestamp: ts("09:30:00.000"), Price: 35.01},
+	}
+	err = service.WriteHiveParquet(filepath.Join(root, constdef.DataTypeOrder), date, orderList, nil,
+		func(v *model.Order) string { return v.InstrumentId }, func(v *model.Order) int64 { return v.OrderTimestamp })
+	if err != nil {
+		t.Fatalf("WriteHiveParquet error: %v", err)
+	}
+
+	ds, err := Open(root)
+	if err != nil {
+		t.Fatalf("Open error: %v", err)
+	}
+
+	from := time.Unix(0, ts("09:30:00.000"))
+	to := time.Unix(0, ts("09:31:00.000"))
+	tradeResult := collect(t, ds.Trades(date, []string{"600000.SH"}, from, to))
+	if len(tradeResult) != 1 || tradeResult[0].Price != 10.18 || tradeResult[0].PriceE4 != 101800 || tradeResult[0].TradeTimestamp != ts("09:30:00.000") {
+		t.Errorf("Trades=%+v", tradeResult)
+	}
+	if all := collect(t, ds.Trades(date, nil, time.Time{}, time.Time{})); len(all) != 3 {
+		t.Errorf("len(Trades)=%d, 期望 3", len(all))
+	}
+
+	snapshotResult := collect(t, ds.Snapshots(date, []string{"000001.SZ"}, time.Time{}, time.Time{}))
+	if len(snapshotResult) != 1 || snapshotResult[0].InstrumentId != "000001.SZ" || snapshotResult[0].BidPriceList[1] != 10.16 ||
+		!slices.Equal(snapshotResult[0].BidPriceListE4, []int64{101700, 101600}) {
+		t.Errorf("Snapshots=%+v", snapshotResult)
+	}
+
+	orderResult := collect(t, ds.Orders(date, []string{"000001.SZ"}, time.Time{}, time.Time{}))
+	if len(orderResult) != 1 || orderResult[0].Price != 35.01 {
+		t.Errorf("Orders=%+v", orderResult)
+	}
+
+	for _, err := range ds.OrderQueues(date, nil, time.Time{}, time.Time{}) {
+		if err == nil {
+			t.Errorf("没有委托队列输出时应返回错误")
+		}
+	}
+}
+
+func TestQuery(t *testing.T) {
+	oldCfg := config.Cfg
+	defer func() { config.Cfg = oldCfg }()
+	config.Cfg = &config.Config{}
+
+	root := t.TempDir()
+	ts := func(date string, timeStr string) int64 {
+		ns, err := utils.TimeToNano(date, timeStr)
+		if err != nil {
+			t.Fatalf("TimeToNano error: %v", err)
+		}
+		return ns
+	}
+	// 两天：第一天 per_day 文件，第二天 per_stock 文件；成交和快照混合
+	if err := os.MkdirAll(filepath.Join(root, constdef.DataTypeTrade, "20240116"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(root, constdef.DataTypeSnapshot), 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeList := func(filePath string, list any) {
+		var err error
+		switch v := list.(type) {
+		case []*model.Trade:
+			err = service.WriteOutputFile(filePath, v, nil)
+		case []*model.Snapshot:
+			err = service.WriteOutputFile(filePath, v, nil)
+		}
+		if err != nil {
+			t.Fatalf("WriteOutputFile(%s) error: %v", filePath, err)
+		}
+	}
+	writeList(filepath.Join(root, constdef.DataTypeTrade, "20240115_trade.parquet"), []*model.Trade{
+		{InstrumentId: "600000.SH", TradeTimestamp: ts("20240115", "09:25:00.000"), SeqNo: 1},
+		{InstrumentId: "600000.SH", TradeTimestamp: ts("20240115", "09:30:00.000"), SeqNo: 3},
+		{InstrumentId: "000001.SZ", TradeTimestamp: ts("20240115", "09:31:00.000"), SeqNo: 4},
+	})
+	writeList(filepath.Join(root, constdef.DataTypeSnapshot, "20240115_snapshot.parquet"), []*model.Snapshot{
+		{InstrumentId: "600000.SH", UpdateTimestamp: ts("20240115", "09:30:00.000"), SeqNo: 2},
+	})
+	writeList(filepath.Join(root, constdef.DataTypeTrade, "20240116", "20240116_trade_600000.SH.parquet"), []*model.Trade{
+		{InstrumentId: "600000.SH", TradeTimestamp: ts("20240116", "09:45:00.000"), SeqNo: 2},
+	})
+	writeList(filepath.Join(root, constdef.DataTypeTrade, "20240116", "20240116_trade_000001.SZ.parquet"), []*model.Trade{
+		{InstrumentId: "000001.SZ", TradeTimestamp: ts("20240116", "09:40:00.000"), SeqNo: 1},
+	})
+
+	ds, err := Open(root)
+	if err != nil {
+		t.Fatalf("Open error: %v", err)
+	}
+	query := &Query{
+		DataTypeList: []string{constdef.DataTypeTrade, constdef.DataTypeSnapshot},
+		DateList:     []string{"20240116", "20240115", "20240113"}, // 20240113 没有输出，跳过
+		TimeStart:    "09:30:00",
+		TimeEnd:      "10:00:00",
+	}
+	recordList := collect(t, ds.Query(query))
+	want := []struct {
+		dataType string
+		ts       int64
+	}{
+		{constdef.DataTypeSnapshot, ts("20240115", "09:30:00.000")},
+		{constdef.DataTypeTrade, ts("20240115", "09:30:00.000")},
+		{constdef.DataTypeTrade, ts("20240115", "09:31:00.000")},
+		{constdef.DataTypeTrade, ts("20240116", "09:40:00.000")},
+		{constdef.DataTypeTrade, ts("20240116", "09:45:00.000")},
+	}
+	if len(recordList) != len(want) {
+		t.Fatalf("len(recordList)=%d, 期望 %d", len(recordList), len(want))
+	}
+	for i, record := range recordList {
+		if record.DataType != want[i].dataType || record.Timestamp != want[i].ts || record.Row() == nil {
+			t.Errorf("recordList[%d]=%+v", i, record)
+		}
+	}
+
+	query.InstrumentList = []string{"000001.SZ"}
+	if recordList := collect(t, ds.Query(query)); len(recordList) != 2 {
+		t.Errorf("len(recordList)=%d, 期望 2", len(recordList))
+	}
+}
+
+// per_day_clustered 按票拆成 run 归并，单票行数超过一批时跨批次仍按时间有序
+func TestQueryClusteredMerge(t *testing.T) {
+	oldCfg := config.Cfg
+	defer func() { config.Cfg = oldCfg }()
+	config.Cfg = &config.Config{}
+
+	date := "20240115"
+	begin, err := utils.TimeToNano(date, "09:30:00.000")
+	if err != nil {
+		t.Fatalf("TimeToNano error: %v", err)
+	}
+	count := readBatchRows + 100
+	tradeList := make([]*model.Trade, 0, 2*count)
+	for i := 0; i < count; i++ {
+		ns := begin + int64(i)*int64(2*time.Millisecond)
+		tradeList = append(tradeList,
+			&model.Trade{InstrumentId: "600000.SH", TradeTimestamp: ns, SeqNo: int64(2 * i)},
+			&model.Trade{InstrumentId: "000001.SZ", TradeTimestamp: ns + int64(time.Millisecond), SeqNo: int64(2*i + 1)})
+	}
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, constdef.DataTypeTrade), 0755); err != nil {
+		t.Fatal(err)
+	}
+	err = service.WriteClusteredOutputFile(filepath.Join(root, constdef.DataTypeTrade, date+"_trade.parquet"), tradeList, nil,
+		func(v *model.Trade) string { return v.InstrumentId }, func(v *model.Trade) int64 { return v.TradeTimestamp })
+	if err != nil {
+		t.Fatalf("WriteClusteredOutputFile error: %v", err)
+	}
+
+	ds, err := Open(root)
+	if err != nil {
+		t.Fatalf("Open error: %v", err)
+	}
+	recordList := collect(t, ds.Query(&Query{DataTypeList: []string{constdef.DataTypeTrade}, DateList: []string{date}}))
+	if len(recordList) != len(tradeList) {
+		t.Fatalf("len(recordList)=%d, 期望 %d", len(recordList), len(tradeList))
+	}
+	for i, record := range recordList {
+		if record.SeqNo != int64(i) {
+			t.Fatalf("recordList[%d]=%+v", i, record)
+		}
+	}
+}
+
+// run 超过 queryMaxOpenRuns 时分组归并到临时文件，输出顺序和一次归并相同
+func TestQuerySpillRunList(t *testing.T) {
+	oldCfg, oldMaxOpenRuns := config.Cfg, queryMaxOpenRuns
+	defer func() { config.Cfg, queryMaxOpenRuns = oldCfg, oldMaxOpenRuns }()
+	config.Cfg = &config.Config{}
+
+	date := "20240115"
+	begin, err := utils.TimeToNano(date, "09:30:00.000")
+	if err != nil {
+		t.Fatalf("TimeToNano error: %v", err)
+	}
+	root := t.TempDir()
+	dir := filepath.Join(root, constdef.DataTypeTrade, date)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	// 7 个票，同一时刻 SeqNo 相同时按文件名（票代码）的先后输出
+	for i := 0; i < 7; i++ {
+		id := fmt.Sprintf("60000%d.SH", i)
+		tradeList := make([]*model.Trade, 0)
+		for j := 0; j < 5; j++ {
+			tradeList = append(tradeList, &model.Trade{InstrumentId: id, TradeTimestamp: begin + int64((j*7+i)%10)*int64(time.Second), SeqNo: int64(j), Price: 10.01})
+		}
+		slices.SortStableFunc(tradeList, func(a, b *model.Trade) int { return int(a.TradeTimestamp - b.TradeTimestamp) })
+		if err := service.WriteOutputFile(filepath.Join(dir, layout.GetPerStockFileName(date, constdef.DataTypeTrade, id)), tradeList, nil); err != nil {
+			t.Fatalf("WriteOutputFile error: %v", err)
+		}
+	}
+
+	ds, err := Open(root)
+	if err != nil {
+		t.Fatalf("Open error: %v", err)
+	}
+	query := &Query{DataTypeList: []string{constdef.DataTypeTrade}, DateList: []string{date}}
+	want := collect(t, ds.Query(query))
+	queryMaxOpenRuns = 2
+	got := collect(t, ds.Query(query))
+	if len(got) != 35 || len(got) != len(want) {
+		t.Fatalf("len(got)=%d len(want)=%d, 期望 35", len(got), len(want))
+	}
+	for i := range want {
+		if got[i].InstrumentId != want[i].InstrumentId || got[i].Timestamp != want[i].Timestamp || got[i].SeqNo != want[i].SeqNo ||
+			got[i].Trade == nil || got[i].Trade.Price != 10.01 {
+			t.Errorf("got[%d]=%+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,470 @@
+package replay
+
+import (
+	"cmp"
+	"data-scrubber/biz/errorx"
+	"data-scrubber/biz/reader"
+	"data-scrubber/biz/utils"
+	"encoding/json"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	logger "github.com/2997215859/golog"
+)
+
+// replay 子命令把历史某几天的快照、成交、委托、委托队列按采集端本地接收时间（LocalTimestamp）归并，
+// 按设定的速度推送给客户端，模拟实盘行情。每个连接独立回放、互不影响，同一天的数据只读入一份，所有连接共用。
+// 一天的数据整体读入内存后再按本地时间排序，所以必须指定票列表，全市场回放会撑爆内存。
+//
+// 服务端消息（TCP 为每行一个 JSON，WebSocket 为每个 text 帧一个 JSON）：
+//
+//	{"type":"trade","date":"20240115","instrument_id":"600000.SH","timestamp":...,"local_timestamp":...,"data":{model.Trade 的字段}}
+//	{"type":"status","date":"20240115","state":"playing","speed":"10","local_timestamp":...}
+//	{"type":"error","error":"..."}
+//
+// 客户端控制命令，格式同上：
+//
+//	{"cmd":"pause"} / {"cmd":"resume"} / {"cmd":"status"}
+//	{"cmd":"speed","speed":"10"}                 倍数或 "max"
+//	{"cmd":"seek","time":"10:00:00"}             当天交易所本地时间，也可以带日期 "20240116 09:30:00.000"
+
+// SpeedMax 不等待，尽快发送
+const SpeedMax = "max"
+
+// MaxInstrumentCount 回放票数上限，一天的记录要全部放在内存里
+const MaxInstrumentCount = 200
+
+const (
+	MessageTypeStatus = "status"
+	MessageTypeError  = "error"
+)
+
+const (
+	StatePlaying = "playing"
+	StatePaused  = "paused"
+	StateEnd     = "end" // 所有日期回放完，仍可以 seek 回去
+)
+
+// Options 回放参数
+type Options struct {
+	DataTypeList   []string // trade / order / snapshot / orderqueue
+	InstrumentList []string // 必填，不超过 MaxInstrumentCount 个
+	DateList       []string // YYYYMMDD，按升序回放
+	Speed          string   // 初始速度，见 ParseSpeed
+	OriginList     []string // WebSocket 允许的跨域 Origin，见 checkOrigin
+}
+
+// Message 推送给客户端的消息，行情消息的 Data 为对应的 model 结构体
+type Message struct {
+	Type           string      `json:"type"`
+	Date           string      `json:"date,omitempty"`
+	InstrumentId   string      `json:"instrument_id,omitempty"`
+	Timestamp      int64       `json:"timestamp,omitempty"`
+	LocalTimestamp int64       `json:"local_timestamp,omitempty"`
+	Data           interface{} `json:"data,omitempty"`
+	State          string      `json:"state,omitempty"`
+	Speed          string      `json:"speed,omitempty"`
+	Error          string      `json:"error,omitempty"`
+}
+
+// Control 客户端控制命令
+type Control struct {
+	Cmd   string `json:"cmd"`
+	Speed string `json:"speed,omitempty"`
+	Time  string `json:"time,omitempty"`
+}
+
+// ParseSpeed "1"、"10"、"10x" 返回倍数，"max" 返回 0
+func ParseSpeed(speed string) (float64, error) {
+	if speed == SpeedMax {
+		return 0, nil
+	}
+	v, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(speed), "x"), 64)
+	if err != nil || v <= 0 {
+		return 0, errorx.NewError("invalid replay speed(%s)", speed)
+	}
+	return v, nil
+}
+
+// messageConn TCP 和 WebSocket 连接的公共接口；ReadMessage 只在读 goroutine 中调用，其余方法只在回放 goroutine 中调用
+type messageConn interface {
+	ReadMessage() ([]byte, error)
+	WriteMessage(data []byte) error
+	Flush() error
+	Close() error
+}
+
+// localTimestamp 回放排序用的时间，没有本地接收时间时退回交易所时间
+func localTimestamp(record *reader.Record) int64 {
+	if record.LocalTimestamp > 0 {
+		return record.LocalTimestamp
+	}
+	return record.Timestamp
+}
+
+// dayCache 各连接共用的按天数据，同一天只读一次；记录只读，会话之间不拷贝。没有连接在用的日期即释放
+type dayCache struct {
+	ds  *reader.Dataset
+	opt *Options
+
+	mu     sync.Mutex
+	dayMap map[string]*cachedDay
+}
+
+type cachedDay struct {
+	ready      chan struct{} // 读完（或出错）后关闭
+	recordList []*reader.Record
+	err        error
+	refCount   int
+}
+
+func newDayCache(ds *reader.Dataset, opt *Options) *dayCache {
+	return &dayCache{ds: ds, opt: opt, dayMap: make(map[string]*cachedDay)}
+}
+
+// acquire 返回 date 当天按 localTimestamp 排好序的记录，用完调用 release；出错时不需要 release
+func (c *dayCache) acquire(date string) ([]*reader.Record, error) {
+	c.mu.Lock()
+	day, ok := c.dayMap[date]
+	if !ok {
+		day = &cachedDay{ready: make(chan struct{})}
+		c.dayMap[date] = day
+	}
+	day.refCount++
+	c.mu.Unlock()
+
+	if !ok {
+		day.recordList, day.err = c.load(date)
+		close(day.ready)
+	}
+	<-day.ready
+	if day.err != nil {
+		c.release(date)
+		return nil, day.err
+	}
+	return day.recordList, nil
+}
+
+func (c *dayCache) release(date string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	day, ok := c.dayMap[date]
+	if !ok {
+		return
+	}
+	if day.refCount--; day.refCount <= 0 {
+		delete(c.dayMap, date)
+	}
+}
+
+func (c *dayCache) load(date string) ([]*reader.Record, error) {
+	query := &reader.Query{
+		DataTypeList:   c.opt.DataTypeList,
+		InstrumentList: c.opt.InstrumentList,
+		DateList:       []string{date},
+	}
+	recordList := make([]*reader.Record, 0)
+	for record, err := range c.ds.Query(query) {
+		if err != nil {
+			return nil, err
+		}
+		recordList = append(recordList, record)
+	}
+	// Query 已按 (Timestamp, SeqNo) 排好，本地接收时间相同时保持交易所顺序
+	slices.SortStableFunc(recordList, func(a *reader.Record, b *reader.Record) int {
+		return cmp.Compare(localTimestamp(a), localTimestamp(b))
+	})
+	logger.Info("replay load date(%s) records=%d", date, len(recordList))
+	return recordList, nil
+}
+
+// session 单个连接的回放状态
+type session struct {
+	cache *dayCache
+	opt   *Options
+	conn  messageConn
+
+	speedText string
+	speed     float64 // 0 表示不等待
+	paused    bool
+
+	dateIndex  int
+	recordList []*reader.Record // 当天按 localTimestamp 排好序的记录，来自 dayCache，不能修改
+	loadedDate string           // recordList 对应的日期，换日和会话结束时 release
+	pos        int
+
+	// 节奏锚点：墙上时间 anchorWall 对应行情时间 anchorEvent，暂停、调速、seek、换日后重新锚定
+	anchorWall  time.Time
+	anchorEvent int64
+}
+
+// controlResult 读 goroutine 交给回放 goroutine 的命令，解析失败时 err 非空
+type controlResult struct {
+	control *Control
+	err     error
+}
+
+func (s *session) send(msg *Message) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return errorx.NewError("json marshal replay message error: %v", err)
+	}
+	return s.conn.WriteMessage(data)
+}
+
+func (s *session) currentDate() string {
+	if s.dateIndex < len(s.opt.DateList) {
+		return s.opt.DateList[s.dateIndex]
+	}
+	return ""
+}
+
+func (s *session) sendStatus() error {
+	msg := &Message{Type: MessageTypeStatus, Date: s.currentDate(), State: StatePlaying, Speed: s.speedText}
+	switch {
+	case s.dateIndex >= len(s.opt.DateList):
+		msg.State = StateEnd
+	case s.paused:
+		msg.State = StatePaused
+	}
+	if s.pos < len(s.recordList) {
+		msg.LocalTimestamp = localTimestamp(s.recordList[s.pos])
+	}
+	if err := s.send(msg); err != nil {
+		return err
+	}
+	return s.conn.Flush()
+}
+
+func (s *session) sendError(err error) error {
+	if err := s.send(&Message{Type: MessageTypeError, Error: err.Error()}); err != nil {
+		return err
+	}
+	return s.conn.Flush()
+}
+
+// loadDate 换到第 dateIndex 天的记录，越界时清空（回放结束）
+func (s *session) loadDate(dateIndex int) error {
+	s.releaseDate()
+	s.dateIndex = dateIndex
+	s.pos = 0
+	s.anchorEvent = 0
+	if dateIndex >= len(s.opt.DateList) {
+		return nil
+	}
+	date := s.opt.DateList[dateIndex]
+	recordList, err := s.cache.acquire(date)
+	if err != nil {
+		return err
+	}
+	s.recordList, s.loadedDate = recordList, date
+	return nil
+}
+
+// releaseDate 归还当前日期的数据
+func (s *session) releaseDate() {
+	if s.loadedDate != "" {
+		s.cache.release(s.loadedDate)
+	}
+	s.recordList, s.loadedDate = nil, ""
+}
+
+// seek timeStr 为 "HH:MM:SS[.mmm]"（当天）或 "YYYYMMDD HH:MM:SS[.mmm]"
+func (s *session) seek(timeStr string) error {
+	date := s.currentDate()
+	dateIndex := s.dateIndex
+	if d, t, ok := strings.Cut(strings.TrimSpace(timeStr), " "); ok {
+		date, timeStr = d, t
+		dateIndex = slices.Index(s.opt.DateList, date)
+		if dateIndex < 0 {
+			return errorx.NewError("seek date(%s) not in replay date list", date)
+		}
+	}
+	if date == "" {
+		return errorx.NewError("seek time(%s) without date after replay end", timeStr)
+	}
+	if !strings.Contains(timeStr, ".") {
+		timeStr += ".000"
+	}
+	target, err := utils.TimeToNano(date, timeStr)
+	if err != nil {
+		return errorx.NewError("seek time(%s) error: %v", timeStr, err)
+	}
+	if dateIndex != s.dateIndex || s.recordList == nil {
+		if err := s.loadDate(dateIndex); err != nil {
+			return err
+		}
+	}
+	s.pos = sort.Search(len(s.recordList), func(i int) bool { return localTimestamp(s.recordList[i]) >= target })
+	s.anchorEvent = 0
+	return nil
+}
+
+// handle 执行一条控制命令并回复状态；命令本身的错误回复给客户端，只有写连接失败才返回错误
+func (s *session) handle(result *controlResult) error {
+	if result.err != nil {
+		return s.sendError(result.err)
+	}
+	var err error
+	switch c := result.control; c.Cmd {
+	case "pause":
+		s.paused = true
+	case "resume":
+		s.paused = false
+		s.anchorEvent = 0
+	case "speed":
+		var speed float64
+		if speed, err = ParseSpeed(c.Speed); err == nil {
+			s.speedText, s.speed = c.Speed, speed
+			s.anchorEvent = 0
+		}
+	case "seek":
+		err = s.seek(c.Time)
+	case "status":
+	default:
+		err = errorx.NewError("unknown replay cmd(%s)", c.Cmd)
+	}
+	if err != nil {
+		return s.sendError(err)
+	}
+	return s.sendStatus()
+}
+
+// waitDuration 按当前速度，距离发送 ts 还要等多久
+func (s *session) waitDuration(ts int64) time.Duration {
+	if s.speed == 0 {
+		return 0
+	}
+	if s.anchorEvent == 0 {
+		s.anchorWall = time.Now()
+		s.anchorEvent = ts
+		return 0
+	}
+	return time.Until(s.anchorWall.Add(time.Duration(float64(ts-s.anchorEvent) / s.speed)))
+}
+
+func newRecordMessage(date string, record *reader.Record) *Message {
+	return &Message{
+		Type:           record.DataType,
+		Date:           date,
+		InstrumentId:   record.InstrumentId,
+		Timestamp:      record.Timestamp,
+		LocalTimestamp: record.LocalTimestamp,
+		Data:           record.Row(),
+	}
+}
+
+// readyChan 已关闭的 channel，不需要等待时代替定时器
+var readyChan = func() <-chan time.Time {
+	res := make(chan time.Time)
+	close(res)
+	return res
+}()
+
+// run 回放主循环，controlChan 关闭（连接断开）或写连接失败时返回
+func (s *session) run(controlChan <-chan *controlResult) error {
+	// 读数据出错时通知客户端并结束会话
+	if err := s.loadDate(0); err != nil {
+		return s.sendError(err)
+	}
+	if err := s.sendStatus(); err != nil {
+		return err
+	}
+	for {
+		// 暂停或全部回放完，只等控制命令
+		if s.paused || s.dateIndex >= len(s.opt.DateList) {
+			result, ok := <-controlChan
+			if !ok {
+				return nil
+			}
+			if err := s.handle(result); err != nil {
+				return err
+			}
+			continue
+		}
+		if s.pos >= len(s.recordList) {
+			if err := s.loadDate(s.dateIndex + 1); err != nil {
+				return s.sendError(err)
+			}
+			if s.dateIndex >= len(s.opt.DateList) {
+				if err := s.sendStatus(); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		record := s.recordList[s.pos]
+		timerChan := readyChan
+		var timer *time.Timer
+		if wait := s.waitDuration(localTimestamp(record)); wait > 0 {
+			if err := s.conn.Flush(); err != nil {
+				return err
+			}
+			timer = time.NewTimer(wait)
+			timerChan = timer.C
+		}
+		select {
+		case result, ok := <-controlChan:
+			if timer != nil {
+				timer.Stop()
+			}
+			if !ok {
+				return nil
+			}
+			if err := s.handle(result); err != nil {
+				return err
+			}
+			continue
+		case <-timerChan:
+		}
+
+		if err := s.send(newRecordMessage(s.currentDate(), record)); err != nil {
+			return err
+		}
+		s.pos++
+	}
+}
+
+// serveConn 一个连接一个回放会话：读 goroutine 解析控制命令，当前 goroutine 回放并独占写
+func serveConn(cache *dayCache, opt *Options, conn messageConn) {
+	defer conn.Close()
+	speedText := opt.Speed
+	speed, err := ParseSpeed(speedText)
+	if err != nil {
+		logger.Warn("replay speed(%s) invalid, use 1", speedText)
+		speedText, speed = "1", 1
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	controlChan := make(chan *controlResult)
+	go func() {
+		defer close(controlChan)
+		for {
+			data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			result := &controlResult{control: &Control{}}
+			if err := json.Unmarshal(data, result.control); err != nil {
+				result.err = errorx.NewError("invalid replay control(%s): %v", data, err)
+			}
+			select {
+			case controlChan <- result:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	s := &session{cache: cache, opt: opt, conn: conn, speedText: speedText, speed: speed}
+	defer s.releaseDate()
+	if err := s.run(controlChan); err != nil {
+		logger.Warn("replay session end: %v", err)
+	}
+}
@@ -0,0 +1,288 @@
+package replay
+
+import (
+	"bufio"
+	"data-scrubber/biz/constdef"
+	"data-scrubber/biz/model"
+	"data-scrubber/biz/reader"
+	"data-scrubber/biz/service"
+	"data-scrubber/biz/utils"
+	"data-scrubber/config"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const testDate = "20240115"
+
+func newTestDataset(t *testing.T) *reader.Dataset {
+	ts := func(timeStr string) int64 {
+		ns, err := utils.TimeToNano(testDate, timeStr)
+		if err != nil {
+			t.Fatalf("TimeToNano error: %v", err)
+		}
+		return ns
+	}
+	root := t.TempDir()
+	for _, dataType := range []string{constdef.DataTypeTrade, constdef.DataTypeSnapshot} {
+		if err := os.MkdirAll(filepath.Join(root, dataType), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 快照的交易所时间早于成交，但本地接收时间晚于成交
+	err := service.WriteOutputFile(filepath.Join(root, constdef.DataTypeTrade, testDate+"_trade.parquet"), []*model.Trade{
+		{InstrumentId: "600000.SH", TradeTimestamp: ts("09:30:00.000"), LocalTimestamp: ts("09:30:00.010"), SeqNo: 1},
+		{InstrumentId: "600000.SH", TradeTimestamp: ts("09:32:00.000"), LocalTimestamp: ts("09:32:00.010"), SeqNo: 3},
+	}, nil)
+	if err != nil {
+		t.Fatalf("WriteOutputFile error: %v", err)
+	}
+	err = service.WriteOutputFile(filepath.Join(root, constdef.DataTypeSnapshot, testDate+"_snapshot.parquet"), []*model.Snapshot{
+		{InstrumentId: "600000.SH", UpdateTimestamp: ts("09:29:59.000"), LocalTimestamp: ts("09:31:00.000"), SeqNo: 2},
+	}, nil)
+	if err != nil {
+		t.Fatalf("WriteOutputFile error: %v", err)
+	}
+	ds, err := reader.Open(root)
+	if err != nil {
+		t.Fatalf("Open error: %v", err)
+	}
+	return ds
+}
+
+func decodeMessage(t *testing.T, data []byte) *Message {
+	msg := &Message{}
+	if err := json.Unmarshal(data, msg); err != nil {
+		t.Fatalf("unmarshal(%s) error: %v", data, err)
+	}
+	return msg
+}
+
+func TestReplayTcp(t *testing.T) {
+	oldCfg := config.Cfg
+	defer func() { config.Cfg = oldCfg }()
+	config.Cfg = &config.Config{}
+
+	opt := &Options{
+		DataTypeList:   []string{constdef.DataTypeTrade, constdef.DataTypeSnapshot},
+		InstrumentList: []string{"600000.SH"},
+		DateList:       []string{testDate},
+		Speed:          SpeedMax,
+	}
+	ds := newTestDataset(t)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen error: %v", err)
+	}
+	defer l.Close()
+	s, err := NewServer(ds, opt)
+	if err != nil {
+		t.Fatalf("NewServer error: %v", err)
+	}
+	go func() { _ = s.ServeTcp(l) }()
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatalf("Dial error: %v", err)
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(10 * time.Second))
+	scanner := bufio.NewScanner(conn)
+	next := func() *Message {
+		if !scanner.Scan() {
+			t.Fatalf("read error: %v", scanner.Err())
+		}
+		return decodeMessage(t, scanner.Bytes())
+	}
+
+	readUntilEnd := func() []string {
+		res := make([]string, 0)
+		for {
+			msg := next()
+			if msg.Type == MessageTypeStatus && msg.State == StateEnd {
+				return res
+			}
+			if msg.Type != MessageTypeStatus {
+				res = append(res, msg.Type)
+			}
+		}
+	}
+	if msg := next(); msg.Type != MessageTypeStatus || msg.State != StatePlaying || msg.Speed != SpeedMax {
+		t.Errorf("first message=%+v", msg)
+	}
+	// 按本地接收时间：成交、快照、成交
+	want := []string{constdef.DataTypeTrade, constdef.DataTypeSnapshot, constdef.DataTypeTrade}
+	if got := readUntilEnd(); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("types=%v, 期望 %v", got, want)
+	}
+
+	if _, err := conn.Write([]byte(`{"cmd":"seek","time":"09:30"}` + "\n")); err != nil {
+		t.Fatal(err)
+	}
+	if msg := next(); msg.Type != MessageTypeError {
+		t.Errorf("回放结束后不带日期 seek 应报错, msg=%+v", msg)
+	}
+	if _, err := conn.Write([]byte(`{"cmd":"seek","time":"` + testDate + ` 09:31:00"}` + "\n")); err != nil {
+		t.Fatal(err)
+	}
+	if got := readUntilEnd(); strings.Join(got, ",") != strings.Join(want[1:], ",") {
+		t.Errorf("seek types=%v, 期望 %v", got, want[1:])
+	}
+}
+
+// wsClient 测试用的 WebSocket 客户端
+type wsClient struct {
+	conn *websocket.Conn
+}
+
+func dialWebSocket(t *testing.T, httpUrl string, origin string) (*wsClient, *http.Response, error) {
+	header := http.Header{}
+	if origin != "" {
+		header.Set("Origin", origin)
+	}
+	conn, resp, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(httpUrl, "http")+"/replay", header)
+	if err != nil {
+		return nil, resp, err
+	}
+	_ = conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+	return &wsClient{conn: conn}, resp, nil
+}
+
+func (c *wsClient) write(t *testing.T, text string) {
+	if err := c.conn.WriteMessage(websocket.TextMessage, []byte(text)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func (c *wsClient) read(t *testing.T) *Message {
+	_, data, err := c.conn.ReadMessage()
+	if err != nil {
+		t.Fatalf("read message error: %v", err)
+	}
+	return decodeMessage(t, data)
+}
+
+func TestReplayWebSocket(t *testing.T) {
+	oldCfg := config.Cfg
+	defer func() { config.Cfg = oldCfg }()
+	config.Cfg = &config.Config{}
+
+	// 1 倍速：第一条之后要等一分钟，靠 pause / speed / resume 控制
+	opt := &Options{
+		DataTypeList:   []string{constdef.DataTypeTrade, constdef.DataTypeSnapshot},
+		InstrumentList: []string{"600000.SH"},
+		DateList:       []string{testDate},
+		Speed:          "1",
+	}
+	s, err := NewServer(newTestDataset(t), opt)
+	if err != nil {
+		t.Fatalf("NewServer error: %v", err)
+	}
+	httpServer := httptest.NewServer(s.WebSocketHandler())
+	defer httpServer.Close()
+	// 跨域连接只接受配置的 Origin
+	if _, resp, err := dialWebSocket(t, httpServer.URL, "http://evil.example"); err == nil || resp == nil || resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("未配置的 Origin 应被拒绝, err=%v", err)
+	}
+	c, _, err := dialWebSocket(t, httpServer.URL, "")
+	if err != nil {
+		t.Fatalf("dial error: %v", err)
+	}
+	defer c.conn.Close()
+
+	if msg := c.read(t); msg.Type != MessageTypeStatus || msg.State != StatePlaying {
+		t.Fatalf("first message=%+v", msg)
+	}
+	if msg := c.read(t); msg.Type != constdef.DataTypeTrade {
+		t.Fatalf("second message=%+v", msg)
+	}
+	c.write(t, `{"cmd":"pause"}`)
+	if msg := c.read(t); msg.Type != MessageTypeStatus || msg.State != StatePaused {
+		t.Fatalf("pause status=%+v", msg)
+	}
+	c.write(t, `{"cmd":"speed","speed":"0"}`)
+	if msg := c.read(t); msg.Type != MessageTypeError {
+		t.Fatalf("invalid speed=%+v", msg)
+	}
+	c.write(t, `{"cmd":"speed","speed":"max"}`)
+	if msg := c.read(t); msg.State != StatePaused || msg.Speed != SpeedMax {
+		t.Fatalf("speed status=%+v", msg)
+	}
+	c.write(t, `{"cmd":"resume"}`)
+	if msg := c.read(t); msg.State != StatePlaying {
+		t.Fatalf("resume status=%+v", msg)
+	}
+	for _, want := range []string{constdef.DataTypeSnapshot, constdef.DataTypeTrade} {
+		if msg := c.read(t); msg.Type != want {
+			t.Fatalf("message=%+v, 期望 %s", msg, want)
+		}
+	}
+	if msg := c.read(t); msg.State != StateEnd {
+		t.Fatalf("end status=%+v", msg)
+	}
+}
+
+// 同一天的数据所有连接共用一份，没有连接在用时释放
+func TestDayCache(t *testing.T) {
+	oldCfg := config.Cfg
+	defer func() { config.Cfg = oldCfg }()
+	config.Cfg = &config.Config{}
+
+	opt := &Options{DataTypeList: []string{constdef.DataTypeTrade, constdef.DataTypeSnapshot}, InstrumentList: []string{"600000.SH"}, DateList: []string{testDate}}
+	cache := newDayCache(newTestDataset(t), opt)
+	a, err := cache.acquire(testDate)
+	if err != nil {
+		t.Fatalf("acquire error: %v", err)
+	}
+	b, err := cache.acquire(testDate)
+	if err != nil {
+		t.Fatalf("acquire error: %v", err)
+	}
+	if len(a) != 3 || &a[0] != &b[0] {
+		t.Fatalf("两个会话应共用同一份记录, len=%d", len(a))
+	}
+	cache.release(testDate)
+	if len(cache.dayMap) != 1 {
+		t.Errorf("还有会话在用时不应释放")
+	}
+	cache.release(testDate)
+	if len(cache.dayMap) != 0 {
+		t.Errorf("没有会话在用时应释放")
+	}
+
+	// 没有输出的日期（非交易日）为空
+	if list, err := cache.acquire("20240116"); err != nil || len(list) != 0 {
+		t.Errorf("20240116 list=%d, err=%v", len(list), err)
+	}
+	cache.release("20240116")
+	if len(cache.dayMap) != 0 {
+		t.Errorf("dayMap=%v", cache.dayMap)
+	}
+}
+
+// 不指定票或票太多时拒绝启动，回放按天整体读入内存
+func TestNewServerInstrumentList(t *testing.T) {
+	opt := &Options{DataTypeList: []string{constdef.DataTypeTrade}, DateList: []string{testDate}}
+	if _, err := NewServer(nil, opt); err == nil {
+		t.Errorf("empty instrument list should be refused")
+	}
+	for i := 0; i <= MaxInstrumentCount; i++ {
+		opt.InstrumentList = append(opt.InstrumentList, fmt.Sprintf("%06d.SZ", i))
+	}
+	if _, err := NewServer(nil, opt); err == nil {
+		t.Errorf("%d instruments should be refused", len(opt.InstrumentList))
+	}
+	opt.InstrumentList = opt.InstrumentList[:1]
+	if _, err := NewServer(nil, opt); err != nil {
+		t.Errorf("NewServer error: %v", err)
+	}
+}
@@ -0,0 +1,192 @@
+package replay
+
+import (
+	"bufio"
+	"data-scrubber/biz/errorx"
+	"data-scrubber/biz/reader"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	logger "github.com/2997215859/golog"
+	"github.com/gorilla/websocket"
+)
+
+// 控制命令的最大长度，TCP 的一行和 WebSocket 的一条消息都不能超过
+const maxControlSize = 64 * 1024
+
+// 单次写的超时，客户端不读时回放会话结束，不会一直阻塞占着当天的数据
+const writeTimeout = 10 * time.Second
+
+// Server 回放服务，TCP 和 WebSocket 可以同时监听，所有连接共用按天读入的数据
+type Server struct {
+	cache *dayCache
+	opt   *Options
+}
+
+// NewServer 票列表为空或超过 MaxInstrumentCount 时报错，回放按天整体读入内存，不支持全市场
+func NewServer(ds *reader.Dataset, opt *Options) (*Server, error) {
+	if len(opt.InstrumentList) == 0 {
+		return nil, errorx.NewError("replay instrument list is empty, replay of the whole market does not fit in memory")
+	}
+	if len(opt.InstrumentList) > MaxInstrumentCount {
+		return nil, errorx.NewError("replay instrument list has %d instruments, more than %d", len(opt.InstrumentList), MaxInstrumentCount)
+	}
+	return &Server{cache: newDayCache(ds, opt), opt: opt}, nil
+}
+
+// ListenTcp 阻塞监听 addr，每个连接一个回放会话，消息为换行分隔的 JSON
+func (s *Server) ListenTcp(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return errorx.NewError("listen tcp(%s) error: %v", addr, err)
+	}
+	logger.Info("replay tcp on %s", addr)
+	return s.ServeTcp(l)
+}
+
+// ServeTcp 在 l 上接受连接，l 关闭时返回
+func (s *Server) ServeTcp(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return errorx.NewError("accept error: %v", err)
+		}
+		logger.Info("replay tcp client %s", conn.RemoteAddr())
+		go serveConn(s.cache, s.opt, newTcpConn(conn))
+	}
+}
+
+// ListenWebSocket 阻塞监听 addr，任意路径都可以升级为 WebSocket
+func (s *Server) ListenWebSocket(addr string) error {
+	httpServer := &http.Server{
+		Addr:              addr,
+		Handler:           s.WebSocketHandler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	logger.Info("replay websocket on %s", addr)
+	if err := httpServer.ListenAndServe(); err != nil {
+		return errorx.NewError("ListenAndServe(%s) error: %v", addr, err)
+	}
+	return nil
+}
+
+// WebSocketHandler 升级为 WebSocket 后在当前 goroutine 回放
+func (s *Server) WebSocketHandler() http.Handler {
+	upgrader := &websocket.Upgrader{
+		ReadBufferSize:  4096,
+		WriteBufferSize: 64 * 1024,
+		CheckOrigin:     checkOrigin(s.opt.OriginList),
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// 握手失败时 Upgrade 已写好错误响应
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			logger.Warn("replay websocket upgrade(%s) origin(%s) error: %v", r.RemoteAddr, r.Header.Get("Origin"), err)
+			return
+		}
+		logger.Info("replay websocket client %s", r.RemoteAddr)
+		serveConn(s.cache, s.opt, newWsConn(conn))
+	})
+}
+
+// tcpConn 每行一个 JSON
+type tcpConn struct {
+	conn    net.Conn
+	scanner *bufio.Scanner
+	writer  *bufio.Writer
+}
+
+func newTcpConn(conn net.Conn) *tcpConn {
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 4096), maxControlSize)
+	return &tcpConn{conn: conn, scanner: scanner, writer: bufio.NewWriter(conn)}
+}
+
+func (c *tcpConn) ReadMessage() ([]byte, error) {
+	for c.scanner.Scan() {
+		if line := strings.TrimSpace(c.scanner.Text()); line != "" {
+			return []byte(line), nil
+		}
+	}
+	if err := c.scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, io.EOF
+}
+
+func (c *tcpConn) WriteMessage(data []byte) error {
+	if err := c.conn.SetWriteDeadline(time.Now().Add(writeTimeout)); err != nil {
+		return err
+	}
+	if _, err := c.writer.Write(data); err != nil {
+		return err
+	}
+	return c.writer.WriteByte('\n')
+}
+
+// Flush 距上次 WriteMessage 可能已经等了很久，重新设置写超时
+func (c *tcpConn) Flush() error {
+	if err := c.conn.SetWriteDeadline(time.Now().Add(writeTimeout)); err != nil {
+		return err
+	}
+	return c.writer.Flush()
+}
+
+func (c *tcpConn) Close() error {
+	_ = c.Flush()
+	return c.conn.Close()
+}
+
+// checkOrigin 浏览器发起的跨域连接只接受 origin_list 中的 Origin；不带 Origin 的非浏览器客户端和同源连接放行
+func checkOrigin(originList []string) func(r *http.Request) bool {
+	return func(r *http.Request) bool {
+		origin := r.Header.Get("Origin")
+		if origin == "" || slices.Contains(originList, origin) {
+			return true
+		}
+		u, err := url.Parse(origin)
+		return err == nil && strings.EqualFold(u.Host, r.Host)
+	}
+}
+
+// wsConn 帧格式、控制帧校验和 ping/close 的回复由 gorilla/websocket 处理，每个 text 帧一条 JSON
+type wsConn struct {
+	conn *websocket.Conn
+}
+
+func newWsConn(conn *websocket.Conn) *wsConn {
+	conn.SetReadLimit(maxControlSize)
+	return &wsConn{conn: conn}
+}
+
+// ReadMessage 返回一条完整的 text/binary 消息，对方关闭时返回 io.EOF
+func (c *wsConn) ReadMessage() ([]byte, error) {
+	_, data, err := c.conn.ReadMessage()
+	if websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway, websocket.CloseNoStatusReceived) {
+		return nil, io.EOF
+	}
+	return data, err
+}
+
+func (c *wsConn) WriteMessage(data []byte) error {
+	if err := c.conn.SetWriteDeadline(time.Now().Add(writeTimeout)); err != nil {
+		return err
+	}
+	return c.conn.WriteMessage(websocket.TextMessage, data)
+}
+
+// Flush WriteMessage 每条消息即时发出，没有缓冲
+func (c *wsConn) Flush() error {
+	return nil
+}
+
+func (c *wsConn) Close() error {
+	message := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "")
+	_ = c.conn.WriteControl(websocket.CloseMessage, message, time.Now().Add(time.Second))
+	return c.conn.Close()
+}
@@ -0,0 +1,314 @@
+package server
+
+import (
+	"data-scrubber/biz/constdef"
+	"data-scrubber/biz/errorx"
+	"data-scrubber/biz/reader"
+	"data-scrubber/biz/service"
+	"data-scrubber/biz/utils"
+	"encoding/json"
+	"io"
+	"iter"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	logger "github.com/2997215859/golog"
+)
+
+// serve 子命令的只读 HTTP 接口，数据都经 reader 包读取，布局识别和过滤下推与 query 子命令一致
+//
+//	GET /api/types                                  有输出的数据类型
+//	GET /api/dates?type=trade                       有输出的日期，type 为空时为所有数据类型的并集
+//	GET /api/instruments?type=trade&date=20240115   当天输出中的票
+//	GET /api/{type}?date=20240115&instrument=600000.SH,000001.SZ&from=09:30:00&to=10:00:00&format=json
+//	    type 为 trade / order / snapshot / orderqueue；date 为 YYYYMMDD；instrument 为 600000.SH 格式，为空表示全部票；
+//	    from、to 为交易所本地时间 "09:30:00[.000]" 或 RFC3339，区间 [from, to)，为空表示不限；
+//	    format 为 json（默认，时间戳为 UTC 纳秒，价格为 float64）、csv 或 arrow（IPC stream），
+//	    csv 和 arrow 的列与 csv.gz、arrow 文件输出一致
+
+const (
+	FormatJson  = "json"
+	FormatCsv   = "csv"
+	FormatArrow = "arrow"
+)
+
+var contentTypeMap = map[string]string{
+	FormatJson:  "application/json",
+	FormatCsv:   "text/csv; charset=utf-8",
+	FormatArrow: "application/vnd.apache.arrow.stream",
+}
+
+// Server 只读 HTTP 接口
+type Server struct {
+	ds *reader.Dataset
+}
+
+func NewServer(ds *reader.Dataset) *Server {
+	return &Server{ds: ds}
+}
+
+// Handler 路由
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/types", s.handleTypes)
+	mux.HandleFunc("GET /api/dates", s.handleDates)
+	mux.HandleFunc("GET /api/instruments", s.handleInstruments)
+	mux.HandleFunc("GET /api/{type}", s.handleRows)
+	return mux
+}
+
+// ListenAndServe 阻塞监听 addr
+func (s *Server) ListenAndServe(addr string) error {
+	httpServer := &http.Server{
+		Addr:              addr,
+		Handler:           s.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	logger.Info("serve %s on %s", s.ds.Root(), addr)
+	if err := httpServer.ListenAndServe(); err != nil {
+		return errorx.NewError("ListenAndServe(%s) error: %v", addr, err)
+	}
+	return nil
+}
+
+func writeJson(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", contentTypeMap[FormatJson])
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logger.Error("write json response error: %v", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	w.Header().Set("Content-Type", contentTypeMap[FormatJson])
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+}
+
+func (s *Server) handleTypes(w http.ResponseWriter, r *http.Request) {
+	dataTypeList, err := s.ds.DataTypeList()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJson(w, dataTypeList)
+}
+
+func (s *Server) handleDates(w http.ResponseWriter, r *http.Request) {
+	dataType := r.URL.Query().Get("type")
+	if dataType != "" && !reader.IsOutputDataType(dataType) {
+		writeError(w, http.StatusBadRequest, errorx.NewError("data type(%s) not supported", dataType))
+		return
+	}
+	dateList, err := s.ds.DateList(dataType)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJson(w, dateList)
+}
+
+func (s *Server) handleInstruments(w http.ResponseWriter, r *http.Request) {
+	dataType := r.URL.Query().Get("type")
+	date := r.URL.Query().Get("date")
+	if dataType == "" || date == "" {
+		writeError(w, http.StatusBadRequest, errorx.NewError("type and date are required"))
+		return
+	}
+	if !reader.IsOutputDataType(dataType) {
+		writeError(w, http.StatusBadRequest, errorx.NewError("data type(%s) not supported", dataType))
+		return
+	}
+	if !reader.IsDate(date) {
+		writeError(w, http.StatusBadRequest, errorx.NewError("date(%s) must be YYYYMMDD", date))
+		return
+	}
+	if !s.checkOutput(w, dataType, date) {
+		return
+	}
+	instrumentList, err := s.ds.InstrumentList(dataType, date)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJson(w, instrumentList)
+}
+
+// checkOutput 没有输出时写 404 并返回 false
+func (s *Server) checkOutput(w http.ResponseWriter, dataType string, date string) bool {
+	ok, err := s.ds.HasOutput(dataType, date)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return false
+	}
+	if !ok {
+		writeError(w, http.StatusNotFound, errorx.NewError("%s date(%s) has no output", dataType, date))
+		return false
+	}
+	return true
+}
+
+// parseTime "09:30:00" / "09:30:00.000" 为 date 当天的交易所本地时间，否则按 RFC3339 解析，空返回零值
+func parseTime(date string, timeStr string) (time.Time, error) {
+	if timeStr == "" {
+		return time.Time{}, nil
+	}
+	if !strings.Contains(timeStr, "T") {
+		if !strings.Contains(timeStr, ".") {
+			timeStr += ".000"
+		}
+		ns, err := utils.TimeToNano(date, timeStr)
+		if err != nil {
+			return time.Time{}, err
+		}
+		return time.Unix(0, ns), nil
+	}
+	return time.Parse(time.RFC3339Nano, timeStr)
+}
+
+func (s *Server) handleRows(w http.ResponseWriter, r *http.Request) {
+	dataType := r.PathValue("type")
+	if !slices.Contains(reader.ReadableDataTypeList, dataType) {
+		writeError(w, http.StatusNotFound, errorx.NewError("data type(%s) not supported", dataType))
+		return
+	}
+	query := r.URL.Query()
+	date := query.Get("date")
+	if date == "" {
+		writeError(w, http.StatusBadRequest, errorx.NewError("date is required"))
+		return
+	}
+	// date 和票代码会拼进文件路径，只接受规范的写法
+	if !reader.IsDate(date) {
+		writeError(w, http.StatusBadRequest, errorx.NewError("date(%s) must be YYYYMMDD", date))
+		return
+	}
+	format := query.Get("format")
+	if format == "" {
+		format = FormatJson
+	}
+	if _, ok := contentTypeMap[format]; !ok {
+		writeError(w, http.StatusBadRequest, errorx.NewError("format(%s) not supported", format))
+		return
+	}
+	var instrumentList []string
+	if instrument := query.Get("instrument"); instrument != "" {
+		instrumentList = strings.Split(instrument, ",")
+	}
+	for _, id := range instrumentList {
+		if !reader.IsInstrumentId(id) {
+			writeError(w, http.StatusBadRequest, errorx.NewError("instrument(%s) must be like 600000.SH", id))
+			return
+		}
+	}
+	from, err := parseTime(date, query.Get("from"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, errorx.NewError("from(%s) error: %v", query.Get("from"), err))
+		return
+	}
+	to, err := parseTime(date, query.Get("to"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, errorx.NewError("to(%s) error: %v", query.Get("to"), err))
+		return
+	}
+	if !s.checkOutput(w, dataType, date) {
+		return
+	}
+
+	switch dataType {
+	case constdef.DataTypeTrade:
+		writeRows(w, format, s.ds.Trades(date, instrumentList, from, to))
+	case constdef.DataTypeOrder:
+		writeRows(w, format, s.ds.Orders(date, instrumentList, from, to))
+	case constdef.DataTypeSnapshot:
+		writeRows(w, format, s.ds.Snapshots(date, instrumentList, from, to))
+	case constdef.DataTypeOrderQueue:
+		writeRows(w, format, s.ds.OrderQueues(date, instrumentList, from, to))
+	}
+}
+
+// rowWriter 按行写响应，service.OutputWriter 也满足
+type rowWriter interface {
+	Write(row interface{}) error
+	Close() error
+}
+
+func newRowWriter(w http.ResponseWriter, format string, schema interface{}) (rowWriter, error) {
+	switch format {
+	case FormatCsv:
+		return service.NewCsvStreamWriter(w, schema)
+	case FormatArrow:
+		return service.NewArrowStreamWriter(w, schema)
+	}
+	return &jsonRowWriter{w: w}, nil
+}
+
+// jsonRowWriter 逐行写出 JSON 数组，不在内存里攒整个结果
+type jsonRowWriter struct {
+	w     io.Writer
+	count int
+}
+
+func (jw *jsonRowWriter) Write(row interface{}) error {
+	data, err := json.Marshal(row)
+	if err != nil {
+		return errorx.NewError("json marshal(%T) error: %v", row, err)
+	}
+	sep := ","
+	if jw.count == 0 {
+		sep = "["
+	}
+	jw.count++
+	if _, err := io.WriteString(jw.w, sep); err != nil {
+		return err
+	}
+	_, err = jw.w.Write(data)
+	return err
+}
+
+func (jw *jsonRowWriter) Close() error {
+	end := "]\n"
+	if jw.count == 0 {
+		end = "[]\n"
+	}
+	_, err := io.WriteString(jw.w, end)
+	return err
+}
+
+// writeRows 流式写出 seq；第一行之前出错返回 500，之后出错只能中断响应（arrow 缺少结束标记、json 不完整，客户端可以识别）
+func writeRows[T any](w http.ResponseWriter, format string, seq iter.Seq2[*T, error]) {
+	var rw rowWriter
+	for v, err := range seq {
+		if err != nil {
+			if rw == nil {
+				writeError(w, http.StatusInternalServerError, err)
+			} else {
+				logger.Error("serve rows error: %v", err)
+			}
+			return
+		}
+		if rw == nil {
+			w.Header().Set("Content-Type", contentTypeMap[format])
+			if rw, err = newRowWriter(w, format, v); err != nil {
+				writeError(w, http.StatusInternalServerError, err)
+				return
+			}
+		}
+		if err := rw.Write(v); err != nil {
+			logger.Error("serve write row error: %v", err)
+			return
+		}
+	}
+	if rw == nil {
+		w.Header().Set("Content-Type", contentTypeMap[format])
+		var err error
+		if rw, err = newRowWriter(w, format, new(T)); err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+	}
+	if err := rw.Close(); err != nil {
+		logger.Error("serve close writer error: %v", err)
+	}
+}
@@ -0,0 +1,178 @@
+package server
+
+import (
+	"data-scrubber/biz/constdef"
+	"data-scrubber/biz/model"
+	"data-scrubber/biz/reader"
+	"data-scrubber/biz/service"
+	"data-scrubber/biz/utils"
+	"data-scrubber/config"
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/apache/arrow/go/v17/arrow/ipc"
+)
+
+func TestServer(t *testing.T) {
+	oldCfg := config.Cfg
+	defer func() { config.Cfg = oldCfg }()
+	config.Cfg = &config.Config{}
+
+	date := "20240115"
+	ts := func(timeStr string) int64 {
+		ns, err := utils.TimeToNano(date, timeStr)
+		if err != nil {
+			t.Fatalf("TimeToNano error: %v", err)
+		}
+		return ns
+	}
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, constdef.DataTypeTrade), 0755); err != nil {
+		t.Fatal(err)
+	}
+	err := service.WriteOutputFile(filepath.Join(root, constdef.DataTypeTrade, date+"_trade.parquet"), []*model.Trade{
+		{InstrumentId: "600000.SH", TradeTimestamp: ts("09:30:00.000"), Price: 10.18},
+		{InstrumentId: "000001.SZ", TradeTimestamp: ts("09:30:01.000"), Price: 35.01},
+		{InstrumentId: "600000.SH", TradeTimestamp: ts("10:00:00.000"), Price: 10.19},
+	}, nil)
+	if err != nil {
+		t.Fatalf("WriteOutputFile error: %v", err)
+	}
+	ds, err := reader.Open(root)
+	if err != nil {
+		t.Fatalf("Open error: %v", err)
+	}
+	httpServer := httptest.NewServer(NewServer(ds).Handler())
+	defer httpServer.Close()
+
+	get := func(path string, wantStatus int) *http.Response {
+		resp, err := http.Get(httpServer.URL + path)
+		if err != nil {
+			t.Fatalf("GET %s error: %v", path, err)
+		}
+		if resp.StatusCode != wantStatus {
+			t.Fatalf("GET %s status=%d, 期望 %d", path, resp.StatusCode, wantStatus)
+		}
+		return resp
+	}
+	getJson := func(path string, v interface{}) {
+		resp := get(path, http.StatusOK)
+		defer resp.Body.Close()
+		if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+			t.Fatalf("GET %s decode error: %v", path, err)
+		}
+	}
+
+	var list []string
+	getJson("/api/types", &list)
+	if !reflect.DeepEqual(list, []string{constdef.DataTypeTrade}) {
+		t.Errorf("types=%v", list)
+	}
+	getJson("/api/dates", &list)
+	if !reflect.DeepEqual(list, []string{date}) {
+		t.Errorf("dates=%v", list)
+	}
+	getJson("/api/instruments?type=trade&date="+date, &list)
+	if !reflect.DeepEqual(list, []string{"000001.SZ", "600000.SH"}) {
+		t.Errorf("instruments=%v", list)
+	}
+
+	var tradeList []*model.Trade
+	getJson("/api/trade?date="+date+"&instrument=600000.SH&from=09:30:00&to=09:31:00", &tradeList)
+	if len(tradeList) != 1 || tradeList[0].Price != 10.18 || tradeList[0].TradeTimestamp != ts("09:30:00.000") {
+		t.Errorf("trades=%+v", tradeList)
+	}
+	getJson("/api/trade?date="+date+"&instrument=300750.SZ", &tradeList)
+	if len(tradeList) != 0 {
+		t.Errorf("len(trades)=%d, 期望 0", len(tradeList))
+	}
+
+	resp := get("/api/trade?date="+date+"&format=csv", http.StatusOK)
+	recordList, err := csv.NewReader(resp.Body).ReadAll()
+	resp.Body.Close()
+	if err != nil {
+		t.Fatalf("read csv error: %v", err)
+	}
+	if len(recordList) != 4 || recordList[0][0] != "InstrumentId" {
+		t.Errorf("csv=%v", recordList)
+	}
+
+	resp = get("/api/trade?date="+date+"&instrument=000001.SZ&format=arrow", http.StatusOK)
+	rr, err := ipc.NewReader(resp.Body)
+	if err != nil {
+		t.Fatalf("ipc.NewReader error: %v", err)
+	}
+	rowCount := int64(0)
+	for rr.Next() {
+		rowCount += rr.Record().NumRows()
+	}
+	rr.Release()
+	resp.Body.Close()
+	if rowCount != 1 {
+		t.Errorf("arrow rows=%d, 期望 1", rowCount)
+	}
+
+	get("/api/snapshot?date="+date, http.StatusNotFound).Body.Close()
+	get("/api/bar?date="+date, http.StatusNotFound).Body.Close()
+	get("/api/trade?date="+date+"&format=xml", http.StatusBadRequest).Body.Close()
+}
+
+// date、票代码中的 ".." 不能读到 dst_dir 以外的文件
+func TestServerPathTraversal(t *testing.T) {
+	oldCfg := config.Cfg
+	defer func() { config.Cfg = oldCfg }()
+	config.Cfg = &config.Config{}
+
+	date := "20240115"
+	base := t.TempDir()
+	root := filepath.Join(base, "root")
+	if err := os.MkdirAll(filepath.Join(root, constdef.DataTypeTrade, date), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(base, "secret"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	// per_stock 布局下 root/trade/<date>/<date>_trade_x/../../../../secret/f.parquet 即 base/secret/f.parquet
+	err := service.WriteOutputFile(filepath.Join(base, "secret", "f.parquet"), []*model.Trade{{InstrumentId: "600000.SH"}}, nil)
+	if err != nil {
+		t.Fatalf("WriteOutputFile error: %v", err)
+	}
+	ds, err := reader.Open(root)
+	if err != nil {
+		t.Fatalf("Open error: %v", err)
+	}
+	httpServer := httptest.NewServer(NewServer(ds).Handler())
+	defer httpServer.Close()
+
+	for _, path := range []string{
+		"/api/trade?date=" + date + "&instrument=" + url.QueryEscape("x/../../../../secret/f"),
+		"/api/trade?date=" + url.QueryEscape("../../secret") + "&instrument=600000.SH",
+		"/api/instruments?type=trade&date=" + url.QueryEscape("../../secret"),
+		"/api/instruments?type=" + url.QueryEscape("../secret") + "&date=" + date,
+		"/api/dates?type=" + url.QueryEscape("../secret"),
+	} {
+		resp, err := http.Get(httpServer.URL + path)
+		if err != nil {
+			t.Fatalf("GET %s error: %v", path, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("GET %s status=%d, 期望 400", path, resp.StatusCode)
+		}
+	}
+
+	// 不经过 handler 直接调用 reader 时由 resolveFileList 拦住
+	for _, err := range ds.Trades(date, []string{"x/../../../../secret/f"}, time.Time{}, time.Time{}) {
+		if err == nil {
+			t.Errorf("越界路径应返回错误")
+		}
+	}
+}
@@ -0,0 +1,343 @@
+package service
+
+import (
+	"data-scrubber/biz/constdef"
+	"data-scrubber/biz/errorx"
+	"data-scrubber/biz/layout"
+	"data-scrubber/biz/model"
+	"data-scrubber/biz/utils"
+	"data-scrubber/config"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	logger "github.com/2997215859/golog"
+	"github.com/dromara/carbon/v2"
+)
+
+// 复权：tushare adj_factor 按交易日缓存在 adj_factor_cache_dir/<date>_adj_factor.json（票 -> 因子），
+// 清洗时按 adjust_type 算出每个票当天的复权比例，价格 × 比例即为复权价。
+// bar 和 daily 额外输出复权后的 <type>_<adjust_type>（如 bar_qfq），目录结构、文件名与原始输出相同；
+// adjust_price_column 开启时 trade 和 snapshot 改为输出带复权列的 AdjustedTrade / AdjustedSnapshot。
+// 复权比例拿不到（tushare 不可用、当天没有因子）时只跳过复权输出，原始输出照常写。
+
+// 前复权基准日不是交易日时，最多向前找的自然日数
+const adjustBaseDateLookBack = 15
+
+const (
+	// RunReportAdjustMissingFactor 缺少复权因子的票数，%s 为 data type
+	RunReportAdjustMissingFactor = "%s_adjust_missing_factor"
+	// RunReportAdjustSkipped 复权比例拿不到、只写了原始输出时为 1，%s 为 data type
+	RunReportAdjustSkipped = "%s_adjust_skipped"
+)
+
+var (
+	adjFactorMu sync.Mutex
+	// adjFactorMap 日期 -> 票 -> 因子
+	adjFactorMap = make(map[string]map[string]float64)
+)
+
+func getAdjFactorCachePath(date string) string {
+	return filepath.Join(config.Cfg.GetAdjFactorCacheDir(), fmt.Sprintf("%s_adj_factor.json", date))
+}
+
+// LoadAdjFactor 某个交易日全市场的复权因子：依次查内存、本地缓存，都没有时从 tushare 拉取并写入本地缓存
+// 非交易日或 tushare 尚未更新时返回空 map；空结果只在日期早于今天（即非交易日）时缓存
+func LoadAdjFactor(date string) (map[string]float64, error) {
+	adjFactorMu.Lock()
+	defer adjFactorMu.Unlock()
+	if res, ok := adjFactorMap[date]; ok {
+		return res, nil
+	}
+
+	cachePath := getAdjFactorCachePath(date)
+	if utils.Exists(cachePath) {
+		data, err := os.ReadFile(cachePath)
+		if err != nil {
+			return nil, errorx.NewError("ReadFile(%s) error: %v", cachePath, err)
+		}
+		res := make(map[string]float64)
+		if err := json.Unmarshal(data, &res); err != nil {
+			return nil, errorx.NewError("json.Unmarshal(%s) error: %v", cachePath, err)
+		}
+		adjFactorMap[date] = res
+		return res, nil
+	}
+
+	if GetTuShare() == nil {
+		return nil, errorx.NewError("adj factor cache(%s) not found and tushare not initialized", cachePath)
+	}
+	list, err := GetTuShareAdjFactor(date)
+	if err != nil {
+		return nil, err
+	}
+	res := make(map[string]float64, len(list))
+	for _, v := range list {
+		res[v.TsCode] = v.AdjFactor
+	}
+	if len(res) == 0 && date >= carbon.Now().Format("Ymd") {
+		return res, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(cachePath), 0755); err != nil {
+		return nil, errorx.NewError("MkdirAll(%s) error: %v", filepath.Dir(cachePath), err)
+	}
+	data, err := json.Marshal(res)
+	if err != nil {
+		return nil, errorx.NewError("json.Marshal adj factor error: %v", err)
+	}
+	if err := os.WriteFile(cachePath, data, 0644); err != nil {
+		return nil, errorx.NewError("WriteFile(%s) error: %v", cachePath, err)
+	}
+	logger.Info("LoadAdjFactor date(%s) from tushare, count=%d", date, len(res))
+	adjFactorMap[date] = res
+	return res, nil
+}
+
+// loadAdjustBaseFactor 前复权基准日的因子，基准日不是交易日时向前取最近一个有因子的日期
+func loadAdjustBaseFactor() (string, map[string]float64, error) {
+	baseDate := config.Cfg.GetAdjustBaseDate()
+	if baseDate == "" {
+		return "", nil, errorx.NewError("adjust_type(%s) requires adjust_base_date", constdef.AdjustTypeForward)
+	}
+	if carbon.Parse(baseDate).IsInvalid() {
+		return "", nil, errorx.NewError("adjust_base_date(%s) is invalid", baseDate)
+	}
+	for i := 0; i < adjustBaseDateLookBack; i++ {
+		date := carbon.Parse(baseDate).StartOfDay().SubDays(i).Format("Ymd")
+		factorMap, err := LoadAdjFactor(date)
+		if err != nil {
+			return "", nil, err
+		}
+		if len(factorMap) > 0 {
+			return date, factorMap, nil
+		}
+	}
+	return "", nil, errorx.NewError("adjust_base_date(%s) has no adj factor within %d days", baseDate, adjustBaseDateLookBack)
+}
+
+// GetAdjustRatioMap 当天每个票的复权比例，没有因子的票（指数、基金、基准日前已退市等）不在结果中
+func GetAdjustRatioMap(date string) (map[string]float64, error) {
+	adjustType := config.Cfg.GetAdjustType()
+	if adjustType != constdef.AdjustTypeForward && adjustType != constdef.AdjustTypeBackward {
+		return nil, errorx.NewError("unknown adjust_type(%s)", adjustType)
+	}
+	factorMap, err := LoadAdjFactor(date)
+	if err != nil {
+		return nil, err
+	}
+	if len(factorMap) == 0 {
+		return nil, errorx.NewError("date(%s) has no adj factor", date)
+	}
+	if adjustType == constdef.AdjustTypeBackward {
+		return factorMap, nil
+	}
+
+	baseDate, baseFactorMap, err := loadAdjustBaseFactor()
+	if err != nil {
+		return nil, err
+	}
+	res := make(map[string]float64, len(factorMap))
+	for instrumentId, factor := range factorMap {
+		if baseFactor := baseFactorMap[instrumentId]; baseFactor > 0 {
+			res[instrumentId] = factor / baseFactor
+		}
+	}
+	logger.Info("GetAdjustRatioMap date(%s) qfq base date(%s), count=%d", date, baseDate, len(res))
+	return res, nil
+}
+
+// getAdjustRatioMapOrSkip 拿不到复权比例时记入运行报告并返回 false，调用方只写原始输出
+func getAdjustRatioMapOrSkip(dataType string, date string) (map[string]float64, bool) {
+	ratioMap, err := GetAdjustRatioMap(date)
+	if err != nil {
+		SetRunReportCount(fmt.Sprintf(RunReportAdjustSkipped, dataType), 1)
+		logger.Warn("Adjust %s date(%s) skipped, raw output only: %v", dataType, date, err)
+		return nil, false
+	}
+	return ratioMap, true
+}
+
+// adjustRatioMap 开启复权且拿到复权比例时返回 true
+func adjustRatioMap(dataType string, date string) (map[string]float64, bool) {
+	if !config.Cfg.IsAdjust() {
+		return nil, false
+	}
+	return getAdjustRatioMapOrSkip(dataType, date)
+}
+
+// adjustPriceColumnRatioMap adjust_price_column 开启且拿到复权比例时返回 true
+func adjustPriceColumnRatioMap(dataType string, date string) (map[string]float64, bool) {
+	if !config.Cfg.IsAdjustPriceColumn() {
+		return nil, false
+	}
+	return getAdjustRatioMapOrSkip(dataType, date)
+}
+
+// GetAdjustDataType 复权输出的 data type，如 bar_qfq
+func GetAdjustDataType(dataType string) string {
+	return dataType + "_" + config.Cfg.GetAdjustType()
+}
+
+// reportAdjustMissing 缺少因子的票记入运行报告，只打一条汇总日志
+func reportAdjustMissing(dataType string, date string, missing map[string]struct{}) {
+	SetRunReportCount(fmt.Sprintf(RunReportAdjustMissingFactor, dataType), int64(len(missing)))
+	if len(missing) == 0 {
+		return
+	}
+	idList := make([]string, 0, len(missing))
+	for id := range missing {
+		idList = append(idList, id)
+	}
+	sort.Strings(idList)
+	logger.Warn("Adjust %s date(%s): %d instruments have no adj factor, first=%s", dataType, date, len(idList), idList[0])
+}
+
+// adjustPrice 价格为 0（空 bar、无成交）时保持 0
+func adjustPrice(price float64, ratio float64) float64 {
+	return price * ratio
+}
+
+// AdjustBar 复权后的价格是计算出来的，清掉原始价格的 E4，int64 / DECIMAL 输出按复权后的 float64 换算
+func AdjustBar(v *model.Bar, ratio float64) *model.Bar {
+	res := *v
+	res.OpenE4, res.HighE4, res.LowE4, res.CloseE4 = 0, 0, 0, 0
+	res.Open = adjustPrice(v.Open, ratio)
+	res.High = adjustPrice(v.High, ratio)
+	res.Low = adjustPrice(v.Low, ratio)
+	res.Close = adjustPrice(v.Close, ratio)
+	res.Vwap = adjustPrice(v.Vwap, ratio)
+	return &res
+}
+
+// AdjustDaily 同 AdjustBar，清掉原始价格的 E4
+func AdjustDaily(v *model.Daily, ratio float64) *model.Daily {
+	res := *v
+	res.PreCloseE4, res.OpenE4, res.HighE4, res.LowE4, res.CloseE4 = 0, 0, 0, 0, 0
+	res.PreClose = adjustPrice(v.PreClose, ratio)
+	res.Open = adjustPrice(v.Open, ratio)
+	res.High = adjustPrice(v.High, ratio)
+	res.Low = adjustPrice(v.Low, ratio)
+	res.Close = adjustPrice(v.Close, ratio)
+	return &res
+}
+
+// AdjustBarMap 复权后的 bar，没有因子的票不输出
+func AdjustBarMap(date string, barMap map[string][]*model.Bar, ratioMap map[string]float64) map[string][]*model.Bar {
+	res := make(map[string][]*model.Bar, len(barMap))
+	missing := make(map[string]struct{})
+	for instrumentId, barList := range barMap {
+		ratio, ok := ratioMap[instrumentId]
+		if !ok {
+			missing[instrumentId] = struct{}{}
+			continue
+		}
+		list := make([]*model.Bar, 0, len(barList))
+		for _, v := range barList {
+			list = append(list, AdjustBar(v, ratio))
+		}
+		res[instrumentId] = list
+	}
+	reportAdjustMissing(constdef.DataTypeBar, date, missing)
+	return res
+}
+
+// AdjustDailyList 复权后的日线，没有因子的票不输出
+func AdjustDailyList(date string, dailyList []*model.Daily, ratioMap map[string]float64) []*model.Daily {
+	res := make([]*model.Daily, 0, len(dailyList))
+	missing := make(map[string]struct{})
+	for _, v := range dailyList {
+		ratio, ok := ratioMap[v.InstrumentId]
+		if !ok {
+			missing[v.InstrumentId] = struct{}{}
+			continue
+		}
+		res = append(res, AdjustDaily(v, ratio))
+	}
+	reportAdjustMissing(constdef.DataTypeDaily, date, missing)
+	return res
+}
+
+func NewAdjustedTrade(v *model.Trade, ratio float64) *model.AdjustedTrade {
+	return &model.AdjustedTrade{
+		Trade:     *v,
+		AdjFactor: ratio,
+		AdjPrice:  adjustPrice(v.Price, ratio),
+	}
+}
+
+func NewAdjustedSnapshot(v *model.Snapshot, ratio float64) *model.AdjustedSnapshot {
+	return &model.AdjustedSnapshot{
+		Snapshot:    *v,
+		AdjFactor:   ratio,
+		AdjLast:     adjustPrice(v.Last, ratio),
+		AdjPreClose: adjustPrice(v.PreClose, ratio),
+		AdjOpen:     adjustPrice(v.Open, ratio),
+		AdjHigh:     adjustPrice(v.High, ratio),
+		AdjLow:      adjustPrice(v.Low, ratio),
+		AdjClose:    adjustPrice(v.Close, ratio),
+	}
+}
+
+// BuildAdjustedTradeList 没有因子的票照常输出，复权列为 0
+func BuildAdjustedTradeList(date string, list []*model.Trade, ratioMap map[string]float64) []*model.AdjustedTrade {
+	res := make([]*model.AdjustedTrade, 0, len(list))
+	missing := make(map[string]struct{})
+	for _, v := range list {
+		ratio, ok := ratioMap[v.InstrumentId]
+		if !ok {
+			missing[v.InstrumentId] = struct{}{}
+		}
+		res = append(res, NewAdjustedTrade(v, ratio))
+	}
+	reportAdjustMissing(constdef.DataTypeTrade, date, missing)
+	return res
+}
+
+// BuildAdjustedSnapshotList 没有因子的票照常输出，复权列为 0
+func BuildAdjustedSnapshotList(date string, list []*model.Snapshot, ratioMap map[string]float64) []*model.AdjustedSnapshot {
+	res := make([]*model.AdjustedSnapshot, 0, len(list))
+	missing := make(map[string]struct{})
+	for _, v := range list {
+		ratio, ok := ratioMap[v.InstrumentId]
+		if !ok {
+			missing[v.InstrumentId] = struct{}{}
+		}
+		res = append(res, NewAdjustedSnapshot(v, ratio))
+	}
+	reportAdjustMissing(constdef.DataTypeSnapshot, date, missing)
+	return res
+}
+
+// WriteAdjustedOutput 按 output_layout / output_mode 写 AdjustedTrade / AdjustedSnapshot，
+// typeDir 和文件名与原始 trade / snapshot 输出相同
+func WriteAdjustedOutput[T any](typeDir string, dataType string, date string, list []*T, sourceFileList []string, instrumentId func(v *T) string, timestamp func(v *T) int64) error {
+	if config.Cfg.IsHiveLayout() {
+		return WriteHiveParquet(typeDir, date, list, sourceFileList, instrumentId, timestamp)
+	}
+	if err := os.MkdirAll(typeDir, 0755); err != nil {
+		return errorx.NewError("MkdirAll(%s) error: %v", typeDir, err)
+	}
+	if config.Cfg.IsPerDay() {
+		filePath := filepath.Join(typeDir, layout.GetPerDayFileName(date, dataType))
+		if config.Cfg.IsPerDayClustered() {
+			return WriteClusteredOutputFile(filePath, list, sourceFileList, instrumentId, timestamp)
+		}
+		return WriteOutputFile(filePath, list, sourceFileList)
+	}
+
+	mapList := make(map[string][]*T)
+	for _, v := range list {
+		mapList[instrumentId(v)] = append(mapList[instrumentId(v)], v)
+	}
+	for id, stockList := range mapList {
+		filePath := filepath.Join(typeDir, layout.GetPerStockFileName(date, dataType, id))
+		if err := WriteOutputFile(filePath, stockList, sourceFileList); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,156 @@
+package service
+
+import (
+	"data-scrubber/biz/constdef"
+	"data-scrubber/biz/model"
+	"data-scrubber/config"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/xitongsys/parquet-go-source/local"
+	"github.com/xitongsys/parquet-go/reader"
+)
+
+// newAdjustTestConfig 本地缓存 20240115-20240120 的因子，000001.SZ 在 20240116 除权，20240117 之后为非交易日
+func newAdjustTestConfig(t *testing.T, adjustType string) {
+	dir := t.TempDir()
+	cacheList := map[string]string{
+		"20240115": `{"000001.SZ": 100, "600000.SH": 10}`,
+		"20240116": `{"000001.SZ": 110, "600000.SH": 10}`,
+		"20240117": `{}`,
+		"20240118": `{}`,
+		"20240119": `{}`,
+		"20240120": `{}`,
+	}
+	for date, data := range cacheList {
+		if err := os.WriteFile(filepath.Join(dir, date+"_adj_factor.json"), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	config.Cfg = &config.Config{
+		AdjustType:        adjustType,
+		AdjustPriceColumn: true,
+		AdjFactorCacheDir: dir,
+		// 周六，向前取到 20240116
+		AdjustBaseDate: "20240120",
+		OutputMode:     constdef.OutputModePerDay,
+	}
+	adjFactorMap = make(map[string]map[string]float64)
+}
+
+func TestGetAdjustRatioMap(t *testing.T) {
+	oldCfg := config.Cfg
+	defer func() { config.Cfg = oldCfg }()
+
+	newAdjustTestConfig(t, constdef.AdjustTypeForward)
+	ratioMap, err := GetAdjustRatioMap("20240115")
+	if err != nil {
+		t.Fatalf("GetAdjustRatioMap error: %v", err)
+	}
+	if math.Abs(ratioMap["000001.SZ"]-100.0/110) > 1e-12 || ratioMap["600000.SH"] != 1 {
+		t.Errorf("qfq ratioMap=%v", ratioMap)
+	}
+
+	newAdjustTestConfig(t, constdef.AdjustTypeBackward)
+	ratioMap, err = GetAdjustRatioMap("20240116")
+	if err != nil {
+		t.Fatalf("GetAdjustRatioMap error: %v", err)
+	}
+	if ratioMap["000001.SZ"] != 110 || ratioMap["600000.SH"] != 10 {
+		t.Errorf("hfq ratioMap=%v", ratioMap)
+	}
+
+	// 非交易日没有因子
+	if _, err := GetAdjustRatioMap("20240117"); err == nil {
+		t.Errorf("缺少因子应报错")
+	}
+}
+
+func TestAdjustOutput(t *testing.T) {
+	oldCfg := config.Cfg
+	defer func() { config.Cfg = oldCfg }()
+	newAdjustTestConfig(t, constdef.AdjustTypeForward)
+	ratioMap := map[string]float64{"000001.SZ": 0.5}
+
+	barMap := AdjustBarMap("20240115", map[string][]*model.Bar{
+		"000001.SZ": {{InstrumentId: "000001.SZ", Open: 10, High: 12, Low: 8, Close: 11, Vwap: 10.5, Volume: 100}},
+		"510300.SH": {{InstrumentId: "510300.SH", Open: 4}},
+	}, ratioMap)
+	if len(barMap) != 1 || *barMap["000001.SZ"][0] != (model.Bar{InstrumentId: "000001.SZ", Open: 5, High: 6, Low: 4, Close: 5.5, Vwap: 5.25, Volume: 100}) {
+		t.Errorf("barMap=%+v", barMap)
+	}
+	if GetRunReportCount("bar_adjust_missing_factor") != 1 {
+		t.Errorf("missing count=%d", GetRunReportCount("bar_adjust_missing_factor"))
+	}
+
+	// 没有因子的票照常输出，复权列为 0
+	adjustedList := BuildAdjustedTradeList("20240115", []*model.Trade{
+		{InstrumentId: "000001.SZ", TradeTimestamp: 1, Price: 11},
+		{InstrumentId: "510300.SH", TradeTimestamp: 2, Price: 4},
+	}, ratioMap)
+	dir := t.TempDir()
+	err := WriteAdjustedOutput(dir, constdef.DataTypeTrade, "20240115", adjustedList, nil, func(v *model.AdjustedTrade) string { return v.InstrumentId },
+		func(v *model.AdjustedTrade) int64 { return v.TradeTimestamp })
+	if err != nil {
+		t.Fatalf("WriteAdjustedOutput error: %v", err)
+	}
+
+	fr, err := local.NewLocalFileReader(filepath.Join(dir, "20240115_trade.parquet"))
+	if err != nil {
+		t.Fatalf("NewLocalFileReader error: %v", err)
+	}
+	defer fr.Close()
+	// AdjustedTrade 嵌入了 Trade，写出的是平铺的列，按平铺的结构体读回
+	type adjustedTradeRow struct {
+		InstrumentId string  `parquet:"name=InstrumentId, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+		Price        float64 `parquet:"name=Price, type=DOUBLE"`
+		AdjFactor    float64 `parquet:"name=AdjFactor, type=DOUBLE"`
+		AdjPrice     float64 `parquet:"name=AdjPrice, type=DOUBLE"`
+	}
+	pr, err := reader.NewParquetReader(fr, new(adjustedTradeRow), 1)
+	if err != nil {
+		t.Fatalf("NewParquetReader error: %v", err)
+	}
+	defer pr.ReadStop()
+	// 根节点 + Trade 的 15 列 + 2 个复权列
+	if pr.GetNumRows() != 2 || len(pr.Footer.Schema) != 18 {
+		t.Fatalf("rows=%d schema=%d", pr.GetNumRows(), len(pr.Footer.Schema))
+	}
+	rowList := make([]adjustedTradeRow, 2)
+	if err := pr.Read(&rowList); err != nil {
+		t.Fatalf("Read error: %v", err)
+	}
+	if math.Abs(rowList[0].AdjPrice-5.5) > 1e-9 || rowList[1].AdjFactor != 0 || rowList[1].AdjPrice != 0 || rowList[1].Price != 4 {
+		t.Errorf("rowList=%+v", rowList)
+	}
+}
+
+func TestAdjustSkipped(t *testing.T) {
+	oldCfg := config.Cfg
+	defer func() { config.Cfg = oldCfg }()
+
+	// qfq 没有基准日时不复权
+	newAdjustTestConfig(t, constdef.AdjustTypeForward)
+	config.Cfg.AdjustBaseDate = ""
+	if _, err := GetAdjustRatioMap("20240115"); err == nil {
+		t.Errorf("qfq 缺少 adjust_base_date 应报错")
+	}
+
+	// 拿不到复权比例时跳过复权输出并记入运行报告
+	newAdjustTestConfig(t, constdef.AdjustTypeBackward)
+	if _, ok := adjustRatioMap(constdef.DataTypeBar, "20240117"); ok {
+		t.Errorf("缺少因子应跳过复权")
+	}
+	if GetRunReportCount("bar_adjust_skipped") != 1 {
+		t.Errorf("skipped count=%d", GetRunReportCount("bar_adjust_skipped"))
+	}
+	if _, ok := adjustPriceColumnRatioMap(constdef.DataTypeTrade, "20240116"); !ok {
+		t.Errorf("有因子时应输出复权列")
+	}
+	config.Cfg.AdjustType = constdef.AdjustTypeNone
+	if _, ok := adjustPriceColumnRatioMap(constdef.DataTypeTrade, "20240116"); ok {
+		t.Errorf("adjust_type 为 none 时不应输出复权列")
+	}
+}
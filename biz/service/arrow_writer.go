@@ -0,0 +1,256 @@
+package service
+
+import (
+	"data-scrubber/biz/constdef"
+	"data-scrubber/biz/errorx"
+	"data-scrubber/biz/utils"
+	"data-scrubber/config"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+
+	"github.com/apache/arrow/go/v17/arrow"
+	"github.com/apache/arrow/go/v17/arrow/array"
+	"github.com/apache/arrow/go/v17/arrow/ipc"
+	"github.com/apache/arrow/go/v17/arrow/memory"
+)
+
+// ArrowWriter 把 model 结构体写成 Arrow IPC 文件，列名取自 parquet tag，和 parquet 输出的列一致
+// 回测程序可以直接 mmap 读取，不需要解码 parquet；写到 io.Writer 时为 Arrow IPC stream 格式
+type ArrowWriter struct {
+	file          io.Closer // stream 写入器为 nil，底层 io.Writer 由调用方关闭
+	recordWriter  arrowRecordWriter
+	recordBuilder *array.RecordBuilder
+	appenderList  []arrowAppender
+
+	rowCount   int // 当前 record batch 中未写出的行数
+	batchCount int
+}
+
+// arrowRecordWriter ipc.FileWriter 和 ipc.Writer 共同的方法
+type arrowRecordWriter interface {
+	Write(rec arrow.Record) error
+	Close() error
+}
+
+// arrowAppender 把结构体的第 index 个字段追加到对应列
+type arrowAppender struct {
+	index  int
+	append func(b array.Builder, v reflect.Value)
+}
+
+// 每个 record batch 最多的行数
+const arrowBatchSize = 64 * 1024
+
+// getParquetColumnName 取 parquet tag 中的 name，没有 tag 时用字段名
+func getParquetColumnName(f reflect.StructField) string {
+	for _, kv := range strings.Split(f.Tag.Get("parquet"), ",") {
+		kv = strings.TrimSpace(kv)
+		if strings.HasPrefix(kv, "name=") {
+			return strings.TrimPrefix(kv, "name=")
+		}
+	}
+	return f.Name
+}
+
+// getArrowField 按字段类型生成 Arrow 列和追加函数；时间戳列按 timestamp_encoding 决定是否用 timestamp 类型
+func getArrowField(f reflect.StructField, timestampEncoding string) (arrow.Field, func(b array.Builder, v reflect.Value), error) {
+	name := getParquetColumnName(f)
+	switch f.Type.Kind() {
+	case reflect.String:
+		return arrow.Field{Name: name, Type: arrow.BinaryTypes.String}, func(b array.Builder, v reflect.Value) {
+			b.(*array.StringBuilder).Append(v.String())
+		}, nil
+	case reflect.Bool:
+		return arrow.Field{Name: name, Type: arrow.FixedWidthTypes.Boolean}, func(b array.Builder, v reflect.Value) {
+			b.(*array.BooleanBuilder).Append(v.Bool())
+		}, nil
+	case reflect.Int32:
+		return arrow.Field{Name: name, Type: arrow.PrimitiveTypes.Int32}, func(b array.Builder, v reflect.Value) {
+			b.(*array.Int32Builder).Append(int32(v.Int()))
+		}, nil
+	case reflect.Int, reflect.Int64:
+		isTimestamp := f.Type.Kind() == reflect.Int64 && strings.HasSuffix(f.Name, timestampFieldSuffix)
+		if isTimestamp && timestampEncoding != constdef.TimestampEncodingHHMMSSmmm {
+			timestampType := &arrow.TimestampType{Unit: arrow.Nanosecond, TimeZone: "UTC"}
+			if timestampEncoding == constdef.TimestampEncodingLocalNanos {
+				timestampType.TimeZone = ""
+			}
+			return arrow.Field{Name: name, Type: timestampType}, func(b array.Builder, v reflect.Value) {
+				b.(*array.TimestampBuilder).Append(arrow.Timestamp(utils.EncodeTimestamp(v.Int(), timestampEncoding)))
+			}, nil
+		}
+		if isTimestamp {
+			return arrow.Field{Name: name, Type: arrow.PrimitiveTypes.Int64}, func(b array.Builder, v reflect.Value) {
+				b.(*array.Int64Builder).Append(utils.EncodeTimestamp(v.Int(), timestampEncoding))
+			}, nil
+		}
+		return arrow.Field{Name: name, Type: arrow.PrimitiveTypes.Int64}, func(b array.Builder, v reflect.Value) {
+			b.(*array.Int64Builder).Append(v.Int())
+		}, nil
+	case reflect.Float64:
+		return arrow.Field{Name: name, Type: arrow.PrimitiveTypes.Float64}, func(b array.Builder, v reflect.Value) {
+			b.(*array.Float64Builder).Append(v.Float())
+		}, nil
+	case reflect.Slice:
+		switch f.Type.Elem().Kind() {
+		case reflect.Float64:
+			return arrow.Field{Name: name, Type: arrow.ListOf(arrow.PrimitiveTypes.Float64)}, func(b array.Builder, v reflect.Value) {
+				lb := b.(*array.ListBuilder)
+				lb.Append(true)
+				lb.ValueBuilder().(*array.Float64Builder).AppendValues(v.Interface().([]float64), nil)
+			}, nil
+		case reflect.Int64:
+			return arrow.Field{Name: name, Type: arrow.ListOf(arrow.PrimitiveTypes.Int64)}, func(b array.Builder, v reflect.Value) {
+				lb := b.(*array.ListBuilder)
+				lb.Append(true)
+				lb.ValueBuilder().(*array.Int64Builder).AppendValues(v.Interface().([]int64), nil)
+			}, nil
+		}
+	}
+	return arrow.Field{}, nil, errorx.NewError("field(%s) type(%s) not supported by arrow writer", f.Name, f.Type)
+}
+
+// newArrowSchema 按 model 结构体生成 Arrow schema 和各列的追加函数，schema 为 model 结构体指针
+// sourceFileList 写入 schema 元数据，见 NewParquetWriter
+func newArrowSchema(schema interface{}, sourceFileList []string) (*arrow.Schema, []arrowAppender, error) {
+	t := structType(reflect.TypeOf(schema))
+	if t == nil {
+		return nil, nil, errorx.NewError("arrow schema(%T) is not a struct", schema)
+	}
+
+	timestampEncoding := config.Cfg.GetTimestampEncoding()
+	fieldList := make([]arrow.Field, 0, t.NumField())
+	appenderList := make([]arrowAppender, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		if !isColumnField(t.Field(i)) {
+			continue
+		}
+		field, appendFunc, err := getArrowField(t.Field(i), timestampEncoding)
+		if err != nil {
+			return nil, nil, err
+		}
+		fieldList = append(fieldList, field)
+		appenderList = append(appenderList, arrowAppender{index: i, append: appendFunc})
+	}
+
+	keyList := make([]string, 0)
+	valueList := make([]string, 0)
+	priceEncoding := ""
+	if hasInt64PriceField(schema) {
+		priceEncoding = constdef.PriceEncodingInt64
+	}
+	for _, kv := range getKeyValueMetadata(sourceFileList, priceEncoding, config.Cfg.GetPriceScale()) {
+		keyList = append(keyList, kv.Key)
+		valueList = append(valueList, *kv.Value)
+	}
+	metadata := arrow.NewMetadata(keyList, valueList)
+	return arrow.NewSchema(fieldList, &metadata), appenderList, nil
+}
+
+// NewArrowWriter 创建 Arrow IPC 文件写入器，schema 为 model 结构体指针
+func NewArrowWriter(filePath string, schema interface{}, sourceFileList []string) (*ArrowWriter, error) {
+	arrowSchema, appenderList, err := newArrowSchema(schema, sourceFileList)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.OpenFile(filePath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return nil, errorx.NewError("OpenFile(%s) error: %v", filePath, err)
+	}
+	mem := memory.NewGoAllocator()
+	fileWriter, err := ipc.NewFileWriter(file, ipc.WithSchema(arrowSchema), ipc.WithAllocator(mem))
+	if err != nil {
+		_ = file.Close()
+		return nil, errorx.NewError("ipc.NewFileWriter(%s) error: %v", filePath, err)
+	}
+
+	return &ArrowWriter{
+		file:          file,
+		recordWriter:  fileWriter,
+		recordBuilder: array.NewRecordBuilder(mem, arrowSchema),
+		appenderList:  appenderList,
+	}, nil
+}
+
+// NewArrowStreamWriter 创建 Arrow IPC stream 写入器（没有文件尾，可以边写边读），用于 HTTP 等流式输出
+// Close 只写出剩余数据和流结束标记，不关闭 w
+func NewArrowStreamWriter(w io.Writer, schema interface{}) (*ArrowWriter, error) {
+	arrowSchema, appenderList, err := newArrowSchema(schema, nil)
+	if err != nil {
+		return nil, err
+	}
+	mem := memory.NewGoAllocator()
+	return &ArrowWriter{
+		recordWriter:  ipc.NewWriter(w, ipc.WithSchema(arrowSchema), ipc.WithAllocator(mem)),
+		recordBuilder: array.NewRecordBuilder(mem, arrowSchema),
+		appenderList:  appenderList,
+	}, nil
+}
+
+// Write 写入单行，攒满 arrowBatchSize 行写出一个 record batch
+func (aw *ArrowWriter) Write(row interface{}) error {
+	rv := reflect.ValueOf(row)
+	for rv.Kind() == reflect.Pointer {
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return errorx.NewError("arrow row(%T) is not a struct", row)
+	}
+
+	for i, appender := range aw.appenderList {
+		appender.append(aw.recordBuilder.Field(i), rv.Field(appender.index))
+	}
+	aw.rowCount++
+	if aw.rowCount >= arrowBatchSize {
+		if _, err := aw.FlushRowGroup(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// FlushRowGroup 把缓冲的行写成一个 record batch（没有缓冲数据时不写），返回已写的 batch 数
+func (aw *ArrowWriter) FlushRowGroup() (int, error) {
+	if aw.rowCount == 0 {
+		return aw.batchCount, nil
+	}
+	record := aw.recordBuilder.NewRecord()
+	defer record.Release()
+	if err := aw.recordWriter.Write(record); err != nil {
+		return aw.batchCount, errorx.NewError("arrow write record error: %v", err)
+	}
+	aw.rowCount = 0
+	aw.batchCount++
+	return aw.batchCount, nil
+}
+
+// RowGroupCount 已写出的 record batch 数
+func (aw *ArrowWriter) RowGroupCount() int {
+	return aw.batchCount
+}
+
+// Close 写出剩余数据和文件尾（stream 为结束标记），文件写入器同时关闭文件
+func (aw *ArrowWriter) Close() error {
+	defer aw.recordBuilder.Release()
+	if _, err := aw.FlushRowGroup(); err != nil {
+		aw.closeFile()
+		return err
+	}
+	if err := aw.recordWriter.Close(); err != nil {
+		aw.closeFile()
+		return errorx.NewError("arrow close error: %v", err)
+	}
+	if aw.file == nil {
+		return nil
+	}
+	return aw.file.Close()
+}
+
+func (aw *ArrowWriter) closeFile() {
+	if aw.file != nil {
+		_ = aw.file.Close()
+	}
+}
@@ -0,0 +1,73 @@
+package service
+
+import (
+	"data-scrubber/biz/constdef"
+	"data-scrubber/biz/model"
+	"data-scrubber/config"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/apache/arrow/go/v17/arrow"
+	"github.com/apache/arrow/go/v17/arrow/array"
+	"github.com/apache/arrow/go/v17/arrow/ipc"
+	"github.com/apache/arrow/go/v17/arrow/memory"
+)
+
+func TestArrowWriter(t *testing.T) {
+	oldCfg := config.Cfg
+	defer func() { config.Cfg = oldCfg }()
+	config.Cfg = &config.Config{OutputFormat: constdef.OutputFormatArrow}
+
+	snapshotList := []*model.Snapshot{
+		{InstrumentId: "600000.SH", UpdateTimestamp: 100, Last: 10.5, BidPriceList: []float64{10.4, 10.3}, BidVolumeList: []int64{100, 200}},
+		{InstrumentId: "000001.SZ", UpdateTimestamp: 200, Last: 8.1, BidPriceList: []float64{8.0}},
+	}
+	filePath := filepath.Join(t.TempDir(), "20240115_snapshot.parquet")
+	if err := WriteOutputFile(filePath, snapshotList, nil); err != nil {
+		t.Fatalf("WriteOutputFile error: %v", err)
+	}
+
+	f, err := os.Open(filepath.Join(filepath.Dir(filePath), "20240115_snapshot.arrow"))
+	if err != nil {
+		t.Fatalf("open arrow file error: %v", err)
+	}
+	defer f.Close()
+	fr, err := ipc.NewFileReader(f, ipc.WithAllocator(memory.NewGoAllocator()))
+	if err != nil {
+		t.Fatalf("ipc.NewFileReader error: %v", err)
+	}
+	defer fr.Close()
+
+	schema := fr.Schema()
+	if i := schema.FieldIndices("BidPriceList"); len(i) != 1 || !arrow.TypeEqual(schema.Field(i[0]).Type, arrow.ListOf(arrow.PrimitiveTypes.Float64)) {
+		t.Errorf("BidPriceList field=%v", schema.FieldIndices("BidPriceList"))
+	}
+	if i := schema.FieldIndices("UpdateTimestamp"); len(i) != 1 || schema.Field(i[0]).Type.ID() != arrow.TIMESTAMP {
+		t.Errorf("UpdateTimestamp field missing or not timestamp")
+	}
+	if i := schema.Metadata().FindKey(constdef.ParquetMetaSchemaVersion); i < 0 {
+		t.Errorf("schema metadata=%v", schema.Metadata())
+	}
+
+	if fr.NumRecords() != 1 {
+		t.Fatalf("NumRecords=%d", fr.NumRecords())
+	}
+	record, err := fr.Record(0)
+	if err != nil {
+		t.Fatalf("Record(0) error: %v", err)
+	}
+	if record.NumRows() != 2 {
+		t.Fatalf("NumRows=%d", record.NumRows())
+	}
+	bidPriceList := record.Column(schema.FieldIndices("BidPriceList")[0]).(*array.List)
+	values := bidPriceList.ListValues().(*array.Float64)
+	offsets := bidPriceList.Offsets()
+	if offsets[1] != 2 || offsets[2] != 3 || values.Value(2) != 8.0 {
+		t.Errorf("offsets=%v values=%v", offsets, values.Float64Values())
+	}
+	instrumentId := record.Column(schema.FieldIndices("InstrumentId")[0]).(*array.String)
+	if instrumentId.Value(1) != "000001.SZ" {
+		t.Errorf("InstrumentId[1]=%s", instrumentId.Value(1))
+	}
+}
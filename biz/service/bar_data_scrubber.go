@@ -0,0 +1,311 @@
+package service
+
+import (
+	"data-scrubber/biz/constdef"
+	"data-scrubber/biz/errorx"
+	"data-scrubber/biz/layout"
+	"data-scrubber/biz/model"
+	"data-scrubber/config"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	logger "github.com/2997215859/golog"
+)
+
+// ParseBarInterval 解析 K 线周期，如 "1s"/"1m"/"5m"，必须是整秒且不小于 1s
+func ParseBarInterval(interval string) (time.Duration, error) {
+	d, err := time.ParseDuration(interval)
+	if err != nil {
+		return 0, errorx.NewError("bar interval(%s) is invalid: %v", interval, err)
+	}
+	if d < time.Second || d%time.Second != 0 {
+		return 0, errorx.NewError("bar interval(%s) must be whole seconds and >= 1s", interval)
+	}
+	return d, nil
+}
+
+// barSlot 一根 bar 在时段网格中的位置
+type barSlot struct {
+	session   *TradingSession
+	timestamp int64
+}
+
+// getBarSlotList 按时段和周期生成当天完整的 bar 网格
+func getBarSlotList(sessionList []*TradingSession, interval time.Duration) []*barSlot {
+	res := make([]*barSlot, 0)
+	for _, session := range sessionList {
+		if session.Single {
+			res = append(res, &barSlot{session: session, timestamp: session.BeginTimestamp})
+			continue
+		}
+		for ts := session.BeginTimestamp; ts < session.EndTimestamp; ts += int64(interval) {
+			res = append(res, &barSlot{session: session, timestamp: ts})
+		}
+	}
+	return res
+}
+
+// getBarTimestamp 计算成交所在 bar 的起始时间
+func getBarTimestamp(session *TradingSession, interval time.Duration, tradeTimestamp int64) int64 {
+	if session.Single {
+		return session.BeginTimestamp
+	}
+	offset := (tradeTimestamp - session.BeginTimestamp) / int64(interval) * int64(interval)
+	barTimestamp := session.BeginTimestamp + offset
+	// 落在时段结束时刻的成交（如 11:30:00.000）归入最后一根 bar
+	if barTimestamp >= session.EndTimestamp {
+		barTimestamp -= int64(interval)
+	}
+	return barTimestamp
+}
+
+// BuildBarList 将单个票的逐笔成交聚合为 K 线
+// tradeList 需为同一个票的成交；fillMode 决定无成交区间的处理方式，见 constdef.BarFill*
+func BuildBarList(instrumentId string, tradeList []*model.Trade, sessionList []*TradingSession, interval string, fillMode string) ([]*model.Bar, error) {
+	d, err := ParseBarInterval(interval)
+	if err != nil {
+		return nil, err
+	}
+
+	// 按交易所时间排序，同一时刻保持原有（接收）顺序
+	sorted := make([]*model.Trade, 0, len(tradeList))
+	for _, v := range tradeList {
+		if v != nil {
+			sorted = append(sorted, v)
+		}
+	}
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].TradeTimestamp < sorted[j].TradeTimestamp
+	})
+
+	mapBar := make(map[int64]*model.Bar)
+	outOfSession := 0
+	for _, trade := range sorted {
+		session := FindTradingSession(sessionList, trade.TradeTimestamp)
+		if session == nil {
+			outOfSession++
+			continue
+		}
+
+		barTimestamp := getBarTimestamp(session, d, trade.TradeTimestamp)
+		bar, ok := mapBar[barTimestamp]
+		if !ok {
+			bar = &model.Bar{
+				InstrumentId: instrumentId,
+				BarTimestamp: barTimestamp,
+				Interval:     interval,
+				Phase:        session.Phase,
+				Open:         trade.Price,
+				High:         trade.Price,
+				Low:          trade.Price,
+				OpenE4:       trade.PriceE4,
+				HighE4:       trade.PriceE4,
+				LowE4:        trade.PriceE4,
+			}
+			mapBar[barTimestamp] = bar
+		}
+
+		if trade.Price > bar.High {
+			bar.High, bar.HighE4 = trade.Price, trade.PriceE4
+		}
+		if trade.Price < bar.Low {
+			bar.Low, bar.LowE4 = trade.Price, trade.PriceE4
+		}
+		bar.Close, bar.CloseE4 = trade.Price, trade.PriceE4
+		bar.Volume += trade.Volume
+		bar.Turnover += trade.Turnover
+		bar.TradeCount++
+		switch trade.Direction {
+		case constdef.DirectionBuy:
+			bar.BuyVolume += trade.Volume
+		case constdef.DirectionSell:
+			bar.SellVolume += trade.Volume
+		}
+	}
+
+	if outOfSession > 0 {
+		logger.Warn("BuildBarList(%s) %d trades out of trading session, skipped", instrumentId, outOfSession)
+	}
+
+	res := make([]*model.Bar, 0, len(mapBar))
+	lastClose := 0.0
+	lastCloseE4 := int64(0)
+	hasTrade := false
+	for _, slot := range getBarSlotList(sessionList, d) {
+		bar, ok := mapBar[slot.timestamp]
+		if ok {
+			if bar.Volume > 0 {
+				bar.Vwap = bar.Turnover / float64(bar.Volume)
+			}
+			lastClose, lastCloseE4 = bar.Close, bar.CloseE4
+			hasTrade = true
+			res = append(res, bar)
+			continue
+		}
+
+		switch fillMode {
+		case constdef.BarFillNone:
+			continue
+		case constdef.BarFillForward:
+			// 第一笔成交之前没有可沿用的价格，不输出
+			if !hasTrade {
+				continue
+			}
+			res = append(res, &model.Bar{
+				InstrumentId: instrumentId,
+				BarTimestamp: slot.timestamp,
+				Interval:     interval,
+				Phase:        slot.session.Phase,
+				Open:         lastClose,
+				High:         lastClose,
+				Low:          lastClose,
+				Close:        lastClose,
+				Vwap:         lastClose,
+				OpenE4:       lastCloseE4,
+				HighE4:       lastCloseE4,
+				LowE4:        lastCloseE4,
+				CloseE4:      lastCloseE4,
+			})
+		default:
+			res = append(res, &model.Bar{
+				InstrumentId: instrumentId,
+				BarTimestamp: slot.timestamp,
+				Interval:     interval,
+				Phase:        slot.session.Phase,
+			})
+		}
+	}
+
+	return res, nil
+}
+
+// ==== 合并 bar
+
+func MergeRawBar(day *DayContext, dstDir string) error {
+	date := day.Date
+	barDir := getBarDir(dstDir, constdef.DataTypeBar, date)
+
+	intervalList := config.Cfg.GetBarIntervalList()
+	for _, interval := range intervalList {
+		if _, err := ParseBarInterval(interval); err != nil {
+			return err
+		}
+	}
+	fillMode := config.Cfg.GetBarFillMode()
+
+	tradeList, err := ReadRawTradeList(day)
+	if err != nil {
+		return err
+	}
+	tradeMap := GetMapTrade(tradeList)
+	sourceFileList := day.GetSourceFileList(constdef.DataTypeTrade)
+
+	// 拿不到复权比例时只写原始 bar
+	ratioMap, adjust := adjustRatioMap(constdef.DataTypeBar, date)
+
+	for _, interval := range intervalList {
+		barMap := make(map[string][]*model.Bar, len(tradeMap))
+		for instrumentId, list := range tradeMap {
+			sessionList, err := GetTradingSessionList(instrumentId, date)
+			if err != nil {
+				return err
+			}
+			barList, err := BuildBarList(instrumentId, list, sessionList, interval, fillMode)
+			if err != nil {
+				return err
+			}
+			barMap[instrumentId] = barList
+		}
+		logger.Info("Build Bar(%s) End, instrument count=%d", interval, len(barMap))
+
+		if err := writeBarMap(barDir, date, interval, barMap, sourceFileList); err != nil {
+			return err
+		}
+		if adjust {
+			adjustDataType := GetAdjustDataType(constdef.DataTypeBar)
+			logger.Info("Write %s(%s) Begin", adjustDataType, interval)
+			if err := writeBarMap(getBarDir(dstDir, adjustDataType, date), date, interval, AdjustBarMap(date, barMap, ratioMap), sourceFileList); err != nil {
+				return err
+			}
+			logger.Info("Write %s(%s) End", adjustDataType, interval)
+		}
+	}
+
+	return nil
+}
+
+// getBarDir 原始 bar 和复权 bar（bar_qfq 等）的输出目录
+func getBarDir(dstDir string, dataType string, date string) string {
+	if config.Cfg.IsPerDay() || config.Cfg.IsHiveLayout() {
+		return filepath.Join(dstDir, dataType)
+	}
+	return filepath.Join(dstDir, dataType, date)
+}
+
+// writeBarMap 按 output_layout / output_mode 写某个周期的 bar
+func writeBarMap(dstDir string, date string, interval string, barMap map[string][]*model.Bar, sourceFileList []string) error {
+	if config.Cfg.IsHiveLayout() {
+		// 不同周期放在 interval= 分区下，避免同一个 date 分区里混着多种周期
+		logger.Info("Write HiveBar(%s).parquet Begin", interval)
+		typeDir := filepath.Join(dstDir, fmt.Sprintf("interval=%s", interval))
+		if err := WriteHiveParquet(typeDir, date, flattenInstrumentMap(barMap), sourceFileList, func(v *model.Bar) string { return v.InstrumentId },
+			func(v *model.Bar) int64 { return v.BarTimestamp }); err != nil {
+			return errorx.NewError("WriteHiveParquet(%s) date(%s) error: %v", typeDir, date, err)
+		}
+		logger.Info("Write HiveBar(%s).parquet End", interval)
+	} else if config.Cfg.IsPerDay() {
+		logger.Info("Write AllBar(%s).parquet Begin", interval)
+		if err := WriteAllBarParquet(dstDir, date, interval, barMap, sourceFileList); err != nil {
+			return errorx.NewError("WriteAllBarParquet(%s) date(%s) error: %v", dstDir, date, err)
+		}
+		logger.Info("Write AllBar(%s).parquet End", interval)
+	} else {
+		logger.Info("Write StockBar(%s).parquet Begin", interval)
+		if err := WriteStockBarParquet(dstDir, date, interval, barMap, sourceFileList); err != nil {
+			return errorx.NewError("WriteStockBarParquet(%s) date(%s) error: %v", dstDir, date, err)
+		}
+		logger.Info("Write StockBar(%s).parquet End", interval)
+	}
+	return nil
+}
+
+func WriteAllBarParquet(dstDir string, date string, interval string, mapBar map[string][]*model.Bar, sourceFileList []string) error {
+	if err := os.MkdirAll(dstDir, 0755); err != nil {
+		return errorx.NewError("MkdirAll(%s) error: %v", dstDir, err)
+	}
+
+	list := make([]*model.Bar, 0)
+	for _, barList := range mapBar {
+		list = append(list, barList...)
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		if list[i].BarTimestamp != list[j].BarTimestamp {
+			return list[i].BarTimestamp < list[j].BarTimestamp
+		}
+		return list[i].InstrumentId < list[j].InstrumentId
+	})
+
+	filePath := filepath.Join(dstDir, layout.GetPerDayFileName(date, constdef.DataTypeBar+"_"+interval))
+	if config.Cfg.IsPerDayClustered() {
+		return WriteClusteredOutputFile(filePath, list, sourceFileList, func(v *model.Bar) string { return v.InstrumentId },
+			func(v *model.Bar) int64 { return v.BarTimestamp })
+	}
+	return WriteOutputFile(filePath, list, sourceFileList)
+}
+
+func WriteStockBarParquet(dstDir string, date string, interval string, mapBar map[string][]*model.Bar, sourceFileList []string) error {
+	if err := os.MkdirAll(dstDir, 0755); err != nil {
+		return errorx.NewError("MkdirAll(%s) error: %v", dstDir, err)
+	}
+
+	for instrumentId, barList := range mapBar {
+		filePath := filepath.Join(dstDir, layout.GetPerStockFileName(date, constdef.DataTypeBar+"_"+interval, instrumentId))
+		if err := WriteOutputFile(filePath, barList, sourceFileList); err != nil {
+			return err
+		}
+	}
+	return nil
+}
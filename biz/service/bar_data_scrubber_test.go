@@ -0,0 +1,142 @@
+package service
+
+import (
+	"data-scrubber/biz/constdef"
+	"data-scrubber/biz/model"
+	"data-scrubber/biz/utils"
+	"testing"
+)
+
+func mustTimeToNano(t *testing.T, date string, timeStr string) int64 {
+	t.Helper()
+	ts, err := utils.TimeToNano(date, timeStr)
+	if err != nil {
+		t.Fatalf("TimeToNano(%s %s) error: %v", date, timeStr, err)
+	}
+	return ts
+}
+
+func TestBuildBarList(t *testing.T) {
+	date := "20240115"
+	instrumentId := "600000.SH"
+	newTrade := func(timeStr string, price float64, volume int64, direction string) *model.Trade {
+		return &model.Trade{
+			InstrumentId:   instrumentId,
+			TradeTimestamp: mustTimeToNano(t, date, timeStr),
+			Price:          price,
+			Volume:         volume,
+			Turnover:       price * float64(volume),
+			Direction:      direction,
+		}
+	}
+	tradeList := []*model.Trade{
+		newTrade("09:25:00.000", 10.00, 1000, constdef.DirectionUnknown),
+		newTrade("09:30:00.000", 10.01, 100, constdef.DirectionBuy),
+		newTrade("09:30:59.990", 10.03, 300, constdef.DirectionBuy),
+		newTrade("09:30:10.000", 9.99, 200, constdef.DirectionSell),
+		newTrade("09:32:00.000", 10.05, 100, constdef.DirectionBuy),
+		newTrade("11:30:00.000", 10.10, 100, constdef.DirectionSell),
+		newTrade("15:00:00.000", 10.20, 500, constdef.DirectionUnknown),
+		newTrade("12:00:00.000", 10.20, 500, constdef.DirectionUnknown), // 午休，不计入
+	}
+
+	sessionList, err := GetTradingSessionList(instrumentId, date)
+	if err != nil {
+		t.Fatalf("GetTradingSessionList error: %v", err)
+	}
+
+	barList, err := BuildBarList(instrumentId, tradeList, sessionList, "1m", constdef.BarFillNone)
+	if err != nil {
+		t.Fatalf("BuildBarList error: %v", err)
+	}
+	if len(barList) != 5 {
+		t.Fatalf("bar count=%d, want 5", len(barList))
+	}
+
+	auction := barList[0]
+	if auction.Phase != constdef.TradingPhaseOpenAuction || auction.Volume != 1000 {
+		t.Errorf("open auction bar=%+v", auction)
+	}
+
+	first := barList[1]
+	if first.BarTimestamp != mustTimeToNano(t, date, "09:30:00.000") {
+		t.Errorf("first continuous bar timestamp=%d", first.BarTimestamp)
+	}
+	if first.Open != 10.01 || first.High != 10.03 || first.Low != 9.99 || first.Close != 10.03 {
+		t.Errorf("first continuous bar OHLC=%v/%v/%v/%v", first.Open, first.High, first.Low, first.Close)
+	}
+	if first.Volume != 600 || first.TradeCount != 3 || first.BuyVolume != 400 || first.SellVolume != 200 {
+		t.Errorf("first continuous bar volume=%+v", first)
+	}
+	if first.Vwap != first.Turnover/600 {
+		t.Errorf("first continuous bar Vwap=%v", first.Vwap)
+	}
+
+	// 11:30:00.000 的成交归入上午最后一根 bar
+	if barList[3].BarTimestamp != mustTimeToNano(t, date, "11:29:00.000") {
+		t.Errorf("11:30 trade bar timestamp=%s", utils.NsToTimeString(barList[3].BarTimestamp))
+	}
+
+	closing := barList[4]
+	if closing.Phase != constdef.TradingPhaseCloseAuction || closing.BarTimestamp != mustTimeToNano(t, date, "14:57:00.000") {
+		t.Errorf("close auction bar=%+v", closing)
+	}
+}
+
+func TestBuildBarList_Fill(t *testing.T) {
+	date := "20240115"
+	instrumentId := "000001.SZ"
+	tradeList := []*model.Trade{
+		{InstrumentId: instrumentId, TradeTimestamp: mustTimeToNano(t, date, "09:30:01.000"), Price: 9.5, Volume: 100, Turnover: 950},
+	}
+	sessionList, err := GetTradingSessionList(instrumentId, date)
+	if err != nil {
+		t.Fatalf("GetTradingSessionList error: %v", err)
+	}
+
+	// 开盘集合竞价 1 + 上午 120 + 下午 117 + 收盘集合竞价 1
+	emptyList, err := BuildBarList(instrumentId, tradeList, sessionList, "1m", constdef.BarFillEmpty)
+	if err != nil {
+		t.Fatalf("BuildBarList error: %v", err)
+	}
+	if len(emptyList) != 239 {
+		t.Fatalf("empty fill bar count=%d, want 239", len(emptyList))
+	}
+	if emptyList[2].Close != 0 || emptyList[2].Volume != 0 {
+		t.Errorf("empty bar=%+v", emptyList[2])
+	}
+
+	forwardList, err := BuildBarList(instrumentId, tradeList, sessionList, "1m", constdef.BarFillForward)
+	if err != nil {
+		t.Fatalf("BuildBarList error: %v", err)
+	}
+	// 第一笔成交之前的开盘集合竞价不输出
+	if len(forwardList) != 238 || forwardList[0].BarTimestamp != mustTimeToNano(t, date, "09:30:00.000") {
+		t.Fatalf("forward fill bar count=%d, first=%+v", len(forwardList), forwardList[0])
+	}
+	if forwardList[2].Close != 9.5 || forwardList[len(forwardList)-1].Close != 9.5 {
+		t.Errorf("forward fill Close=%v/%v, want 9.5", forwardList[2].Close, forwardList[len(forwardList)-1].Close)
+	}
+}
+
+func TestGetTradingSessionList_StarAfterHours(t *testing.T) {
+	sessionList, err := GetTradingSessionList("688001.SH", "20240115")
+	if err != nil {
+		t.Fatalf("GetTradingSessionList error: %v", err)
+	}
+	last := sessionList[len(sessionList)-1]
+	if last.Phase != constdef.TradingPhaseAfterHours {
+		t.Errorf("last phase=%s, want %s", last.Phase, constdef.TradingPhaseAfterHours)
+	}
+
+	// 20180820 之前沪市没有收盘集合竞价
+	sessionList, err = GetTradingSessionList("600000.SH", "20180817")
+	if err != nil {
+		t.Fatalf("GetTradingSessionList error: %v", err)
+	}
+	for _, v := range sessionList {
+		if v.Phase == constdef.TradingPhaseCloseAuction {
+			t.Errorf("unexpected close auction before 20180820")
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package service
+
+import (
+	"data-scrubber/biz/errorx"
+	"data-scrubber/biz/layout"
+	"data-scrubber/biz/model"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+
+	logger "github.com/2997215859/golog"
+)
+
+// per_day_clustered：所有票写在一个文件里，但按 (InstrumentId, 时间) 排序，每个票写完就强制切一个行组，
+// 行组的 min/max 统计和 sidecar 索引都能把读取范围缩小到单个票，读单票的代价接近 per_stock 文件
+
+// WriteClusteredOutputFile 按票聚簇写入 filePath，并写出 sidecar 索引
+// 单个票超过 row_group_size 时会被切成多个行组，索引记录的是行组范围；arrow 格式下行组即 record batch
+func WriteClusteredOutputFile[T any](filePath string, list []*T, sourceFileList []string, instrumentId func(v *T) string, timestamp func(v *T) int64) error {
+	sortedList := make([]*T, 0, len(list))
+	for _, v := range list {
+		if v != nil {
+			sortedList = append(sortedList, v)
+		}
+	}
+	sort.SliceStable(sortedList, func(i, j int) bool {
+		if instrumentId(sortedList[i]) != instrumentId(sortedList[j]) {
+			return instrumentId(sortedList[i]) < instrumentId(sortedList[j])
+		}
+		return timestamp(sortedList[i]) < timestamp(sortedList[j])
+	})
+
+	pw, err := NewOutputWriter(filePath, new(T), sourceFileList)
+	if err != nil {
+		return errorx.NewError("NewOutputWriter(%s) error: %s", filePath, err)
+	}
+
+	index := &model.ClusteredIndex{
+		FileName:       filepath.Base(GetOutputFilePath(filePath)),
+		InstrumentList: make([]*model.ClusteredIndexEntry, 0),
+	}
+	for begin := 0; begin < len(sortedList); {
+		id := instrumentId(sortedList[begin])
+		end := begin
+		for end < len(sortedList) && instrumentId(sortedList[end]) == id {
+			end++
+		}
+
+		entry := &model.ClusteredIndexEntry{
+			InstrumentId:  id,
+			RowGroupBegin: pw.RowGroupCount(),
+			RowBegin:      index.RowCount,
+			RowCount:      int64(end - begin),
+		}
+		for _, v := range sortedList[begin:end] {
+			if err := pw.Write(v); err != nil {
+				logger.Error("WriteClusteredOutputFile(%s) error: %v", filePath, err)
+			}
+		}
+		rowGroupCount, err := pw.FlushRowGroup()
+		if err != nil {
+			_ = pw.Close()
+			return errorx.NewError("FlushRowGroup(%s) instrument(%s) error: %v", filePath, id, err)
+		}
+		entry.RowGroupEnd = rowGroupCount
+
+		index.InstrumentList = append(index.InstrumentList, entry)
+		index.RowCount += entry.RowCount
+		index.RowGroupCount = rowGroupCount
+		begin = end
+	}
+
+	if err := pw.Close(); err != nil {
+		return errorx.NewError("close output(%s) error: %v", filePath, err)
+	}
+
+	data, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return errorx.NewError("json.Marshal ClusteredIndex error: %v", err)
+	}
+	indexPath := layout.GetClusteredIndexPath(GetOutputFilePath(filePath))
+	if err := os.WriteFile(indexPath, data, 0644); err != nil {
+		return errorx.NewError("WriteFile(%s) error: %v", indexPath, err)
+	}
+	return nil
+}
+
+// ReadClusteredIndex 读取 sidecar 索引，filePath 为实际的输出文件路径
+func ReadClusteredIndex(filePath string) (*model.ClusteredIndex, error) {
+	indexPath := layout.GetClusteredIndexPath(filePath)
+	data, err := os.ReadFile(indexPath)
+	if err != nil {
+		return nil, errorx.NewError("ReadFile(%s) error: %v", indexPath, err)
+	}
+	index := &model.ClusteredIndex{}
+	if err := json.Unmarshal(data, index); err != nil {
+		return nil, errorx.NewError("json.Unmarshal(%s) error: %v", indexPath, err)
+	}
+	return index, nil
+}
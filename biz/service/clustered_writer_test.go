@@ -0,0 +1,72 @@
+package service
+
+import (
+	"data-scrubber/biz/model"
+	"path/filepath"
+	"testing"
+
+	"github.com/xitongsys/parquet-go-source/local"
+	"github.com/xitongsys/parquet-go/reader"
+)
+
+func TestWriteClusteredOutputFile(t *testing.T) {
+	// 按时间交错的三只票
+	tradeList := []*model.Trade{
+		{InstrumentId: "600000.SH", TradeTimestamp: 3},
+		{InstrumentId: "000001.SZ", TradeTimestamp: 1},
+		{InstrumentId: "600000.SH", TradeTimestamp: 1},
+		{InstrumentId: "000002.SZ", TradeTimestamp: 2},
+		{InstrumentId: "000001.SZ", TradeTimestamp: 2},
+	}
+	filePath := filepath.Join(t.TempDir(), "20240115_trade.parquet")
+	err := WriteClusteredOutputFile(filePath, tradeList, nil, func(v *model.Trade) string { return v.InstrumentId },
+		func(v *model.Trade) int64 { return v.TradeTimestamp })
+	if err != nil {
+		t.Fatalf("WriteClusteredOutputFile error: %v", err)
+	}
+
+	index, err := ReadClusteredIndex(filePath)
+	if err != nil {
+		t.Fatalf("ReadClusteredIndex error: %v", err)
+	}
+	if index.RowCount != 5 || index.RowGroupCount != 3 || len(index.InstrumentList) != 3 {
+		t.Fatalf("index=%+v", index)
+	}
+	want := []model.ClusteredIndexEntry{
+		{InstrumentId: "000001.SZ", RowGroupBegin: 0, RowGroupEnd: 1, RowBegin: 0, RowCount: 2},
+		{InstrumentId: "000002.SZ", RowGroupBegin: 1, RowGroupEnd: 2, RowBegin: 2, RowCount: 1},
+		{InstrumentId: "600000.SH", RowGroupBegin: 2, RowGroupEnd: 3, RowBegin: 3, RowCount: 2},
+	}
+	for i, v := range index.InstrumentList {
+		if *v != want[i] {
+			t.Errorf("InstrumentList[%d]=%+v, 期望 %+v", i, *v, want[i])
+		}
+	}
+
+	fr, err := local.NewLocalFileReader(filePath)
+	if err != nil {
+		t.Fatalf("NewLocalFileReader error: %v", err)
+	}
+	defer fr.Close()
+	pr, err := reader.NewParquetReader(fr, new(model.Trade), 1)
+	if err != nil {
+		t.Fatalf("NewParquetReader error: %v", err)
+	}
+	defer pr.ReadStop()
+
+	// 每个行组只有一个票，InstrumentId 的 min/max 统计相同
+	for i, rowGroup := range pr.Footer.RowGroups {
+		statistics := rowGroup.Columns[0].MetaData.Statistics
+		if statistics == nil || string(statistics.MinValue) != want[i].InstrumentId || string(statistics.MaxValue) != want[i].InstrumentId {
+			t.Errorf("RowGroups[%d] statistics=%+v", i, statistics)
+		}
+	}
+
+	rowList := make([]model.Trade, 5)
+	if err := pr.Read(&rowList); err != nil {
+		t.Fatalf("Read error: %v", err)
+	}
+	if rowList[3].InstrumentId != "600000.SH" || rowList[3].TradeTimestamp != 1 || rowList[4].TradeTimestamp != 3 {
+		t.Errorf("rowList=%+v", rowList)
+	}
+}
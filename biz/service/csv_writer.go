@@ -0,0 +1,259 @@
+package service
+
+import (
+	"compress/gzip"
+	"data-scrubber/biz/errorx"
+	"data-scrubber/biz/utils"
+	"data-scrubber/config"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// CsvGzWriter 把 model 结构体写成 gzip 压缩的 CSV，列名取自 parquet tag
+// 列表列展开成固定宽度的多列：BidPriceList -> BidPrice1..BidPrice10，不足的档位补 0
+// NewCsvStreamWriter 创建的写入器不压缩，直接写到调用方的 io.Writer
+type CsvGzWriter struct {
+	file      *os.File     // stream 写入器为 nil
+	gzWriter  *gzip.Writer // stream 写入器为 nil
+	csvWriter *csv.Writer
+
+	columnList []csvColumn
+	record     []string
+
+	pendingCount int // 上次 FlushRowGroup 之后写入的行数
+	flushCount   int
+}
+
+type csvColumn struct {
+	index  int
+	append func(record []string, v reflect.Value) []string
+}
+
+// 列表列展开的宽度，未列出的按 10 档
+const csvDefaultListWidth = 10
+
+var csvListWidthMap = map[string]int{
+	"OrderQtyList": 50, // 委托队列最多揭示 50 笔
+}
+
+// getCsvListWidth schema profile 投影后的盘口列带 listwidth tag，优先使用
+func getCsvListWidth(f reflect.StructField, name string) int {
+	if width, err := strconv.Atoi(f.Tag.Get(listWidthTag)); err == nil && width > 0 {
+		return width
+	}
+	if width, ok := csvListWidthMap[name]; ok {
+		return width
+	}
+	return csvDefaultListWidth
+}
+
+func formatCsvFloat(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+// getCsvColumn 返回字段对应的表头和追加函数
+func getCsvColumn(f reflect.StructField, timestampEncoding string) ([]string, func(record []string, v reflect.Value) []string, error) {
+	name := getParquetColumnName(f)
+	switch f.Type.Kind() {
+	case reflect.String:
+		return []string{name}, func(record []string, v reflect.Value) []string {
+			return append(record, v.String())
+		}, nil
+	case reflect.Bool:
+		return []string{name}, func(record []string, v reflect.Value) []string {
+			return append(record, strconv.FormatBool(v.Bool()))
+		}, nil
+	case reflect.Int, reflect.Int32, reflect.Int64:
+		if f.Type.Kind() == reflect.Int64 && strings.HasSuffix(f.Name, timestampFieldSuffix) {
+			return []string{name}, func(record []string, v reflect.Value) []string {
+				return append(record, strconv.FormatInt(utils.EncodeTimestamp(v.Int(), timestampEncoding), 10))
+			}, nil
+		}
+		return []string{name}, func(record []string, v reflect.Value) []string {
+			return append(record, strconv.FormatInt(v.Int(), 10))
+		}, nil
+	case reflect.Float64:
+		return []string{name}, func(record []string, v reflect.Value) []string {
+			return append(record, formatCsvFloat(v.Float()))
+		}, nil
+	case reflect.Slice:
+		width := getCsvListWidth(f, name)
+		prefix := strings.TrimSuffix(name, "List")
+		headerList := make([]string, 0, width)
+		for i := 1; i <= width; i++ {
+			headerList = append(headerList, fmt.Sprintf("%s%d", prefix, i))
+		}
+		switch f.Type.Elem().Kind() {
+		case reflect.Float64:
+			return headerList, func(record []string, v reflect.Value) []string {
+				for i := 0; i < width; i++ {
+					if i < v.Len() {
+						record = append(record, formatCsvFloat(v.Index(i).Float()))
+					} else {
+						record = append(record, "0")
+					}
+				}
+				return record
+			}, nil
+		case reflect.Int64:
+			return headerList, func(record []string, v reflect.Value) []string {
+				for i := 0; i < width; i++ {
+					if i < v.Len() {
+						record = append(record, strconv.FormatInt(v.Index(i).Int(), 10))
+					} else {
+						record = append(record, "0")
+					}
+				}
+				return record
+			}, nil
+		}
+	}
+	return nil, nil, errorx.NewError("field(%s) type(%s) not supported by csv writer", f.Name, f.Type)
+}
+
+// newCsvColumnList 按 model 结构体生成表头和各列的追加函数，schema 为 model 结构体指针
+func newCsvColumnList(schema interface{}) ([]string, []csvColumn, error) {
+	t := structType(reflect.TypeOf(schema))
+	if t == nil {
+		return nil, nil, errorx.NewError("csv schema(%T) is not a struct", schema)
+	}
+
+	timestampEncoding := config.Cfg.GetTimestampEncoding()
+	headerList := make([]string, 0, t.NumField())
+	columnList := make([]csvColumn, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		if !isColumnField(t.Field(i)) {
+			continue
+		}
+		header, appendFunc, err := getCsvColumn(t.Field(i), timestampEncoding)
+		if err != nil {
+			return nil, nil, err
+		}
+		headerList = append(headerList, header...)
+		columnList = append(columnList, csvColumn{index: i, append: appendFunc})
+	}
+	return headerList, columnList, nil
+}
+
+// NewCsvGzWriter 创建 csv.gz 写入器，已存在的文件会被截断；schema 为 model 结构体指针
+func NewCsvGzWriter(filePath string, schema interface{}) (*CsvGzWriter, error) {
+	headerList, columnList, err := newCsvColumnList(schema)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.OpenFile(filePath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return nil, errorx.NewError("open file(%s): %v", filePath, err)
+	}
+	gzWriter := gzip.NewWriter(file)
+	csvWriter := csv.NewWriter(gzWriter)
+	if err := csvWriter.Write(headerList); err != nil {
+		_ = file.Close()
+		return nil, errorx.NewError("write csv header(%s) error: %v", filePath, err)
+	}
+
+	return &CsvGzWriter{
+		file:       file,
+		gzWriter:   gzWriter,
+		csvWriter:  csvWriter,
+		columnList: columnList,
+		record:     make([]string, 0, len(headerList)),
+	}, nil
+}
+
+// NewCsvStreamWriter 创建不压缩的 CSV 写入器，列和 csv.gz 文件一致；Close 只写出缓冲，不关闭 w
+func NewCsvStreamWriter(w io.Writer, schema interface{}) (*CsvGzWriter, error) {
+	headerList, columnList, err := newCsvColumnList(schema)
+	if err != nil {
+		return nil, err
+	}
+	csvWriter := csv.NewWriter(w)
+	if err := csvWriter.Write(headerList); err != nil {
+		return nil, errorx.NewError("write csv header error: %v", err)
+	}
+	return &CsvGzWriter{
+		csvWriter:  csvWriter,
+		columnList: columnList,
+		record:     make([]string, 0, len(headerList)),
+	}, nil
+}
+
+// Write 写入单行
+func (cw *CsvGzWriter) Write(row interface{}) error {
+	rv := reflect.ValueOf(row)
+	for rv.Kind() == reflect.Pointer {
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return errorx.NewError("csv row(%T) is not a struct", row)
+	}
+
+	cw.record = cw.record[:0]
+	for _, column := range cw.columnList {
+		cw.record = column.append(cw.record, rv.Field(column.index))
+	}
+	cw.pendingCount++
+	return cw.csvWriter.Write(cw.record)
+}
+
+// FlushRowGroup CSV 没有行组，只把缓冲写出并计数，方便 per_day_clustered 索引和其他格式保持一致
+func (cw *CsvGzWriter) FlushRowGroup() (int, error) {
+	if cw.pendingCount == 0 {
+		return cw.flushCount, nil
+	}
+	cw.csvWriter.Flush()
+	if err := cw.csvWriter.Error(); err != nil {
+		return cw.flushCount, errorx.NewError("csv flush error: %v", err)
+	}
+	cw.pendingCount = 0
+	cw.flushCount++
+	return cw.flushCount, nil
+}
+
+func (cw *CsvGzWriter) RowGroupCount() int {
+	return cw.flushCount
+}
+
+// Close 依次关闭 csv、gzip 和文件，任何一步出错都返回
+func (cw *CsvGzWriter) Close() error {
+	cw.csvWriter.Flush()
+	if cw.file == nil {
+		if err := cw.csvWriter.Error(); err != nil {
+			return errorx.NewError("csv flush error: %v", err)
+		}
+		return nil
+	}
+	if err := cw.csvWriter.Error(); err != nil {
+		_ = cw.file.Close()
+		return errorx.NewError("csv flush error: %v", err)
+	}
+	if err := cw.gzWriter.Close(); err != nil {
+		_ = cw.file.Close()
+		return errorx.NewError("gzip close error: %v", err)
+	}
+	return cw.file.Close()
+}
+
+// WriteCsvGzFile 不看 output_format，直接把 list 写成 csv.gz
+func WriteCsvGzFile[T any](filePath string, list []*T) error {
+	cw, err := NewCsvGzWriter(filePath, new(T))
+	if err != nil {
+		return err
+	}
+	for _, v := range list {
+		if v == nil {
+			continue
+		}
+		if err := cw.Write(v); err != nil {
+			_ = cw.Close()
+			return errorx.NewError("filePath(%s) write csv error: %v", filePath, err)
+		}
+	}
+	return cw.Close()
+}
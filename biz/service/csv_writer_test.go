@@ -0,0 +1,71 @@
+package service
+
+import (
+	"compress/gzip"
+	"data-scrubber/biz/constdef"
+	"data-scrubber/biz/model"
+	"data-scrubber/biz/utils"
+	"data-scrubber/config"
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func readCsvGz(t *testing.T, filePath string) [][]string {
+	f, err := os.Open(filePath)
+	if err != nil {
+		t.Fatalf("open(%s) error: %v", filePath, err)
+	}
+	defer f.Close()
+	gzReader, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatalf("gzip.NewReader(%s) error: %v", filePath, err)
+	}
+	recordList, err := csv.NewReader(gzReader).ReadAll()
+	if err != nil {
+		t.Fatalf("csv ReadAll(%s) error: %v", filePath, err)
+	}
+	return recordList
+}
+
+func TestCsvGzWriter(t *testing.T) {
+	oldCfg := config.Cfg
+	defer func() { config.Cfg = oldCfg }()
+	config.Cfg = &config.Config{OutputFormat: constdef.OutputFormatBoth}
+
+	dir := t.TempDir()
+	snapshotList := []*model.Snapshot{
+		{InstrumentId: "600000.SH", UpdateTimestamp: 100, Last: 10.5, BidPriceList: []float64{10.4, 10.3}},
+		{InstrumentId: "600000.SH", UpdateTimestamp: 200, Last: 10.6, BidPriceList: []float64{10.5}},
+	}
+	// 先写一份更长的文件，再覆盖写，确认没有残留
+	longList := append(slices.Clone(snapshotList), snapshotList...)
+	if err := WriteSnapshotGz(dir, "20240115", map[string][]*model.Snapshot{"600000.SH": longList}); err != nil {
+		t.Fatalf("WriteSnapshotGz error: %v", err)
+	}
+	if err := WriteOutputFile(filepath.Join(dir, "20240115_snapshot_600000.SH.parquet"), snapshotList, nil); err != nil {
+		t.Fatalf("WriteOutputFile error: %v", err)
+	}
+	if !utils.Exists(filepath.Join(dir, "20240115_snapshot_600000.SH.parquet")) {
+		t.Errorf("both: parquet file not written")
+	}
+
+	recordList := readCsvGz(t, filepath.Join(dir, "20240115_snapshot_600000.SH.csv.gz"))
+	if len(recordList) != 3 {
+		t.Fatalf("len(recordList)=%d, 期望 3（表头 + 2 行）", len(recordList))
+	}
+	header := recordList[0]
+	bidPrice1 := slices.Index(header, "BidPrice1")
+	if bidPrice1 < 0 || header[bidPrice1+9] != "BidPrice10" || slices.Contains(header, "BidPriceList") {
+		t.Fatalf("header=%v", header)
+	}
+	if recordList[1][bidPrice1] != "10.4" || recordList[1][bidPrice1+1] != "10.3" || recordList[1][bidPrice1+2] != "0" {
+		t.Errorf("record=%v", recordList[1])
+	}
+	last := slices.Index(header, "Last")
+	if recordList[2][last] != "10.6" {
+		t.Errorf("record=%v", recordList[2])
+	}
+}
@@ -0,0 +1,266 @@
+package service
+
+import (
+	"data-scrubber/biz/constdef"
+	"data-scrubber/biz/errorx"
+	"data-scrubber/biz/layout"
+	"data-scrubber/biz/model"
+	"data-scrubber/biz/upstream/gotushare"
+	"data-scrubber/config"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+
+	logger "github.com/2997215859/golog"
+)
+
+// tushare daily 的 vol 单位为手，amount 单位为千元
+const (
+	tuShareVolumeUnit   = 100
+	tuShareTurnoverUnit = 1000
+)
+
+// 对账字段
+const (
+	ReconcileFieldOpen        = "open"
+	ReconcileFieldHigh        = "high"
+	ReconcileFieldLow         = "low"
+	ReconcileFieldClose       = "close"
+	ReconcileFieldPreClose    = "pre_close"
+	ReconcileFieldVolume      = "volume"
+	ReconcileFieldTurnover    = "turnover"
+	ReconcileFieldMissingTick = "missing_tick" // tushare 有日线但逐笔没有成交
+)
+
+// BuildDaily 汇总单个票当天的成交和快照
+// tradeList / snapshotList 均为同一个票的数据，任一为空时对应字段为 0
+func BuildDaily(instrumentId string, date string, tradeList []*model.Trade, snapshotList []*model.Snapshot) (*model.Daily, error) {
+	res := &model.Daily{
+		InstrumentId: instrumentId,
+		TradeDate:    date,
+	}
+
+	for _, v := range snapshotList {
+		if v == nil {
+			continue
+		}
+		if res.PreClose == 0 {
+			res.PreClose, res.PreCloseE4 = v.PreClose, v.PreCloseE4
+		}
+		res.SnapshotVolume = v.TradeVolume
+		res.SnapshotTurnover = v.TradeTurnover
+	}
+
+	if len(tradeList) == 0 {
+		return res, nil
+	}
+
+	sessionList, err := GetTradingSessionList(instrumentId, date)
+	if err != nil {
+		return nil, err
+	}
+
+	sorted := make([]*model.Trade, 0, len(tradeList))
+	for _, v := range tradeList {
+		if v != nil {
+			sorted = append(sorted, v)
+		}
+	}
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].TradeTimestamp < sorted[j].TradeTimestamp
+	})
+
+	var auctionOpen, auctionClose *model.Trade
+	for _, trade := range sorted {
+		session := FindTradingSession(sessionList, trade.TradeTimestamp)
+		if session != nil {
+			switch session.Phase {
+			case constdef.TradingPhaseAfterHours:
+				continue
+			case constdef.TradingPhaseOpenAuction:
+				auctionOpen = trade
+			case constdef.TradingPhaseCloseAuction:
+				auctionClose = trade
+			}
+		}
+
+		if res.TradeCount == 0 {
+			res.Open, res.OpenE4 = trade.Price, trade.PriceE4
+			res.High, res.HighE4 = trade.Price, trade.PriceE4
+			res.Low, res.LowE4 = trade.Price, trade.PriceE4
+		}
+		if trade.Price > res.High {
+			res.High, res.HighE4 = trade.Price, trade.PriceE4
+		}
+		if trade.Price < res.Low {
+			res.Low, res.LowE4 = trade.Price, trade.PriceE4
+		}
+		res.Close, res.CloseE4 = trade.Price, trade.PriceE4
+		res.Volume += trade.Volume
+		res.Turnover += trade.Turnover
+		res.TradeCount++
+	}
+
+	if auctionOpen != nil && auctionOpen.Price != 0 {
+		res.Open, res.OpenE4 = auctionOpen.Price, auctionOpen.PriceE4
+	}
+	if auctionClose != nil && auctionClose.Price != 0 {
+		res.Close, res.CloseE4 = auctionClose.Price, auctionClose.PriceE4
+	}
+	return res, nil
+}
+
+// ReconcileDaily 将逐笔汇总的日线与 tushare daily 对账，返回超出容差的差异
+// priceTolerance 为价格绝对误差，volumeTolerance 为成交量/额的相对误差
+// 全天停牌的票不参与对账；盘中停牌的票当天仍有成交，照常对账
+func ReconcileDaily(date string, dailyList []*model.Daily, tsList []*gotushare.QuotationData, priceTolerance float64, volumeTolerance float64) []*model.DailyReconcile {
+	mapDaily := make(map[string]*model.Daily, len(dailyList))
+	for _, v := range dailyList {
+		mapDaily[v.InstrumentId] = v
+	}
+
+	res := make([]*model.DailyReconcile, 0)
+	add := func(instrumentId string, field string, tickValue float64, tsValue float64) {
+		res = append(res, &model.DailyReconcile{
+			InstrumentId: instrumentId,
+			TradeDate:    date,
+			Field:        field,
+			TickValue:    tickValue,
+			TuShareValue: tsValue,
+			Diff:         tickValue - tsValue,
+		})
+	}
+	checkPrice := func(instrumentId string, field string, tickValue float64, tsValue float64) {
+		if math.Abs(tickValue-tsValue) > priceTolerance {
+			add(instrumentId, field, tickValue, tsValue)
+		}
+	}
+	checkVolume := func(instrumentId string, field string, tickValue float64, tsValue float64) {
+		if math.Abs(tickValue-tsValue) > volumeTolerance*math.Max(math.Abs(tsValue), 1) {
+			add(instrumentId, field, tickValue, tsValue)
+		}
+	}
+
+	for _, ts := range tsList {
+		if GetSuspendType(ts.TsCode) == constdef.SuspendTypeFull {
+			continue
+		}
+		daily, ok := mapDaily[ts.TsCode]
+		if !ok || daily.TradeCount == 0 {
+			add(ts.TsCode, ReconcileFieldMissingTick, 0, ts.Vol*tuShareVolumeUnit)
+			continue
+		}
+
+		checkPrice(ts.TsCode, ReconcileFieldOpen, daily.Open, ts.Open)
+		checkPrice(ts.TsCode, ReconcileFieldHigh, daily.High, ts.High)
+		checkPrice(ts.TsCode, ReconcileFieldLow, daily.Low, ts.Low)
+		checkPrice(ts.TsCode, ReconcileFieldClose, daily.Close, ts.Close)
+		if daily.PreClose != 0 {
+			checkPrice(ts.TsCode, ReconcileFieldPreClose, daily.PreClose, ts.PreClose)
+		}
+		checkVolume(ts.TsCode, ReconcileFieldVolume, float64(daily.Volume), ts.Vol*tuShareVolumeUnit)
+		checkVolume(ts.TsCode, ReconcileFieldTurnover, daily.Turnover, ts.Amount*tuShareTurnoverUnit)
+	}
+
+	return res
+}
+
+// ==== 合并 daily
+
+// MergeRawDaily 日线汇总 + tushare 对账
+// 日线每天只有一个文件（不区分 output_mode），对账差异写入 reconcile 子目录；开启复权时另写 daily_<adjust_type>
+func MergeRawDaily(day *DayContext, dstDir string) error {
+	date := day.Date
+	adjustDir := filepath.Join(dstDir, GetAdjustDataType(constdef.DataTypeDaily))
+	dstDir = filepath.Join(dstDir, constdef.DataTypeDaily)
+
+	tradeList, err := ReadRawTradeList(day)
+	if err != nil {
+		return err
+	}
+	snapshotList, err := ReadRawSnapshotList(day)
+	if err != nil {
+		return err
+	}
+
+	tradeMap := GetMapTrade(tradeList)
+	snapshotMap := GetMapSnapshot(snapshotList)
+	sourceFileList := day.GetSourceFileList(constdef.DataTypeTrade, constdef.DataTypeSnapshot)
+
+	instrumentIdList := make([]string, 0, len(snapshotMap))
+	for instrumentId := range snapshotMap {
+		instrumentIdList = append(instrumentIdList, instrumentId)
+	}
+	for instrumentId := range tradeMap {
+		if _, ok := snapshotMap[instrumentId]; !ok {
+			instrumentIdList = append(instrumentIdList, instrumentId)
+		}
+	}
+	sort.Strings(instrumentIdList)
+
+	dailyList := make([]*model.Daily, 0, len(instrumentIdList))
+	for _, instrumentId := range instrumentIdList {
+		daily, err := BuildDaily(instrumentId, date, tradeMap[instrumentId], snapshotMap[instrumentId])
+		if err != nil {
+			return err
+		}
+		if suspend := GetSuspend(instrumentId); suspend != nil {
+			daily.SuspendType = suspend.SuspendType
+			daily.SuspendTiming = suspend.SuspendTiming
+		}
+		dailyList = append(dailyList, daily)
+	}
+	logger.Info("Build Daily End, count=%d", len(dailyList))
+
+	if err := os.MkdirAll(dstDir, 0755); err != nil {
+		return errorx.NewError("MkdirAll(%s) error: %v", dstDir, err)
+	}
+	if err := WriteOutputFile(filepath.Join(dstDir, layout.GetPerDayFileName(date, constdef.DataTypeDaily)), dailyList, sourceFileList); err != nil {
+		return err
+	}
+
+	// 拿不到复权比例时跳过复权日线，不影响后面的对账
+	if ratioMap, ok := adjustRatioMap(constdef.DataTypeDaily, date); ok {
+		if err := os.MkdirAll(adjustDir, 0755); err != nil {
+			return errorx.NewError("MkdirAll(%s) error: %v", adjustDir, err)
+		}
+		if err := WriteOutputFile(filepath.Join(adjustDir, layout.GetPerDayFileName(date, constdef.DataTypeDaily)), AdjustDailyList(date, dailyList, ratioMap), sourceFileList); err != nil {
+			return err
+		}
+	}
+
+	logger.Info("Reconcile Daily With TuShare Begin")
+	tsList, err := GetTuShareDaily(date)
+	if err != nil {
+		return errorx.NewError("GetTuShareDaily(%s) error: %v", date, err)
+	}
+
+	reconcileList := ReconcileDaily(date, dailyList, tsList,
+		config.Cfg.GetReconcilePriceTolerance(), config.Cfg.GetReconcileVolumeTolerance())
+
+	reconcileDir := filepath.Join(dstDir, "reconcile")
+	if err := os.MkdirAll(reconcileDir, 0755); err != nil {
+		return errorx.NewError("MkdirAll(%s) error: %v", reconcileDir, err)
+	}
+	if err := WriteOutputFile(filepath.Join(reconcileDir, layout.GetPerDayFileName(date, "daily_reconcile")), reconcileList, sourceFileList); err != nil {
+		return err
+	}
+
+	mismatchInstrument := make(map[string]struct{})
+	missingCount := 0
+	for _, v := range reconcileList {
+		if v.Field == ReconcileFieldMissingTick {
+			missingCount++
+			continue
+		}
+		mismatchInstrument[v.InstrumentId] = struct{}{}
+	}
+	if len(reconcileList) > 0 {
+		logger.Warn("Reconcile Daily date(%s): tushare count=%d, mismatch instrument=%d, missing tick=%d",
+			date, len(tsList), len(mismatchInstrument), missingCount)
+	}
+	logger.Info("Reconcile Daily With TuShare End")
+
+	return nil
+}
@@ -0,0 +1,106 @@
+package service
+
+import (
+	"data-scrubber/biz/constdef"
+	"data-scrubber/biz/model"
+	"data-scrubber/biz/upstream/gotushare"
+	"testing"
+)
+
+func TestBuildDaily(t *testing.T) {
+	date := "20240115"
+	instrumentId := "688001.SH"
+	newTrade := func(timeStr string, price float64, volume int64) *model.Trade {
+		return &model.Trade{
+			InstrumentId:   instrumentId,
+			TradeTimestamp: mustTimeToNano(t, date, timeStr),
+			Price:          price,
+			Volume:         volume,
+			Turnover:       price * float64(volume),
+			Direction:      constdef.DirectionBuy,
+		}
+	}
+	tradeList := []*model.Trade{
+		newTrade("09:30:01.000", 10.10, 100),
+		newTrade("09:25:00.000", 10.00, 1000),
+		newTrade("10:00:00.000", 10.50, 200),
+		newTrade("14:00:00.000", 9.80, 300),
+		newTrade("15:00:00.000", 10.20, 400),
+		newTrade("15:10:00.000", 10.20, 500), // 盘后固定价格交易，不计入
+	}
+	snapshotList := []*model.Snapshot{
+		{InstrumentId: instrumentId, PreClose: 9.90, TradeVolume: 0},
+		{InstrumentId: instrumentId, PreClose: 9.90, TradeVolume: 2000, TradeTurnover: 20000},
+	}
+
+	daily, err := BuildDaily(instrumentId, date, tradeList, snapshotList)
+	if err != nil {
+		t.Fatalf("BuildDaily error: %v", err)
+	}
+	if daily.Open != 10.00 || daily.High != 10.50 || daily.Low != 9.80 || daily.Close != 10.20 {
+		t.Errorf("OHLC=%v/%v/%v/%v", daily.Open, daily.High, daily.Low, daily.Close)
+	}
+	if daily.Volume != 2000 || daily.TradeCount != 5 {
+		t.Errorf("Volume=%d TradeCount=%d, want 2000/5", daily.Volume, daily.TradeCount)
+	}
+	if daily.PreClose != 9.90 || daily.SnapshotVolume != 2000 {
+		t.Errorf("PreClose=%v SnapshotVolume=%d", daily.PreClose, daily.SnapshotVolume)
+	}
+}
+
+func TestReconcileDaily(t *testing.T) {
+	dailyList := []*model.Daily{
+		{InstrumentId: "600000.SH", Open: 10, High: 11, Low: 9, Close: 10.5, PreClose: 10, Volume: 120000, Turnover: 1260000, TradeCount: 10},
+		{InstrumentId: "000001.SZ", Open: 8, High: 8, Low: 8, Close: 8, Volume: 100, Turnover: 800, TradeCount: 1},
+	}
+	tsList := []*gotushare.QuotationData{
+		{TsCode: "600000.SH", Open: 10, High: 11, Low: 9, Close: 10.5, PreClose: 10, Vol: 1200, Amount: 1260},
+		{TsCode: "000001.SZ", Open: 8, High: 8.1, Low: 8, Close: 8, Vol: 1, Amount: 0.8},
+		{TsCode: "300750.SZ", Open: 200, High: 200, Low: 200, Close: 200, Vol: 10, Amount: 200},
+	}
+
+	res := ReconcileDaily("20240115", dailyList, tsList, 0.001, 0.001)
+	if len(res) != 2 {
+		t.Fatalf("reconcile count=%d, want 2: %+v", len(res), res)
+	}
+	if res[0].InstrumentId != "000001.SZ" || res[0].Field != ReconcileFieldHigh {
+		t.Errorf("res[0]=%+v, want 000001.SZ high", res[0])
+	}
+	if res[1].InstrumentId != "300750.SZ" || res[1].Field != ReconcileFieldMissingTick || res[1].TuShareValue != 1000 {
+		t.Errorf("res[1]=%+v, want 300750.SZ missing_tick", res[1])
+	}
+}
+
+func TestSuspend(t *testing.T) {
+	oldPriceLimit, oldSuspend := mapPriceLimit, mapSuspend
+	defer func() { mapPriceLimit, mapSuspend = oldPriceLimit, oldSuspend }()
+	mapPriceLimit = map[string]*PriceLimit{"600000.SH": {InstrumentId: "600000.SH", HighLimit: 11, LowLimit: 9}}
+	mapSuspend = map[string]*Suspend{
+		"600001.SH": {InstrumentId: "600001.SH", SuspendType: constdef.SuspendTypeFull},
+		"300750.SZ": {InstrumentId: "300750.SZ", SuspendType: constdef.SuspendTypeFull},
+	}
+
+	// 停牌的票和未知的票都没有涨跌停价，每个票只计一次，停牌的不计入
+	rawList := make([]*model.ShRawSnapshot, 0)
+	for _, id := range []string{"600000", "600001", "600001", "600002", "600002"} {
+		rawList = append(rawList, &model.ShRawSnapshot{SecurityID: id, UpdateTime: "09:30:00.000", LocalTime: "09:30:00.010"})
+	}
+	list, err := ShRawSnapshot2SnapshotList("20240115", rawList)
+	if err != nil {
+		t.Fatalf("ShRawSnapshot2SnapshotList error: %v", err)
+	}
+	if len(list) != 5 || list[0].HighLimit != 11 || list[1].HighLimit != 0 {
+		t.Errorf("list=%+v", list)
+	}
+	if GetRunReportCount(RunReportSnapshotMissingPriceLimit) != 1 {
+		t.Errorf("missing count=%d", GetRunReportCount(RunReportSnapshotMissingPriceLimit))
+	}
+
+	// 全天停牌的票不报 missing_tick
+	tsList := []*gotushare.QuotationData{
+		{TsCode: "300750.SZ", Open: 200, High: 200, Low: 200, Close: 200, Vol: 10, Amount: 200},
+	}
+	if res := ReconcileDaily("20240115", nil, tsList, 0.001, 0.001); len(res) != 0 {
+		t.Errorf("reconcile=%+v", res)
+	}
+}
@@ -0,0 +1,83 @@
+package service
+
+import (
+	"data-scrubber/biz/model"
+	"path/filepath"
+	"slices"
+	"sort"
+	"sync"
+)
+
+// DayContext 一个交易日的清洗上下文，由调用方（如 RunDaily）按日期创建，传给当天各 data type 的 MergeRaw*。
+// 同一天各 data type 之间共享的状态放在这里而不是包级变量中，
+// 清洗结果不依赖同一进程内此前处理过哪些日期、哪些 data type
+type DayContext struct {
+	SrcDir string
+	Date   string
+
+	mu sync.Mutex
+	// sequenceCheckMap 当天已检查过序号的市场 -> 是否检查过缺失，见 CheckSequenceOnce
+	sequenceCheckMap map[string]bool
+	// sourceFileMap 原始数据的 data type -> 当天读取过的源文件名，写入输出文件的 key/value 元数据
+	sourceFileMap map[string][]string
+	// instrumentSeen 当天快照和成交中出现过的票，instrument 输出复用，见 loadInstrumentSeen
+	instrumentSeen instrumentSeen
+}
+
+func NewDayContext(srcDir string, date string) *DayContext {
+	return &DayContext{
+		SrcDir:           srcDir,
+		Date:             date,
+		sequenceCheckMap: make(map[string]bool),
+		sourceFileMap:    make(map[string][]string),
+	}
+}
+
+// AddSourceFile 记录 dataType 的原始数据读取过的源文件，只保留文件名
+func (d *DayContext) AddSourceFile(dataType string, filePath string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	name := filepath.Base(filePath)
+	if !slices.Contains(d.sourceFileMap[dataType], name) {
+		d.sourceFileMap[dataType] = append(d.sourceFileMap[dataType], name)
+	}
+}
+
+// GetSourceFileList 返回 dataTypeList 的原始数据读取过的源文件名，按文件名排序。
+// 输出由哪些原始数据生成由调用方决定，如 tick 传 snapshot、trade、order、orderqueue
+func (d *DayContext) GetSourceFileList(dataTypeList ...string) []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var res []string
+	for _, dataType := range dataTypeList {
+		for _, name := range d.sourceFileMap[dataType] {
+			if !slices.Contains(res, name) {
+				res = append(res, name)
+			}
+		}
+	}
+	sort.Strings(res)
+	return res
+}
+
+// addSeenSnapshotList ReadRawSnapshotList 读完后记录当天出现过的票
+func (d *DayContext) addSeenSnapshotList(list []*model.Snapshot) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.instrumentSeen.addSnapshotList(list)
+}
+
+// addSeenTradeList ReadRawTradeList 读完后记录当天出现过的票
+func (d *DayContext) addSeenTradeList(list []*model.Trade) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.instrumentSeen.addTradeList(list)
+}
+
+// getInstrumentSeen 返回副本，记录时整体替换 map 而不修改，副本可以在锁外读
+func (d *DayContext) getInstrumentSeen() *instrumentSeen {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	seen := d.instrumentSeen
+	return &seen
+}
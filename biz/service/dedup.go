@@ -0,0 +1,138 @@
+package service
+
+import (
+	"data-scrubber/biz/model"
+
+	logger "github.com/2997215859/golog"
+)
+
+// 盘中断线后通联会补发数据，补发的记录没有 SeqNo/LocalTime，且可能和已收到的记录重叠。
+// 去重时优先用交易所标识：沪市新格式 (Channel, BizIndex)，深市 (ChannelNo, ApplSeqNum)；
+// 沪市旧格式（bySeq=false）以及没有交易所序号的记录（如合成的委托）用内容元组。
+// 重复记录保留先出现的一条，若先出现的是补发记录（LocalTimestamp=0）而后面的有 LocalTimestamp，则保留后者
+
+// RunReport 计数键
+const (
+	RunReportTradeDuplicate    = "trade_duplicate_dropped"
+	RunReportOrderDuplicate    = "order_duplicate_dropped"
+	RunReportSnapshotDuplicate = "snapshot_duplicate_dropped"
+)
+
+// seqDedupKey 交易所标识；沪市 seq 为 BizIndex，深市为 ApplSeqNum
+type seqDedupKey struct {
+	sh      bool
+	channel int64
+	seq     int64
+}
+
+type tradeContentKey struct {
+	instrumentId   string
+	tradeTimestamp int64
+	price          float64
+	volume         int64
+	buyOrderId     int64
+	sellOrderId    int64
+}
+
+type orderContentKey struct {
+	instrumentId   string
+	orderTimestamp int64
+	orderId        int64
+	orderType      string
+	price          float64
+	volume         int64
+}
+
+type snapshotDedupKey struct {
+	instrumentId    string
+	updateTimestamp int64
+	tradeVolume     int64
+}
+
+func getSeqDedupKey(channel int64, bizIndex int64, applSeqNum int64) (seqDedupKey, bool) {
+	if bizIndex != 0 {
+		return seqDedupKey{sh: true, channel: channel, seq: bizIndex}, true
+	}
+	if applSeqNum != 0 {
+		return seqDedupKey{sh: false, channel: channel, seq: applSeqNum}, true
+	}
+	return seqDedupKey{}, false
+}
+
+// dedupList 通用去重：key 相同的记录只保留一条，返回去重后的列表和丢弃数量
+func dedupList[T any, K comparable](list []*T, getKey func(v *T) K, localTimestamp func(v *T) int64) ([]*T, int) {
+	mapIndex := make(map[K]int, len(list))
+	res := make([]*T, 0, len(list))
+	dropped := 0
+	for _, v := range list {
+		if v == nil {
+			continue
+		}
+		key := getKey(v)
+		if i, ok := mapIndex[key]; ok {
+			dropped++
+			if localTimestamp(res[i]) == 0 && localTimestamp(v) != 0 {
+				res[i] = v
+			}
+			continue
+		}
+		mapIndex[key] = len(res)
+		res = append(res, v)
+	}
+	return res, dropped
+}
+
+// DedupTradeList 逐笔成交去重，bySeq=false 时只用内容元组
+func DedupTradeList(list []*model.Trade, bySeq bool) ([]*model.Trade, int) {
+	type key struct {
+		seq     seqDedupKey
+		content tradeContentKey
+	}
+	return dedupList(list, func(v *model.Trade) key {
+		if seq, ok := getSeqDedupKey(v.Channel, v.BizIndex, v.ApplSeqNum); bySeq && ok {
+			return key{seq: seq}
+		}
+		return key{content: tradeContentKey{
+			instrumentId:   v.InstrumentId,
+			tradeTimestamp: v.TradeTimestamp,
+			price:          v.Price,
+			volume:         v.Volume,
+			buyOrderId:     v.BuyOrderId,
+			sellOrderId:    v.SellOrderId,
+		}}
+	}, func(v *model.Trade) int64 { return v.LocalTimestamp })
+}
+
+// DedupOrderList 逐笔委托去重，bySeq=false 时只用内容元组
+func DedupOrderList(list []*model.Order, bySeq bool) ([]*model.Order, int) {
+	type key struct {
+		seq     seqDedupKey
+		content orderContentKey
+	}
+	return dedupList(list, func(v *model.Order) key {
+		if seq, ok := getSeqDedupKey(v.Channel, v.BizIndex, v.ApplSeqNum); bySeq && ok {
+			return key{seq: seq}
+		}
+		return key{content: orderContentKey{
+			instrumentId:   v.InstrumentId,
+			orderTimestamp: v.OrderTimestamp,
+			orderId:        v.OrderId,
+			orderType:      v.OrderType,
+			price:          v.Price,
+			volume:         v.Volume,
+		}}
+	}, func(v *model.Order) int64 { return v.LocalTimestamp })
+}
+
+// DedupSnapshotList 快照去重，key 为 (票, 行情时间, 累计成交量)
+func DedupSnapshotList(list []*model.Snapshot) ([]*model.Snapshot, int) {
+	return dedupList(list, func(v *model.Snapshot) snapshotDedupKey {
+		return snapshotDedupKey{instrumentId: v.InstrumentId, updateTimestamp: v.UpdateTimestamp, tradeVolume: v.TradeVolume}
+	}, func(v *model.Snapshot) int64 { return v.LocalTimestamp })
+}
+
+func logDedup(name string, date string, dropped int) {
+	if dropped > 0 {
+		logger.Warn("Dedup %s date(%s): dropped %d duplicate records", name, date, dropped)
+	}
+}
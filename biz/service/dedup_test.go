@@ -0,0 +1,60 @@
+package service
+
+import (
+	"data-scrubber/biz/constdef"
+	"data-scrubber/biz/model"
+	"testing"
+)
+
+func TestDedupTradeList(t *testing.T) {
+	tradeList := []*model.Trade{
+		{InstrumentId: "000001.SZ", Channel: 2011, ApplSeqNum: 10, Volume: 100},
+		{InstrumentId: "000001.SZ", Channel: 2011, ApplSeqNum: 11, Volume: 200},
+		// 断线补发：同一交易所序号，没有 LocalTimestamp
+		{InstrumentId: "000001.SZ", Channel: 2011, ApplSeqNum: 10, Volume: 100},
+		// 不同通道同一序号不是重复
+		{InstrumentId: "000002.SZ", Channel: 2012, ApplSeqNum: 10, Volume: 300},
+	}
+	res, dropped := DedupTradeList(tradeList, true)
+	if dropped != 1 || len(res) != 3 {
+		t.Fatalf("dropped=%d len=%d, 期望 1/3", dropped, len(res))
+	}
+
+	// 沪市旧格式按内容去重；先出现的是补发记录时保留有 LocalTimestamp 的那条
+	oldShList := []*model.Trade{
+		{InstrumentId: "600000.SH", TradeTimestamp: 1, Price: 10, Volume: 100, BuyOrderId: 1, SellOrderId: 2},
+		{InstrumentId: "600000.SH", TradeTimestamp: 1, Price: 10, Volume: 100, BuyOrderId: 1, SellOrderId: 2, LocalTimestamp: 5},
+		{InstrumentId: "600000.SH", TradeTimestamp: 1, Price: 10, Volume: 100, BuyOrderId: 1, SellOrderId: 3},
+	}
+	res, dropped = DedupTradeList(oldShList, false)
+	if dropped != 1 || len(res) != 2 || res[0].LocalTimestamp != 5 {
+		t.Errorf("dropped=%d len=%d res[0]=%+v", dropped, len(res), res[0])
+	}
+}
+
+func TestDedupOrderList(t *testing.T) {
+	orderList := []*model.Order{
+		{InstrumentId: "600000.SH", Channel: 1, BizIndex: 100, OrderId: 7, OrderType: constdef.OrderTypeAdd},
+		{InstrumentId: "600000.SH", Channel: 1, BizIndex: 100, OrderId: 7, OrderType: constdef.OrderTypeAdd},
+		// 合成委托没有 BizIndex，按内容去重
+		{InstrumentId: "600000.SH", Channel: 1, OrderId: 8, OrderType: constdef.OrderTypeAdd, Volume: 100},
+		{InstrumentId: "600000.SH", Channel: 1, OrderId: 9, OrderType: constdef.OrderTypeAdd, Volume: 100},
+	}
+	res, dropped := DedupOrderList(orderList, true)
+	if dropped != 1 || len(res) != 3 {
+		t.Errorf("dropped=%d len=%d, 期望 1/3", dropped, len(res))
+	}
+}
+
+func TestDedupSnapshotList(t *testing.T) {
+	snapshotList := []*model.Snapshot{
+		{InstrumentId: "000001.SZ", UpdateTimestamp: 1, TradeVolume: 100},
+		{InstrumentId: "000001.SZ", UpdateTimestamp: 1, TradeVolume: 100},
+		// 同一时刻累计成交量不同，保留
+		{InstrumentId: "000001.SZ", UpdateTimestamp: 1, TradeVolume: 200},
+	}
+	res, dropped := DedupSnapshotList(snapshotList)
+	if dropped != 1 || len(res) != 2 {
+		t.Errorf("dropped=%d len=%d, 期望 1/2", dropped, len(res))
+	}
+}
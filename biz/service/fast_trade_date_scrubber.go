@@ -3,6 +3,7 @@ package service
 import (
 	"archive/zip"
 	"data-scrubber/biz/errorx"
+	"data-scrubber/biz/layout"
 	"data-scrubber/biz/model"
 	"data-scrubber/biz/utils"
 	"fmt"
@@ -154,7 +155,7 @@ func MergeRawTradeStream(srcDir string, dstDir string, date string) error {
 		}
 	}()
 
-	if err := WriteParquetStream(date, dstDir, result); err != nil {
+	if err := WriteParquetStream(date, dstDir, result, []string{filepath.Base(shFilepath), filepath.Base(szFilepath)}); err != nil {
 		logger.Error("WriteParquetStream error: %s", err)
 	}
 
@@ -222,17 +223,17 @@ func SortRawTradeStream(date string, shRawTradeChan <-chan *model.ShRawTrade, sz
 }
 
 // 修改原有的WriteParquetStream函数
-func WriteParquetStream(date string, dstDir string, result <-chan *model.Trade) error {
+func WriteParquetStream(date string, dstDir string, result <-chan *model.Trade, sourceFileList []string) error {
 	dstDir = filepath.Join(dstDir, date)
 	if err := os.MkdirAll(dstDir, 0755); err != nil {
 		return errorx.NewError("MkdirAll(%s) error: %v", dstDir, err)
 	}
 
 	// 构建输出文件名
-	outputPath := filepath.Join(dstDir, fmt.Sprintf("%s_trades.parquet", date))
+	outputPath := filepath.Join(dstDir, layout.GetPerDayFileName(date, "trades"))
 
 	//创建写入器
-	pw, err := NewParquetWriter(outputPath, new(model.Trade))
+	pw, err := NewParquetWriter(outputPath, new(model.Trade), sourceFileList)
 	if err != nil {
 		return errorx.NewError("NewParquetWriter error: %s", err)
 	}
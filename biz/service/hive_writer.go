@@ -0,0 +1,79 @@
+package service
+
+import (
+	"data-scrubber/biz/errorx"
+	"data-scrubber/biz/layout"
+	"data-scrubber/config"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// hive 布局：dst/<type>/date=YYYYMMDD/market=SH|SZ[/bucket=N]/part-00000.parquet
+// Spark / DuckDB / Arrow dataset 可以直接按 date、market、bucket 做分区裁剪
+
+// flattenInstrumentMap 把按票分组的数据按 InstrumentId 顺序展开
+func flattenInstrumentMap[T any](m map[string][]*T) []*T {
+	keyList := make([]string, 0, len(m))
+	for k := range m {
+		keyList = append(keyList, k)
+	}
+	sort.Strings(keyList)
+	res := make([]*T, 0)
+	for _, k := range keyList {
+		res = append(res, m[k]...)
+	}
+	return res
+}
+
+// WriteHiveParquet 按 market（和可选的 bucket）把 list 写到 typeDir 下当天的分区
+// 重跑时先删除当天的分区目录，避免分桶数变化后留下旧文件
+// 分区文件内默认按时间排序（同一时刻保持 list 中的顺序）；per_day_clustered 时按票聚簇并带 sidecar 索引
+func WriteHiveParquet[T any](typeDir string, date string, list []*T, sourceFileList []string, instrumentId func(v *T) string, timestamp func(v *T) int64) error {
+	dateDir := layout.GetHiveDateDir(typeDir, date)
+	if err := os.RemoveAll(dateDir); err != nil {
+		return errorx.NewError("RemoveAll(%s) error: %v", dateDir, err)
+	}
+
+	bucketCount := config.Cfg.OutputBucketCount
+	partitionMap := make(map[string][]*T)
+	for _, v := range list {
+		if v == nil {
+			continue
+		}
+		id := instrumentId(v)
+		bucket := 0
+		if bucketCount > 0 {
+			bucket = layout.GetInstrumentBucket(id, bucketCount)
+		}
+		dir := layout.GetHivePartitionDir(typeDir, date, layout.GetInstrumentMarket(id), bucket, bucketCount)
+		partitionMap[dir] = append(partitionMap[dir], v)
+	}
+
+	dirList := make([]string, 0, len(partitionMap))
+	for dir := range partitionMap {
+		dirList = append(dirList, dir)
+	}
+	sort.Strings(dirList)
+
+	for _, dir := range dirList {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return errorx.NewError("MkdirAll(%s) error: %v", dir, err)
+		}
+		filePath := filepath.Join(dir, layout.HivePartFileName)
+		partitionList := partitionMap[dir]
+		var err error
+		if config.Cfg.IsPerDayClustered() {
+			err = WriteClusteredOutputFile(filePath, partitionList, sourceFileList, instrumentId, timestamp)
+		} else {
+			sort.SliceStable(partitionList, func(i, j int) bool {
+				return timestamp(partitionList[i]) < timestamp(partitionList[j])
+			})
+			err = WriteOutputFile(filePath, partitionList, sourceFileList)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package service
+
+import (
+	"data-scrubber/biz/constdef"
+	"data-scrubber/biz/layout"
+	"data-scrubber/biz/model"
+	"data-scrubber/biz/utils"
+	"data-scrubber/config"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteHiveParquet(t *testing.T) {
+	oldCfg := config.Cfg
+	defer func() { config.Cfg = oldCfg }()
+	config.Cfg = &config.Config{OutputLayout: constdef.OutputLayoutHive}
+
+	tradeList := []*model.Trade{
+		{InstrumentId: "600000.SH", TradeTimestamp: 1},
+		{InstrumentId: "000001.SZ", TradeTimestamp: 2},
+		{InstrumentId: "600001.SH", TradeTimestamp: 3},
+	}
+	typeDir := filepath.Join(t.TempDir(), "trade")
+	instrumentId := func(v *model.Trade) string { return v.InstrumentId }
+	timestamp := func(v *model.Trade) int64 { return v.TradeTimestamp }
+	if err := WriteHiveParquet(typeDir, "20240115", tradeList, nil, instrumentId, timestamp); err != nil {
+		t.Fatalf("WriteHiveParquet error: %v", err)
+	}
+	for _, market := range []string{"SH", "SZ"} {
+		filePath := filepath.Join(typeDir, "date=20240115", "market="+market, layout.HivePartFileName)
+		if !utils.Exists(filePath) {
+			t.Errorf("%s not exists", filePath)
+		}
+	}
+
+	// 分桶后重跑，旧的未分桶文件被清理
+	config.Cfg.OutputBucketCount = 4
+	if err := WriteHiveParquet(typeDir, "20240115", tradeList, nil, instrumentId, timestamp); err != nil {
+		t.Fatalf("WriteHiveParquet(bucket) error: %v", err)
+	}
+	if utils.Exists(filepath.Join(typeDir, "date=20240115", "market=SH", layout.HivePartFileName)) {
+		t.Errorf("stale partition file not removed")
+	}
+	for _, v := range tradeList {
+		dir := layout.GetHivePartitionDir(typeDir, "20240115", layout.GetInstrumentMarket(v.InstrumentId), layout.GetInstrumentBucket(v.InstrumentId, 4), 4)
+		if !utils.Exists(filepath.Join(dir, layout.HivePartFileName)) {
+			t.Errorf("%s not exists", dir)
+		}
+	}
+}
@@ -0,0 +1,273 @@
+package service
+
+import (
+	"data-scrubber/biz/constdef"
+	"data-scrubber/biz/errorx"
+	"data-scrubber/biz/layout"
+	"data-scrubber/biz/model"
+	"data-scrubber/biz/upstream/gotushare"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	logger "github.com/2997215859/golog"
+)
+
+// 证券主数据：每个交易日输出 reference/<date>_instruments.parquet，
+// 汇总 tushare stock_basic、namechange、stk_limit、daily_basic、margin_detail 和停牌信息，
+// 再加上逐笔数据自己的昨收和当天出现过的票，下游统一用这一份 point-in-time 的证券定义。
+// 当天出现过的票在读取快照、成交时顺带记录到 DayContext（见 instrumentSeen），同一天前面已经读过的不再重复读取转换。
+// instrument 和其他数据类型一样需要写进 data_type_list 才输出：它额外依赖 tushare stock_basic、namechange、
+// daily_basic 和 margin_detail 的接口权限，只跑逐笔清洗的环境不应因此多出失败。
+
+// tushare daily_basic 的股本单位为万股
+const tuShareShareUnit = 10000
+
+// RunReportInstrument 当天输出的证券数
+const RunReportInstrument = "instrument"
+
+// stock_basic 和 namechange 是全量历史数据，进程内只拉取一次
+var (
+	instrumentBasicMu  sync.Mutex
+	stockBasicList     []*gotushare.StockBasicData
+	nameChangeMap      map[string][]*gotushare.NameChangeData // 票 -> 简称变更记录
+	instrumentBasicSet bool
+)
+
+// instrumentSeen 某一天快照和成交中出现过的票，记在 DayContext 中，ReadRawSnapshotList、ReadRawTradeList 读完后填入
+type instrumentSeen struct {
+	snapshotFirst map[string]*model.Snapshot // 票 -> 当天第一条快照（取昨收），nil 表示当天还没读过快照
+	tradeSet      map[string]struct{}        // nil 表示当天还没读过成交
+}
+
+// addSnapshotList list 按时间排好序，每个票取第一条快照的昨收
+func (s *instrumentSeen) addSnapshotList(list []*model.Snapshot) {
+	s.snapshotFirst = make(map[string]*model.Snapshot)
+	for _, v := range list {
+		if v == nil {
+			continue
+		}
+		if _, ok := s.snapshotFirst[v.InstrumentId]; !ok {
+			s.snapshotFirst[v.InstrumentId] = v
+		}
+	}
+}
+
+func (s *instrumentSeen) addTradeList(list []*model.Trade) {
+	s.tradeSet = make(map[string]struct{})
+	for _, v := range list {
+		if v != nil {
+			s.tradeSet[v.InstrumentId] = struct{}{}
+		}
+	}
+}
+
+// loadInstrumentSeen 当天出现过的票，快照或成交还没读过时补读一次
+func loadInstrumentSeen(day *DayContext) (*instrumentSeen, error) {
+	seen := day.getInstrumentSeen()
+	hasSnapshot, hasTrade := seen.snapshotFirst != nil, seen.tradeSet != nil
+
+	// 读取快照时会刷新当天的涨跌停和停牌，已读过时沿用
+	if !hasSnapshot {
+		if _, err := ReadRawSnapshotList(day); err != nil {
+			return nil, err
+		}
+	}
+	if !hasTrade {
+		if _, err := ReadRawTradeList(day); err != nil {
+			return nil, err
+		}
+	}
+	logger.Info("Load Instrument Seen date(%s): reuse snapshot=%v, reuse trade=%v", day.Date, hasSnapshot, hasTrade)
+	return day.getInstrumentSeen(), nil
+}
+
+// loadInstrumentBasic 拉取全部股票的基础信息和历史简称
+func loadInstrumentBasic() ([]*gotushare.StockBasicData, map[string][]*gotushare.NameChangeData, error) {
+	instrumentBasicMu.Lock()
+	defer instrumentBasicMu.Unlock()
+	if instrumentBasicSet {
+		return stockBasicList, nameChangeMap, nil
+	}
+
+	basicList, err := GetTuShareStockBasic()
+	if err != nil {
+		return nil, nil, err
+	}
+	nameChangeList, err := GetTuShareNameChange()
+	if err != nil {
+		return nil, nil, err
+	}
+	stockBasicList = basicList
+	nameChangeMap = GetMapNameChange(nameChangeList)
+	instrumentBasicSet = true
+	logger.Info("Load Instrument Basic: stock_basic=%d, namechange=%d", len(basicList), len(nameChangeList))
+	return stockBasicList, nameChangeMap, nil
+}
+
+func GetMapNameChange(list []*gotushare.NameChangeData) map[string][]*gotushare.NameChangeData {
+	res := make(map[string][]*gotushare.NameChangeData)
+	for _, v := range list {
+		res[v.TsCode] = append(res[v.TsCode], v)
+	}
+	return res
+}
+
+// GetDateName 票在 date 当天的简称，取生效区间包含 date 的记录中开始日期最晚的一条，没有时返回空
+func GetDateName(date string, nameChangeList []*gotushare.NameChangeData) string {
+	var res *gotushare.NameChangeData
+	for _, v := range nameChangeList {
+		if v.StartDate == "" || v.StartDate > date || (v.EndDate != "" && v.EndDate < date) {
+			continue
+		}
+		if res == nil || v.StartDate > res.StartDate {
+			res = v
+		}
+	}
+	if res == nil {
+		return ""
+	}
+	return res.Name
+}
+
+// GetStStatus 按简称判断 ST 状态，*ST 优先
+func GetStStatus(name string) string {
+	switch {
+	case strings.Contains(name, "*ST"):
+		return constdef.StStatusStarST
+	case strings.Contains(name, "ST"):
+		return constdef.StStatusST
+	}
+	return constdef.StStatusNone
+}
+
+// isListed date 当天是否已上市且未退市，退市日当天不再交易
+func isListed(date string, v *gotushare.StockBasicData) bool {
+	if v.ListDate == "" || v.ListDate > date {
+		return false
+	}
+	return v.DelistDate == "" || v.DelistDate > date
+}
+
+// BuildInstrumentList 生成当天的证券主数据，按 InstrumentId 排序
+// 涨跌停和停牌取自当天已刷新的 mapPriceLimit / mapSuspend；marginDetailList 为空时融资融券标记均为 false
+func BuildInstrumentList(date string, basicList []*gotushare.StockBasicData, nameChangeMap map[string][]*gotushare.NameChangeData,
+	dailyBasicList []*gotushare.DailyBasicData, marginDetailList []*gotushare.MarginDetailData, seen *instrumentSeen) []*model.Instrument {
+	mapInstrument := make(map[string]*model.Instrument)
+	get := func(instrumentId string) *model.Instrument {
+		res, ok := mapInstrument[instrumentId]
+		if !ok {
+			res = &model.Instrument{InstrumentId: instrumentId, TradeDate: date}
+			mapInstrument[instrumentId] = res
+		}
+		return res
+	}
+
+	for _, v := range basicList {
+		if !isListed(date, v) {
+			continue
+		}
+		res := get(v.TsCode)
+		res.Name = v.Name
+		if name := GetDateName(date, nameChangeMap[v.TsCode]); name != "" {
+			res.Name = name
+		}
+		res.Exchange = v.Exchange
+		res.Market = v.Market
+		res.Industry = v.Industry
+		res.ListDate = v.ListDate
+		res.DelistDate = v.DelistDate
+		res.StStatus = GetStStatus(res.Name)
+	}
+
+	// 快照和成交里出现过的票都输出，不在 stock_basic 里的（如 ETF）只有行情相关的字段
+	for instrumentId, snapshot := range seen.snapshotFirst {
+		res := get(instrumentId)
+		res.InSnapshot = true
+		res.TickPreClose, res.TickPreCloseE4 = snapshot.PreClose, snapshot.PreCloseE4
+	}
+	for instrumentId := range seen.tradeSet {
+		get(instrumentId).InTrade = true
+	}
+
+	mapDailyBasic := make(map[string]*gotushare.DailyBasicData, len(dailyBasicList))
+	for _, v := range dailyBasicList {
+		mapDailyBasic[v.TsCode] = v
+	}
+	marginSet := make(map[string]struct{}, len(marginDetailList))
+	for _, v := range marginDetailList {
+		marginSet[v.TsCode] = struct{}{}
+	}
+
+	res := make([]*model.Instrument, 0, len(mapInstrument))
+	for instrumentId, v := range mapInstrument {
+		if priceLimit, ok := mapPriceLimit[instrumentId]; ok {
+			v.PreClose = priceLimit.PreClose
+			v.HighLimit = priceLimit.HighLimit
+			v.LowLimit = priceLimit.LowLimit
+		}
+		if dailyBasic, ok := mapDailyBasic[instrumentId]; ok {
+			v.TotalShare = dailyBasic.TotalShare * tuShareShareUnit
+			v.FloatShare = dailyBasic.FloatShare * tuShareShareUnit
+		}
+		_, v.MarginEligible = marginSet[instrumentId]
+		if suspend := GetSuspend(instrumentId); suspend != nil {
+			v.SuspendType = suspend.SuspendType
+			v.SuspendTiming = suspend.SuspendTiming
+		}
+		res = append(res, v)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].InstrumentId < res[j].InstrumentId
+	})
+	return res
+}
+
+// ==== 合并 instrument
+
+// MergeRawInstrument 输出当天的证券主数据，每天一个文件（不区分 output_mode）
+func MergeRawInstrument(day *DayContext, dstDir string) error {
+	date := day.Date
+	dstDir = filepath.Join(dstDir, "reference")
+
+	seen, err := loadInstrumentSeen(day)
+	if err != nil {
+		return err
+	}
+
+	basicList, nameChangeMap, err := loadInstrumentBasic()
+	if err != nil {
+		return err
+	}
+	dailyBasicList, err := GetTuShareDailyBasic(date)
+	if err != nil {
+		return err
+	}
+	if len(dailyBasicList) == 0 {
+		logger.Warn("Build Instrument date(%s): tushare daily_basic is empty, share columns are 0", date)
+	}
+
+	// 融资融券数据次日才发布，汇总为空时说明当天还没有明细
+	marginList, err := GetTuShareMargin(date)
+	if err != nil {
+		return err
+	}
+	var marginDetailList []*gotushare.MarginDetailData
+	if len(marginList) == 0 {
+		logger.Warn("Build Instrument date(%s): tushare margin is not published, MarginEligible is false", date)
+	} else if marginDetailList, err = GetTuShareMarginDetail(date); err != nil {
+		return err
+	}
+
+	list := BuildInstrumentList(date, basicList, nameChangeMap, dailyBasicList, marginDetailList, seen)
+	SetRunReportCount(RunReportInstrument, int64(len(list)))
+	logger.Info("Build Instrument End, count=%d", len(list))
+
+	if err := os.MkdirAll(dstDir, 0755); err != nil {
+		return errorx.NewError("MkdirAll(%s) error: %v", dstDir, err)
+	}
+	return WriteOutputFile(filepath.Join(dstDir, layout.GetPerDayFileName(date, "instruments")), list,
+		day.GetSourceFileList(constdef.DataTypeSnapshot, constdef.DataTypeTrade))
+}
@@ -0,0 +1,101 @@
+package service
+
+import (
+	"data-scrubber/biz/constdef"
+	"data-scrubber/biz/model"
+	"data-scrubber/biz/upstream/gotushare"
+	"data-scrubber/config"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBuildInstrumentList(t *testing.T) {
+	oldCfg, oldLimit, oldSuspend := config.Cfg, mapPriceLimit, mapSuspend
+	defer func() { config.Cfg, mapPriceLimit, mapSuspend = oldCfg, oldLimit, oldSuspend }()
+	config.Cfg = &config.Config{}
+	mapPriceLimit = map[string]*PriceLimit{
+		"000001.SZ": {InstrumentId: "000001.SZ", PreClose: 10, HighLimit: 11, LowLimit: 9},
+	}
+	mapSuspend = map[string]*Suspend{
+		"600001.SH": {InstrumentId: "600001.SH", SuspendType: constdef.SuspendTypeFull},
+	}
+
+	date := "20240115"
+	basicList := []*gotushare.StockBasicData{
+		{TsCode: "000001.SZ", Name: "平安银行", Exchange: "SZSE", Market: "主板", ListDate: "19910403"},
+		{TsCode: "600001.SH", Name: "退市邯钢", Exchange: "SSE", Market: "主板", ListDate: "19980122", DelistDate: "20240116"},
+		{TsCode: "600002.SH", Name: "齐鲁石化", ListDate: "19980408", DelistDate: "20060424"}, // 已退市
+		{TsCode: "688999.SH", Name: "未上市", ListDate: "20240116"},
+	}
+	// 当前简称已摘帽，但 20240115 当天仍是 *ST
+	nameChangeMap := GetMapNameChange([]*gotushare.NameChangeData{
+		{TsCode: "600001.SH", Name: "邯郸钢铁", StartDate: "19980122", EndDate: "20230501"},
+		{TsCode: "600001.SH", Name: "*ST邯钢", StartDate: "20230502", EndDate: "20240110"},
+		{TsCode: "600001.SH", Name: "ST邯钢", StartDate: "20240111"},
+	})
+	dailyBasicList := []*gotushare.DailyBasicData{{TsCode: "000001.SZ", TotalShare: 1.5, FloatShare: 1.2}}
+	marginDetailList := []*gotushare.MarginDetailData{{TsCode: "000001.SZ"}}
+	snapshotList := []*model.Snapshot{
+		{InstrumentId: "000001.SZ", PreClose: 10.01},
+		{InstrumentId: "000001.SZ", PreClose: 10.5},
+		{InstrumentId: "510300.SH", PreClose: 3.5},
+	}
+	tradeList := []*model.Trade{{InstrumentId: "000001.SZ"}}
+
+	seen := &instrumentSeen{}
+	seen.addSnapshotList(snapshotList)
+	seen.addTradeList(tradeList)
+	list := BuildInstrumentList(date, basicList, nameChangeMap, dailyBasicList, marginDetailList, seen)
+	if len(list) != 3 || list[0].InstrumentId != "000001.SZ" || list[1].InstrumentId != "510300.SH" || list[2].InstrumentId != "600001.SH" {
+		t.Fatalf("list=%+v", list)
+	}
+
+	want := model.Instrument{
+		InstrumentId: "000001.SZ", TradeDate: date, Name: "平安银行", Exchange: "SZSE", Market: "主板", ListDate: "19910403",
+		PreClose: 10, HighLimit: 11, LowLimit: 9, TotalShare: 15000, FloatShare: 12000, MarginEligible: true,
+		TickPreClose: 10.01, InSnapshot: true, InTrade: true,
+	}
+	if *list[0] != want {
+		t.Errorf("list[0]=%+v", list[0])
+	}
+	// 不在 stock_basic 里的票只有行情字段
+	if v := list[1]; v.Name != "" || !v.InSnapshot || v.InTrade || v.TickPreClose != 3.5 {
+		t.Errorf("list[1]=%+v", v)
+	}
+	if v := list[2]; v.Name != "ST邯钢" || v.StStatus != constdef.StStatusST || v.SuspendType != constdef.SuspendTypeFull || v.InSnapshot || v.MarginEligible {
+		t.Errorf("list[2]=%+v", v)
+	}
+	if name := GetDateName("20240105", nameChangeMap["600001.SH"]); GetStStatus(name) != constdef.StStatusStarST {
+		t.Errorf("20240105 name=%s", name)
+	}
+
+	dir := t.TempDir()
+	if err := WriteOutputFile(filepath.Join(dir, date+"_instruments.parquet"), list, nil); err != nil {
+		t.Fatalf("WriteOutputFile error: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, date+"_instruments.parquet")); err != nil {
+		t.Fatalf("Stat error: %v", err)
+	}
+}
+
+func TestLoadInstrumentSeen(t *testing.T) {
+	// 当天已读过快照和成交时直接复用，不再读取 srcDir
+	day := NewDayContext(t.TempDir(), "20240115")
+	day.addSeenSnapshotList([]*model.Snapshot{{InstrumentId: "000001.SZ", PreClose: 10}})
+	day.addSeenTradeList([]*model.Trade{{InstrumentId: "600000.SH"}})
+	seen, err := loadInstrumentSeen(day)
+	if err != nil {
+		t.Fatalf("loadInstrumentSeen error: %v", err)
+	}
+	if seen.snapshotFirst["000001.SZ"].PreClose != 10 || len(seen.tradeSet) != 1 {
+		t.Errorf("seen=%+v", seen)
+	}
+
+	// 每天各自记录，另一天只读过成交时仍需补读快照
+	other := NewDayContext(t.TempDir(), "20240116")
+	other.addSeenTradeList(nil)
+	if seen := other.getInstrumentSeen(); seen.snapshotFirst != nil || seen.tradeSet == nil {
+		t.Errorf("seen=%+v", seen)
+	}
+}
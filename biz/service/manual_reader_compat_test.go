@@ -2,6 +2,7 @@ package service
 
 import (
 	"archive/zip"
+	"data-scrubber/biz/constdef"
 	"os"
 	"path/filepath"
 	"strconv"
@@ -65,6 +66,26 @@ func TestManualReadSzRawOrder_AllowsMissingLocalTimeAndSeqNo(t *testing.T) {
 	}
 }
 
+func TestManualReadSzRawOrder_CharOrdType(t *testing.T) {
+	content := strings.Join([]string{
+		"ChannelNo,ApplSeqNum,MDStreamID,SecurityID,SecurityIDSource,Price,OrderQty,Side,TransactTime,OrdType,LocalTime,SeqNo",
+		"2012,1,011,002813,102 ,35.0100,100,49,09:15:00.000,2,,",
+		"2012,2,011,002813,102 ,0,100,49,09:30:00.000,1,,",
+		"2012,3,011,002813,102 ,0,100,50,09:30:01.000,U,,",
+	}, "\n") + "\n"
+
+	orders, err := ManualReadSzRawOrder(writeTestZipCSV(t, "order.csv", content))
+	if err != nil {
+		t.Fatalf("ManualReadSzRawOrder error: %v", err)
+	}
+	want := []string{constdef.PriceTypeLimit, constdef.PriceTypeMarket, constdef.PriceTypeBestOwn}
+	for i, v := range orders {
+		if got := SzRaw2OrderPriceType(v.OrdType); got != want[i] {
+			t.Errorf("orders[%d] OrdType=%d PriceType=%s, want %s", i, v.OrdType, got, want[i])
+		}
+	}
+}
+
 func TestManualReadOldShRawOrder_AllowsMissingLocalTimeAndSeqNo(t *testing.T) {
 	content := strings.Join([]string{
 		"DataStatus,OrderIndex,OrderChannel,SecurityID,OrderTime,OrderType,OrderNO,OrderPrice,Balance,OrderBSFlag,BizIndex,LocalTime,SeqNo",
@@ -3,6 +3,7 @@ package service
 import (
 	"data-scrubber/biz/constdef"
 	"data-scrubber/biz/errorx"
+	"data-scrubber/biz/layout"
 	"data-scrubber/biz/model"
 	"data-scrubber/biz/utils"
 	"data-scrubber/config"
@@ -40,16 +41,28 @@ func ShRawTrade2Order(date string, v *model.ShRawTrade) (*model.Order, error) {
 
 	direction := ShRaw2Direction(v.TickBSFlag)
 
+	// A/D 记录只有一方的委托号非零，即该笔委托的原始订单号，与成交记录中的 BuyOrderNO/SellOrderNO 对应
+	orderId := v.BuyOrderNo
+	if orderId == 0 {
+		orderId = v.SellOrderNo
+	}
+
+	// 沪市市价委托进入订单簿时已转为限价（剩余部分按成交价/保护价挂单），逐笔数据中不区分，统一按限价处理
 	res := &model.Order{
 		InstrumentId:   fmt.Sprintf("%s.SH", v.SecurityID),
 		OrderTimestamp: orderTimestamp,
-		OrderId:        v.BizIndex,
+		OrderId:        orderId,
 		OrderType:      orderType,
 		Direction:      direction,
-		Price:          v.Price,
+		Price:          priceE4ToFloat(v.Price),
+		PriceType:      constdef.PriceTypeLimit,
 		Volume:         v.Qty,
+		Channel:        v.Channel,
+		BizIndex:       v.BizIndex,
+		ExecType:       v.Type,
 		SeqNo:          v.SeqNo,
 		LocalTimestamp: localTimestamp,
+		PriceE4:        v.Price,
 	}
 
 	return res, nil
@@ -70,6 +83,123 @@ func ShRawTrade2OrderList(date string, rawList []*model.ShRawTrade) ([]*model.Or
 	return res, nil
 }
 
+type shOrderKey struct {
+	securityId string
+	orderNo    int64
+}
+
+// shAggressiveFill 一笔委托进入时立即撮合（作为主动方）的成交汇总
+type shAggressiveFill struct {
+	first     *model.ShRawTrade
+	qty       int64
+	worstPx   int64 // 买单取最高成交价、卖单取最低成交价，作为全部成交委托的价格下限估计
+	direction string
+}
+
+// ShRawTrade2OrderListRestoreQty 与 ShRawTrade2OrderList 相同，但还原沪市新增委托的原始数量
+// mdl_4_24_0 中进入时部分成交的委托，A 记录的 Qty 只是剩余挂单量，立即成交的部分只体现在 T 记录中；
+// 这里将 T 记录中主动方（TickBSFlag=B 取 BuyOrderNO，S 取 SellOrderNO）的成交量加回到 A 记录，
+// 对进入时即全部成交、没有 A 记录的委托，在其第一笔成交的位置合成一条新增委托。
+// 返回的第二个值为合成的新增委托数量
+func ShRawTrade2OrderListRestoreQty(date string, rawList []*model.ShRawTrade) ([]*model.Order, int, error) {
+	mapFill := make(map[shOrderKey]*shAggressiveFill)
+	mapAdd := make(map[shOrderKey]struct{})
+	for _, v := range rawList {
+		switch v.Type {
+		case "A":
+			orderNo := v.BuyOrderNo
+			if orderNo == 0 {
+				orderNo = v.SellOrderNo
+			}
+			mapAdd[shOrderKey{securityId: v.SecurityID, orderNo: orderNo}] = struct{}{}
+		case "T":
+			var orderNo int64
+			switch v.TickBSFlag {
+			case "B":
+				orderNo = v.BuyOrderNo
+			case "S":
+				orderNo = v.SellOrderNo
+			default:
+				// 集合竞价成交没有主动方
+				continue
+			}
+			key := shOrderKey{securityId: v.SecurityID, orderNo: orderNo}
+			fill, ok := mapFill[key]
+			if !ok {
+				fill = &shAggressiveFill{first: v, worstPx: v.Price, direction: ShRaw2Direction(v.TickBSFlag)}
+				mapFill[key] = fill
+			}
+			fill.qty += v.Qty
+			if fill.direction == constdef.DirectionBuy {
+				fill.worstPx = max(fill.worstPx, v.Price)
+			} else {
+				fill.worstPx = min(fill.worstPx, v.Price)
+			}
+		}
+	}
+
+	var res []*model.Order
+	synthesized := 0
+	for _, v := range rawList {
+		if v.Type == "T" {
+			var orderNo int64
+			switch v.TickBSFlag {
+			case "B":
+				orderNo = v.BuyOrderNo
+			case "S":
+				orderNo = v.SellOrderNo
+			default:
+				continue
+			}
+			key := shOrderKey{securityId: v.SecurityID, orderNo: orderNo}
+			fill := mapFill[key]
+			if _, ok := mapAdd[key]; ok || fill.first != v {
+				continue
+			}
+
+			orderTimestamp, err := utils.TimeToNano(date, v.TickTime)
+			if err != nil {
+				return nil, 0, errorx.NewError("timeToNano(%s %s) error: %v", date, v.TickTime, err)
+			}
+			localTimestamp, err := timeToNanoOrZero(date, v.LocalTime)
+			if err != nil {
+				return nil, 0, errorx.NewError("timeToNano(%s %s) error: %v", date, v.LocalTime, err)
+			}
+			res = append(res, &model.Order{
+				InstrumentId:   fmt.Sprintf("%s.SH", v.SecurityID),
+				OrderTimestamp: orderTimestamp,
+				OrderId:        orderNo,
+				OrderType:      constdef.OrderTypeAdd,
+				Direction:      fill.direction,
+				Price:          priceE4ToFloat(fill.worstPx),
+				PriceType:      constdef.PriceTypeUnknown,
+				Volume:         fill.qty,
+				Channel:        v.Channel, // 合成委托没有自己的 BizIndex，保持为 0
+				SeqNo:          v.SeqNo,
+				LocalTimestamp: localTimestamp,
+				PriceE4:        fill.worstPx,
+			})
+			synthesized++
+			continue
+		}
+
+		order, err := ShRawTrade2Order(date, v)
+		if err != nil {
+			return nil, 0, err
+		}
+		if order == nil {
+			continue
+		}
+		if order.OrderType == constdef.OrderTypeAdd {
+			if fill, ok := mapFill[shOrderKey{securityId: v.SecurityID, orderNo: order.OrderId}]; ok {
+				order.Volume += fill.qty
+			}
+		}
+		res = append(res, order)
+	}
+	return res, synthesized, nil
+}
+
 // ==== 沪市旧格式转换
 
 func OldShRawOrder2Order(date string, v *model.OldShRawOrder) (*model.Order, error) {
@@ -95,16 +225,22 @@ func OldShRawOrder2Order(date string, v *model.OldShRawOrder) (*model.Order, err
 
 	direction := ShRaw2Direction(v.OrderBSFlag)
 
+	// OrderNO 为原始订单号，与逐笔成交中的 TradeBuyNo/TradeSellNo 对应
 	res := &model.Order{
 		InstrumentId:   fmt.Sprintf("%s.SH", v.SecurityID),
 		OrderTimestamp: orderTimestamp,
-		OrderId:        v.BizIndex,
+		OrderId:        v.OrderNO,
 		OrderType:      orderType,
 		Direction:      direction,
-		Price:          v.OrderPrice,
+		Price:          priceE4ToFloat(v.OrderPrice),
+		PriceType:      constdef.PriceTypeLimit,
 		Volume:         int64(v.Balance),
+		Channel:        v.OrderChannel,
+		BizIndex:       v.BizIndex,
+		ExecType:       v.OrderType,
 		SeqNo:          v.SeqNo,
 		LocalTimestamp: localTimestamp,
+		PriceE4:        v.OrderPrice,
 	}
 
 	return res, nil
@@ -137,6 +273,19 @@ func SzRaw2OrderDirection(side int) string {
 	return constdef.DirectionUnknown
 }
 
+// SzRaw2OrderPriceType 深市 OrdType: 50='2' 限价, 49='1' 市价, 85='U' 本方最优
+func SzRaw2OrderPriceType(ordType int) string {
+	switch ordType {
+	case 50:
+		return constdef.PriceTypeLimit
+	case 49:
+		return constdef.PriceTypeMarket
+	case 85:
+		return constdef.PriceTypeBestOwn
+	}
+	return constdef.PriceTypeUnknown
+}
+
 func SzRawOrder2Order(date string, v *model.SzRawOrder) (*model.Order, error) {
 	orderTimestamp, err := utils.TimeToNano(date, v.TransactTime)
 	if err != nil {
@@ -156,10 +305,14 @@ func SzRawOrder2Order(date string, v *model.SzRawOrder) (*model.Order, error) {
 		OrderId:        v.ApplSeqNum,
 		OrderType:      constdef.OrderTypeAdd,
 		Direction:      direction,
-		Price:          v.Price,
+		Price:          priceE4ToFloat(v.Price),
+		PriceType:      SzRaw2OrderPriceType(v.OrdType),
 		Volume:         v.OrderQty,
+		Channel:        v.ChannelNo,
+		ApplSeqNum:     v.ApplSeqNum,
 		SeqNo:          v.SeqNo,
 		LocalTimestamp: localTimestamp,
+		PriceE4:        v.Price,
 	}
 
 	return res, nil
@@ -218,10 +371,15 @@ func SzRawTrade2CancelOrder(date string, v *model.SzRawTrade) (*model.Order, err
 		OrderId:        orderId,
 		OrderType:      constdef.OrderTypeCancel,
 		Direction:      direction,
-		Price:          v.LastPx,
+		Price:          priceE4ToFloat(v.LastPx),
+		PriceType:      constdef.PriceTypeUnknown,
 		Volume:         v.LastQty,
+		Channel:        v.ChannelNo,
+		ApplSeqNum:     v.ApplSeqNum,
+		ExecType:       string(rune(v.ExecType)),
 		SeqNo:          v.SeqNo,
 		LocalTimestamp: localTimestamp,
+		PriceE4:        v.LastPx,
 	}
 
 	return res, nil
@@ -242,21 +400,222 @@ func SzRawTrade2CancelOrderList(date string, rawList []*model.SzRawTrade) ([]*mo
 	return res, nil
 }
 
+type szOrderKey struct {
+	channelNo  int64
+	applSeqNum int64
+}
+
+// ResolveSzCancelOrderList 将深市撤单关联到 mdl_6_33_0 中的原始委托（同一 ChannelNo 下按 ApplSeqNum 匹配），
+// 用原始委托的价格和方向填充撤单（撤单记录的 LastPx 为 0，且 Bid/Offer 两侧都非零时方向未知）。
+// 找不到原始委托的撤单保持 SzRawTrade2CancelOrder 的结果，数量通过第二个返回值返回
+func ResolveSzCancelOrderList(date string, rawOrderList []*model.SzRawOrder, rawTradeList []*model.SzRawTrade) ([]*model.Order, int, error) {
+	mapRawOrder := make(map[szOrderKey]*model.SzRawOrder, len(rawOrderList))
+	for _, v := range rawOrderList {
+		mapRawOrder[szOrderKey{channelNo: v.ChannelNo, applSeqNum: v.ApplSeqNum}] = v
+	}
+
+	var res []*model.Order
+	orphan := 0
+	for _, v := range rawTradeList {
+		order, err := SzRawTrade2CancelOrder(date, v)
+		if err != nil {
+			return nil, 0, err
+		}
+		if order == nil {
+			continue
+		}
+
+		var rawOrder *model.SzRawOrder
+		for _, applSeqNum := range []int64{v.BidApplSeqNum, v.OfferApplSeqNum} {
+			if applSeqNum == 0 {
+				continue
+			}
+			if o, ok := mapRawOrder[szOrderKey{channelNo: v.ChannelNo, applSeqNum: applSeqNum}]; ok && o.SecurityID == v.SecurityID {
+				rawOrder = o
+				break
+			}
+		}
+
+		if rawOrder == nil {
+			orphan++
+		} else {
+			order.OrderId = rawOrder.ApplSeqNum
+			order.Price = priceE4ToFloat(rawOrder.Price)
+			order.PriceE4 = rawOrder.Price
+			order.Direction = SzRaw2OrderDirection(rawOrder.Side)
+			order.PriceType = SzRaw2OrderPriceType(rawOrder.OrdType)
+		}
+		res = append(res, order)
+	}
+	return res, orphan, nil
+}
+
+// ==== 有效价格
+
+type orderKey struct {
+	instrumentId string
+	orderId      int64
+}
+
+// FillOrderEffectivePrice 填充委托的 EffectivePrice
+// 限价单取委托价；市价/本方最优单优先取该委托第一笔成交的价格，没有成交时取委托时刻之前最近一笔快照的盘口价
+// （本方最优取本方一档，市价取对手方一档）；撤单沿用对应新增委托的有效价格。返回无法确定有效价格的委托数量
+func FillOrderEffectivePrice(orderList []*model.Order, tradeList []*model.Trade, snapshotList []*model.Snapshot) int {
+	type fill struct {
+		timestamp int64
+		price     int64
+	}
+	mapFirstFill := make(map[orderKey]*fill)
+	setFill := func(key orderKey, trade *model.Trade) {
+		if key.orderId == 0 {
+			return
+		}
+		if f, ok := mapFirstFill[key]; !ok || trade.TradeTimestamp < f.timestamp {
+			mapFirstFill[key] = &fill{timestamp: trade.TradeTimestamp, price: trade.PriceE4}
+		}
+	}
+	for _, v := range tradeList {
+		setFill(orderKey{instrumentId: v.InstrumentId, orderId: v.BuyOrderId}, v)
+		setFill(orderKey{instrumentId: v.InstrumentId, orderId: v.SellOrderId}, v)
+	}
+
+	mapSnapshot := GetMapSnapshot(snapshotList)
+	for _, list := range mapSnapshot {
+		sort.SliceStable(list, func(i, j int) bool {
+			return list[i].UpdateTimestamp < list[j].UpdateTimestamp
+		})
+	}
+	bookPrice := func(order *model.Order) int64 {
+		list := mapSnapshot[order.InstrumentId]
+		i := sort.Search(len(list), func(i int) bool {
+			return list[i].UpdateTimestamp > order.OrderTimestamp
+		})
+		if i == 0 {
+			return 0
+		}
+		snapshot := list[i-1]
+		ownBuy := order.Direction == constdef.DirectionBuy
+		if order.PriceType == constdef.PriceTypeMarket {
+			ownBuy = !ownBuy
+		}
+		if ownBuy && len(snapshot.BidPriceListE4) > 0 {
+			return snapshot.BidPriceListE4[0]
+		}
+		if !ownBuy && len(snapshot.AskPriceListE4) > 0 {
+			return snapshot.AskPriceListE4[0]
+		}
+		return 0
+	}
+
+	unresolved := 0
+	mapAddPrice := make(map[orderKey]int64)
+	for _, v := range orderList {
+		if v.OrderType != constdef.OrderTypeAdd {
+			continue
+		}
+		key := orderKey{instrumentId: v.InstrumentId, orderId: v.OrderId}
+		switch v.PriceType {
+		case constdef.PriceTypeMarket, constdef.PriceTypeBestOwn:
+			if f, ok := mapFirstFill[key]; ok {
+				v.EffectivePriceE4 = f.price
+			} else {
+				v.EffectivePriceE4 = bookPrice(v)
+			}
+		default:
+			v.EffectivePriceE4 = v.PriceE4
+		}
+		v.EffectivePrice = priceE4ToFloat(v.EffectivePriceE4)
+		if v.EffectivePriceE4 == 0 {
+			unresolved++
+		}
+		mapAddPrice[key] = v.EffectivePriceE4
+	}
+	for _, v := range orderList {
+		if v.OrderType != constdef.OrderTypeCancel {
+			continue
+		}
+		if price, ok := mapAddPrice[orderKey{instrumentId: v.InstrumentId, orderId: v.OrderId}]; ok {
+			v.EffectivePriceE4 = price
+		} else {
+			v.EffectivePriceE4 = v.PriceE4
+		}
+		v.EffectivePrice = priceE4ToFloat(v.EffectivePriceE4)
+	}
+	return unresolved
+}
+
+// FillLimitOrderEffectivePrice 未开启 order_effective_price 时只填充限价单（含撤单）的 EffectivePrice，
+// 市价/本方最优单需要成交和快照才能确定，保持 0
+func FillLimitOrderEffectivePrice(orderList []*model.Order) {
+	for _, v := range orderList {
+		if v.PriceType == constdef.PriceTypeLimit {
+			v.EffectivePrice = v.Price
+			v.EffectivePriceE4 = v.PriceE4
+		}
+	}
+}
+
 // ==== 合并 order
 
-func MergeRawOrder(srcDir string, dstDir string, date string) error {
-	if config.Cfg.IsPerDay() {
+func MergeRawOrder(day *DayContext, dstDir string) error {
+	date := day.Date
+	if config.Cfg.IsPerDay() || config.Cfg.IsHiveLayout() {
 		dstDir = filepath.Join(dstDir, constdef.DataTypeOrder)
 	} else {
 		dstDir = filepath.Join(dstDir, constdef.DataTypeOrder, date)
 	}
 
+	orderList, err := ReadRawOrderList(day)
+	if err != nil {
+		return err
+	}
+	sourceFileList := day.GetSourceFileList(constdef.DataTypeOrder)
+
+	// 根据 output_mode 选择写入方式
+	if config.Cfg.IsHiveLayout() {
+		logger.Info("Write HiveOrder.parquet Begin")
+		if err := WriteHiveParquet(dstDir, date, orderList, sourceFileList, func(v *model.Order) string { return v.InstrumentId },
+			func(v *model.Order) int64 { return v.OrderTimestamp }); err != nil {
+			return errorx.NewError("WriteHiveParquet(%s) date(%s) error: %v", dstDir, date, err)
+		}
+		logger.Info("Write HiveOrder.parquet End")
+	} else if config.Cfg.IsPerDay() {
+		logger.Info("Write AllOrder.parquet Begin")
+		if err := WriteAllOrderParquet(dstDir, date, orderList, sourceFileList); err != nil {
+			return errorx.NewError("WriteAllOrderParquet(%s) date(%s) error: %v", dstDir, date, err)
+		}
+		logger.Info("Write AllOrder.parquet End")
+	} else {
+		orderMap := GetMapOrder(orderList)
+
+		logger.Info("Write StockOrder.parquet Begin")
+		if err := WriteStockOrderParquet(dstDir, date, orderMap, sourceFileList); err != nil {
+			return errorx.NewError("WriteStockOrderParquet(%s) date(%s) error: %v", dstDir, date, err)
+		}
+		logger.Info("Write StockOrder.parquet End")
+	}
+
+	return nil
+}
+
+// RunReportOrderOrphanCancel 深市找不到原始新增委托的撤单数
+const RunReportOrderOrphanCancel = "order_orphan_cancel"
+
+// ReadRawOrderList 读取并转换沪深两市当天的逐笔委托（含深市撤单），返回按时间归并后的列表
+// 沪市新格式是否还原原始委托量由 sh_restore_order_qty 决定
+func ReadRawOrderList(day *DayContext) ([]*model.Order, error) {
+	return readRawOrderList(day, config.Cfg.ShRestoreOrderQty)
+}
+
+// readRawOrderList shRestoreQty 见 ShRawTrade2OrderListRestoreQty，order lifecycle 不论配置始终还原
+func readRawOrderList(day *DayContext, shRestoreQty bool) ([]*model.Order, error) {
+	srcDir, date := day.SrcDir, day.Date
 	szFilepath := filepath.Join(srcDir, date, fmt.Sprintf("%s_mdl_6_33_0.csv.zip", date))
 
 	// 读取和处理上海数据
 	currentDate := carbon.Parse(date).StartOfDay()
 	if currentDate.IsInvalid() {
-		return errorx.NewError("date(%s) is invalid", date)
+		return nil, errorx.NewError("date(%s) is invalid", date)
 	}
 
 	// 沪市逐笔委托数据从 20210607 起才有，此前跳过沪市部分
@@ -270,13 +629,14 @@ func MergeRawOrder(srcDir string, dstDir string, date string) error {
 		logger.Info("Read Old Sh Raw Order Begin")
 		oldShRawOrderList, err := ManualReadOldShRawOrder(shFilepath)
 		if err != nil {
-			return errorx.NewError("ManualReadOldShRawOrder(%s) error: %s", shFilepath, err)
+			return nil, errorx.NewError("ManualReadOldShRawOrder(%s) error: %s", shFilepath, err)
 		}
+		day.AddSourceFile(constdef.DataTypeOrder, shFilepath)
 		logger.Info("Read Old Sh Raw Order End")
 
 		shOrderList, err = OldShRawOrder2OrderList(date, oldShRawOrderList)
 		if err != nil {
-			return errorx.NewError("OldShRawOrder2OrderList(%s) error: %s", shFilepath, err)
+			return nil, errorx.NewError("OldShRawOrder2OrderList(%s) error: %s", shFilepath, err)
 		}
 		logger.Info("Convert Old Sh Raw Order End")
 	} else {
@@ -286,28 +646,43 @@ func MergeRawOrder(srcDir string, dstDir string, date string) error {
 		logger.Info("Read Sh Raw Order Begin (from mdl_4_24_0)")
 		shRawTradeList, err := ManualReadShRawTrade(shFilepath)
 		if err != nil {
-			return errorx.NewError("ManualReadShRawTrade(%s) error: %s", shFilepath, err)
+			return nil, errorx.NewError("ManualReadShRawTrade(%s) error: %s", shFilepath, err)
 		}
+		day.AddSourceFile(constdef.DataTypeOrder, shFilepath)
 		logger.Info("Read Sh Raw Order End")
 
-		shOrderList, err = ShRawTrade2OrderList(date, shRawTradeList)
-		if err != nil {
-			return errorx.NewError("ShRawTrade2OrderList(%s) error: %s", shFilepath, err)
+		day.CheckSequenceOnce(constdef.MarketSH, constdef.DataTypeOrder, func() [][]*SequenceRecord {
+			return [][]*SequenceRecord{ShRawTrade2SequenceList(shRawTradeList)}
+		}, true)
+
+		if shRestoreQty {
+			var synthesized int
+			shOrderList, synthesized, err = ShRawTrade2OrderListRestoreQty(date, shRawTradeList)
+			if err != nil {
+				return nil, errorx.NewError("ShRawTrade2OrderListRestoreQty(%s) error: %s", shFilepath, err)
+			}
+			logger.Info("Convert Sh Raw Order End (restore qty), synthesized add count=%d", synthesized)
+		} else {
+			shOrderList, err = ShRawTrade2OrderList(date, shRawTradeList)
+			if err != nil {
+				return nil, errorx.NewError("ShRawTrade2OrderList(%s) error: %s", shFilepath, err)
+			}
+			logger.Info("Convert Sh Raw Order End")
 		}
-		logger.Info("Convert Sh Raw Order End")
 	}
 
 	// 读取和处理深圳委托数据（mdl_6_33_0，仅包含新增委托）
 	logger.Info("Read Sz Raw Order Begin")
 	szRawOrderList, err := ManualReadSzRawOrder(szFilepath)
 	if err != nil {
-		return errorx.NewError("ManualReadSzRawOrder(%s) error: %s", szFilepath, err)
+		return nil, errorx.NewError("ManualReadSzRawOrder(%s) error: %s", szFilepath, err)
 	}
+	day.AddSourceFile(constdef.DataTypeOrder, szFilepath)
 	logger.Info("Read Sz Raw Order End")
 
 	szOrderList, err := SzRawOrder2OrderList(date, szRawOrderList)
 	if err != nil {
-		return errorx.NewError("SzRawOrder2OrderList(%s) error: %s", szFilepath, err)
+		return nil, errorx.NewError("SzRawOrder2OrderList(%s) error: %s", szFilepath, err)
 	}
 	logger.Info("Convert Sz Raw Order End, add count=%d", len(szOrderList))
 
@@ -316,41 +691,59 @@ func MergeRawOrder(srcDir string, dstDir string, date string) error {
 	logger.Info("Read Sz Raw Trade for Cancel Orders Begin")
 	szRawTradeList, err := ManualReadSzRawTrade(szTradeFilepath)
 	if err != nil {
-		return errorx.NewError("ManualReadSzRawTrade(%s) error: %s", szTradeFilepath, err)
+		return nil, errorx.NewError("ManualReadSzRawTrade(%s) error: %s", szTradeFilepath, err)
 	}
+	day.AddSourceFile(constdef.DataTypeOrder, szTradeFilepath)
 	logger.Info("Read Sz Raw Trade End")
 
-	szCancelOrderList, err := SzRawTrade2CancelOrderList(date, szRawTradeList)
+	day.CheckSequenceOnce(constdef.MarketSZ, constdef.DataTypeOrder, func() [][]*SequenceRecord {
+		return [][]*SequenceRecord{SzRawOrder2SequenceList(szRawOrderList), SzRawTrade2SequenceList(szRawTradeList)}
+	}, true)
+
+	szCancelOrderList, orphanCancel, err := ResolveSzCancelOrderList(date, szRawOrderList, szRawTradeList)
 	if err != nil {
-		return errorx.NewError("SzRawTrade2CancelOrderList(%s) error: %s", szTradeFilepath, err)
+		return nil, errorx.NewError("ResolveSzCancelOrderList(%s) error: %s", szTradeFilepath, err)
 	}
 	logger.Info("Convert Sz Cancel Order End, cancel count=%d", len(szCancelOrderList))
+	SetRunReportCount(RunReportOrderOrphanCancel, int64(orphanCancel))
+	if orphanCancel > 0 {
+		logger.Warn("Sz Cancel Order date(%s): %d cancels have no matching add order in %s", date, orphanCancel, szFilepath)
+	}
 
 	// 合并深市新增委托 + 撤单委托
 	szOrderList = append(szOrderList, szCancelOrderList...)
 
+	// 去重
+	shOrderList, shDropped := DedupOrderList(shOrderList, currentDate.Gte(shNewTradeStartDay))
+	szOrderList, szDropped := DedupOrderList(szOrderList, true)
+	logDedup(constdef.DataTypeOrder, date, shDropped+szDropped)
+	SetRunReportCount(RunReportOrderDuplicate, int64(shDropped+szDropped))
+
 	// 排序
 	orderList := SortOrderRaw(shOrderList, szOrderList)
 	logger.Info("Convert All Raw Order End")
 
-	// 根据 output_mode 选择写入方式
-	if config.Cfg.IsPerDay() {
-		logger.Info("Write AllOrder.parquet Begin")
-		if err := WriteAllOrderParquet(dstDir, date, orderList); err != nil {
-			return errorx.NewError("WriteAllOrderParquet(%s) date(%s) error: %v", dstDir, date, err)
-		}
-		logger.Info("Write AllOrder.parquet End")
-	} else {
-		orderMap := GetMapOrder(orderList)
+	CheckOrderTickSize(date, orderList)
 
-		logger.Info("Write StockOrder.parquet Begin")
-		if err := WriteStockOrderParquet(dstDir, date, orderMap); err != nil {
-			return errorx.NewError("WriteStockOrderParquet(%s) date(%s) error: %v", dstDir, date, err)
+	if config.Cfg.OrderEffectivePrice {
+		logger.Info("Fill Order EffectivePrice Begin")
+		tradeList, err := ReadRawTradeList(day)
+		if err != nil {
+			return nil, err
 		}
-		logger.Info("Write StockOrder.parquet End")
+		snapshotList, err := ReadRawSnapshotList(day)
+		if err != nil {
+			return nil, err
+		}
+		if unresolved := FillOrderEffectivePrice(orderList, tradeList, snapshotList); unresolved > 0 {
+			logger.Warn("Fill Order EffectivePrice date(%s): %d add orders have no effective price", date, unresolved)
+		}
+		logger.Info("Fill Order EffectivePrice End")
+	} else {
+		FillLimitOrderEffectivePrice(orderList)
 	}
 
-	return nil
+	return orderList, nil
 }
 
 func SortOrderRaw(a []*model.Order, b []*model.Order) []*model.Order {
@@ -400,16 +793,20 @@ func GetMapOrder(orderList []*model.Order) map[string][]*model.Order {
 	return res
 }
 
-func WriteAllOrderParquet(dstDir string, date string, orderList []*model.Order) error {
+func WriteAllOrderParquet(dstDir string, date string, orderList []*model.Order, sourceFileList []string) error {
 	if err := os.MkdirAll(dstDir, 0755); err != nil {
 		return errorx.NewError("MkdirAll(%s) error: %v", dstDir, err)
 	}
 
-	filePath := filepath.Join(dstDir, fmt.Sprintf("%s_order.parquet", date))
+	filePath := filepath.Join(dstDir, layout.GetPerDayFileName(date, constdef.DataTypeOrder))
+	if config.Cfg.IsPerDayClustered() {
+		return WriteClusteredOutputFile(filePath, orderList, sourceFileList, func(v *model.Order) string { return v.InstrumentId },
+			func(v *model.Order) int64 { return v.OrderTimestamp })
+	}
 
-	pw, err := NewParquetWriter(filePath, new(model.Order))
+	pw, err := NewOutputWriter(filePath, new(model.Order), sourceFileList)
 	if err != nil {
-		return errorx.NewError("NewParquetWriter error: %s", err)
+		return errorx.NewError("NewOutputWriter error: %s", err)
 	}
 
 	defer func() {
@@ -430,17 +827,17 @@ func WriteAllOrderParquet(dstDir string, date string, orderList []*model.Order)
 	return nil
 }
 
-func WriteStockOrderParquet(dstDir string, date string, mapOrder map[string][]*model.Order) error {
+func WriteStockOrderParquet(dstDir string, date string, mapOrder map[string][]*model.Order, sourceFileList []string) error {
 	if err := os.MkdirAll(dstDir, 0755); err != nil {
 		return errorx.NewError("MkdirAll(%s) error: %v", dstDir, err)
 	}
 
 	for instrumentId, orderList := range mapOrder {
-		filePath := filepath.Join(dstDir, fmt.Sprintf("%s_order_%s.parquet", date, instrumentId))
+		filePath := filepath.Join(dstDir, layout.GetPerStockFileName(date, constdef.DataTypeOrder, instrumentId))
 
-		pw, err := NewParquetWriter(filePath, new(model.Order))
+		pw, err := NewOutputWriter(filePath, new(model.Order), sourceFileList)
 		if err != nil {
-			return errorx.NewError("NewParquetWriter error: %s", err)
+			return errorx.NewError("NewOutputWriter error: %s", err)
 		}
 
 		defer func() {
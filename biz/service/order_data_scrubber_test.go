@@ -105,7 +105,7 @@ func TestManualReadSzRawOrder(t *testing.T) {
 		t.Errorf("第一条 Side=%d 不合法", first.Side)
 	}
 	t.Logf("第一条: SecurityID=%s, TransactTime=%s, Side=%d, Price=%.4f, OrderQty=%d",
-		first.SecurityID, first.TransactTime, first.Side, first.Price, first.OrderQty)
+		first.SecurityID, first.TransactTime, first.Side, priceE4ToFloat(first.Price), first.OrderQty)
 }
 
 // 测试深市转换为统一 Order
@@ -183,6 +183,186 @@ func TestShRawTrade2OrderList(t *testing.T) {
 	}
 }
 
+// 沪市 OrderId 为交易所委托号，BizIndex 单独输出
+func TestShOrderIdMapping(t *testing.T) {
+	rawList := []*model.ShRawTrade{
+		{BizIndex: 101, Channel: 1, SecurityID: "600000", TickTime: "09:30:00.000", Type: "A", BuyOrderNo: 7, Price: 100000, Qty: 100, TickBSFlag: "B"},
+		{BizIndex: 102, Channel: 1, SecurityID: "600000", TickTime: "09:30:01.000", Type: "D", SellOrderNo: 8, Price: 100100, Qty: 200, TickBSFlag: "S"},
+	}
+	orderList, err := ShRawTrade2OrderList("20240115", rawList)
+	if err != nil {
+		t.Fatalf("ShRawTrade2OrderList error: %v", err)
+	}
+	if len(orderList) != 2 || orderList[0].OrderId != 7 || orderList[0].BizIndex != 101 ||
+		orderList[1].OrderId != 8 || orderList[1].BizIndex != 102 || orderList[1].Direction != constdef.DirectionSell {
+		t.Errorf("新格式 orderList[0]=%+v orderList[1]=%+v", orderList[0], orderList[1])
+	}
+
+	order, err := OldShRawOrder2Order("20220708", &model.OldShRawOrder{
+		OrderChannel: 3, SecurityID: "603758", OrderTime: "09:15:00.260", OrderType: "A",
+		OrderNO: 979, OrderPrice: 101800, Balance: 1800, OrderBSFlag: "S", BizIndex: 1,
+	})
+	if err != nil {
+		t.Fatalf("OldShRawOrder2Order error: %v", err)
+	}
+	if order.OrderId != 979 || order.BizIndex != 1 || order.Channel != 3 || order.Volume != 1800 {
+		t.Errorf("旧格式 order=%+v", order)
+	}
+}
+
+// 测试沪市新格式还原原始委托量
+func TestShRawTrade2OrderListRestoreQty(t *testing.T) {
+	rawList := []*model.ShRawTrade{
+		// 卖单 1 挂单 1000
+		{SecurityID: "600000", TickTime: "09:30:00.000", Type: "A", SellOrderNo: 1, Price: 100000, Qty: 1000, TickBSFlag: "S"},
+		// 买单 2 委托 600，进入时成交 400，剩余 200 挂单
+		{SecurityID: "600000", TickTime: "09:30:01.000", Type: "T", BuyOrderNo: 2, SellOrderNo: 1, Price: 100000, Qty: 400, TickBSFlag: "B"},
+		{SecurityID: "600000", TickTime: "09:30:01.000", Type: "A", BuyOrderNo: 2, Price: 100100, Qty: 200, TickBSFlag: "B"},
+		// 买单 3 委托 500，进入时全部成交，没有 A 记录
+		{SecurityID: "600000", TickTime: "09:30:02.000", Type: "T", BuyOrderNo: 3, SellOrderNo: 1, Price: 100000, Qty: 300, TickBSFlag: "B", SeqNo: 7},
+		{SecurityID: "600000", TickTime: "09:30:02.000", Type: "T", BuyOrderNo: 3, SellOrderNo: 4, Price: 100200, Qty: 200, TickBSFlag: "B"},
+		{SecurityID: "600000", TickTime: "10:00:00.000", Type: "D", BuyOrderNo: 2, Price: 100100, Qty: 200, TickBSFlag: "B"},
+	}
+
+	orderList, synthesized, err := ShRawTrade2OrderListRestoreQty("20240115", rawList)
+	if err != nil {
+		t.Fatalf("ShRawTrade2OrderListRestoreQty error: %v", err)
+	}
+	if synthesized != 1 {
+		t.Errorf("synthesized=%d, 期望1", synthesized)
+	}
+	if len(orderList) != 4 {
+		t.Fatalf("委托数量=%d, 期望4", len(orderList))
+	}
+
+	want := []struct {
+		orderId   int64
+		orderType string
+		direction string
+		price     float64
+		volume    int64
+	}{
+		{1, constdef.OrderTypeAdd, constdef.DirectionSell, 10.00, 1000},
+		{2, constdef.OrderTypeAdd, constdef.DirectionBuy, 10.01, 600},
+		{3, constdef.OrderTypeAdd, constdef.DirectionBuy, 10.02, 500},
+		{2, constdef.OrderTypeCancel, constdef.DirectionBuy, 10.01, 200},
+	}
+	for i, w := range want {
+		o := orderList[i]
+		if o.OrderId != w.orderId || o.OrderType != w.orderType || o.Direction != w.direction ||
+			o.Price != w.price || o.Volume != w.volume {
+			t.Errorf("orderList[%d]=%+v, 期望 %+v", i, o, w)
+		}
+	}
+	if orderList[2].SeqNo != 7 {
+		t.Errorf("合成委托 SeqNo=%d, 期望取第一笔成交的 7", orderList[2].SeqNo)
+	}
+}
+
+// 测试深市撤单关联原始委托
+func TestResolveSzCancelOrderList(t *testing.T) {
+	rawOrderList := []*model.SzRawOrder{
+		{ChannelNo: 2011, ApplSeqNum: 10, SecurityID: "000001", Price: 115000, OrderQty: 500, Side: 49, TransactTime: "09:30:00.000"},
+		{ChannelNo: 2012, ApplSeqNum: 10, SecurityID: "000002", Price: 82000, OrderQty: 300, Side: 50, TransactTime: "09:30:00.000"},
+	}
+	rawTradeList := []*model.SzRawTrade{
+		// 成交记录，不输出
+		{ChannelNo: 2011, ApplSeqNum: 11, BidApplSeqNum: 10, OfferApplSeqNum: 9, SecurityID: "000001", LastPx: 115000, LastQty: 100, ExecType: 70, TransactTime: "09:30:01.000"},
+		// 买方撤单
+		{ChannelNo: 2011, ApplSeqNum: 12, BidApplSeqNum: 10, SecurityID: "000001", LastQty: 400, ExecType: 52, TransactTime: "09:31:00.000"},
+		// 同一 ApplSeqNum 不同通道，应匹配 2012 的卖单
+		{ChannelNo: 2012, ApplSeqNum: 13, OfferApplSeqNum: 10, SecurityID: "000002", LastQty: 300, ExecType: 52, TransactTime: "09:32:00.000"},
+		// 找不到原始委托
+		{ChannelNo: 2012, ApplSeqNum: 14, OfferApplSeqNum: 99, SecurityID: "000002", LastQty: 100, ExecType: 52, TransactTime: "09:33:00.000"},
+	}
+
+	cancelList, orphan, err := ResolveSzCancelOrderList("20240115", rawOrderList, rawTradeList)
+	if err != nil {
+		t.Fatalf("ResolveSzCancelOrderList error: %v", err)
+	}
+	if orphan != 1 {
+		t.Errorf("orphan=%d, 期望1", orphan)
+	}
+	if len(cancelList) != 3 {
+		t.Fatalf("撤单数量=%d, 期望3", len(cancelList))
+	}
+
+	if c := cancelList[0]; c.OrderId != 10 || c.Price != 11.50 || c.Direction != constdef.DirectionBuy || c.Volume != 400 {
+		t.Errorf("cancelList[0]=%+v", c)
+	}
+	// 交易所原生字段：ApplSeqNum 为撤单记录自身的记录号，OrderId 指向原始委托
+	if c := cancelList[0]; c.Channel != 2011 || c.ApplSeqNum != 12 || c.ExecType != "4" || c.BizIndex != 0 {
+		t.Errorf("cancelList[0] 原生字段=%+v", c)
+	}
+	if c := cancelList[1]; c.InstrumentId != "000002.SZ" || c.Price != 8.20 || c.Direction != constdef.DirectionSell {
+		t.Errorf("cancelList[1]=%+v", c)
+	}
+	if c := cancelList[2]; c.Price != 0 || c.OrderType != constdef.OrderTypeCancel {
+		t.Errorf("cancelList[2]=%+v", c)
+	}
+}
+
+// 测试委托价格类型和有效价格
+func TestFillOrderEffectivePrice(t *testing.T) {
+	date := "20240115"
+	rawOrderList := []*model.SzRawOrder{
+		{ChannelNo: 2011, ApplSeqNum: 1, SecurityID: "000001", Price: 100000, OrderQty: 100, Side: 49, OrdType: 50, TransactTime: "09:30:00.000"},
+		{ChannelNo: 2011, ApplSeqNum: 2, SecurityID: "000001", Price: 0, OrderQty: 100, Side: 49, OrdType: 49, TransactTime: "09:30:01.000"},
+		{ChannelNo: 2011, ApplSeqNum: 3, SecurityID: "000001", Price: 0, OrderQty: 100, Side: 50, OrdType: 85, TransactTime: "09:30:02.000"},
+		{ChannelNo: 2011, ApplSeqNum: 4, SecurityID: "000001", Price: 0, OrderQty: 100, Side: 49, OrdType: 49, TransactTime: "09:30:03.000"},
+	}
+	orderList, err := SzRawOrder2OrderList(date, rawOrderList)
+	if err != nil {
+		t.Fatalf("SzRawOrder2OrderList error: %v", err)
+	}
+	wantPriceType := []string{constdef.PriceTypeLimit, constdef.PriceTypeMarket, constdef.PriceTypeBestOwn, constdef.PriceTypeMarket}
+	for i, o := range orderList {
+		if o.PriceType != wantPriceType[i] {
+			t.Errorf("orderList[%d].PriceType=%s, 期望%s", i, o.PriceType, wantPriceType[i])
+		}
+	}
+	orderList = append(orderList, &model.Order{
+		InstrumentId: "000001.SZ", OrderTimestamp: mustTimeToNano(t, date, "09:31:00.000"),
+		OrderId: 3, OrderType: constdef.OrderTypeCancel, PriceType: constdef.PriceTypeBestOwn, Volume: 100,
+	})
+
+	tradeList := []*model.Trade{
+		{InstrumentId: "000001.SZ", TradeTimestamp: mustTimeToNano(t, date, "09:30:01.000"), Price: 10.05, PriceE4: 100500, BuyOrderId: 2, SellOrderId: 9},
+	}
+	snapshotList := []*model.Snapshot{
+		{InstrumentId: "000001.SZ", UpdateTimestamp: mustTimeToNano(t, date, "09:30:00.000"),
+			BidPriceList: []float64{9.98}, AskPriceList: []float64{10.02}, BidPriceListE4: []int64{99800}, AskPriceListE4: []int64{100200}},
+	}
+
+	unresolved := FillOrderEffectivePrice(orderList, tradeList, snapshotList)
+	if unresolved != 0 {
+		t.Errorf("unresolved=%d, 期望0", unresolved)
+	}
+	// 限价取委托价；市价有成交取首笔成交价；本方最优卖单取卖一；市价买单无成交取卖一；撤单沿用新增委托
+	want := []int64{100000, 100500, 100200, 100200, 100200}
+	for i, o := range orderList {
+		if o.EffectivePriceE4 != want[i] || o.EffectivePrice != priceE4ToFloat(want[i]) {
+			t.Errorf("orderList[%d].EffectivePrice=%v(%d), 期望%d", i, o.EffectivePrice, o.EffectivePriceE4, want[i])
+		}
+	}
+}
+
+// 测试未开启 order_effective_price 时只填充限价单
+func TestFillLimitOrderEffectivePrice(t *testing.T) {
+	orderList := []*model.Order{
+		{PriceType: constdef.PriceTypeLimit, Price: 10.00, PriceE4: 100000},
+		{PriceType: constdef.PriceTypeMarket, Price: 0},
+		{PriceType: constdef.PriceTypeLimit, OrderType: constdef.OrderTypeCancel, Price: 9.99, PriceE4: 99900},
+	}
+	FillLimitOrderEffectivePrice(orderList)
+	want := []float64{10.00, 0, 9.99}
+	for i, o := range orderList {
+		if o.EffectivePrice != want[i] || o.EffectivePriceE4 != o.PriceE4 {
+			t.Errorf("orderList[%d].EffectivePrice=%v, 期望%v", i, o.EffectivePrice, want[i])
+		}
+	}
+}
+
 // 测试排序合并
 func TestSortOrderRaw(t *testing.T) {
 	a := []*model.Order{
@@ -233,7 +413,7 @@ func TestMergeRawOrder_OldFormat(t *testing.T) {
 	outDir := filepath.Join(dstDir, constdef.DataTypeOrder, "20220708")
 	os.RemoveAll(outDir)
 
-	err := MergeRawOrder(srcDir, dstDir, "20220708")
+	err := MergeRawOrder(NewDayContext(srcDir, "20220708"), dstDir)
 	if err != nil {
 		t.Fatalf("MergeRawOrder error: %v", err)
 	}
@@ -263,7 +443,7 @@ func TestMergeRawOrder_NewFormat(t *testing.T) {
 	outDir := filepath.Join(dstDir, constdef.DataTypeOrder, "20260213")
 	os.RemoveAll(outDir)
 
-	err := MergeRawOrder(srcDir, dstDir, "20260213")
+	err := MergeRawOrder(NewDayContext(srcDir, "20260213"), dstDir)
 	if err != nil {
 		t.Fatalf("MergeRawOrder error: %v", err)
 	}
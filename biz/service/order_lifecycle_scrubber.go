@@ -0,0 +1,236 @@
+package service
+
+import (
+	"data-scrubber/biz/constdef"
+	"data-scrubber/biz/errorx"
+	"data-scrubber/biz/layout"
+	"data-scrubber/biz/model"
+	"data-scrubber/config"
+	"os"
+	"path/filepath"
+	"sort"
+
+	logger "github.com/2997215859/golog"
+)
+
+// 运行报告计数
+const (
+	RunReportOrderLifecycleOrphan     = "order_lifecycle_orphan"     // 成交或撤单引用、但没有新增委托记录的委托号数
+	RunReportOrderLifecycleOverfilled = "order_lifecycle_overfilled" // 成交加撤单超过委托量的委托数
+)
+
+// BuildOrderLifecycleList 将单个票的委托（新增/撤单）和成交按委托号关联，得到每笔委托的生命周期
+// orderList / tradeList 均为同一个票的数据；只在成交中出现、没有新增委托记录的委托号计入 orphan 返回；
+// 成交加撤单超过委托量的委托 RemainingQty 记为 0，个数计入 overfilled 返回
+// OrderQty 需为原始委托量：沪市新格式 A 记录只有剩余挂单量，调用方需先还原（见 ShRawTrade2OrderListRestoreQty）
+func BuildOrderLifecycleList(instrumentId string, orderList []*model.Order, tradeList []*model.Trade) ([]*model.OrderLifecycle, int, int) {
+	mapLifecycle := make(map[int64]*model.OrderLifecycle)
+	orphanOrderId := make(map[int64]struct{})
+
+	for _, v := range orderList {
+		if v == nil || v.OrderType != constdef.OrderTypeAdd {
+			continue
+		}
+		if _, ok := mapLifecycle[v.OrderId]; ok {
+			continue
+		}
+		mapLifecycle[v.OrderId] = &model.OrderLifecycle{
+			InstrumentId: instrumentId,
+			OrderId:      v.OrderId,
+			Direction:    v.Direction,
+			AddTimestamp: v.OrderTimestamp,
+			Price:        v.Price,
+			OrderQty:     v.Volume,
+			PriceE4:      v.PriceE4,
+		}
+	}
+
+	sorted := make([]*model.Trade, 0, len(tradeList))
+	for _, v := range tradeList {
+		if v != nil {
+			sorted = append(sorted, v)
+		}
+	}
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].TradeTimestamp < sorted[j].TradeTimestamp
+	})
+
+	fill := func(orderId int64, trade *model.Trade) {
+		if orderId == 0 {
+			return
+		}
+		lifecycle, ok := mapLifecycle[orderId]
+		if !ok {
+			orphanOrderId[orderId] = struct{}{}
+			return
+		}
+		if lifecycle.FillCount == 0 {
+			lifecycle.FirstFillTimestamp = trade.TradeTimestamp
+		}
+		lifecycle.LastFillTimestamp = trade.TradeTimestamp
+		lifecycle.FilledQty += trade.Volume
+		lifecycle.FillCount++
+	}
+	for _, trade := range sorted {
+		fill(trade.BuyOrderId, trade)
+		fill(trade.SellOrderId, trade)
+	}
+
+	for _, v := range orderList {
+		if v == nil || v.OrderType != constdef.OrderTypeCancel {
+			continue
+		}
+		lifecycle, ok := mapLifecycle[v.OrderId]
+		if !ok {
+			orphanOrderId[v.OrderId] = struct{}{}
+			continue
+		}
+		if lifecycle.CancelTimestamp == 0 {
+			lifecycle.CancelTimestamp = v.OrderTimestamp
+		}
+		lifecycle.CancelQty += v.Volume
+	}
+
+	res := make([]*model.OrderLifecycle, 0, len(mapLifecycle))
+	overfilled := 0
+	for _, lifecycle := range mapLifecycle {
+		lifecycle.RemainingQty = lifecycle.OrderQty - lifecycle.FilledQty - lifecycle.CancelQty
+		if lifecycle.RemainingQty < 0 {
+			overfilled++
+			lifecycle.RemainingQty = 0
+		}
+
+		switch {
+		case lifecycle.CancelQty > 0:
+			lifecycle.State = constdef.OrderStateCancelled
+		case lifecycle.FilledQty > 0 && lifecycle.RemainingQty == 0:
+			lifecycle.State = constdef.OrderStateFilled
+		case lifecycle.FilledQty > 0:
+			lifecycle.State = constdef.OrderStatePartiallyFilled
+		default:
+			lifecycle.State = constdef.OrderStateLive
+		}
+		res = append(res, lifecycle)
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].AddTimestamp != res[j].AddTimestamp {
+			return res[i].AddTimestamp < res[j].AddTimestamp
+		}
+		return res[i].OrderId < res[j].OrderId
+	})
+
+	return res, len(orphanOrderId), overfilled
+}
+
+// ==== 合并 order lifecycle
+
+func MergeRawOrderLifecycle(day *DayContext, dstDir string) error {
+	date := day.Date
+	if config.Cfg.IsPerDay() || config.Cfg.IsHiveLayout() {
+		dstDir = filepath.Join(dstDir, constdef.DataTypeOrderLifecycle)
+	} else {
+		dstDir = filepath.Join(dstDir, constdef.DataTypeOrderLifecycle, date)
+	}
+
+	// 不论 sh_restore_order_qty 是否开启，生命周期都基于还原后的沪市委托量
+	orderList, err := readRawOrderList(day, true)
+	if err != nil {
+		return err
+	}
+	tradeList, err := ReadRawTradeList(day)
+	if err != nil {
+		return err
+	}
+
+	orderMap := GetMapOrder(orderList)
+	tradeMap := GetMapTrade(tradeList)
+	sourceFileList := day.GetSourceFileList(constdef.DataTypeOrder, constdef.DataTypeTrade)
+
+	lifecycleMap := make(map[string][]*model.OrderLifecycle, len(orderMap))
+	orphanCount, overfilledCount := 0, 0
+	for instrumentId, list := range orderMap {
+		lifecycleList, orphan, overfilled := BuildOrderLifecycleList(instrumentId, list, tradeMap[instrumentId])
+		lifecycleMap[instrumentId] = lifecycleList
+		orphanCount += orphan
+		overfilledCount += overfilled
+	}
+	for instrumentId, list := range tradeMap {
+		if _, ok := orderMap[instrumentId]; ok {
+			continue
+		}
+		// 没有委托数据的票（如 20210607 之前的沪市），成交全部是 orphan
+		_, orphan, _ := BuildOrderLifecycleList(instrumentId, nil, list)
+		orphanCount += orphan
+	}
+	logger.Info("Build OrderLifecycle End, instrument count=%d", len(lifecycleMap))
+	SetRunReportCount(RunReportOrderLifecycleOrphan, int64(orphanCount))
+	if orphanCount > 0 {
+		logger.Warn("Build OrderLifecycle date(%s): %d order ids referenced by trades/cancels have no add record", date, orphanCount)
+	}
+	SetRunReportCount(RunReportOrderLifecycleOverfilled, int64(overfilledCount))
+	if overfilledCount > 0 {
+		logger.Warn("Build OrderLifecycle date(%s): %d orders filled and cancelled more than OrderQty, RemainingQty set to 0", date, overfilledCount)
+	}
+
+	if config.Cfg.IsHiveLayout() {
+		logger.Info("Write HiveOrderLifecycle.parquet Begin")
+		if err := WriteHiveParquet(dstDir, date, flattenInstrumentMap(lifecycleMap), sourceFileList, func(v *model.OrderLifecycle) string { return v.InstrumentId },
+			func(v *model.OrderLifecycle) int64 { return v.AddTimestamp }); err != nil {
+			return errorx.NewError("WriteHiveParquet(%s) date(%s) error: %v", dstDir, date, err)
+		}
+		logger.Info("Write HiveOrderLifecycle.parquet End")
+	} else if config.Cfg.IsPerDay() {
+		logger.Info("Write AllOrderLifecycle.parquet Begin")
+		if err := WriteAllOrderLifecycleParquet(dstDir, date, lifecycleMap, sourceFileList); err != nil {
+			return errorx.NewError("WriteAllOrderLifecycleParquet(%s) date(%s) error: %v", dstDir, date, err)
+		}
+		logger.Info("Write AllOrderLifecycle.parquet End")
+	} else {
+		logger.Info("Write StockOrderLifecycle.parquet Begin")
+		if err := WriteStockOrderLifecycleParquet(dstDir, date, lifecycleMap, sourceFileList); err != nil {
+			return errorx.NewError("WriteStockOrderLifecycleParquet(%s) date(%s) error: %v", dstDir, date, err)
+		}
+		logger.Info("Write StockOrderLifecycle.parquet End")
+	}
+
+	return nil
+}
+
+func WriteAllOrderLifecycleParquet(dstDir string, date string, mapLifecycle map[string][]*model.OrderLifecycle, sourceFileList []string) error {
+	if err := os.MkdirAll(dstDir, 0755); err != nil {
+		return errorx.NewError("MkdirAll(%s) error: %v", dstDir, err)
+	}
+
+	list := make([]*model.OrderLifecycle, 0)
+	for _, lifecycleList := range mapLifecycle {
+		list = append(list, lifecycleList...)
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		if list[i].AddTimestamp != list[j].AddTimestamp {
+			return list[i].AddTimestamp < list[j].AddTimestamp
+		}
+		return list[i].InstrumentId < list[j].InstrumentId
+	})
+
+	filePath := filepath.Join(dstDir, layout.GetPerDayFileName(date, constdef.DataTypeOrderLifecycle))
+	if config.Cfg.IsPerDayClustered() {
+		return WriteClusteredOutputFile(filePath, list, sourceFileList, func(v *model.OrderLifecycle) string { return v.InstrumentId },
+			func(v *model.OrderLifecycle) int64 { return v.AddTimestamp })
+	}
+	return WriteOutputFile(filePath, list, sourceFileList)
+}
+
+func WriteStockOrderLifecycleParquet(dstDir string, date string, mapLifecycle map[string][]*model.OrderLifecycle, sourceFileList []string) error {
+	if err := os.MkdirAll(dstDir, 0755); err != nil {
+		return errorx.NewError("MkdirAll(%s) error: %v", dstDir, err)
+	}
+
+	for instrumentId, lifecycleList := range mapLifecycle {
+		filePath := filepath.Join(dstDir, layout.GetPerStockFileName(date, constdef.DataTypeOrderLifecycle, instrumentId))
+		if err := WriteOutputFile(filePath, lifecycleList, sourceFileList); err != nil {
+			return err
+		}
+	}
+	return nil
+}
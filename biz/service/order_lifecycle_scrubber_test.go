@@ -0,0 +1,94 @@
+package service
+
+import (
+	"data-scrubber/biz/constdef"
+	"data-scrubber/biz/model"
+	"testing"
+)
+
+func TestBuildOrderLifecycleList(t *testing.T) {
+	date := "20240115"
+	instrumentId := "000001.SZ"
+	newOrder := func(timeStr string, orderId int64, orderType string, direction string, volume int64) *model.Order {
+		return &model.Order{
+			InstrumentId:   instrumentId,
+			OrderTimestamp: mustTimeToNano(t, date, timeStr),
+			OrderId:        orderId,
+			OrderType:      orderType,
+			Direction:      direction,
+			Price:          10.00,
+			Volume:         volume,
+		}
+	}
+	newTrade := func(timeStr string, buyOrderId int64, sellOrderId int64, volume int64) *model.Trade {
+		return &model.Trade{
+			InstrumentId:   instrumentId,
+			TradeTimestamp: mustTimeToNano(t, date, timeStr),
+			Price:          10.00,
+			Volume:         volume,
+			BuyOrderId:     buyOrderId,
+			SellOrderId:    sellOrderId,
+		}
+	}
+
+	orderList := []*model.Order{
+		newOrder("09:30:00.000", 1, constdef.OrderTypeAdd, constdef.DirectionSell, 500),
+		newOrder("09:30:01.000", 2, constdef.OrderTypeAdd, constdef.DirectionBuy, 300),
+		newOrder("09:30:02.000", 3, constdef.OrderTypeAdd, constdef.DirectionBuy, 400),
+		newOrder("09:30:03.000", 4, constdef.OrderTypeAdd, constdef.DirectionBuy, 100),
+		newOrder("10:00:00.000", 3, constdef.OrderTypeCancel, constdef.DirectionBuy, 300),
+		newOrder("10:00:01.000", 99, constdef.OrderTypeCancel, constdef.DirectionBuy, 100),
+	}
+	tradeList := []*model.Trade{
+		newTrade("09:30:02.000", 3, 1, 100),
+		newTrade("09:30:01.000", 2, 1, 300),
+		newTrade("09:31:00.000", 98, 1, 50),
+	}
+
+	list, orphan, overfilled := BuildOrderLifecycleList(instrumentId, orderList, tradeList)
+	if orphan != 2 || overfilled != 0 {
+		t.Fatalf("orphan = %d, overfilled = %d, want 2, 0", orphan, overfilled)
+	}
+	if len(list) != 4 {
+		t.Fatalf("len(list) = %d, want 4", len(list))
+	}
+
+	want := []struct {
+		orderId   int64
+		filled    int64
+		fillCount int64
+		cancel    int64
+		remaining int64
+		state     string
+	}{
+		{1, 450, 3, 0, 50, constdef.OrderStatePartiallyFilled},
+		{2, 300, 1, 0, 0, constdef.OrderStateFilled},
+		{3, 100, 1, 300, 0, constdef.OrderStateCancelled},
+		{4, 0, 0, 0, 100, constdef.OrderStateLive},
+	}
+	for i, w := range want {
+		got := list[i]
+		if got.OrderId != w.orderId || got.FilledQty != w.filled || got.FillCount != w.fillCount ||
+			got.CancelQty != w.cancel || got.RemainingQty != w.remaining || got.State != w.state {
+			t.Errorf("list[%d] = %+v, want %+v", i, got, w)
+		}
+	}
+
+	if list[0].FirstFillTimestamp != mustTimeToNano(t, date, "09:30:01.000") ||
+		list[0].LastFillTimestamp != mustTimeToNano(t, date, "09:31:00.000") {
+		t.Errorf("order 1 fill timestamp = (%d, %d)", list[0].FirstFillTimestamp, list[0].LastFillTimestamp)
+	}
+	if list[2].CancelTimestamp != mustTimeToNano(t, date, "10:00:00.000") {
+		t.Errorf("order 3 cancel timestamp = %d", list[2].CancelTimestamp)
+	}
+}
+
+func TestBuildOrderLifecycleList_Overfilled(t *testing.T) {
+	// 沪市新格式未还原时 A 记录只有剩余挂单量，成交超过 OrderQty
+	orderList := []*model.Order{{InstrumentId: "600000.SH", OrderId: 1, OrderType: constdef.OrderTypeAdd, Volume: 100}}
+	tradeList := []*model.Trade{{InstrumentId: "600000.SH", BuyOrderId: 1, Volume: 300}}
+	list, _, overfilled := BuildOrderLifecycleList("600000.SH", orderList, tradeList)
+	if overfilled != 1 || list[0].RemainingQty != 0 || list[0].State != constdef.OrderStateFilled {
+		t.Errorf("overfilled = %d, list[0] = %+v", overfilled, list[0])
+	}
+}
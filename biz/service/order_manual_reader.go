@@ -112,7 +112,7 @@ func ManualReadOldShRawOrder(filepath string) ([]*model.OldShRawOrder, error) {
 			continue
 		}
 
-		if err := parseFloat64Field(fields, headerIndex, "OrderPrice", &order.OrderPrice); err != nil {
+		if err := parsePriceField(fields, headerIndex, "OrderPrice", &order.OrderPrice); err != nil {
 			logger.Error("警告: 第 %d 行 OrderPrice 解析错误: %v，跳过", lineNum, err)
 			lineNum++
 			continue
@@ -238,7 +238,7 @@ func ManualReadSzRawOrder(filepath string) ([]*model.SzRawOrder, error) {
 			continue
 		}
 
-		if err := parseFloat64Field(fields, headerIndex, "Price", &order.Price); err != nil {
+		if err := parsePriceField(fields, headerIndex, "Price", &order.Price); err != nil {
 			logger.Error("警告: 第 %d 行 Price 解析错误: %v，跳过", lineNum, err)
 			lineNum++
 			continue
@@ -258,7 +258,7 @@ func ManualReadSzRawOrder(filepath string) ([]*model.SzRawOrder, error) {
 
 		order.TransactTime = getOptionalFieldValue(fields, headerIndex, "TransactTime")
 
-		if err := parseIntField(fields, headerIndex, "OrdType", &order.OrdType); err != nil {
+		if err := parseCharCodeField(fields, headerIndex, "OrdType", &order.OrdType); err != nil {
 			logger.Error("警告: 第 %d 行 OrdType 解析错误: %v，跳过", lineNum, err)
 			lineNum++
 			continue
@@ -3,6 +3,7 @@ package service
 import (
 	"data-scrubber/biz/constdef"
 	"data-scrubber/biz/errorx"
+	"data-scrubber/biz/layout"
 	"data-scrubber/biz/model"
 	"data-scrubber/biz/utils"
 	"data-scrubber/config"
@@ -45,12 +46,13 @@ func RawOrderQueue2OrderQueue(date string, v *model.RawOrderQueue, suffix string
 		InstrumentId:    fmt.Sprintf("%s.%s", v.SecurityID, suffix),
 		UpdateTimestamp: timestamp,
 		Direction:       direction,
-		Price:           v.Price,
+		Price:           priceE4ToFloat(v.Price),
 		Volume:          int64(v.Volume),
 		NumOrders:       int64(v.NumOrders),
 		OrderQtyList:    orderQtyList,
 		SeqNo:           v.SeqNo,
 		LocalTimestamp:  localTimestamp,
+		PriceE4:         v.Price,
 	}
 
 	return res, nil
@@ -117,16 +119,20 @@ func GetMapOrderQueue(list []*model.OrderQueue) map[string][]*model.OrderQueue {
 	return res
 }
 
-func WriteAllOrderQueueParquet(dstDir string, date string, oqList []*model.OrderQueue) error {
+func WriteAllOrderQueueParquet(dstDir string, date string, oqList []*model.OrderQueue, sourceFileList []string) error {
 	if err := os.MkdirAll(dstDir, 0755); err != nil {
 		return errorx.NewError("MkdirAll(%s) error: %v", dstDir, err)
 	}
 
-	filePath := filepath.Join(dstDir, fmt.Sprintf("%s_orderqueue.parquet", date))
+	filePath := filepath.Join(dstDir, layout.GetPerDayFileName(date, constdef.DataTypeOrderQueue))
+	if config.Cfg.IsPerDayClustered() {
+		return WriteClusteredOutputFile(filePath, oqList, sourceFileList, func(v *model.OrderQueue) string { return v.InstrumentId },
+			func(v *model.OrderQueue) int64 { return v.UpdateTimestamp })
+	}
 
-	pw, err := NewParquetWriter(filePath, new(model.OrderQueue))
+	pw, err := NewOutputWriter(filePath, new(model.OrderQueue), sourceFileList)
 	if err != nil {
-		return errorx.NewError("NewParquetWriter error: %s", err)
+		return errorx.NewError("NewOutputWriter error: %s", err)
 	}
 
 	defer func() {
@@ -147,17 +153,17 @@ func WriteAllOrderQueueParquet(dstDir string, date string, oqList []*model.Order
 	return nil
 }
 
-func WriteStockOrderQueueParquet(dstDir string, date string, mapOQ map[string][]*model.OrderQueue) error {
+func WriteStockOrderQueueParquet(dstDir string, date string, mapOQ map[string][]*model.OrderQueue, sourceFileList []string) error {
 	if err := os.MkdirAll(dstDir, 0755); err != nil {
 		return errorx.NewError("MkdirAll(%s) error: %v", dstDir, err)
 	}
 
 	for instrumentId, oqList := range mapOQ {
-		filePath := filepath.Join(dstDir, fmt.Sprintf("%s_orderqueue_%s.parquet", date, instrumentId))
+		filePath := filepath.Join(dstDir, layout.GetPerStockFileName(date, constdef.DataTypeOrderQueue, instrumentId))
 
-		pw, err := NewParquetWriter(filePath, new(model.OrderQueue))
+		pw, err := NewOutputWriter(filePath, new(model.OrderQueue), sourceFileList)
 		if err != nil {
-			return errorx.NewError("NewParquetWriter error: %s", err)
+			return errorx.NewError("NewOutputWriter error: %s", err)
 		}
 
 		defer func() {
@@ -180,26 +186,65 @@ func WriteStockOrderQueueParquet(dstDir string, date string, mapOQ map[string][]
 }
 
 // MergeRawOrderQueue 委托队列清洗主入口
-func MergeRawOrderQueue(srcDir string, dstDir string, date string) error {
-	if config.Cfg.IsPerDay() {
+func MergeRawOrderQueue(day *DayContext, dstDir string) error {
+	date := day.Date
+	if config.Cfg.IsPerDay() || config.Cfg.IsHiveLayout() {
 		dstDir = filepath.Join(dstDir, constdef.DataTypeOrderQueue)
 	} else {
 		dstDir = filepath.Join(dstDir, constdef.DataTypeOrderQueue, date)
 	}
 
+	oqList, err := ReadRawOrderQueueList(day)
+	if err != nil {
+		return err
+	}
+	sourceFileList := day.GetSourceFileList(constdef.DataTypeOrderQueue)
+
+	// 根据 output_mode 选择写入方式
+	if config.Cfg.IsHiveLayout() {
+		logger.Info("Write HiveOrderQueue.parquet Begin")
+		if err := WriteHiveParquet(dstDir, date, oqList, sourceFileList, func(v *model.OrderQueue) string { return v.InstrumentId },
+			func(v *model.OrderQueue) int64 { return v.UpdateTimestamp }); err != nil {
+			return errorx.NewError("WriteHiveParquet(%s) date(%s) error: %v", dstDir, date, err)
+		}
+		logger.Info("Write HiveOrderQueue.parquet End")
+	} else if config.Cfg.IsPerDay() {
+		logger.Info("Write AllOrderQueue.parquet Begin")
+		if err := WriteAllOrderQueueParquet(dstDir, date, oqList, sourceFileList); err != nil {
+			return errorx.NewError("WriteAllOrderQueueParquet(%s) date(%s) error: %v", dstDir, date, err)
+		}
+		logger.Info("Write AllOrderQueue.parquet End")
+	} else {
+		// 按 InstrumentId 分组
+		oqMap := GetMapOrderQueue(oqList)
+
+		logger.Info("Write StockOrderQueue.parquet Begin")
+		if err := WriteStockOrderQueueParquet(dstDir, date, oqMap, sourceFileList); err != nil {
+			return errorx.NewError("WriteStockOrderQueueParquet(%s) date(%s) error: %v", dstDir, date, err)
+		}
+		logger.Info("Write StockOrderQueue.parquet End")
+	}
+
+	return nil
+}
+
+// ReadRawOrderQueueList 读取并转换沪深两市当天的委托队列，返回按时间归并后的列表
+func ReadRawOrderQueueList(day *DayContext) ([]*model.OrderQueue, error) {
+	srcDir, date := day.SrcDir, day.Date
 	// 沪市：OrderQueue.csv.zip
 	shFilepath := filepath.Join(srcDir, date, fmt.Sprintf("%s_OrderQueue.csv.zip", date))
 
 	logger.Info("Read Sh OrderQueue Begin")
 	shRawList, err := ManualReadOrderQueue(shFilepath, "SH")
 	if err != nil {
-		return errorx.NewError("ManualReadOrderQueue(%s) error: %s", shFilepath, err)
+		return nil, errorx.NewError("ManualReadOrderQueue(%s) error: %s", shFilepath, err)
 	}
+	day.AddSourceFile(constdef.DataTypeOrderQueue, shFilepath)
 	logger.Info("Read Sh OrderQueue End, count=%d", len(shRawList))
 
 	shList, err := RawOrderQueue2OrderQueueList(date, shRawList, "SH")
 	if err != nil {
-		return errorx.NewError("RawOrderQueue2OrderQueueList(SH) error: %s", err)
+		return nil, errorx.NewError("RawOrderQueue2OrderQueueList(SH) error: %s", err)
 	}
 	logger.Info("Convert Sh OrderQueue End, count=%d", len(shList))
 
@@ -209,13 +254,14 @@ func MergeRawOrderQueue(srcDir string, dstDir string, date string) error {
 	logger.Info("Read Sz Sell OrderQueue Begin")
 	szSellRawList, err := ManualReadOrderQueue(szSellFilepath, "SZ")
 	if err != nil {
-		return errorx.NewError("ManualReadOrderQueue(%s) error: %s", szSellFilepath, err)
+		return nil, errorx.NewError("ManualReadOrderQueue(%s) error: %s", szSellFilepath, err)
 	}
+	day.AddSourceFile(constdef.DataTypeOrderQueue, szSellFilepath)
 	logger.Info("Read Sz Sell OrderQueue End, count=%d", len(szSellRawList))
 
 	szSellList, err := RawOrderQueue2OrderQueueList(date, szSellRawList, "SZ")
 	if err != nil {
-		return errorx.NewError("RawOrderQueue2OrderQueueList(SZ sell) error: %s", err)
+		return nil, errorx.NewError("RawOrderQueue2OrderQueueList(SZ sell) error: %s", err)
 	}
 	logger.Info("Convert Sz Sell OrderQueue End, count=%d", len(szSellList))
 
@@ -225,13 +271,14 @@ func MergeRawOrderQueue(srcDir string, dstDir string, date string) error {
 	logger.Info("Read Sz Buy OrderQueue Begin")
 	szBuyRawList, err := ManualReadOrderQueue(szBuyFilepath, "SZ")
 	if err != nil {
-		return errorx.NewError("ManualReadOrderQueue(%s) error: %s", szBuyFilepath, err)
+		return nil, errorx.NewError("ManualReadOrderQueue(%s) error: %s", szBuyFilepath, err)
 	}
+	day.AddSourceFile(constdef.DataTypeOrderQueue, szBuyFilepath)
 	logger.Info("Read Sz Buy OrderQueue End, count=%d", len(szBuyRawList))
 
 	szBuyList, err := RawOrderQueue2OrderQueueList(date, szBuyRawList, "SZ")
 	if err != nil {
-		return errorx.NewError("RawOrderQueue2OrderQueueList(SZ buy) error: %s", err)
+		return nil, errorx.NewError("RawOrderQueue2OrderQueueList(SZ buy) error: %s", err)
 	}
 	logger.Info("Convert Sz Buy OrderQueue End, count=%d", len(szBuyList))
 
@@ -242,23 +289,5 @@ func MergeRawOrderQueue(srcDir string, dstDir string, date string) error {
 	oqList := SortOrderQueueRaw(shList, szList)
 	logger.Info("Sort OrderQueue End, count=%d", len(oqList))
 
-	// 根据 output_mode 选择写入方式
-	if config.Cfg.IsPerDay() {
-		logger.Info("Write AllOrderQueue.parquet Begin")
-		if err := WriteAllOrderQueueParquet(dstDir, date, oqList); err != nil {
-			return errorx.NewError("WriteAllOrderQueueParquet(%s) date(%s) error: %v", dstDir, date, err)
-		}
-		logger.Info("Write AllOrderQueue.parquet End")
-	} else {
-		// 按 InstrumentId 分组
-		oqMap := GetMapOrderQueue(oqList)
-
-		logger.Info("Write StockOrderQueue.parquet Begin")
-		if err := WriteStockOrderQueueParquet(dstDir, date, oqMap); err != nil {
-			return errorx.NewError("WriteStockOrderQueueParquet(%s) date(%s) error: %v", dstDir, date, err)
-		}
-		logger.Info("Write StockOrderQueue.parquet End")
-	}
-
-	return nil
+	return oqList, nil
 }
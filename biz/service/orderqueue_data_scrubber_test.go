@@ -28,7 +28,7 @@ func TestManualReadOrderQueue_SH(t *testing.T) {
 		t.Errorf("第一条 Side=%s 不合法", first.Side)
 	}
 	t.Logf("第一条: SecurityID=%s, Timestamp=%s, Side=%s, Price=%.3f, Volume=%.0f, NoOrders=%d, OrderQtyList=%v",
-		first.SecurityID, first.Timestamp, first.Side, first.Price, first.Volume, first.NoOrders, first.OrderQtyList)
+		first.SecurityID, first.Timestamp, first.Side, priceE4ToFloat(first.Price), first.Volume, first.NoOrders, first.OrderQtyList)
 }
 
 // 测试深市卖方 OrderQueue 读取
@@ -51,7 +51,7 @@ func TestManualReadOrderQueue_SZ(t *testing.T) {
 		t.Errorf("深市卖方文件第一条 Side=%s, 期望 S", first.Side)
 	}
 	t.Logf("第一条: SecurityID=%s, Timestamp=%s, Side=%s, Price=%.4f, Volume=%.0f, NoOrders=%d, OrderQtyList=%v",
-		first.SecurityID, first.Timestamp, first.Side, first.Price, first.Volume, first.NoOrders, first.OrderQtyList)
+		first.SecurityID, first.Timestamp, first.Side, priceE4ToFloat(first.Price), first.Volume, first.NoOrders, first.OrderQtyList)
 }
 
 // 测试沪市转换
@@ -165,7 +165,7 @@ func TestMergeRawOrderQueue_20220708(t *testing.T) {
 	outDir := filepath.Join(dstDir, constdef.DataTypeOrderQueue, "20220708")
 	os.RemoveAll(outDir)
 
-	err := MergeRawOrderQueue(srcDir, dstDir, "20220708")
+	err := MergeRawOrderQueue(NewDayContext(srcDir, "20220708"), dstDir)
 	if err != nil {
 		t.Fatalf("MergeRawOrderQueue error: %v", err)
 	}
@@ -193,7 +193,7 @@ func TestMergeRawOrderQueue_20260213(t *testing.T) {
 	outDir := filepath.Join(dstDir, constdef.DataTypeOrderQueue, "20260213")
 	os.RemoveAll(outDir)
 
-	err := MergeRawOrderQueue(srcDir, dstDir, "20260213")
+	err := MergeRawOrderQueue(NewDayContext(srcDir, "20260213"), dstDir)
 	if err != nil {
 		t.Fatalf("MergeRawOrderQueue error: %v", err)
 	}
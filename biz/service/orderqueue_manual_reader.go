@@ -43,6 +43,21 @@ func parseFloat64FieldOptional(fields []string, headerIndex map[string]int, fiel
 	*target = value
 }
 
+// parsePriceFieldOptional 解析价格字段，空值时默认为 0
+func parsePriceFieldOptional(fields []string, headerIndex map[string]int, fieldName string, target *int64) {
+	valueStr, err := getFieldValue(fields, headerIndex, fieldName)
+	if err != nil || valueStr == "" {
+		*target = 0
+		return
+	}
+	value, err := parsePriceText(valueStr)
+	if err != nil {
+		*target = 0
+		return
+	}
+	*target = value
+}
+
 // ManualReadOrderQueue 从 zip 文件中读取委托队列原始数据
 // market: "SH" 或 "SZ"，决定时间列名（SH=UpdateTime, SZ=DataTimeStamp）
 func ManualReadOrderQueue(filepath string, market string) ([]*model.RawOrderQueue, error) {
@@ -140,7 +155,7 @@ func ManualReadOrderQueue(filepath string, market string) ([]*model.RawOrderQueu
 
 		parseIntFieldOptional(fields, headerIndex, "NoPriceLevel", &oq.NoPriceLevel)
 		parseIntFieldOptional(fields, headerIndex, "PrcLvlOperator", &oq.PrcLvlOperator)
-		parseFloat64FieldOptional(fields, headerIndex, "Price", &oq.Price)
+		parsePriceFieldOptional(fields, headerIndex, "Price", &oq.Price)
 		parseFloat64FieldOptional(fields, headerIndex, "Volume", &oq.Volume)
 		parseIntFieldOptional(fields, headerIndex, "NumOrders", &oq.NumOrders)
 		parseIntFieldOptional(fields, headerIndex, "NoOrders", &oq.NoOrders)
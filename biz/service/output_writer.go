@@ -0,0 +1,144 @@
+package service
+
+import (
+	"data-scrubber/biz/constdef"
+	"data-scrubber/biz/errorx"
+	"data-scrubber/biz/layout"
+	"data-scrubber/config"
+	"reflect"
+	"strings"
+
+	logger "github.com/2997215859/golog"
+)
+
+// OutputWriter 各数据类型的输出统一走这个接口，按 output_format 选择 parquet、arrow 或 csv.gz
+type OutputWriter interface {
+	Write(row interface{}) error
+	FlushRowGroup() (int, error) // 强制切分行组（arrow 为 record batch），返回已写的行组数
+	RowGroupCount() int
+	Close() error
+}
+
+func replaceFileSuffix(filePath string, suffix string) string {
+	return strings.TrimSuffix(filePath, layout.ParquetFileSuffix) + suffix
+}
+
+// GetOutputFilePath 各 writer 按 parquet 文件名拼路径，这里按 output_format 换成实际的扩展名
+// both 时返回 parquet 文件（per_day_clustered 的索引以 parquet 行组为准）
+func GetOutputFilePath(filePath string) string {
+	switch config.Cfg.GetOutputFormat() {
+	case constdef.OutputFormatArrow:
+		return replaceFileSuffix(filePath, ".arrow")
+	case constdef.OutputFormatCsvGz:
+		return replaceFileSuffix(filePath, ".csv.gz")
+	}
+	return filePath
+}
+
+// NewOutputWriter filePath 为 parquet 文件名，其他格式自动换成对应扩展名
+// 输出的列按 schema_profile 投影，Write 仍然传原始的 model 结构体；sourceFileList 见 NewParquetWriter
+func NewOutputWriter(filePath string, schema interface{}, sourceFileList []string) (OutputWriter, error) {
+	projection, err := getSchemaProjection(schema)
+	if err != nil {
+		return nil, err
+	}
+	if projection == nil {
+		return newFormatWriter(filePath, schema, sourceFileList)
+	}
+	w, err := newFormatWriter(filePath, reflect.New(projection.projectedType).Interface(), sourceFileList)
+	if err != nil {
+		return nil, err
+	}
+	return &projectedOutputWriter{OutputWriter: w, projection: projection}, nil
+}
+
+func newFormatWriter(filePath string, schema interface{}, sourceFileList []string) (OutputWriter, error) {
+	switch format := config.Cfg.GetOutputFormat(); format {
+	case constdef.OutputFormatParquet:
+		return NewParquetWriter(filePath, schema, sourceFileList)
+	case constdef.OutputFormatArrow:
+		return NewArrowWriter(replaceFileSuffix(filePath, ".arrow"), schema, sourceFileList)
+	case constdef.OutputFormatCsvGz:
+		return NewCsvGzWriter(replaceFileSuffix(filePath, ".csv.gz"), schema)
+	case constdef.OutputFormatBoth:
+		pw, err := NewParquetWriter(filePath, schema, sourceFileList)
+		if err != nil {
+			return nil, err
+		}
+		cw, err := NewCsvGzWriter(replaceFileSuffix(filePath, ".csv.gz"), schema)
+		if err != nil {
+			_ = pw.Close()
+			return nil, err
+		}
+		return &multiOutputWriter{writerList: []OutputWriter{pw, cw}}, nil
+	default:
+		return nil, errorx.NewError("unknown output_format(%s)", format)
+	}
+}
+
+// multiOutputWriter 同一份数据写多个格式，行组数以第一个 writer 为准
+type multiOutputWriter struct {
+	writerList []OutputWriter
+}
+
+func (mw *multiOutputWriter) Write(row interface{}) error {
+	for _, w := range mw.writerList {
+		if err := w.Write(row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (mw *multiOutputWriter) FlushRowGroup() (int, error) {
+	res := 0
+	for i, w := range mw.writerList {
+		count, err := w.FlushRowGroup()
+		if err != nil {
+			return 0, err
+		}
+		if i == 0 {
+			res = count
+		}
+	}
+	return res, nil
+}
+
+func (mw *multiOutputWriter) RowGroupCount() int {
+	return mw.writerList[0].RowGroupCount()
+}
+
+// Close 关闭全部 writer，返回第一个错误
+func (mw *multiOutputWriter) Close() error {
+	var res error
+	for _, w := range mw.writerList {
+		if err := w.Close(); err != nil && res == nil {
+			res = err
+		}
+	}
+	return res
+}
+
+// WriteOutputFile 将 list 整体写入 filePath，写入器在返回前关闭
+// 新增的数据类型统一走这里，避免每种类型各写一遍打开/关闭逻辑；
+// sourceFileList 见 NewParquetWriter，清洗流程取 DayContext.GetSourceFileList
+func WriteOutputFile[T any](filePath string, list []*T, sourceFileList []string) error {
+	w, err := NewOutputWriter(filePath, new(T), sourceFileList)
+	if err != nil {
+		return errorx.NewError("NewOutputWriter(%s) error: %s", filePath, err)
+	}
+
+	for _, v := range list {
+		if v == nil {
+			continue
+		}
+		if err := w.Write(v); err != nil {
+			logger.Error("WriteOutputFile(%s) error: %v", filePath, err)
+		}
+	}
+
+	if err := w.Close(); err != nil {
+		return errorx.NewError("close output(%s) error: %v", filePath, err)
+	}
+	return nil
+}
@@ -1,8 +1,16 @@
 package service
 
 import (
-	"github.com/xitongsys/parquet-go/source"
+	"data-scrubber/biz/constdef"
+	"data-scrubber/biz/utils"
+	"data-scrubber/config"
+	"fmt"
 	"log"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/xitongsys/parquet-go/source"
 
 	"github.com/xitongsys/parquet-go-source/local"
 	"github.com/xitongsys/parquet-go/parquet"
@@ -13,10 +21,175 @@ import (
 type ParquetWriter struct {
 	fileWriter    source.ParquetFile
 	parquetWriter *writer.ParquetWriter
+
+	timestampEncoding string
+	timestampField    []int // 需要按 timestampEncoding 转换的字段下标
+
+	decimalType  reflect.Type // 开启 parquet_decimal_price 时实际写入的结构体，价格字段为 int64
+	decimalField []int        // 需要转成定点数的价格字段下标
+	decimalE4    [][]int      // decimalField 对应的 E4 字段下标，没有 E4 字段的价格为 nil，见 setScaledPrice
+	decimalScale int          // DECIMAL 小数位数
+}
+
+// 字段名以 Timestamp 结尾的 int64 字段都是纳秒时间戳
+const timestampFieldSuffix = "Timestamp"
+
+// decimalPriceFieldSet 开启 parquet_decimal_price 时写成 DECIMAL 的价格字段（float64 或 []float64）
+var decimalPriceFieldSet = map[string]bool{
+	"Price":          true,
+	"EffectivePrice": true,
+	"Last":           true,
+	"PreClose":       true,
+	"Open":           true,
+	"High":           true,
+	"Low":            true,
+	"Close":          true,
+	"HighLimit":      true,
+	"LowLimit":       true,
+	"Vwap":           true,
+	"BidPriceList":   true,
+	"AskPriceList":   true,
+	"AdjPrice":       true,
+	"AdjLast":        true,
+	"AdjPreClose":    true,
+	"AdjOpen":        true,
+	"AdjHigh":        true,
+	"AdjLow":         true,
+	"AdjClose":       true,
+	"TickPreClose":   true,
+}
+
+// DECIMAL 用 INT64 存储时最大精度为 18
+const decimalPricePrecision = 18
+
+func structType(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+	return t
+}
+
+// getTimestampField 返回结构体中时间戳字段的下标
+func getTimestampField(t reflect.Type) []int {
+	t = structType(t)
+	if t == nil {
+		return nil
+	}
+	var res []int
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.Type.Kind() == reflect.Int64 && strings.HasSuffix(f.Name, timestampFieldSuffix) {
+			res = append(res, i)
+		}
+	}
+	return res
+}
+
+// getDecimalType 把价格字段换成 int64/[]int64 并改写 parquet tag，返回新的结构体类型和价格字段下标；
+// 没有价格字段时返回 nil
+func getDecimalType(t reflect.Type, scale int) (reflect.Type, []int) {
+	t = structType(t)
+	if t == nil {
+		return nil, nil
+	}
+	var decimalField []int
+	fieldList := make([]reflect.StructField, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if decimalPriceFieldSet[f.Name] {
+			switch f.Type {
+			case reflect.TypeOf(float64(0)):
+				f.Type = reflect.TypeOf(int64(0))
+				f.Tag = reflect.StructTag(fmt.Sprintf(`parquet:"name=%s, type=INT64, convertedtype=DECIMAL, scale=%d, precision=%d"`,
+					f.Name, scale, decimalPricePrecision))
+				decimalField = append(decimalField, i)
+			case reflect.TypeOf([]float64{}):
+				f.Type = reflect.TypeOf([]int64{})
+				f.Tag = reflect.StructTag(fmt.Sprintf(`parquet:"name=%s, type=MAP, convertedtype=LIST, valuetype=INT64, valueconvertedtype=DECIMAL, valuescale=%d, valueprecision=%d"`,
+					f.Name, scale, decimalPricePrecision))
+				decimalField = append(decimalField, i)
+			}
+		}
+		fieldList = append(fieldList, f)
+	}
+	if len(decimalField) == 0 {
+		return nil, nil
+	}
+	return reflect.StructOf(fieldList), decimalField
+}
+
+// setTimestampLogicalType 给时间戳列加上 TIMESTAMP(NANOS) 逻辑类型，pandas/Spark 可以直接读成时间
+// hhmmssmmm 编码不是时间点，保持普通 INT64
+func setTimestampLogicalType(pw *writer.ParquetWriter, encoding string) {
+	if encoding == constdef.TimestampEncodingHHMMSSmmm {
+		return
+	}
+	for _, element := range pw.SchemaHandler.SchemaElements {
+		if element.Type == nil || *element.Type != parquet.Type_INT64 || !strings.HasSuffix(element.Name, timestampFieldSuffix) {
+			continue
+		}
+		element.LogicalType = &parquet.LogicalType{
+			TIMESTAMP: &parquet.TimestampType{
+				IsAdjustedToUTC: encoding == constdef.TimestampEncodingUtcNanos,
+				Unit:            &parquet.TimeUnit{NANOS: parquet.NewNanoSeconds()},
+			},
+		}
+	}
+}
+
+// getKeyValueMetadata 文件级元数据：生产者版本、schema 版本、生成这个文件读取的源文件，
+// 价格为整数（int64 或 DECIMAL）时额外记录编码和 scale，priceEncoding 为空表示 float64 价格
+func getKeyValueMetadata(sourceFileList []string, priceEncoding string, scale int) []*parquet.KeyValue {
+	newKeyValue := func(key string, value string) *parquet.KeyValue {
+		return &parquet.KeyValue{Key: key, Value: &value}
+	}
+
+	producer := "data-scrubber"
+	if config.GitCommitSha1 != "" {
+		producer = fmt.Sprintf("data-scrubber %s", config.GitCommitSha1)
+	}
+	res := []*parquet.KeyValue{
+		newKeyValue(constdef.ParquetMetaProducer, producer),
+		newKeyValue(constdef.ParquetMetaSchemaVersion, constdef.ParquetSchemaVersion),
+		newKeyValue(constdef.ParquetMetaSourceFiles, strings.Join(sourceFileList, ",")),
+	}
+	if priceEncoding != "" {
+		res = append(res, newKeyValue(constdef.ParquetMetaPriceEncoding, priceEncoding))
+		res = append(res, newKeyValue(constdef.ParquetMetaPriceScale, strconv.Itoa(scale)))
+	}
+	return res
 }
 
 // NewParquetWriter 创建一个新的Parquet写入器
-func NewParquetWriter(filePath string, schema interface{}) (*ParquetWriter, error) {
+// 压缩、行组/页大小、DECIMAL 价格由配置决定，低基数字符串列的字典编码在 model 的 tag 里声明；
+// sourceFileList 写入文件元数据，不是由原始文件生成的输出（如 query）传 nil
+func NewParquetWriter(filePath string, schema interface{}, sourceFileList []string) (*ParquetWriter, error) {
+	codec, err := GetParquetCompressionCodec(config.Cfg.GetParquetCompression())
+	if err != nil {
+		return nil, err
+	}
+
+	res := &ParquetWriter{
+		timestampEncoding: config.Cfg.GetTimestampEncoding(),
+		timestampField:    getTimestampField(reflect.TypeOf(schema)),
+	}
+	writeSchema := schema
+	if config.Cfg.ParquetDecimalPrice {
+		scale := config.Cfg.GetParquetDecimalScale()
+		res.decimalType, res.decimalField = getDecimalType(reflect.TypeOf(schema), scale)
+		res.decimalScale = scale
+		if res.decimalType != nil {
+			writeSchema = reflect.New(res.decimalType).Interface()
+			t := structType(reflect.TypeOf(schema))
+			for _, i := range res.decimalField {
+				res.decimalE4 = append(res.decimalE4, getPriceE4Index(t, t.Field(i).Name))
+			}
+		}
+	}
+
 	// 创建本地文件写入器
 	fw, err := local.NewLocalFileWriter(filePath)
 	if err != nil {
@@ -24,25 +197,89 @@ func NewParquetWriter(filePath string, schema interface{}) (*ParquetWriter, erro
 	}
 
 	// 创建Parquet写入器
-	pw, err := writer.NewParquetWriter(fw, schema, 4)
+	pw, err := writer.NewParquetWriter(fw, writeSchema, config.Cfg.GetParquetWriterParallel())
 	if err != nil {
 		fw.Close() // 这里使用Close()是正确的，因为它是io.Closer接口方法
 		return nil, err
 	}
 
 	// 设置Parquet配置
-	pw.RowGroupSize = 128 * 1024 * 1024 // 128M
-	pw.CompressionType = parquet.CompressionCodec_SNAPPY
+	pw.RowGroupSize = config.Cfg.GetParquetRowGroupSize()
+	pw.PageSize = config.Cfg.GetParquetPageSize()
+	pw.CompressionType = codec
+	switch {
+	case res.decimalType != nil:
+		pw.Footer.KeyValueMetadata = getKeyValueMetadata(sourceFileList, constdef.PriceEncodingDecimal, config.Cfg.GetParquetDecimalScale())
+	case hasInt64PriceField(schema):
+		pw.Footer.KeyValueMetadata = getKeyValueMetadata(sourceFileList, constdef.PriceEncodingInt64, config.Cfg.GetPriceScale())
+	default:
+		pw.Footer.KeyValueMetadata = getKeyValueMetadata(sourceFileList, "", 0)
+	}
+
+	setTimestampLogicalType(pw, res.timestampEncoding)
 
-	return &ParquetWriter{
-		fileWriter:    fw,
-		parquetWriter: pw,
-	}, nil
+	res.fileWriter = fw
+	res.parquetWriter = pw
+	return res, nil
 }
 
 // Write 写入单行数据
+// 非默认时间戳编码或 DECIMAL 价格时写入的是转换后的副本，不修改调用方的数据
 func (pw *ParquetWriter) Write(row interface{}) error {
-	return pw.parquetWriter.Write(row)
+	convertTimestamp := pw.timestampEncoding != constdef.TimestampEncodingUtcNanos && len(pw.timestampField) > 0
+	if !convertTimestamp && pw.decimalType == nil {
+		return pw.parquetWriter.Write(row)
+	}
+
+	rv := reflect.ValueOf(row)
+	for rv.Kind() == reflect.Pointer {
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return pw.parquetWriter.Write(row)
+	}
+
+	var cp reflect.Value
+	if pw.decimalType == nil {
+		cp = reflect.New(rv.Type())
+		cp.Elem().Set(rv)
+	} else {
+		cp = reflect.New(pw.decimalType)
+		decimalIndex := 0
+		for i := 0; i < rv.NumField(); i++ {
+			if decimalIndex < len(pw.decimalField) && pw.decimalField[decimalIndex] == i {
+				var e4 reflect.Value
+				if pw.decimalE4[decimalIndex] != nil {
+					e4 = rv.FieldByIndex(pw.decimalE4[decimalIndex])
+				}
+				decimalIndex++
+				setScaledPrice(cp.Elem().Field(i), rv.Field(i), e4, pw.decimalScale)
+				continue
+			}
+			cp.Elem().Field(i).Set(rv.Field(i))
+		}
+	}
+
+	if convertTimestamp {
+		for _, i := range pw.timestampField {
+			f := cp.Elem().Field(i)
+			f.SetInt(utils.EncodeTimestamp(f.Int(), pw.timestampEncoding))
+		}
+	}
+	return pw.parquetWriter.Write(cp.Interface())
+}
+
+// FlushRowGroup 把已缓冲的数据写成一个行组（没有缓冲数据时不写），返回文件目前的行组数
+func (pw *ParquetWriter) FlushRowGroup() (int, error) {
+	if err := pw.parquetWriter.Flush(true); err != nil {
+		return 0, err
+	}
+	return pw.RowGroupCount(), nil
+}
+
+// RowGroupCount 已写入的行组数
+func (pw *ParquetWriter) RowGroupCount() int {
+	return len(pw.parquetWriter.Footer.RowGroups)
 }
 
 // WriteBatch 批量写入多行数据
@@ -77,7 +314,7 @@ func ExampleUsage() {
 	}
 
 	// 创建写入器
-	pw, err := NewParquetWriter("output.parquet", new(Student))
+	pw, err := NewParquetWriter("output.parquet", new(Student), nil)
 	if err != nil {
 		log.Fatal(err)
 	}
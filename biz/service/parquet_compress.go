@@ -0,0 +1,24 @@
+package service
+
+import (
+	"data-scrubber/biz/constdef"
+	"data-scrubber/biz/errorx"
+
+	"github.com/xitongsys/parquet-go/parquet"
+)
+
+// GetParquetCompressionCodec 配置的压缩算法名转 parquet 枚举
+// parquet-go 没有设置压缩级别的接口，各算法使用编码器默认级别；配置 parquet_compression_level 会在读取配置时报错
+func GetParquetCompressionCodec(name string) (parquet.CompressionCodec, error) {
+	switch name {
+	case constdef.ParquetCompressionSnappy:
+		return parquet.CompressionCodec_SNAPPY, nil
+	case constdef.ParquetCompressionZstd:
+		return parquet.CompressionCodec_ZSTD, nil
+	case constdef.ParquetCompressionGzip:
+		return parquet.CompressionCodec_GZIP, nil
+	case constdef.ParquetCompressionNone:
+		return parquet.CompressionCodec_UNCOMPRESSED, nil
+	}
+	return parquet.CompressionCodec_UNCOMPRESSED, errorx.NewError("unknown parquet compression(%s)", name)
+}
@@ -0,0 +1,111 @@
+package service
+
+import (
+	"data-scrubber/biz/constdef"
+	"data-scrubber/biz/model"
+	"data-scrubber/config"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/xitongsys/parquet-go-source/local"
+	"github.com/xitongsys/parquet-go/common"
+	"github.com/xitongsys/parquet-go/parquet"
+	"github.com/xitongsys/parquet-go/reader"
+)
+
+func TestParquetWriterOption(t *testing.T) {
+	oldCfg := config.Cfg
+	defer func() { config.Cfg = oldCfg }()
+	config.Cfg = &config.Config{
+		ParquetCompression:  constdef.ParquetCompressionZstd,
+		ParquetDecimalPrice: true,
+		ParquetDecimalScale: 3,
+	}
+
+	day := NewDayContext("/src", "20240115")
+	day.AddSourceFile(constdef.DataTypeTrade, "/src/20240115/20240115_mdl_6_36_0.csv.zip")
+	day.AddSourceFile(constdef.DataTypeTrade, "/src/20240115/20240115_mdl_4_24_0.csv.zip")
+	day.AddSourceFile(constdef.DataTypeTrade, "/src/20240115/20240115_mdl_4_24_0.csv.zip")
+	// 其他 data type 读取的源文件不写入 trade 的元数据
+	day.AddSourceFile(constdef.DataTypeSnapshot, "/src/20240115/20240115_mdl_6_28_0.csv.zip")
+
+	filePath := filepath.Join(t.TempDir(), "trade.parquet")
+	tradeList := []*model.Trade{
+		{InstrumentId: "600000.SH", Price: 10.1234, Volume: 100, Direction: constdef.DirectionBuy},
+		{InstrumentId: "600000.SH", Price: 10.05, Volume: 200, Direction: constdef.DirectionSell},
+	}
+	if err := WriteOutputFile(filePath, tradeList, day.GetSourceFileList(constdef.DataTypeTrade)); err != nil {
+		t.Fatalf("WriteParquetFile error: %v", err)
+	}
+	// 调用方数据不被修改
+	if tradeList[0].Price != 10.1234 {
+		t.Errorf("tradeList[0].Price=%v", tradeList[0].Price)
+	}
+
+	fr, err := local.NewLocalFileReader(filePath)
+	if err != nil {
+		t.Fatalf("NewLocalFileReader error: %v", err)
+	}
+	defer fr.Close()
+	pr, err := reader.NewParquetReader(fr, nil, 1)
+	if err != nil {
+		t.Fatalf("NewParquetReader error: %v", err)
+	}
+	defer pr.ReadStop()
+
+	kv := make(map[string]string)
+	for _, v := range pr.Footer.KeyValueMetadata {
+		kv[v.Key] = *v.Value
+	}
+	if kv[constdef.ParquetMetaSchemaVersion] != constdef.ParquetSchemaVersion || kv[constdef.ParquetMetaPriceScale] != "3" ||
+		kv[constdef.ParquetMetaSourceFiles] != "20240115_mdl_4_24_0.csv.zip,20240115_mdl_6_36_0.csv.zip" {
+		t.Errorf("KeyValueMetadata=%v", kv)
+	}
+
+	for _, column := range pr.Footer.RowGroups[0].Columns {
+		name := column.MetaData.PathInSchema[len(column.MetaData.PathInSchema)-1]
+		if column.MetaData.Codec != parquet.CompressionCodec_ZSTD {
+			t.Errorf("column(%s) codec=%s", name, column.MetaData.Codec)
+		}
+		if name == "InstrumentId" && !slices.Contains(column.MetaData.Encodings, parquet.Encoding_PLAIN_DICTIONARY) {
+			t.Errorf("column(%s) encodings=%v", name, column.MetaData.Encodings)
+		}
+	}
+
+	priceList, _, _, err := pr.ReadColumnByPath(common.ReformPathStr("parquet_go_root.Price"), 2)
+	if err != nil {
+		t.Fatalf("ReadColumnByPath(Price) error: %v", err)
+	}
+	if len(priceList) != 2 || priceList[0] != int64(10123) || priceList[1] != int64(10050) {
+		t.Errorf("priceList=%v", priceList)
+	}
+
+	// 源文件由调用方显式传入，不是由原始文件生成的输出（如 query）不带上一次清洗的源文件
+	queryPath := filepath.Join(t.TempDir(), "query_trade.parquet")
+	pw, err := NewParquetWriter(queryPath, new(model.Trade), nil)
+	if err != nil {
+		t.Fatalf("NewParquetWriter error: %v", err)
+	}
+	if err := pw.Write(tradeList[0]); err != nil {
+		t.Fatalf("Write error: %v", err)
+	}
+	if err := pw.Close(); err != nil {
+		t.Fatalf("Close error: %v", err)
+	}
+	qfr, err := local.NewLocalFileReader(queryPath)
+	if err != nil {
+		t.Fatalf("NewLocalFileReader error: %v", err)
+	}
+	defer qfr.Close()
+	qpr, err := reader.NewParquetReader(qfr, nil, 1)
+	if err != nil {
+		t.Fatalf("NewParquetReader error: %v", err)
+	}
+	defer qpr.ReadStop()
+	for _, v := range qpr.Footer.KeyValueMetadata {
+		if v.Key == constdef.ParquetMetaSourceFiles && *v.Value != "" {
+			t.Errorf("query source_files=%s", *v.Value)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package service
+
+import (
+	"data-scrubber/biz/model"
+	"data-scrubber/biz/utils"
+	"data-scrubber/config"
+	"math"
+	"sort"
+
+	logger "github.com/2997215859/golog"
+)
+
+// 价格是否落在最小价格变动单位上。用解析时保存的 E4 整数价格（见 model.PriceE4Suffix）直接对最小变动单位取模，
+// 不从 float64 反推；0 价格（市价委托、未开盘）不检查
+
+// RunReport 计数键
+const (
+	RunReportTradeOffTick    = "trade_off_tick_price"
+	RunReportOrderOffTick    = "order_off_tick_price"
+	RunReportSnapshotOffTick = "snapshot_off_tick_price"
+)
+
+type offTickStat struct {
+	count      int
+	firstPrice int64 // ×10^model.PriceE4Scale
+}
+
+// CheckTickSize 统计不在价格网格上的价格个数，每个票只打一条告警（个数和首个异常价格），返回总数
+// priceList 返回 E4 价格
+func CheckTickSize[T any](name string, date string, list []*T, instrumentId func(v *T) string, priceList func(v *T) []int64) int {
+	statMap := make(map[string]*offTickStat)
+	total := 0
+	for _, v := range list {
+		id := instrumentId(v)
+		tick := utils.ScalePrice(utils.GetTickSize(id), utils.TickScale, model.PriceE4Scale)
+		if tick == 0 {
+			continue
+		}
+		for _, price := range priceList(v) {
+			if price <= 0 || price%tick == 0 {
+				continue
+			}
+			stat, ok := statMap[id]
+			if !ok {
+				stat = &offTickStat{firstPrice: price}
+				statMap[id] = stat
+			}
+			stat.count++
+			total++
+		}
+	}
+
+	idList := make([]string, 0, len(statMap))
+	for id := range statMap {
+		idList = append(idList, id)
+	}
+	sort.Strings(idList)
+	for _, id := range idList {
+		stat := statMap[id]
+		logger.Warn("CheckTickSize %s date(%s) instrument(%s): %d prices not on tick(%g), first price=%v",
+			name, date, id, stat.count, float64(utils.GetTickSize(id))/math.Pow10(utils.TickScale), priceE4ToFloat(stat.firstPrice))
+	}
+	return total
+}
+
+// CheckTradeTickSize 开启 tick_size_check 时检查成交价
+func CheckTradeTickSize(date string, list []*model.Trade) {
+	if !config.Cfg.TickSizeCheck {
+		return
+	}
+	count := CheckTickSize("trade", date, list, func(v *model.Trade) string { return v.InstrumentId },
+		func(v *model.Trade) []int64 { return []int64{v.PriceE4} })
+	SetRunReportCount(RunReportTradeOffTick, int64(count))
+}
+
+// CheckOrderTickSize 开启 tick_size_check 时检查委托价
+func CheckOrderTickSize(date string, list []*model.Order) {
+	if !config.Cfg.TickSizeCheck {
+		return
+	}
+	count := CheckTickSize("order", date, list, func(v *model.Order) string { return v.InstrumentId },
+		func(v *model.Order) []int64 { return []int64{v.PriceE4} })
+	SetRunReportCount(RunReportOrderOffTick, int64(count))
+}
+
+// CheckSnapshotTickSize 开启 tick_size_check 时检查快照的最新价、OHLC、昨收和盘口价
+func CheckSnapshotTickSize(date string, list []*model.Snapshot) {
+	if !config.Cfg.TickSizeCheck {
+		return
+	}
+	count := CheckTickSize("snapshot", date, list, func(v *model.Snapshot) string { return v.InstrumentId },
+		func(v *model.Snapshot) []int64 {
+			res := []int64{v.LastE4, v.PreCloseE4, v.OpenE4, v.HighE4, v.LowE4, v.CloseE4}
+			res = append(res, v.BidPriceListE4...)
+			return append(res, v.AskPriceListE4...)
+		})
+	SetRunReportCount(RunReportSnapshotOffTick, int64(count))
+}
@@ -0,0 +1,112 @@
+package service
+
+import (
+	"data-scrubber/biz/constdef"
+	"data-scrubber/biz/model"
+	"data-scrubber/config"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"testing"
+
+	"github.com/xitongsys/parquet-go-source/local"
+	"github.com/xitongsys/parquet-go/reader"
+)
+
+func TestInt64PriceEncoding(t *testing.T) {
+	oldCfg := config.Cfg
+	defer func() { config.Cfg = oldCfg }()
+	config.Cfg = &config.Config{PriceEncoding: constdef.PriceEncodingInt64}
+
+	price, err := parsePriceText("35.0100")
+	if err != nil {
+		t.Fatalf("parsePriceText error: %v", err)
+	}
+	filePath := filepath.Join(t.TempDir(), "20240115_trade.parquet")
+	if err := WriteOutputFile(filePath, []*model.Trade{{InstrumentId: "000001.SZ", Price: priceE4ToFloat(price), PriceE4: price}}, nil); err != nil {
+		t.Fatalf("WriteOutputFile error: %v", err)
+	}
+
+	fr, err := local.NewLocalFileReader(filePath)
+	if err != nil {
+		t.Fatalf("NewLocalFileReader error: %v", err)
+	}
+	defer fr.Close()
+	pr, err := reader.NewParquetReader(fr, nil, 1)
+	if err != nil {
+		t.Fatalf("NewParquetReader error: %v", err)
+	}
+	defer pr.ReadStop()
+
+	metadata := make(map[string]string)
+	for _, kv := range pr.Footer.KeyValueMetadata {
+		metadata[kv.Key] = *kv.Value
+	}
+	if metadata[constdef.ParquetMetaPriceEncoding] != constdef.PriceEncodingInt64 || metadata[constdef.ParquetMetaPriceScale] != "4" {
+		t.Errorf("metadata=%v", metadata)
+	}
+	valueList, _, _, err := pr.ReadColumnByPath(pr.SchemaHandler.GetRootInName()+"\x01Price", 1)
+	if err != nil {
+		t.Fatalf("ReadColumnByPath error: %v", err)
+	}
+	if len(valueList) != 1 || valueList[0] != int64(350100) {
+		t.Errorf("Price=%v, 期望 350100", valueList)
+	}
+}
+
+// 原始价格按 E4 整数换算 scale，不在输出的 scale 上对浮点数重新舍入
+func TestSetScaledPrice(t *testing.T) {
+	scaled := func(price float64, e4 reflect.Value, scale int) int64 {
+		var dst int64
+		setScaledPrice(reflect.ValueOf(&dst).Elem(), reflect.ValueOf(price), e4, scale)
+		return dst
+	}
+	for _, c := range []struct {
+		text  string
+		scale int
+		want  int64
+	}{
+		{"1.005", 2, 101}, // 1.005×100 的浮点结果为 100.49999999999999，浮点四舍五入得到 100
+		{"35.0100", 6, 35010000},
+		{"-1.015", 2, -102},
+		{"3.853", 4, 38530},
+	} {
+		price, err := parsePriceText(c.text)
+		if err != nil {
+			t.Fatalf("parsePriceText(%s) error: %v", c.text, err)
+		}
+		if v := scaled(priceE4ToFloat(price), reflect.ValueOf(price), c.scale); v != c.want {
+			t.Errorf("setScaledPrice(%s, %d)=%d, 期望 %d", c.text, c.scale, v, c.want)
+		}
+	}
+	// 计算出来的价格没有 E4 字段，E4 没有填时也按浮点四舍五入
+	if v := scaled(10.123456, reflect.Value{}, 4); v != 101235 {
+		t.Errorf("setScaledPrice(10.123456, 4)=%d", v)
+	}
+	if v := scaled(10.123456, reflect.ValueOf(int64(0)), 4); v != 101235 {
+		t.Errorf("setScaledPrice(10.123456, E4=0, 4)=%d", v)
+	}
+
+	// 盘口按 book depth 截断时价格列比 E4 短
+	var dst []int64
+	setScaledPrice(reflect.ValueOf(&dst).Elem(), reflect.ValueOf([]float64{1.005, 1.015}), reflect.ValueOf([]int64{10050, 10150, 10250}), 2)
+	if !slices.Equal(dst, []int64{101, 102}) {
+		t.Errorf("setScaledPrice list=%v", dst)
+	}
+}
+
+func TestCheckTickSize(t *testing.T) {
+	tradeList := []*model.Trade{
+		{InstrumentId: "600000.SH", PriceE4: 101800},
+		{InstrumentId: "600000.SH", PriceE4: 101850},
+		{InstrumentId: "510300.SH", PriceE4: 38530},
+		{InstrumentId: "000001.SZ", PriceE4: 0},
+		{InstrumentId: "000001.SZ", PriceE4: 123456},
+		{InstrumentId: "131810.SZ", PriceE4: 12345}, // 债券回购不检查
+	}
+	count := CheckTickSize("trade", "20240115", tradeList, func(v *model.Trade) string { return v.InstrumentId },
+		func(v *model.Trade) []int64 { return []int64{v.PriceE4} })
+	if count != 2 {
+		t.Errorf("count=%d, 期望 2", count)
+	}
+}
@@ -1,7 +1,11 @@
 package service
 
 import (
+	"data-scrubber/biz/model"
+	"data-scrubber/biz/utils"
 	"fmt"
+	"math"
+	"reflect"
 	"strconv"
 	"strings"
 )
@@ -97,6 +101,104 @@ func parseFloat64Field(fields []string, headerIndex map[string]int, fieldName st
 	return nil
 }
 
+// 交易所原始价格最多 4 位小数（沪市 3 位，深市 4 位），正好精确解析成 model.PriceE4Scale 位小数的整数
+const rawPriceFactor = 10000
+
+// parsePriceText 价格文本精确解析成 价格×10^4 的整数（见 model.PriceE4Suffix），不经过浮点数；
+// 小数位更多或写法不规范的按浮点解析后四舍五入到 4 位小数
+func parsePriceText(text string) (int64, error) {
+	value, err := utils.ParsePrice(text, model.PriceE4Scale)
+	if err == nil {
+		return value, nil
+	}
+	price, err := strconv.ParseFloat(strings.TrimSpace(text), 64)
+	if err != nil {
+		return 0, err
+	}
+	return utils.PriceToInt64(price, rawPriceFactor), nil
+}
+
+// priceE4ToFloat 精确价格换算成 float64 价格列，结果是离原始价格文本最近的 float64
+func priceE4ToFloat(value int64) float64 {
+	return float64(value) / rawPriceFactor
+}
+
+func priceE4ListToFloat(list []int64) []float64 {
+	res := make([]float64, len(list))
+	for i, v := range list {
+		res[i] = priceE4ToFloat(v)
+	}
+	return res
+}
+
+// getPriceE4Index 价格字段 name 对应的 E4 字段下标，没有 E4 字段（计算出来的价格）时返回 nil
+func getPriceE4Index(t reflect.Type, name string) []int {
+	if f, ok := t.FieldByName(name + model.PriceE4Suffix); ok {
+		return f.Index
+	}
+	return nil
+}
+
+// setScaledPrice 价格列 src（float64 或 []float64）转成 价格×10^scale 的整数写到 dst（int64 价格列和 DECIMAL 价格列）
+// 原始价格用 E4 字段 e4 的整数换算，不在输出的 scale 上对浮点数重新舍入；
+// 计算出来的价格（Vwap、复权价等）没有 E4 字段（e4 为零值），E4 没有填（为 0 而价格不为 0）时也一样，只能按浮点四舍五入
+func setScaledPrice(dst reflect.Value, src reflect.Value, e4 reflect.Value, scale int) {
+	toInt := func(price float64, e4Value reflect.Value) int64 {
+		if e4Value.IsValid() && (e4Value.Int() != 0 || price == 0) {
+			return utils.ScalePrice(e4Value.Int(), model.PriceE4Scale, scale)
+		}
+		return utils.PriceToInt64(price, math.Pow10(scale))
+	}
+	if src.Kind() == reflect.Float64 {
+		dst.SetInt(toInt(src.Float(), e4))
+		return
+	}
+	if src.IsNil() {
+		return
+	}
+	list := make([]int64, src.Len())
+	for i := range list {
+		var e4Value reflect.Value
+		if e4.IsValid() && i < e4.Len() {
+			e4Value = e4.Index(i)
+		}
+		list[i] = toInt(src.Index(i).Float(), e4Value)
+	}
+	dst.Set(reflect.ValueOf(list))
+}
+
+// 辅助函数：解析价格字段，见 parsePriceText
+func parsePriceField(fields []string, headerIndex map[string]int, fieldName string, target *int64) error {
+	valueStr, err := getFieldValue(fields, headerIndex, fieldName)
+	if err != nil {
+		return err
+	}
+	value, err := parsePriceText(valueStr)
+	if err != nil {
+		return fmt.Errorf("解析 %s 失败: %v", fieldName, err)
+	}
+	*target = value
+	return nil
+}
+
+// 辅助函数：解析字符编码字段，兼容 ASCII 码（如 "50"）和单个字符（如 "2"、"U"）两种写法
+// 单个字符一律按字符取编码，"2" 为 50 而不是 2（个位数的 ASCII 码都是控制字符，不会出现）
+func parseCharCodeField(fields []string, headerIndex map[string]int, fieldName string, target *int) error {
+	valueStr, err := getFieldValue(fields, headerIndex, fieldName)
+	if err != nil {
+		return err
+	}
+	if len(valueStr) == 1 {
+		*target = int(valueStr[0])
+		return nil
+	}
+	if value, err := strconv.Atoi(valueStr); err == nil {
+		*target = value
+		return nil
+	}
+	return fmt.Errorf("解析 %s 失败: %q", fieldName, valueStr)
+}
+
 // 辅助函数：解析int类型字段
 func parseIntField(fields []string, headerIndex map[string]int, fieldName string, target *int) error {
 	valueStr, err := getFieldValue(fields, headerIndex, fieldName)
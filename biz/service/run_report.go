@@ -0,0 +1,75 @@
+package service
+
+import (
+	"data-scrubber/biz/errorx"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	logger "github.com/2997215859/golog"
+)
+
+// RunReport 单日运行报告，记录各环节的计数（如去重丢弃的记录数），每天处理结束后写入 dst/report/<date>_report.json
+type RunReport struct {
+	Date     string           `json:"date"`
+	Counters map[string]int64 `json:"counters"`
+}
+
+var (
+	runReportMu sync.Mutex
+	runReport   = &RunReport{Counters: make(map[string]int64)}
+)
+
+// ResetRunReport 开始处理新的一天前调用
+func ResetRunReport(date string) {
+	runReportMu.Lock()
+	defer runReportMu.Unlock()
+	runReport = &RunReport{Date: date, Counters: make(map[string]int64)}
+}
+
+// SetRunReportCount 设置计数；同一份数据可能被多个 data type 重复读取，这里覆盖而不是累加
+func SetRunReportCount(key string, value int64) {
+	runReportMu.Lock()
+	defer runReportMu.Unlock()
+	runReport.Counters[key] = value
+}
+
+// GetRunReportCount 读取计数，不存在时返回 0
+func GetRunReportCount(key string) int64 {
+	runReportMu.Lock()
+	defer runReportMu.Unlock()
+	return runReport.Counters[key]
+}
+
+// WriteRunReport 将当天的运行报告写入 dstDir/report/<date>_report.json 并打印
+func WriteRunReport(dstDir string) error {
+	runReportMu.Lock()
+	defer runReportMu.Unlock()
+
+	keyList := make([]string, 0, len(runReport.Counters))
+	for k := range runReport.Counters {
+		keyList = append(keyList, k)
+	}
+	sort.Strings(keyList)
+	for _, k := range keyList {
+		logger.Info("RunReport date(%s) %s=%d", runReport.Date, k, runReport.Counters[k])
+	}
+
+	dstDir = filepath.Join(dstDir, "report")
+	if err := os.MkdirAll(dstDir, 0755); err != nil {
+		return errorx.NewError("MkdirAll(%s) error: %v", dstDir, err)
+	}
+
+	data, err := json.MarshalIndent(runReport, "", "  ")
+	if err != nil {
+		return errorx.NewError("json.Marshal RunReport error: %v", err)
+	}
+	filePath := filepath.Join(dstDir, fmt.Sprintf("%s_report.json", runReport.Date))
+	if err := os.WriteFile(filePath, data, 0644); err != nil {
+		return errorx.NewError("WriteFile(%s) error: %v", filePath, err)
+	}
+	return nil
+}
@@ -0,0 +1,221 @@
+package service
+
+import (
+	"data-scrubber/biz/constdef"
+	"data-scrubber/biz/errorx"
+	"data-scrubber/biz/model"
+	"data-scrubber/config"
+	"fmt"
+	"reflect"
+	"slices"
+	"strconv"
+)
+
+// 参与 schema profile 投影的 model 类型，未列出的类型（如 SequenceIssue）始终输出全部列
+var schemaDataTypeMap = map[reflect.Type]string{
+	reflect.TypeOf(model.Trade{}):            constdef.DataTypeTrade,
+	reflect.TypeOf(model.Order{}):            constdef.DataTypeOrder,
+	reflect.TypeOf(model.OrderQueue{}):       constdef.DataTypeOrderQueue,
+	reflect.TypeOf(model.Snapshot{}):         constdef.DataTypeSnapshot,
+	reflect.TypeOf(model.Bar{}):              constdef.DataTypeBar,
+	reflect.TypeOf(model.Daily{}):            constdef.DataTypeDaily,
+	reflect.TypeOf(model.OrderLifecycle{}):   constdef.DataTypeOrderLifecycle,
+	reflect.TypeOf(model.Tick{}):             constdef.DataTypeTick,
+	reflect.TypeOf(model.AdjustedTrade{}):    constdef.DataTypeTrade,
+	reflect.TypeOf(model.AdjustedSnapshot{}): constdef.DataTypeSnapshot,
+}
+
+// 盘口列，按 book_depth 截断
+var bookFieldSet = map[string]bool{
+	"BidVolumeList": true,
+	"BidPriceList":  true,
+	"AskVolumeList": true,
+	"AskPriceList":  true,
+}
+
+const (
+	fullBookDepth = 10
+	listWidthTag  = "listwidth" // 投影后列表列的固定宽度，csv 展开时使用
+)
+
+// schemaProjection model 结构体到投影后结构体的映射
+// 投影后的结构体沿用原字段的名字、类型和 tag，所以各 profile 之间同名列的类型一致；
+// price_encoding 为 int64 时价格列统一换成 int64，嵌入的结构体（如 AdjustedTrade 中的 Trade）展开成平铺的列
+type schemaProjection struct {
+	projectedType  reflect.Type
+	fieldIndexList [][]int // 投影后第 i 个字段对应原结构体的字段下标，见 reflect.Value.FieldByIndex
+	bookFieldList  []bool  // 投影后第 i 个字段是否为盘口列
+	priceFieldList []bool  // 投影后第 i 个字段是否需要转成 int64 价格
+	priceE4List    [][]int // 投影后第 i 个价格字段对应的 E4 字段在原结构体中的下标，没有时为 nil
+	bookDepth      int
+	priceScale     int
+}
+
+// getSchemaProjection 按 schema 对应的 data type 取 profile，不需要投影时返回 nil
+func getSchemaProjection(schema interface{}) (*schemaProjection, error) {
+	t := structType(reflect.TypeOf(schema))
+	if t == nil {
+		return nil, nil
+	}
+	profile := &config.SchemaProfile{}
+	dataType, ok := schemaDataTypeMap[t]
+	if ok {
+		if profile, ok = config.Cfg.GetSchemaProfile(dataType); !ok {
+			return nil, errorx.NewError("data type(%s) unknown schema profile(%s)", dataType, config.Cfg.GetSchemaProfileName(dataType))
+		}
+	}
+
+	bookDepth := profile.BookDepth
+	if bookDepth == 0 {
+		bookDepth = fullBookDepth
+	}
+	if bookDepth != 5 && bookDepth != fullBookDepth {
+		return nil, errorx.NewError("data type(%s) schema profile book_depth(%d) must be 5 or 10", dataType, profile.BookDepth)
+	}
+	for _, name := range slices.Concat(profile.ColumnList, profile.ExcludeColumnList) {
+		// 自定义 profile 对所有类型生效，只要有一个类型认识这个列名即可
+		if !isSchemaColumn(name) {
+			return nil, errorx.NewError("data type(%s) schema profile unknown column(%s)", dataType, name)
+		}
+	}
+
+	p := &schemaProjection{bookDepth: bookDepth, priceScale: config.Cfg.GetPriceScale()}
+	int64Price := config.Cfg.IsInt64Price()
+	changed := false
+	columnCount := 0
+	fieldList := make([]reflect.StructField, 0, t.NumField())
+	for _, f := range reflect.VisibleFields(t) {
+		if f.Anonymous {
+			changed = true
+			continue
+		}
+		// E4 等不是输出列的字段不参与 profile 筛选，原样保留，DECIMAL 价格列写入时还要用
+		isColumn := isColumnField(f)
+		if isColumn && len(profile.ColumnList) > 0 && !slices.Contains(profile.ColumnList, f.Name) {
+			continue
+		}
+		if isColumn && slices.Contains(profile.ExcludeColumnList, f.Name) {
+			continue
+		}
+		name := f.Name
+		isPrice := int64Price && setInt64PriceField(&f)
+		isBook := bookFieldSet[f.Name]
+		if isBook && bookDepth != fullBookDepth {
+			f.Tag = reflect.StructTag(string(f.Tag) + ` ` + listWidthTag + `:"` + strconv.Itoa(bookDepth) + `"`)
+		}
+		changed = changed || isPrice
+		p.fieldIndexList = append(p.fieldIndexList, f.Index)
+		f.Index = nil
+		f.Offset = 0
+		fieldList = append(fieldList, f)
+		p.bookFieldList = append(p.bookFieldList, isBook)
+		p.priceFieldList = append(p.priceFieldList, isPrice)
+		var e4Index []int
+		if isPrice {
+			e4Index = getPriceE4Index(t, name)
+		}
+		p.priceE4List = append(p.priceE4List, e4Index)
+		if isColumn {
+			columnCount++
+		}
+	}
+	if columnCount == 0 {
+		return nil, errorx.NewError("data type(%s) schema profile(%s) selects no column", dataType, config.Cfg.GetSchemaProfileName(dataType))
+	}
+	if !changed && len(fieldList) == t.NumField() && bookDepth == fullBookDepth {
+		return nil, nil
+	}
+	p.projectedType = reflect.StructOf(fieldList)
+	return p, nil
+}
+
+// setInt64PriceField 价格字段改成 int64/[]int64 并改写 parquet tag，不是价格字段时返回 false
+func setInt64PriceField(f *reflect.StructField) bool {
+	if !decimalPriceFieldSet[f.Name] {
+		return false
+	}
+	switch f.Type {
+	case reflect.TypeOf(float64(0)):
+		f.Type = reflect.TypeOf(int64(0))
+		f.Tag = reflect.StructTag(fmt.Sprintf(`parquet:"name=%s, type=INT64"`, getParquetColumnName(*f)))
+	case reflect.TypeOf([]float64{}):
+		f.Type = reflect.TypeOf([]int64{})
+		f.Tag = reflect.StructTag(fmt.Sprintf(`parquet:"name=%s, type=MAP, convertedtype=LIST, valuetype=INT64"`, getParquetColumnName(*f)))
+	default:
+		return false
+	}
+	return true
+}
+
+// hasInt64PriceField schema 中是否有 setInt64PriceField 转换过的价格列，有则在文件元数据中记录 scale
+func hasInt64PriceField(schema interface{}) bool {
+	t := structType(reflect.TypeOf(schema))
+	if t == nil || !config.Cfg.IsInt64Price() {
+		return false
+	}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if decimalPriceFieldSet[f.Name] && (f.Type == reflect.TypeOf(int64(0)) || f.Type == reflect.TypeOf([]int64{})) {
+			return true
+		}
+	}
+	return false
+}
+
+// isColumnField 有 parquet tag 的字段才是输出列，E4 等内部字段没有（parquet-go 同样跳过没有 tag 的字段）
+func isColumnField(f reflect.StructField) bool {
+	return f.Tag.Get("parquet") != ""
+}
+
+func isSchemaColumn(name string) bool {
+	for t := range schemaDataTypeMap {
+		if f, ok := t.FieldByName(name); ok && !f.Anonymous && isColumnField(f) {
+			return true
+		}
+	}
+	return false
+}
+
+// project 把一行 model 数据拷贝成投影后的结构体指针，盘口列截断到 bookDepth
+func (p *schemaProjection) project(row interface{}) (interface{}, error) {
+	rv := reflect.ValueOf(row)
+	for rv.Kind() == reflect.Pointer {
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return nil, errorx.NewError("row(%T) is not a struct", row)
+	}
+
+	res := reflect.New(p.projectedType)
+	dst := res.Elem()
+	for i, index := range p.fieldIndexList {
+		v := rv.FieldByIndex(index)
+		if p.bookFieldList[i] && v.Len() > p.bookDepth {
+			v = v.Slice(0, p.bookDepth)
+		}
+		if p.priceFieldList[i] {
+			var e4 reflect.Value
+			if p.priceE4List[i] != nil {
+				e4 = rv.FieldByIndex(p.priceE4List[i])
+			}
+			setScaledPrice(dst.Field(i), v, e4, p.priceScale)
+			continue
+		}
+		dst.Field(i).Set(v)
+	}
+	return res.Interface(), nil
+}
+
+// projectedOutputWriter 写入前先按 schema profile 投影
+type projectedOutputWriter struct {
+	OutputWriter
+	projection *schemaProjection
+}
+
+func (w *projectedOutputWriter) Write(row interface{}) error {
+	v, err := w.projection.project(row)
+	if err != nil {
+		return err
+	}
+	return w.OutputWriter.Write(v)
+}
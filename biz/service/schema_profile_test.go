@@ -0,0 +1,81 @@
+package service
+
+import (
+	"data-scrubber/biz/constdef"
+	"data-scrubber/biz/model"
+	"data-scrubber/config"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/xitongsys/parquet-go-source/local"
+	"github.com/xitongsys/parquet-go/reader"
+)
+
+func TestSchemaProfile(t *testing.T) {
+	oldCfg := config.Cfg
+	defer func() { config.Cfg = oldCfg }()
+	config.Cfg = &config.Config{
+		OutputFormat:     constdef.OutputFormatBoth,
+		SchemaProfileMap: map[string]string{constdef.DataTypeSnapshot: constdef.SchemaProfileMinimal, constdef.DataTypeTrade: "price_only"},
+		SchemaProfileDef: map[string]*config.SchemaProfile{"price_only": {ColumnList: []string{"InstrumentId", "TradeTimestamp", "Price"}}},
+	}
+
+	dir := t.TempDir()
+	bidPriceList := []float64{10.9, 10.8, 10.7, 10.6, 10.5, 10.4, 10.3}
+	snapshotList := []*model.Snapshot{
+		{InstrumentId: "600000.SH", UpdateTimestamp: 100, Last: 11, BidPriceList: bidPriceList, SeqNo: 7, LocalTimestamp: 8},
+	}
+	snapshotPath := filepath.Join(dir, "20240115_snapshot.parquet")
+	if err := WriteOutputFile(snapshotPath, snapshotList, nil); err != nil {
+		t.Fatalf("WriteOutputFile(snapshot) error: %v", err)
+	}
+	if bidPriceList[6] != 10.3 || len(snapshotList[0].BidPriceList) != 7 {
+		t.Errorf("投影不应修改原始数据")
+	}
+
+	// minimal：没有 SeqNo/LocalTimestamp，盘口 5 档
+	header := readCsvGz(t, filepath.Join(dir, "20240115_snapshot.csv.gz"))[0]
+	if slices.Contains(header, "SeqNo") || slices.Contains(header, "LocalTimestamp") || !slices.Contains(header, "BidPrice5") || slices.Contains(header, "BidPrice6") {
+		t.Errorf("snapshot header=%v", header)
+	}
+	fr, err := local.NewLocalFileReader(snapshotPath)
+	if err != nil {
+		t.Fatalf("NewLocalFileReader error: %v", err)
+	}
+	defer fr.Close()
+	pr, err := reader.NewParquetReader(fr, nil, 1)
+	if err != nil {
+		t.Fatalf("NewParquetReader error: %v", err)
+	}
+	defer pr.ReadStop()
+	columnList := make([]string, 0)
+	for _, column := range pr.Footer.RowGroups[0].Columns {
+		columnList = append(columnList, column.MetaData.PathInSchema[0])
+	}
+	if slices.Contains(columnList, "SeqNo") || !slices.Contains(columnList, "BidPriceList") {
+		t.Errorf("snapshot parquet columnList=%v", columnList)
+	}
+	bidPriceValueList, _, _, err := pr.ReadColumnByPath(pr.SchemaHandler.GetRootInName()+"\x01BidPriceList\x01List\x01Element", 10)
+	if err != nil {
+		t.Fatalf("ReadColumnByPath error: %v", err)
+	}
+	if len(bidPriceValueList) != 5 {
+		t.Errorf("BidPriceList=%v, 期望 5 档", bidPriceValueList)
+	}
+
+	// 自定义 profile 只输出指定列
+	tradePath := filepath.Join(dir, "20240115_trade.parquet")
+	if err := WriteOutputFile(tradePath, []*model.Trade{{InstrumentId: "600000.SH", TradeTimestamp: 1, Price: 10.5, Volume: 100}}, nil); err != nil {
+		t.Fatalf("WriteOutputFile(trade) error: %v", err)
+	}
+	recordList := readCsvGz(t, filepath.Join(dir, "20240115_trade.csv.gz"))
+	if !slices.Equal(recordList[0], []string{"InstrumentId", "TradeTimestamp", "Price"}) || recordList[1][2] != "10.5" {
+		t.Errorf("trade recordList=%v", recordList)
+	}
+
+	config.Cfg.SchemaProfile = "unknown"
+	if err := WriteOutputFile(filepath.Join(dir, "20240115_order.parquet"), []*model.Order{{}}, nil); err == nil {
+		t.Errorf("unknown schema profile 应报错")
+	}
+}
@@ -0,0 +1,273 @@
+package service
+
+import (
+	"data-scrubber/biz/constdef"
+	"data-scrubber/biz/errorx"
+	"data-scrubber/biz/layout"
+	"data-scrubber/biz/model"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	logger "github.com/2997215859/golog"
+	"github.com/dromara/carbon/v2"
+)
+
+// 单次检查最多逐条打印的问题数，其余只计入汇总
+const maxLogSequenceIssue = 20
+
+// RunReportSequenceIssue 序号问题涉及的记录数，%s 为市场和问题类型，如 sequence_sh_gap
+const RunReportSequenceIssue = "sequence_%s_%s"
+
+// SequenceRecord 参与序号检查的一条逐笔记录
+type SequenceRecord struct {
+	Channel      int64
+	Seq          int64
+	InstrumentId string
+}
+
+// ShRawTrade2SequenceList 沪市新格式 mdl_4_24_0（成交、委托、状态共用 BizIndex）
+func ShRawTrade2SequenceList(rawList []*model.ShRawTrade) []*SequenceRecord {
+	res := make([]*SequenceRecord, 0, len(rawList))
+	for _, v := range rawList {
+		res = append(res, &SequenceRecord{Channel: v.Channel, Seq: v.BizIndex, InstrumentId: fmt.Sprintf("%s.SH", v.SecurityID)})
+	}
+	return res
+}
+
+// SzRawOrder2SequenceList 深市逐笔委托 mdl_6_33_0
+func SzRawOrder2SequenceList(rawList []*model.SzRawOrder) []*SequenceRecord {
+	res := make([]*SequenceRecord, 0, len(rawList))
+	for _, v := range rawList {
+		res = append(res, &SequenceRecord{Channel: v.ChannelNo, Seq: v.ApplSeqNum, InstrumentId: fmt.Sprintf("%s.SZ", v.SecurityID)})
+	}
+	return res
+}
+
+// SzRawTrade2SequenceList 深市逐笔成交 mdl_6_36_0（含撤单）
+func SzRawTrade2SequenceList(rawList []*model.SzRawTrade) []*SequenceRecord {
+	res := make([]*SequenceRecord, 0, len(rawList))
+	for _, v := range rawList {
+		res = append(res, &SequenceRecord{Channel: v.ChannelNo, Seq: v.ApplSeqNum, InstrumentId: fmt.Sprintf("%s.SZ", v.SecurityID)})
+	}
+	return res
+}
+
+// joinInstrumentId 去重排序后用逗号拼接
+func joinInstrumentId(set map[string]struct{}) string {
+	list := make([]string, 0, len(set))
+	for k := range set {
+		list = append(list, k)
+	}
+	sort.Strings(list)
+	return strings.Join(list, ",")
+}
+
+// CheckSequence 检查同一市场各通道的序号完整性
+// streamList 为同一市场的多个原始文件（如深市委托 + 成交），每个文件内保持原始顺序：
+// 重复和缺失在所有文件合并后判断，乱序在单个文件内判断（文件之间本来就是交错的）。
+// checkGap=false 时只检查重复和乱序，用于只读到部分文件、序号本身不连续的场景
+func CheckSequence(date string, market string, streamList [][]*SequenceRecord, checkGap bool) []*model.SequenceIssue {
+	mapChannel := make(map[int64][]*SequenceRecord)
+	for _, stream := range streamList {
+		for _, v := range stream {
+			mapChannel[v.Channel] = append(mapChannel[v.Channel], v)
+		}
+	}
+	channelList := make([]int64, 0, len(mapChannel))
+	for channel := range mapChannel {
+		channelList = append(channelList, channel)
+	}
+	sort.Slice(channelList, func(i, j int) bool { return channelList[i] < channelList[j] })
+
+	res := make([]*model.SequenceIssue, 0)
+	newIssue := func(channel int64, issueType string, begin int64, end int64, count int64, instrumentSet map[string]struct{}) {
+		res = append(res, &model.SequenceIssue{
+			TradeDate:        date,
+			Market:           market,
+			Channel:          channel,
+			IssueType:        issueType,
+			BeginSeq:         begin,
+			EndSeq:           end,
+			Count:            count,
+			InstrumentIdList: joinInstrumentId(instrumentSet),
+		})
+	}
+
+	// 重复 + 缺失
+	duplicateSeq := make(map[int64]map[int64]struct{})
+	for _, channel := range channelList {
+		list := make([]*SequenceRecord, len(mapChannel[channel]))
+		copy(list, mapChannel[channel])
+		sort.SliceStable(list, func(i, j int) bool { return list[i].Seq < list[j].Seq })
+
+		for i := 1; i < len(list); i++ {
+			prev, cur := list[i-1], list[i]
+			if cur.Seq == prev.Seq {
+				// 连续相同序号合并为一条
+				j := i
+				instrumentSet := map[string]struct{}{cur.InstrumentId: {}}
+				for j+1 < len(list) && list[j+1].Seq == cur.Seq {
+					j++
+					instrumentSet[list[j].InstrumentId] = struct{}{}
+				}
+				newIssue(channel, constdef.SequenceIssueDuplicate, cur.Seq, cur.Seq, int64(j-i+1), instrumentSet)
+				if duplicateSeq[channel] == nil {
+					duplicateSeq[channel] = make(map[int64]struct{})
+				}
+				duplicateSeq[channel][cur.Seq] = struct{}{}
+				i = j
+				continue
+			}
+			if checkGap && cur.Seq > prev.Seq+1 {
+				newIssue(channel, constdef.SequenceIssueGap, prev.Seq+1, cur.Seq-1, cur.Seq-prev.Seq-1,
+					map[string]struct{}{prev.InstrumentId: {}, cur.InstrumentId: {}})
+			}
+		}
+	}
+
+	// 乱序：单个文件内小于已出现最大序号的连续记录合并为一段
+	for _, stream := range streamList {
+		type run struct {
+			begin, end, count int64
+			instrumentSet     map[string]struct{}
+		}
+		maxSeq := make(map[int64]int64)
+		openRun := make(map[int64]*run)
+		closeRun := func(channel int64) {
+			if r, ok := openRun[channel]; ok {
+				newIssue(channel, constdef.SequenceIssueOutOfOrder, r.begin, r.end, r.count, r.instrumentSet)
+				delete(openRun, channel)
+			}
+		}
+
+		for _, v := range stream {
+			if _, ok := duplicateSeq[v.Channel][v.Seq]; ok {
+				continue
+			}
+			last, seen := maxSeq[v.Channel]
+			if !seen || v.Seq > last {
+				closeRun(v.Channel)
+				maxSeq[v.Channel] = v.Seq
+				continue
+			}
+			r, ok := openRun[v.Channel]
+			if !ok {
+				r = &run{begin: v.Seq, end: v.Seq, instrumentSet: make(map[string]struct{})}
+				openRun[v.Channel] = r
+			}
+			r.begin = min(r.begin, v.Seq)
+			r.end = max(r.end, v.Seq)
+			r.count++
+			r.instrumentSet[v.InstrumentId] = struct{}{}
+		}
+		for _, channel := range channelList {
+			closeRun(channel)
+		}
+	}
+
+	return res
+}
+
+// LogSequenceIssueList 打印序号问题，source 用于标识来源（如 "order"/"trade"/"validate"）
+func LogSequenceIssueList(source string, issueList []*model.SequenceIssue) {
+	if len(issueList) == 0 {
+		return
+	}
+	count := make(map[string]int)
+	for i, v := range issueList {
+		count[v.IssueType]++
+		if i < maxLogSequenceIssue {
+			logger.Warn("Sequence(%s) date(%s) %s channel(%d) %s seq[%d, %d] count=%d instruments=%s",
+				source, v.TradeDate, v.Market, v.Channel, v.IssueType, v.BeginSeq, v.EndSeq, v.Count, v.InstrumentIdList)
+		}
+	}
+	logger.Warn("Sequence(%s) issue total=%d, gap=%d, duplicate=%d, out_of_order=%d",
+		source, len(issueList), count[constdef.SequenceIssueGap], count[constdef.SequenceIssueDuplicate], count[constdef.SequenceIssueOutOfOrder])
+}
+
+// ReportSequenceIssueList 按问题类型汇总 Count 写入运行报告，同一市场的三种类型都会写（没有问题时为 0）
+func ReportSequenceIssueList(market string, issueList []*model.SequenceIssue) {
+	count := map[string]int64{
+		constdef.SequenceIssueGap:        0,
+		constdef.SequenceIssueDuplicate:  0,
+		constdef.SequenceIssueOutOfOrder: 0,
+	}
+	for _, v := range issueList {
+		count[v.IssueType] += v.Count
+	}
+	for issueType, v := range count {
+		SetRunReportCount(fmt.Sprintf(RunReportSequenceIssue, strings.ToLower(market), issueType), v)
+	}
+}
+
+// CheckSequenceOnce 清洗流程中的序号检查：同一个 DayContext 内同一市场只检查一次，结果打印并写入运行报告。
+// 同一份原始文件会被 trade/order/bar/daily 等多个 data type 重复读取；
+// 之前只做过不含缺失的检查（checkGap=false）时，checkGap=true 的检查会重新做一次并覆盖报告
+func (d *DayContext) CheckSequenceOnce(market string, source string, getStreamList func() [][]*SequenceRecord, checkGap bool) {
+	d.mu.Lock()
+	if checked, ok := d.sequenceCheckMap[market]; ok && (checked || !checkGap) {
+		d.mu.Unlock()
+		return
+	}
+	d.sequenceCheckMap[market] = checkGap
+	d.mu.Unlock()
+
+	issueList := CheckSequence(d.Date, market, getStreamList(), checkGap)
+	LogSequenceIssueList(source, issueList)
+	ReportSequenceIssueList(market, issueList)
+}
+
+// ==== validate
+
+// ValidateSequence 独立的序号完整性检查：读取当天沪市新格式 mdl_4_24_0、深市 mdl_6_33_0 + mdl_6_36_0，
+// 问题写入 dst/validate/<date>_sequence.parquet
+// 沪市旧格式（20231204 之前）委托和成交分文件且没有共用的连续序号，跳过
+func ValidateSequence(srcDir string, dstDir string, date string) error {
+	dstDir = filepath.Join(dstDir, constdef.CommandValidate)
+
+	currentDate := carbon.Parse(date).StartOfDay()
+	if currentDate.IsInvalid() {
+		return errorx.NewError("date(%s) is invalid", date)
+	}
+
+	issueList := make([]*model.SequenceIssue, 0)
+	var sourceFileList []string
+
+	if currentDate.Lt(shNewTradeStartDay) {
+		logger.Info("Skip Sh Sequence: date(%s) < 20231204, old format has no BizIndex sequence", date)
+	} else {
+		shFilepath := filepath.Join(srcDir, date, fmt.Sprintf("%s_mdl_4_24_0.csv.zip", date))
+		shRawTradeList, err := ManualReadShRawTrade(shFilepath)
+		if err != nil {
+			return errorx.NewError("ManualReadShRawTrade(%s) error: %s", shFilepath, err)
+		}
+		sourceFileList = append(sourceFileList, filepath.Base(shFilepath))
+		issueList = append(issueList, CheckSequence(date, constdef.MarketSH,
+			[][]*SequenceRecord{ShRawTrade2SequenceList(shRawTradeList)}, true)...)
+	}
+
+	szOrderFilepath := filepath.Join(srcDir, date, fmt.Sprintf("%s_mdl_6_33_0.csv.zip", date))
+	szRawOrderList, err := ManualReadSzRawOrder(szOrderFilepath)
+	if err != nil {
+		return errorx.NewError("ManualReadSzRawOrder(%s) error: %s", szOrderFilepath, err)
+	}
+	sourceFileList = append(sourceFileList, filepath.Base(szOrderFilepath))
+	szTradeFilepath := filepath.Join(srcDir, date, fmt.Sprintf("%s_mdl_6_36_0.csv.zip", date))
+	szRawTradeList, err := ManualReadSzRawTrade(szTradeFilepath)
+	if err != nil {
+		return errorx.NewError("ManualReadSzRawTrade(%s) error: %s", szTradeFilepath, err)
+	}
+	sourceFileList = append(sourceFileList, filepath.Base(szTradeFilepath))
+	issueList = append(issueList, CheckSequence(date, constdef.MarketSZ,
+		[][]*SequenceRecord{SzRawOrder2SequenceList(szRawOrderList), SzRawTrade2SequenceList(szRawTradeList)}, true)...)
+
+	LogSequenceIssueList(constdef.CommandValidate, issueList)
+
+	if err := os.MkdirAll(dstDir, 0755); err != nil {
+		return errorx.NewError("MkdirAll(%s) error: %v", dstDir, err)
+	}
+	return WriteOutputFile(filepath.Join(dstDir, layout.GetPerDayFileName(date, "sequence")), issueList, sourceFileList)
+}
@@ -0,0 +1,90 @@
+package service
+
+import (
+	"data-scrubber/biz/constdef"
+	"testing"
+)
+
+func TestCheckSequence(t *testing.T) {
+	newRecord := func(channel int64, seq int64, instrumentId string) *SequenceRecord {
+		return &SequenceRecord{Channel: channel, Seq: seq, InstrumentId: instrumentId}
+	}
+	// 委托文件：通道 2011 序号 1,2,4,7；通道 2012 序号 1,2,3
+	orderStream := []*SequenceRecord{
+		newRecord(2011, 1, "000001.SZ"),
+		newRecord(2011, 2, "000001.SZ"),
+		newRecord(2012, 1, "000002.SZ"),
+		newRecord(2011, 4, "000003.SZ"),
+		newRecord(2012, 3, "000002.SZ"),
+		newRecord(2012, 2, "000004.SZ"), // 乱序
+		newRecord(2011, 7, "000001.SZ"),
+	}
+	// 成交文件：通道 2011 序号 3,8,8（重复），缺 5,6
+	tradeStream := []*SequenceRecord{
+		newRecord(2011, 3, "000001.SZ"),
+		newRecord(2011, 8, "000003.SZ"),
+		newRecord(2011, 8, "000003.SZ"),
+	}
+
+	issueList := CheckSequence("20240115", constdef.MarketSZ, [][]*SequenceRecord{orderStream, tradeStream}, true)
+	if len(issueList) != 3 {
+		for _, v := range issueList {
+			t.Logf("%+v", v)
+		}
+		t.Fatalf("len(issueList)=%d, 期望3", len(issueList))
+	}
+
+	gap, duplicate, outOfOrder := issueList[0], issueList[1], issueList[2]
+	if gap.IssueType != constdef.SequenceIssueGap || gap.Channel != 2011 || gap.BeginSeq != 5 || gap.EndSeq != 6 ||
+		gap.Count != 2 || gap.InstrumentIdList != "000001.SZ,000003.SZ" {
+		t.Errorf("gap=%+v", gap)
+	}
+	if duplicate.IssueType != constdef.SequenceIssueDuplicate || duplicate.BeginSeq != 8 || duplicate.Count != 1 {
+		t.Errorf("duplicate=%+v", duplicate)
+	}
+	if outOfOrder.IssueType != constdef.SequenceIssueOutOfOrder || outOfOrder.Channel != 2012 ||
+		outOfOrder.BeginSeq != 2 || outOfOrder.Count != 1 || outOfOrder.InstrumentIdList != "000004.SZ" {
+		t.Errorf("outOfOrder=%+v", outOfOrder)
+	}
+
+	// 只读到部分文件时不检查缺失
+	issueList = CheckSequence("20240115", constdef.MarketSZ, [][]*SequenceRecord{tradeStream}, false)
+	if len(issueList) != 1 || issueList[0].IssueType != constdef.SequenceIssueDuplicate {
+		t.Errorf("checkGap=false issueList=%+v", issueList)
+	}
+}
+
+func TestCheckSequenceOnce(t *testing.T) {
+	ResetRunReport("20240115")
+	day := NewDayContext("", "20240115")
+	callCount := 0
+	getStreamList := func() [][]*SequenceRecord {
+		callCount++
+		return [][]*SequenceRecord{{
+			{Channel: 2011, Seq: 1, InstrumentId: "000001.SZ"},
+			{Channel: 2011, Seq: 4, InstrumentId: "000001.SZ"},
+			{Channel: 2011, Seq: 4, InstrumentId: "000001.SZ"},
+		}}
+	}
+
+	// trade 只读了成交文件，不检查缺失；之后的同类检查跳过
+	day.CheckSequenceOnce(constdef.MarketSZ, constdef.DataTypeTrade, getStreamList, false)
+	day.CheckSequenceOnce(constdef.MarketSZ, constdef.DataTypeTrade, getStreamList, false)
+	if callCount != 1 || GetRunReportCount("sequence_sz_duplicate") != 1 || GetRunReportCount("sequence_sz_gap") != 0 {
+		t.Errorf("callCount=%d duplicate=%d gap=%d", callCount, GetRunReportCount("sequence_sz_duplicate"), GetRunReportCount("sequence_sz_gap"))
+	}
+
+	// order 读了完整文件，重新检查一次并覆盖报告，之后都跳过
+	day.CheckSequenceOnce(constdef.MarketSZ, constdef.DataTypeOrder, getStreamList, true)
+	day.CheckSequenceOnce(constdef.MarketSZ, constdef.DataTypeOrder, getStreamList, true)
+	day.CheckSequenceOnce(constdef.MarketSZ, constdef.DataTypeTrade, getStreamList, false)
+	if callCount != 2 || GetRunReportCount("sequence_sz_gap") != 2 {
+		t.Errorf("callCount=%d gap=%d", callCount, GetRunReportCount("sequence_sz_gap"))
+	}
+
+	// 换一天（新的 DayContext）重新检查
+	NewDayContext("", "20240116").CheckSequenceOnce(constdef.MarketSZ, constdef.DataTypeTrade, getStreamList, false)
+	if callCount != 3 {
+		t.Errorf("callCount=%d", callCount)
+	}
+}
@@ -3,9 +3,9 @@ package service
 import (
 	"archive/zip"
 	"bufio"
-	"compress/gzip"
 	"data-scrubber/biz/constdef"
 	"data-scrubber/biz/errorx"
+	"data-scrubber/biz/layout"
 	"data-scrubber/biz/model"
 	"data-scrubber/biz/utils"
 	"data-scrubber/config"
@@ -18,7 +18,6 @@ import (
 	"strings"
 
 	logger "github.com/2997215859/golog"
-	"github.com/gocarina/gocsv"
 )
 
 // ==== sh 处理
@@ -122,37 +121,37 @@ func ManualReadShRawSnapshot(filepath string) ([]*model.ShRawSnapshot, error) {
 			continue
 		}
 
-		if err := parseFloat64Field(fields, headerIndex, "PreCloPrice", &snapshot.PreCloPrice); err != nil {
+		if err := parsePriceField(fields, headerIndex, "PreCloPrice", &snapshot.PreCloPrice); err != nil {
 			logger.Warn("警告: 第 %d 行 PreCloPrice 解析错误: %v，跳过该行", lineNum, err)
 			lineNum++
 			continue
 		}
 
-		if err := parseFloat64Field(fields, headerIndex, "OpenPrice", &snapshot.OpenPrice); err != nil {
+		if err := parsePriceField(fields, headerIndex, "OpenPrice", &snapshot.OpenPrice); err != nil {
 			logger.Warn("警告: 第 %d 行 OpenPrice 解析错误: %v，跳过该行", lineNum, err)
 			lineNum++
 			continue
 		}
 
-		if err := parseFloat64Field(fields, headerIndex, "HighPrice", &snapshot.HighPrice); err != nil {
+		if err := parsePriceField(fields, headerIndex, "HighPrice", &snapshot.HighPrice); err != nil {
 			logger.Warn("警告: 第 %d 行 HighPrice 解析错误: %v，跳过该行", lineNum, err)
 			lineNum++
 			continue
 		}
 
-		if err := parseFloat64Field(fields, headerIndex, "LowPrice", &snapshot.LowPrice); err != nil {
+		if err := parsePriceField(fields, headerIndex, "LowPrice", &snapshot.LowPrice); err != nil {
 			logger.Warn("警告: 第 %d 行 LowPrice 解析错误: %v，跳过该行", lineNum, err)
 			lineNum++
 			continue
 		}
 
-		if err := parseFloat64Field(fields, headerIndex, "LastPrice", &snapshot.LastPrice); err != nil {
+		if err := parsePriceField(fields, headerIndex, "LastPrice", &snapshot.LastPrice); err != nil {
 			logger.Warn("警告: 第 %d 行 LastPrice 解析错误: %v，跳过该行", lineNum, err)
 			lineNum++
 			continue
 		}
 
-		if err := parseFloat64Field(fields, headerIndex, "ClosePrice", &snapshot.ClosePrice); err != nil {
+		if err := parsePriceField(fields, headerIndex, "ClosePrice", &snapshot.ClosePrice); err != nil {
 			logger.Warn("警告: 第 %d 行 ClosePrice 解析错误: %v，跳过该行", lineNum, err)
 			lineNum++
 			continue
@@ -369,7 +368,7 @@ func ManualReadShRawSnapshot(filepath string) ([]*model.ShRawSnapshot, error) {
 			priceField := fmt.Sprintf("AskPrice%d", i)
 			volumeField := fmt.Sprintf("AskVolume%d", i)
 
-			var pricePtr *float64
+			var pricePtr *int64
 			var volumePtr *float64
 
 			switch i {
@@ -405,7 +404,7 @@ func ManualReadShRawSnapshot(filepath string) ([]*model.ShRawSnapshot, error) {
 				volumePtr = &snapshot.AskVolume10
 			}
 
-			_ = parseFloat64Field(fields, headerIndex, priceField, pricePtr)
+			_ = parsePriceField(fields, headerIndex, priceField, pricePtr)
 
 			_ = parseFloat64Field(fields, headerIndex, volumeField, volumePtr)
 
@@ -417,7 +416,7 @@ func ManualReadShRawSnapshot(filepath string) ([]*model.ShRawSnapshot, error) {
 			priceField := fmt.Sprintf("BidPrice%d", i)
 			volumeField := fmt.Sprintf("BidVolume%d", i)
 
-			var pricePtr *float64
+			var pricePtr *int64
 			var volumePtr *float64
 
 			switch i {
@@ -453,7 +452,7 @@ func ManualReadShRawSnapshot(filepath string) ([]*model.ShRawSnapshot, error) {
 				volumePtr = &snapshot.BidVolume10
 			}
 
-			_ = parseFloat64Field(fields, headerIndex, priceField, pricePtr)
+			_ = parsePriceField(fields, headerIndex, priceField, pricePtr)
 
 			_ = parseFloat64Field(fields, headerIndex, volumeField, volumePtr)
 
@@ -557,7 +556,8 @@ func CalculateLimitPrices(instrumentId string, preClose float64) (highLimit, low
 	return highLimit, lowLimit
 }
 
-func ShRawSnapshot2Snapshot(date string, v *model.ShRawSnapshot) (*model.Snapshot, error) {
+// ShRawSnapshot2Snapshot 找不到涨跌停价的票记入 missingPriceLimitSet，由调用方转换完后汇总
+func ShRawSnapshot2Snapshot(date string, v *model.ShRawSnapshot, missingPriceLimitSet map[string]struct{}) (*model.Snapshot, error) {
 	updateTimestamp, err := utils.TimeToNano(date, v.UpdateTime)
 	if err != nil {
 		return nil, errorx.NewError("timeToNano(%s %s) error: %v", date, v.UpdateTime, err)
@@ -581,7 +581,8 @@ func ShRawSnapshot2Snapshot(date string, v *model.ShRawSnapshot) (*model.Snapsho
 
 	priceLimit, err := GetStockLimit(instrumentId)
 	if err != nil {
-		logger.Error("GetStockLimit(%s) error: %v", instrumentId, err)
+		// 停牌的票通常没有涨跌停价，不逐行报错，转换完后每个票汇总一条
+		missingPriceLimitSet[instrumentId] = struct{}{}
 		priceLimit = &PriceLimit{
 			InstrumentId: instrumentId,
 			HighLimit:    0.0,
@@ -589,15 +590,23 @@ func ShRawSnapshot2Snapshot(date string, v *model.ShRawSnapshot) (*model.Snapsho
 		}
 	}
 
+	bidPriceList := []int64{
+		v.BidPrice1, v.BidPrice2, v.BidPrice3, v.BidPrice4, v.BidPrice5,
+		v.BidPrice6, v.BidPrice7, v.BidPrice8, v.BidPrice9, v.BidPrice10,
+	}
+	askPriceList := []int64{
+		v.AskPrice1, v.AskPrice2, v.AskPrice3, v.AskPrice4, v.AskPrice5,
+		v.AskPrice6, v.AskPrice7, v.AskPrice8, v.AskPrice9, v.AskPrice10,
+	}
 	res := &model.Snapshot{
 		InstrumentId:    instrumentId,
 		UpdateTimestamp: updateTimestamp,
-		Last:            v.LastPrice,
-		PreClose:        v.PreCloPrice,
-		Open:            v.OpenPrice,
-		High:            v.HighPrice,
-		Low:             v.LowPrice,
-		Close:           v.ClosePrice,
+		Last:            priceE4ToFloat(v.LastPrice),
+		PreClose:        priceE4ToFloat(v.PreCloPrice),
+		Open:            priceE4ToFloat(v.OpenPrice),
+		High:            priceE4ToFloat(v.HighPrice),
+		Low:             priceE4ToFloat(v.LowPrice),
+		Close:           priceE4ToFloat(v.ClosePrice),
 		TradeNumber:     v.TradNumber,
 		TradeVolume:     int64(v.TradVolume),
 		TradeTurnover:   v.Turnover,
@@ -608,28 +617,54 @@ func ShRawSnapshot2Snapshot(date string, v *model.ShRawSnapshot) (*model.Snapsho
 			v.BidVolume1, v.BidVolume2, v.BidVolume3, v.BidVolume4, v.BidVolume5,
 			v.BidVolume6, v.BidVolume7, v.BidVolume8, v.BidVolume9, v.BidVolume10,
 		}),
-		BidPriceList: []float64{
-			v.BidPrice1, v.BidPrice2, v.BidPrice3, v.BidPrice4, v.BidPrice5,
-			v.BidPrice6, v.BidPrice7, v.BidPrice8, v.BidPrice9, v.BidPrice10,
-		},
+		BidPriceList: priceE4ListToFloat(bidPriceList),
 		AskVolumeList: utils.Float64ToInt64([]float64{
 			v.AskVolume1, v.AskVolume2, v.AskVolume3, v.AskVolume4, v.AskVolume5,
 			v.AskVolume6, v.AskVolume7, v.AskVolume8, v.AskVolume9, v.AskVolume10,
 		}),
-		AskPriceList: []float64{
-			v.AskPrice1, v.AskPrice2, v.AskPrice3, v.AskPrice4, v.AskPrice5,
-			v.AskPrice6, v.AskPrice7, v.AskPrice8, v.AskPrice9, v.AskPrice10,
-		},
+		AskPriceList:   priceE4ListToFloat(askPriceList),
 		SeqNo:          v.SeqNo,
 		LocalTimestamp: localTimestamp,
+		LastE4:         v.LastPrice,
+		PreCloseE4:     v.PreCloPrice,
+		OpenE4:         v.OpenPrice,
+		HighE4:         v.HighPrice,
+		LowE4:          v.LowPrice,
+		CloseE4:        v.ClosePrice,
+		// 沪市涨跌停价来自 tushare 的 float64（两位小数），四舍五入到 E4 是精确的
+		HighLimitE4:    utils.PriceToInt64(priceLimit.HighLimit, rawPriceFactor),
+		LowLimitE4:     utils.PriceToInt64(priceLimit.LowLimit, rawPriceFactor),
+		BidPriceListE4: bidPriceList,
+		AskPriceListE4: askPriceList,
 	}
 	return res, nil
 }
 
+// reportMissingPriceLimit 每个找不到涨跌停价的票只打一条日志：停牌的票属于正常情况打 Info，其余打 Warn
+func reportMissingPriceLimit(date string, missingPriceLimitSet map[string]struct{}) {
+	idList := make([]string, 0, len(missingPriceLimitSet))
+	for id := range missingPriceLimitSet {
+		idList = append(idList, id)
+	}
+	sort.Strings(idList)
+	missingCount := 0
+	for _, id := range idList {
+		if suspend := GetSuspend(id); suspend != nil {
+			logger.Info("date(%s) instrument(%s) suspended(%s %s), no price limit", date, id, suspend.SuspendType, suspend.SuspendTiming)
+			continue
+		}
+		missingCount++
+		logger.Warn("date(%s) GetStockLimit(%s) not found, HighLimit/LowLimit set to 0", date, id)
+	}
+	SetRunReportCount(RunReportSnapshotMissingPriceLimit, int64(missingCount))
+}
+
 func ShRawSnapshot2SnapshotList(date string, rawList []*model.ShRawSnapshot) ([]*model.Snapshot, error) {
 	var res []*model.Snapshot
+	// 沪市快照转换时 GetStockLimit 找不到的票
+	missingPriceLimitSet := make(map[string]struct{})
 	for _, v := range rawList {
-		item, err := ShRawSnapshot2Snapshot(date, v)
+		item, err := ShRawSnapshot2Snapshot(date, v, missingPriceLimitSet)
 		if err != nil {
 			return nil, err
 		}
@@ -639,6 +674,7 @@ func ShRawSnapshot2SnapshotList(date string, rawList []*model.ShRawSnapshot) ([]
 
 		res = append(res, item)
 	}
+	reportMissingPriceLimit(date, missingPriceLimitSet)
 
 	return res, nil
 }
@@ -765,7 +801,7 @@ func ManualReadSzRawSnapshot(filepath string) ([]*model.SzRawSnapshot, error) {
 		snapshot.UpdateTime = strings.TrimSpace(fields[headerIndex["UpdateTime"]])
 		snapshot.SecurityID = strings.TrimSpace(fields[headerIndex["SecurityID"]])
 
-		if err := parseFloat64Field(fields, headerIndex, "PreCloPrice", &snapshot.PreCloPrice); err != nil {
+		if err := parsePriceField(fields, headerIndex, "PreCloPrice", &snapshot.PreCloPrice); err != nil {
 			logger.Warn("警告: 第 %d 行 PreCloPrice 解析错误: %v，跳过该行", lineNum, err)
 			lineNum++
 			continue
@@ -789,25 +825,25 @@ func ManualReadSzRawSnapshot(filepath string) ([]*model.SzRawSnapshot, error) {
 			continue
 		}
 
-		if err := parseFloat64Field(fields, headerIndex, "LastPrice", &snapshot.LastPrice); err != nil {
+		if err := parsePriceField(fields, headerIndex, "LastPrice", &snapshot.LastPrice); err != nil {
 			logger.Warn("警告: 第 %d 行 LastPrice 解析错误: %v，跳过该行", lineNum, err)
 			lineNum++
 			continue
 		}
 
-		if err := parseFloat64Field(fields, headerIndex, "OpenPrice", &snapshot.OpenPrice); err != nil {
+		if err := parsePriceField(fields, headerIndex, "OpenPrice", &snapshot.OpenPrice); err != nil {
 			logger.Warn("警告: 第 %d 行 OpenPrice 解析错误: %v，跳过该行", lineNum, err)
 			lineNum++
 			continue
 		}
 
-		if err := parseFloat64Field(fields, headerIndex, "HighPrice", &snapshot.HighPrice); err != nil {
+		if err := parsePriceField(fields, headerIndex, "HighPrice", &snapshot.HighPrice); err != nil {
 			logger.Warn("警告: 第 %d 行 HighPrice 解析错误: %v，跳过该行", lineNum, err)
 			lineNum++
 			continue
 		}
 
-		if err := parseFloat64Field(fields, headerIndex, "LowPrice", &snapshot.LowPrice); err != nil {
+		if err := parsePriceField(fields, headerIndex, "LowPrice", &snapshot.LowPrice); err != nil {
 			logger.Warn("警告: 第 %d 行 LowPrice 解析错误: %v，跳过该行", lineNum, err)
 			lineNum++
 			continue
@@ -825,13 +861,13 @@ func ManualReadSzRawSnapshot(filepath string) ([]*model.SzRawSnapshot, error) {
 			continue
 		}
 
-		if err := parseFloat64Field(fields, headerIndex, "HighLimitPrice", &snapshot.HighLimitPrice); err != nil {
+		if err := parsePriceField(fields, headerIndex, "HighLimitPrice", &snapshot.HighLimitPrice); err != nil {
 			logger.Warn("警告: 第 %d 行 TotalBidQty 解析错误: %v，跳过该行", lineNum, err)
 			lineNum++
 			continue
 		}
 
-		if err := parseFloat64Field(fields, headerIndex, "LowLimitPrice", &snapshot.LowLimitPrice); err != nil {
+		if err := parsePriceField(fields, headerIndex, "LowLimitPrice", &snapshot.LowLimitPrice); err != nil {
 			logger.Warn("警告: 第 %d 行 TotalOfferQty 解析错误: %v，跳过该行", lineNum, err)
 			lineNum++
 			continue
@@ -842,7 +878,7 @@ func ManualReadSzRawSnapshot(filepath string) ([]*model.SzRawSnapshot, error) {
 			priceField := fmt.Sprintf("AskPrice%d", i)
 			volumeField := fmt.Sprintf("AskVolume%d", i)
 
-			var pricePtr *float64
+			var pricePtr *int64
 			var volumePtr *int64
 
 			switch i {
@@ -878,7 +914,7 @@ func ManualReadSzRawSnapshot(filepath string) ([]*model.SzRawSnapshot, error) {
 				volumePtr = &snapshot.AskVolume10
 			}
 
-			_ = parseFloat64Field(fields, headerIndex, priceField, pricePtr)
+			_ = parsePriceField(fields, headerIndex, priceField, pricePtr)
 
 			_ = parseInt64Field(fields, headerIndex, volumeField, volumePtr)
 
@@ -891,7 +927,7 @@ func ManualReadSzRawSnapshot(filepath string) ([]*model.SzRawSnapshot, error) {
 			priceField := fmt.Sprintf("BidPrice%d", i)
 			volumeField := fmt.Sprintf("BidVolume%d", i)
 
-			var pricePtr *float64
+			var pricePtr *int64
 			var volumePtr *int64
 
 			switch i {
@@ -927,7 +963,7 @@ func ManualReadSzRawSnapshot(filepath string) ([]*model.SzRawSnapshot, error) {
 				volumePtr = &snapshot.BidVolume10
 			}
 
-			_ = parseFloat64Field(fields, headerIndex, priceField, pricePtr)
+			_ = parsePriceField(fields, headerIndex, priceField, pricePtr)
 
 			_ = parseInt64Field(fields, headerIndex, volumeField, volumePtr)
 
@@ -1018,39 +1054,50 @@ func SzRawSnapshot2Snapshot(date string, v *model.SzRawSnapshot) (*model.Snapsho
 		return nil, nil
 	}
 
+	bidPriceList := []int64{
+		v.BidPrice1, v.BidPrice2, v.BidPrice3, v.BidPrice4, v.BidPrice5,
+		v.BidPrice6, v.BidPrice7, v.BidPrice8, v.BidPrice9, v.BidPrice10,
+	}
+	askPriceList := []int64{
+		v.AskPrice1, v.AskPrice2, v.AskPrice3, v.AskPrice4, v.AskPrice5,
+		v.AskPrice6, v.AskPrice7, v.AskPrice8, v.AskPrice9, v.AskPrice10,
+	}
 	res := &model.Snapshot{
 		InstrumentId:    fmt.Sprintf("%s.SZ", v.SecurityID),
 		UpdateTimestamp: updateTimestamp,
-		Last:            v.LastPrice,
-		PreClose:        v.PreCloPrice,
-		Open:            v.OpenPrice,
-		High:            v.HighPrice,
-		Low:             v.LowPrice,
+		Last:            priceE4ToFloat(v.LastPrice),
+		PreClose:        priceE4ToFloat(v.PreCloPrice),
+		Open:            priceE4ToFloat(v.OpenPrice),
+		High:            priceE4ToFloat(v.HighPrice),
+		Low:             priceE4ToFloat(v.LowPrice),
 		Close:           0.0,
 		TradeNumber:     v.TurnNum,
 		TradeVolume:     v.Volume,
 		TradeTurnover:   v.Turnover,
-		HighLimit:       v.HighLimitPrice,
-		LowLimit:        v.LowLimitPrice,
+		HighLimit:       priceE4ToFloat(v.HighLimitPrice),
+		LowLimit:        priceE4ToFloat(v.LowLimitPrice),
 		Status:          strings.TrimSpace(v.TradingPhaseCode),
 		BidVolumeList: []int64{
 			v.BidVolume1, v.BidVolume2, v.BidVolume3, v.BidVolume4, v.BidVolume5,
 			v.BidVolume6, v.BidVolume7, v.BidVolume8, v.BidVolume9, v.BidVolume10,
 		},
-		BidPriceList: []float64{
-			v.BidPrice1, v.BidPrice2, v.BidPrice3, v.BidPrice4, v.BidPrice5,
-			v.BidPrice6, v.BidPrice7, v.BidPrice8, v.BidPrice9, v.BidPrice10,
-		},
+		BidPriceList: priceE4ListToFloat(bidPriceList),
 		AskVolumeList: []int64{
 			v.AskVolume1, v.AskVolume2, v.AskVolume3, v.AskVolume4, v.AskVolume5,
 			v.AskVolume6, v.AskVolume7, v.AskVolume8, v.AskVolume9, v.AskVolume10,
 		},
-		AskPriceList: []float64{
-			v.AskPrice1, v.AskPrice2, v.AskPrice3, v.AskPrice4, v.AskPrice5,
-			v.AskPrice6, v.AskPrice7, v.AskPrice8, v.AskPrice9, v.AskPrice10,
-		},
+		AskPriceList:   priceE4ListToFloat(askPriceList),
 		SeqNo:          v.SeqNo,
 		LocalTimestamp: localTimestamp,
+		LastE4:         v.LastPrice,
+		PreCloseE4:     v.PreCloPrice,
+		OpenE4:         v.OpenPrice,
+		HighE4:         v.HighPrice,
+		LowE4:          v.LowPrice,
+		HighLimitE4:    v.HighLimitPrice,
+		LowLimitE4:     v.LowLimitPrice,
+		BidPriceListE4: bidPriceList,
+		AskPriceListE4: askPriceList,
 	}
 	return res, nil
 }
@@ -1074,16 +1121,70 @@ func SzRawSnapshot2SnapshotList(date string, rawList []*model.SzRawSnapshot) ([]
 
 // ==== 合并 Snapshot
 
-func MergeRawSnapshot(srcDir string, dstDir string, date string) error {
-	// 刷新一下 turshare 数据
-	if err := UpdateTuShareDailyLimit(date); err != nil {
+func MergeRawSnapshot(day *DayContext, dstDir string) error {
+	date := day.Date
+	if config.Cfg.IsPerDay() || config.Cfg.IsHiveLayout() {
+		dstDir = filepath.Join(dstDir, constdef.DataTypeSnapshot)
+	} else {
+		dstDir = filepath.Join(dstDir, constdef.DataTypeSnapshot, date)
+	}
+
+	list, err := ReadRawSnapshotList(day)
+	if err != nil {
 		return err
 	}
+	sourceFileList := day.GetSourceFileList(constdef.DataTypeSnapshot)
+
+	// 拿不到复权比例时不带复权列，按原始 snapshot 输出
+	if ratioMap, ok := adjustPriceColumnRatioMap(constdef.DataTypeSnapshot, date); ok {
+		adjustedList := BuildAdjustedSnapshotList(date, list, ratioMap)
+		logger.Info("Write AdjustedSnapshot.parquet Begin")
+		if err := WriteAdjustedOutput(dstDir, constdef.DataTypeSnapshot, date, adjustedList, sourceFileList, func(v *model.AdjustedSnapshot) string { return v.InstrumentId },
+			func(v *model.AdjustedSnapshot) int64 { return v.UpdateTimestamp }); err != nil {
+			return errorx.NewError("WriteAdjustedOutput(%s) date(%s) error: %v", dstDir, date, err)
+		}
+		logger.Info("Write AdjustedSnapshot.parquet End")
+		return nil
+	}
 
-	if config.Cfg.IsPerDay() {
-		dstDir = filepath.Join(dstDir, constdef.DataTypeSnapshot)
+	// 根据 output_mode 选择写入方式
+	if config.Cfg.IsHiveLayout() {
+		logger.Info("Write HiveSnapshot.parquet Begin")
+		if err := WriteHiveParquet(dstDir, date, list, sourceFileList, func(v *model.Snapshot) string { return v.InstrumentId },
+			func(v *model.Snapshot) int64 { return v.UpdateTimestamp }); err != nil {
+			return errorx.NewError("WriteHiveParquet(%s) date(%s) error: %v", dstDir, date, err)
+		}
+		logger.Info("Write HiveSnapshot.parquet End")
+	} else if config.Cfg.IsPerDay() {
+		logger.Info("Write AllSnapshot.parquet Begin")
+		if err := WriteAllSnapshotParquet(dstDir, date, list, sourceFileList); err != nil {
+			return errorx.NewError("WriteAllSnapshotParquet(%s) date(%s) error: %v", dstDir, date, err)
+		}
+		logger.Info("Write AllSnapshot.parquet End")
 	} else {
-		dstDir = filepath.Join(dstDir, constdef.DataTypeSnapshot, date)
+		snapshotMap := GetMapSnapshot(list)
+
+		logger.Info("Write StockSnapshot.parquet Begin")
+		if err := WriteSnapshotParquet(dstDir, date, snapshotMap, sourceFileList); err != nil {
+			return errorx.NewError("WriteParquet(%s) date(%s) error: %v", dstDir, date, err)
+		}
+		logger.Info("Write StockSnapshot.parquet End")
+	}
+	return nil
+}
+
+// ReadRawSnapshotList 读取并转换沪深两市当天的快照，返回按时间归并后的列表
+// 沪市快照需要涨跌停价，读取前会先刷新 tushare 当天的涨跌停和停牌数据
+func ReadRawSnapshotList(day *DayContext) ([]*model.Snapshot, error) {
+	srcDir, date := day.SrcDir, day.Date
+	// 刷新一下 turshare 数据
+	if err := UpdateTuShareDailyLimit(date); err != nil {
+		return nil, err
+	}
+	// 停牌信息只用于标记和日志，拉取失败时不影响快照清洗
+	if err := UpdateTuShareSuspend(date); err != nil {
+		SetRunReportCount(RunReportSuspendUnavailable, 1)
+		logger.Warn("date(%s) UpdateTuShareSuspend error, suspend info unavailable: %v", date, err)
 	}
 
 	shFilepath := filepath.Join(srcDir, date, fmt.Sprintf("%s_MarketData.csv.zip", date))
@@ -1093,13 +1194,14 @@ func MergeRawSnapshot(srcDir string, dstDir string, date string) error {
 	logger.Info("Read Sh Raw Snapshot Begin")
 	shRawList, err := ManualReadShRawSnapshot(shFilepath)
 	if err != nil {
-		return errorx.NewError("ReadShRaw(%s) error: %s", shFilepath, err)
+		return nil, errorx.NewError("ReadShRaw(%s) error: %s", shFilepath, err)
 	}
+	day.AddSourceFile(constdef.DataTypeSnapshot, shFilepath)
 	logger.Info("Read Sh Raw Snapshot End")
 
 	shList, err := ShRawSnapshot2SnapshotList(date, shRawList)
 	if err != nil {
-		return errorx.NewError("ShRawSnapshot2SnapshotList(%s) error: %s", shFilepath, err)
+		return nil, errorx.NewError("ShRawSnapshot2SnapshotList(%s) error: %s", shFilepath, err)
 	}
 	logger.Info("Convert Sh Raw Snapshot End")
 
@@ -1107,13 +1209,14 @@ func MergeRawSnapshot(srcDir string, dstDir string, date string) error {
 	logger.Info("Read Sz Raw Snapshot Begin")
 	szRawList, err := ManualReadSzRawSnapshot(szFilepath)
 	if err != nil {
-		return errorx.NewError("ManualReadSzRawSnapshot(%s) error: %s", szFilepath, err)
+		return nil, errorx.NewError("ManualReadSzRawSnapshot(%s) error: %s", szFilepath, err)
 	}
+	day.AddSourceFile(constdef.DataTypeSnapshot, szFilepath)
 	logger.Info("Read Sz Raw Snapshot End")
 
 	szList, err := SzRawSnapshot2SnapshotList(date, szRawList)
 	if err != nil {
-		return errorx.NewError("SzRawSnapshot2SnapshotList(%s) error: %s", szFilepath, err)
+		return nil, errorx.NewError("SzRawSnapshot2SnapshotList(%s) error: %s", szFilepath, err)
 	}
 	logger.Info("Convert Sz Raw Snapshot End")
 
@@ -1121,23 +1224,14 @@ func MergeRawSnapshot(srcDir string, dstDir string, date string) error {
 	list := SortSnapshotRaw(shList, szList)
 	logger.Info("Convert All Raw Snapshot End")
 
-	// 根据 output_mode 选择写入方式
-	if config.Cfg.IsPerDay() {
-		logger.Info("Write AllSnapshot.parquet Begin")
-		if err := WriteAllSnapshotParquet(dstDir, date, list); err != nil {
-			return errorx.NewError("WriteAllSnapshotParquet(%s) date(%s) error: %v", dstDir, date, err)
-		}
-		logger.Info("Write AllSnapshot.parquet End")
-	} else {
-		snapshotMap := GetMapSnapshot(list)
+	list, dropped := DedupSnapshotList(list)
+	logDedup(constdef.DataTypeSnapshot, date, dropped)
+	SetRunReportCount(RunReportSnapshotDuplicate, int64(dropped))
 
-		logger.Info("Write StockSnapshot.parquet Begin")
-		if err := WriteSnapshotParquet(dstDir, date, snapshotMap); err != nil {
-			return errorx.NewError("WriteParquet(%s) date(%s) error: %v", dstDir, date, err)
-		}
-		logger.Info("Write StockSnapshot.parquet End")
-	}
-	return nil
+	CheckSnapshotTickSize(date, list)
+	day.addSeenSnapshotList(list)
+
+	return list, nil
 }
 
 func SortSnapshotRaw(a []*model.Snapshot, b []*model.Snapshot) []*model.Snapshot {
@@ -1182,18 +1276,18 @@ func GetMapSnapshot(list []*model.Snapshot) map[string][]*model.Snapshot {
 	return res
 }
 
-func WriteSnapshotParquet(dstDir string, date string, mapSnapshot map[string][]*model.Snapshot) error {
+func WriteSnapshotParquet(dstDir string, date string, mapSnapshot map[string][]*model.Snapshot, sourceFileList []string) error {
 	if err := os.MkdirAll(dstDir, 0755); err != nil {
 		return errorx.NewError("MkdirAll(%s) error: %v", dstDir, err)
 	}
 
 	for instrumentId, list := range mapSnapshot {
-		filePath := filepath.Join(dstDir, fmt.Sprintf("%s_snapshot_%s.parquet", date, instrumentId))
+		filePath := filepath.Join(dstDir, layout.GetPerStockFileName(date, constdef.DataTypeSnapshot, instrumentId))
 
 		//创建写入器
-		pw, err := NewParquetWriter(filePath, new(model.Snapshot))
+		pw, err := NewOutputWriter(filePath, new(model.Snapshot), sourceFileList)
 		if err != nil {
-			return errorx.NewError("NewParquetWriter error: %s", err)
+			return errorx.NewError("NewOutputWriter error: %s", err)
 		}
 
 		defer func() {
@@ -1215,16 +1309,20 @@ func WriteSnapshotParquet(dstDir string, date string, mapSnapshot map[string][]*
 	return nil
 }
 
-func WriteAllSnapshotParquet(dstDir string, date string, list []*model.Snapshot) error {
+func WriteAllSnapshotParquet(dstDir string, date string, list []*model.Snapshot, sourceFileList []string) error {
 	if err := os.MkdirAll(dstDir, 0755); err != nil {
 		return errorx.NewError("MkdirAll(%s) error: %v", dstDir, err)
 	}
 
-	filePath := filepath.Join(dstDir, fmt.Sprintf("%s_snapshot.parquet", date))
+	filePath := filepath.Join(dstDir, layout.GetPerDayFileName(date, constdef.DataTypeSnapshot))
+	if config.Cfg.IsPerDayClustered() {
+		return WriteClusteredOutputFile(filePath, list, sourceFileList, func(v *model.Snapshot) string { return v.InstrumentId },
+			func(v *model.Snapshot) int64 { return v.UpdateTimestamp })
+	}
 
-	pw, err := NewParquetWriter(filePath, new(model.Snapshot))
+	pw, err := NewOutputWriter(filePath, new(model.Snapshot), sourceFileList)
 	if err != nil {
-		return errorx.NewError("NewParquetWriter error: %s", err)
+		return errorx.NewError("NewOutputWriter error: %s", err)
 	}
 
 	defer func() {
@@ -1253,17 +1351,8 @@ func WriteSnapshotGz(dstDir string, date string, mapSnapshot map[string][]*model
 	for instrumentId, list := range mapSnapshot {
 		filePath := filepath.Join(dstDir, fmt.Sprintf("%s_snapshot_%s.csv.gz", date, instrumentId))
 
-		file, err := os.OpenFile(filePath, os.O_RDWR|os.O_CREATE, 0755)
-		if err != nil {
-			return errorx.NewError("open file(%s): %v", filePath, err)
-		}
-		defer file.Close()
-
-		gzWriter := gzip.NewWriter(file)
-		defer gzWriter.Close()
-
-		if err := gocsv.Marshal(&list, gzWriter); err != nil {
-			return errorx.NewError("filePath(%s) gocsv.Marshal error: %v", filePath, err)
+		if err := WriteCsvGzFile(filePath, list); err != nil {
+			return err
 		}
 	}
 
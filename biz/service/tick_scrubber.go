@@ -0,0 +1,278 @@
+package service
+
+import (
+	"cmp"
+	"data-scrubber/biz/constdef"
+	"data-scrubber/biz/errorx"
+	"data-scrubber/biz/layout"
+	"data-scrubber/biz/model"
+	"data-scrubber/config"
+	"os"
+	"path/filepath"
+	"slices"
+
+	logger "github.com/2997215859/golog"
+)
+
+// 同一时间、同一通道序号时各事件类型的先后：快照和委托队列是该时刻之前的状态，排在逐笔之前
+var tickEventTypeRank = map[string]int{
+	constdef.DataTypeSnapshot:   0,
+	constdef.DataTypeOrderQueue: 1,
+	constdef.DataTypeOrder:      2,
+	constdef.DataTypeTrade:      3,
+}
+
+// getChannelSeq 沪市新格式取 BizIndex，深市取 ApplSeqNum，沪市旧格式两者都为 0
+func getChannelSeq(bizIndex int64, applSeqNum int64) int64 {
+	if bizIndex != 0 {
+		return bizIndex
+	}
+	return applSeqNum
+}
+
+func TradeToTick(v *model.Trade) *model.Tick {
+	return &model.Tick{
+		InstrumentId:   v.InstrumentId,
+		EventTimestamp: v.TradeTimestamp,
+		EventType:      constdef.DataTypeTrade,
+		Channel:        v.Channel,
+		ChannelSeq:     getChannelSeq(v.BizIndex, v.ApplSeqNum),
+		SeqNo:          v.SeqNo,
+		LocalTimestamp: v.LocalTimestamp,
+		Price:          v.Price,
+		Volume:         v.Volume,
+		Direction:      v.Direction,
+		ExecType:       v.ExecType,
+		TradeId:        v.TradeId,
+		Turnover:       v.Turnover,
+		BuyOrderId:     v.BuyOrderId,
+		SellOrderId:    v.SellOrderId,
+		PriceE4:        v.PriceE4,
+	}
+}
+
+func OrderToTick(v *model.Order) *model.Tick {
+	return &model.Tick{
+		InstrumentId:     v.InstrumentId,
+		EventTimestamp:   v.OrderTimestamp,
+		EventType:        constdef.DataTypeOrder,
+		Channel:          v.Channel,
+		ChannelSeq:       getChannelSeq(v.BizIndex, v.ApplSeqNum),
+		SeqNo:            v.SeqNo,
+		LocalTimestamp:   v.LocalTimestamp,
+		Price:            v.Price,
+		Volume:           v.Volume,
+		Direction:        v.Direction,
+		ExecType:         v.ExecType,
+		OrderId:          v.OrderId,
+		OrderType:        v.OrderType,
+		PriceType:        v.PriceType,
+		EffectivePrice:   v.EffectivePrice,
+		PriceE4:          v.PriceE4,
+		EffectivePriceE4: v.EffectivePriceE4,
+	}
+}
+
+func OrderQueueToTick(v *model.OrderQueue) *model.Tick {
+	return &model.Tick{
+		InstrumentId:   v.InstrumentId,
+		EventTimestamp: v.UpdateTimestamp,
+		EventType:      constdef.DataTypeOrderQueue,
+		SeqNo:          v.SeqNo,
+		LocalTimestamp: v.LocalTimestamp,
+		Price:          v.Price,
+		Volume:         v.Volume,
+		Direction:      v.Direction,
+		NumOrders:      v.NumOrders,
+		OrderQtyList:   v.OrderQtyList,
+		PriceE4:        v.PriceE4,
+	}
+}
+
+func SnapshotToTick(v *model.Snapshot) *model.Tick {
+	return &model.Tick{
+		InstrumentId:   v.InstrumentId,
+		EventTimestamp: v.UpdateTimestamp,
+		EventType:      constdef.DataTypeSnapshot,
+		SeqNo:          v.SeqNo,
+		LocalTimestamp: v.LocalTimestamp,
+		Last:           v.Last,
+		PreClose:       v.PreClose,
+		Open:           v.Open,
+		High:           v.High,
+		Low:            v.Low,
+		Close:          v.Close,
+		TradeNumber:    v.TradeNumber,
+		TradeVolume:    v.TradeVolume,
+		TradeTurnover:  v.TradeTurnover,
+		HighLimit:      v.HighLimit,
+		LowLimit:       v.LowLimit,
+		Status:         v.Status,
+		BidVolumeList:  v.BidVolumeList,
+		BidPriceList:   v.BidPriceList,
+		AskVolumeList:  v.AskVolumeList,
+		AskPriceList:   v.AskPriceList,
+		LastE4:         v.LastE4,
+		PreCloseE4:     v.PreCloseE4,
+		OpenE4:         v.OpenE4,
+		HighE4:         v.HighE4,
+		LowE4:          v.LowE4,
+		CloseE4:        v.CloseE4,
+		HighLimitE4:    v.HighLimitE4,
+		LowLimitE4:     v.LowLimitE4,
+		BidPriceListE4: v.BidPriceListE4,
+		AskPriceListE4: v.AskPriceListE4,
+	}
+}
+
+// tickSortTimestamp 按 tick_order 取排序时间，本地时间缺失时退回交易所时间
+func tickSortTimestamp(v *model.Tick, orderByExchange bool) int64 {
+	if orderByExchange || v.LocalTimestamp == 0 {
+		return v.EventTimestamp
+	}
+	return v.LocalTimestamp
+}
+
+// compareTick 先按时间，同一时间按 (Channel, ChannelSeq) 保持交易所的逐笔顺序，再按事件类型和采集序号，保证结果确定
+func compareTick(a *model.Tick, b *model.Tick, orderByExchange bool) int {
+	return cmp.Or(
+		cmp.Compare(tickSortTimestamp(a, orderByExchange), tickSortTimestamp(b, orderByExchange)),
+		cmp.Compare(a.Channel, b.Channel),
+		cmp.Compare(a.ChannelSeq, b.ChannelSeq),
+		cmp.Compare(tickEventTypeRank[a.EventType], tickEventTypeRank[b.EventType]),
+		cmp.Compare(a.SeqNo, b.SeqNo),
+		cmp.Compare(a.InstrumentId, b.InstrumentId),
+	)
+}
+
+// BuildTickList 把四种数据合成一个按 tick_order 排好序的事件流，任一列表可以为空
+func BuildTickList(snapshotList []*model.Snapshot, tradeList []*model.Trade, orderList []*model.Order, orderQueueList []*model.OrderQueue) []*model.Tick {
+	res := make([]*model.Tick, 0, len(snapshotList)+len(tradeList)+len(orderList)+len(orderQueueList))
+	for _, v := range snapshotList {
+		if v != nil {
+			res = append(res, SnapshotToTick(v))
+		}
+	}
+	for _, v := range orderQueueList {
+		if v != nil {
+			res = append(res, OrderQueueToTick(v))
+		}
+	}
+	for _, v := range orderList {
+		if v != nil {
+			res = append(res, OrderToTick(v))
+		}
+	}
+	for _, v := range tradeList {
+		if v != nil {
+			res = append(res, TradeToTick(v))
+		}
+	}
+
+	orderByExchange := config.Cfg.GetTickOrder() == constdef.TickOrderExchange
+	slices.SortStableFunc(res, func(a *model.Tick, b *model.Tick) int {
+		return compareTick(a, b, orderByExchange)
+	})
+	return res
+}
+
+// getTickSortTimestamp hive / per_day_clustered 写入时按票稳定重排用的时间，和 BuildTickList 的排序时间一致，不打乱同票内的事件顺序
+func getTickSortTimestamp() func(v *model.Tick) int64 {
+	orderByExchange := config.Cfg.GetTickOrder() == constdef.TickOrderExchange
+	return func(v *model.Tick) int64 {
+		return tickSortTimestamp(v, orderByExchange)
+	}
+}
+
+// ==== 合并 tick
+
+// MergeRawTick 读取当天的快照、成交、委托和委托队列，合成统一事件流；四种数据各自的输出不受影响
+// 四种数据同时在内存中，内存占用约为分别清洗时的总和
+func MergeRawTick(day *DayContext, dstDir string) error {
+	date := day.Date
+	if tickOrder := config.Cfg.GetTickOrder(); tickOrder != constdef.TickOrderLocal && tickOrder != constdef.TickOrderExchange {
+		return errorx.NewError("unknown tick_order(%s)", tickOrder)
+	}
+	if config.Cfg.IsPerDay() || config.Cfg.IsHiveLayout() {
+		dstDir = filepath.Join(dstDir, constdef.DataTypeTick)
+	} else {
+		dstDir = filepath.Join(dstDir, constdef.DataTypeTick, date)
+	}
+
+	snapshotList, err := ReadRawSnapshotList(day)
+	if err != nil {
+		return err
+	}
+	tradeList, err := ReadRawTradeList(day)
+	if err != nil {
+		return err
+	}
+	orderList, err := ReadRawOrderList(day)
+	if err != nil {
+		return err
+	}
+	orderQueueList, err := ReadRawOrderQueueList(day)
+	if err != nil {
+		return err
+	}
+
+	tickList := BuildTickList(snapshotList, tradeList, orderList, orderQueueList)
+	sourceFileList := day.GetSourceFileList(constdef.DataTypeSnapshot, constdef.DataTypeTrade, constdef.DataTypeOrder, constdef.DataTypeOrderQueue)
+	logger.Info("Build Tick End, count=%d", len(tickList))
+
+	if config.Cfg.IsHiveLayout() {
+		logger.Info("Write HiveTick.parquet Begin")
+		if err := WriteHiveParquet(dstDir, date, tickList, sourceFileList, func(v *model.Tick) string { return v.InstrumentId },
+			getTickSortTimestamp()); err != nil {
+			return errorx.NewError("WriteHiveParquet(%s) date(%s) error: %v", dstDir, date, err)
+		}
+		logger.Info("Write HiveTick.parquet End")
+	} else if config.Cfg.IsPerDay() {
+		logger.Info("Write AllTick.parquet Begin")
+		if err := WriteAllTickParquet(dstDir, date, tickList, sourceFileList); err != nil {
+			return errorx.NewError("WriteAllTickParquet(%s) date(%s) error: %v", dstDir, date, err)
+		}
+		logger.Info("Write AllTick.parquet End")
+	} else {
+		logger.Info("Write StockTick.parquet Begin")
+		if err := WriteStockTickParquet(dstDir, date, GetMapTick(tickList), sourceFileList); err != nil {
+			return errorx.NewError("WriteStockTickParquet(%s) date(%s) error: %v", dstDir, date, err)
+		}
+		logger.Info("Write StockTick.parquet End")
+	}
+	return nil
+}
+
+func GetMapTick(list []*model.Tick) map[string][]*model.Tick {
+	res := make(map[string][]*model.Tick)
+	for _, v := range list {
+		res[v.InstrumentId] = append(res[v.InstrumentId], v)
+	}
+	return res
+}
+
+func WriteAllTickParquet(dstDir string, date string, list []*model.Tick, sourceFileList []string) error {
+	if err := os.MkdirAll(dstDir, 0755); err != nil {
+		return errorx.NewError("MkdirAll(%s) error: %v", dstDir, err)
+	}
+
+	filePath := filepath.Join(dstDir, layout.GetPerDayFileName(date, constdef.DataTypeTick))
+	if config.Cfg.IsPerDayClustered() {
+		return WriteClusteredOutputFile(filePath, list, sourceFileList, func(v *model.Tick) string { return v.InstrumentId }, getTickSortTimestamp())
+	}
+	return WriteOutputFile(filePath, list, sourceFileList)
+}
+
+func WriteStockTickParquet(dstDir string, date string, mapTick map[string][]*model.Tick, sourceFileList []string) error {
+	if err := os.MkdirAll(dstDir, 0755); err != nil {
+		return errorx.NewError("MkdirAll(%s) error: %v", dstDir, err)
+	}
+
+	for instrumentId, list := range mapTick {
+		filePath := filepath.Join(dstDir, layout.GetPerStockFileName(date, constdef.DataTypeTick, instrumentId))
+		if err := WriteOutputFile(filePath, list, sourceFileList); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package service
+
+import (
+	"data-scrubber/biz/constdef"
+	"data-scrubber/biz/model"
+	"data-scrubber/config"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBuildTickList(t *testing.T) {
+	oldCfg := config.Cfg
+	defer func() { config.Cfg = oldCfg }()
+	config.Cfg = &config.Config{}
+
+	snapshotList := []*model.Snapshot{
+		{InstrumentId: "000001.SZ", UpdateTimestamp: 100, LocalTimestamp: 130, SeqNo: 9, Last: 10.1, BidPriceList: []float64{10.1}},
+	}
+	// 深市委托和成交共用 ApplSeqNum，同一时间按通道序号排
+	orderList := []*model.Order{
+		{InstrumentId: "000001.SZ", OrderTimestamp: 110, LocalTimestamp: 120, Channel: 2011, ApplSeqNum: 5, OrderId: 5, SeqNo: 3},
+		{InstrumentId: "000001.SZ", OrderTimestamp: 110, LocalTimestamp: 120, Channel: 2011, ApplSeqNum: 7, OrderId: 7, SeqNo: 1},
+	}
+	tradeList := []*model.Trade{
+		{InstrumentId: "000001.SZ", TradeTimestamp: 110, LocalTimestamp: 120, Channel: 2011, ApplSeqNum: 6, Price: 10.1, BuyOrderId: 5, SeqNo: 2},
+	}
+	orderQueueList := []*model.OrderQueue{
+		{InstrumentId: "000001.SZ", UpdateTimestamp: 100, LocalTimestamp: 125, Price: 10.1, OrderQtyList: []int64{100}},
+	}
+
+	type event struct {
+		eventType  string
+		channelSeq int64
+	}
+	check := func(tickList []*model.Tick, want []event) {
+		t.Helper()
+		if len(tickList) != len(want) {
+			t.Fatalf("len(tickList)=%d, 期望 %d", len(tickList), len(want))
+		}
+		for i, tick := range tickList {
+			if tick.EventType != want[i].eventType || tick.ChannelSeq != want[i].channelSeq {
+				t.Errorf("tickList[%d]=%s/%d, 期望 %s/%d", i, tick.EventType, tick.ChannelSeq, want[i].eventType, want[i].channelSeq)
+			}
+		}
+	}
+
+	// 默认按本地接收时间：逐笔（120）、委托队列（125）、快照（130）
+	tickList := BuildTickList(snapshotList, tradeList, orderList, orderQueueList)
+	check(tickList, []event{
+		{constdef.DataTypeOrder, 5}, {constdef.DataTypeTrade, 6}, {constdef.DataTypeOrder, 7},
+		{constdef.DataTypeOrderQueue, 0}, {constdef.DataTypeSnapshot, 0},
+	})
+	if tickList[1].Price != 10.1 || tickList[1].BuyOrderId != 5 || tickList[4].BidPriceList[0] != 10.1 || tickList[3].OrderQtyList[0] != 100 {
+		t.Errorf("字段未拷贝: trade=%+v snapshot=%+v", tickList[1], tickList[4])
+	}
+
+	// 按交易所时间：快照和委托队列（100）在前，同一时间快照先于委托队列
+	config.Cfg.TickOrder = constdef.TickOrderExchange
+	check(BuildTickList(snapshotList, tradeList, orderList, orderQueueList), []event{
+		{constdef.DataTypeSnapshot, 0}, {constdef.DataTypeOrderQueue, 0},
+		{constdef.DataTypeOrder, 5}, {constdef.DataTypeTrade, 6}, {constdef.DataTypeOrder, 7},
+	})
+
+	// per_day_clustered 按票重排时用 tick 的排序时间
+	config.Cfg = &config.Config{OutputMode: constdef.OutputModePerDayClustered}
+	tickList = BuildTickList(snapshotList, tradeList, orderList, orderQueueList)
+	dir := t.TempDir()
+	if err := WriteAllTickParquet(dir, "20240115", tickList, nil); err != nil {
+		t.Fatalf("WriteAllTickParquet error: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "20240115_tick.parquet")); err != nil {
+		t.Fatalf("Stat error: %v", err)
+	}
+}
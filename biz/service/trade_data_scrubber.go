@@ -2,9 +2,9 @@ package service
 
 import (
 	"archive/zip"
-	"compress/gzip"
 	"data-scrubber/biz/constdef"
 	"data-scrubber/biz/errorx"
+	"data-scrubber/biz/layout"
 	"data-scrubber/biz/model"
 	"data-scrubber/biz/utils"
 	"data-scrubber/config"
@@ -88,14 +88,18 @@ func ShRawTrade2Trade(date string, v *model.ShRawTrade) (*model.Trade, error) {
 		InstrumentId:   fmt.Sprintf("%s.SH", v.SecurityID),
 		TradeTimestamp: tradeTimestamp,
 		TradeId:        v.BizIndex,
-		Price:          v.Price,
+		Price:          priceE4ToFloat(v.Price),
 		Volume:         v.Qty,
 		Turnover:       v.TradeMoney,
 		Direction:      direction,
 		BuyOrderId:     v.BuyOrderNo,
 		SellOrderId:    v.SellOrderNo,
+		Channel:        v.Channel,
+		BizIndex:       v.BizIndex,
+		ExecType:       v.Type,
 		SeqNo:          v.SeqNo,
 		LocalTimestamp: localTimestamp,
+		PriceE4:        v.Price,
 	}
 
 	return res, nil
@@ -119,15 +123,19 @@ func OldShRawTrade2Trade(date string, v *model.OldShRawTrade) (*model.Trade, err
 	res := &model.Trade{
 		InstrumentId:   fmt.Sprintf("%s.SH", v.SecurityID),
 		TradeTimestamp: tradeTimestamp,
-		TradeId:        v.BizIndex,
-		Price:          v.TradPrice,
+		TradeId:        v.TradeIndex,
+		Price:          priceE4ToFloat(v.TradPrice),
 		Volume:         int64(v.TradVolume),
 		Turnover:       v.TradeMoney,
 		Direction:      direction,
 		BuyOrderId:     v.TradeBuyNo,
 		SellOrderId:    v.TradeSellNo,
+		Channel:        int64(v.TradeChan),
+		BizIndex:       v.BizIndex,
+		ExecType:       "T", // 旧格式成交文件只有成交记录，与新格式的 Type=T 保持一致
 		SeqNo:          v.SeqNo,
 		LocalTimestamp: localTimestamp,
+		PriceE4:        v.TradPrice,
 	}
 
 	return res, nil
@@ -238,15 +246,19 @@ func SzRawTrade2Trade(date string, v *model.SzRawTrade) (*model.Trade, error) {
 	res := &model.Trade{
 		InstrumentId:   fmt.Sprintf("%s.SZ", v.SecurityID),
 		TradeTimestamp: tradeTimestamp,
-		TradeId:        v.SeqNo,
-		Price:          v.LastPx,
+		TradeId:        v.ApplSeqNum,
+		Price:          priceE4ToFloat(v.LastPx),
 		Volume:         v.LastQty,
-		Turnover:       v.LastPx * float64(v.LastQty),
+		Turnover:       priceE4ToFloat(v.LastPx) * float64(v.LastQty),
 		Direction:      direction,
 		BuyOrderId:     v.BidApplSeqNum,
 		SellOrderId:    v.OfferApplSeqNum,
+		Channel:        v.ChannelNo,
+		ApplSeqNum:     v.ApplSeqNum,
+		ExecType:       string(rune(v.ExecType)),
 		SeqNo:          v.SeqNo,
 		LocalTimestamp: localTimestamp,
+		PriceE4:        v.LastPx,
 	}
 	return res, nil
 }
@@ -274,19 +286,76 @@ var shNewTradeStartDay = carbon.Parse("20231204").StartOfDay()
 var shBizIndexStartDay = carbon.Parse("20210426").StartOfDay()
 var shOrderStartDay = carbon.Parse("20210607").StartOfDay()
 
-func MergeRawTrade(srcDir string, dstDir string, date string) error {
-	if config.Cfg.IsPerDay() {
+func MergeRawTrade(day *DayContext, dstDir string) error {
+	date := day.Date
+	if config.Cfg.IsPerDay() || config.Cfg.IsHiveLayout() {
 		dstDir = filepath.Join(dstDir, constdef.DataTypeTrade)
 	} else {
 		dstDir = filepath.Join(dstDir, constdef.DataTypeTrade, date)
 	}
 
+	tradeList, err := ReadRawTradeList(day)
+	if err != nil {
+		return err
+	}
+	sourceFileList := day.GetSourceFileList(constdef.DataTypeTrade)
+
+	//
+	//logger.Info("Write Trade.parquet Begin")
+	//if err := WriteParquet(dstDir, date, tradeList); err != nil {
+	//	return errorx.NewError("WriteParquet(%s) date(%s) error: %v", dstDir, date, err)
+	//}
+	//logger.Info("Write Trade.parquet End")
+
+	// 拿不到复权比例时不带复权列，按原始 trade 输出
+	if ratioMap, ok := adjustPriceColumnRatioMap(constdef.DataTypeTrade, date); ok {
+		adjustedList := BuildAdjustedTradeList(date, tradeList, ratioMap)
+		logger.Info("Write AdjustedTrade.parquet Begin")
+		if err := WriteAdjustedOutput(dstDir, constdef.DataTypeTrade, date, adjustedList, sourceFileList, func(v *model.AdjustedTrade) string { return v.InstrumentId },
+			func(v *model.AdjustedTrade) int64 { return v.TradeTimestamp }); err != nil {
+			return errorx.NewError("WriteAdjustedOutput(%s) date(%s) error: %v", dstDir, date, err)
+		}
+		logger.Info("Write AdjustedTrade.parquet End")
+		return nil
+	}
+
+	// 根据 output_mode 选择写入方式
+	if config.Cfg.IsHiveLayout() {
+		logger.Info("Write HiveTrade.parquet Begin")
+		if err := WriteHiveParquet(dstDir, date, tradeList, sourceFileList, func(v *model.Trade) string { return v.InstrumentId },
+			func(v *model.Trade) int64 { return v.TradeTimestamp }); err != nil {
+			return errorx.NewError("WriteHiveParquet(%s) date(%s) error: %v", dstDir, date, err)
+		}
+		logger.Info("Write HiveTrade.parquet End")
+	} else if config.Cfg.IsPerDay() {
+		logger.Info("Write AllTrade.parquet Begin")
+		if err := WriteTradeParquet(dstDir, date, tradeList, sourceFileList); err != nil {
+			return errorx.NewError("WriteTradeParquet(%s) date(%s) error: %v", dstDir, date, err)
+		}
+		logger.Info("Write AllTrade.parquet End")
+	} else {
+		tradeMap := GetMapTrade(tradeList)
+
+		logger.Info("Write StockTrade.parquet Begin")
+		if err := WriteStockTradeParquet(dstDir, date, tradeMap, sourceFileList); err != nil {
+			return errorx.NewError("WriteParquet(%s) date(%s) error: %v", dstDir, date, err)
+		}
+		logger.Info("Write StockTrade.parquet End")
+	}
+
+	return nil
+}
+
+// ReadRawTradeList 读取并转换沪深两市当天的逐笔成交，返回按时间归并后的列表
+// trade / bar 等基于成交的数据类型共用这一份读取逻辑
+func ReadRawTradeList(day *DayContext) ([]*model.Trade, error) {
+	srcDir, date := day.SrcDir, day.Date
 	szFilepath := filepath.Join(srcDir, date, fmt.Sprintf("%s_mdl_6_36_0.csv.zip", date))
 
 	// 读取和处理上海数据
 	currentDate := carbon.Parse(date).StartOfDay()
 	if currentDate.IsInvalid() {
-		return errorx.NewError("date(%s) is invalid", date)
+		return nil, errorx.NewError("date(%s) is invalid", date)
 	}
 
 	shTradeList, err := func() ([]*model.Trade, error) {
@@ -298,6 +367,7 @@ func MergeRawTrade(srcDir string, dstDir string, date string) error {
 			if err != nil {
 				return nil, errorx.NewError("ManualReadOldShRawTrade(%s) error: %s", shFilepath, err)
 			}
+			day.AddSourceFile(constdef.DataTypeTrade, shFilepath)
 			logger.Info("Read Old Sh Raw Trade End")
 
 			shTradeList, err := OldShRawTrade2TradeList(date, OldShRawTradeList)
@@ -313,8 +383,13 @@ func MergeRawTrade(srcDir string, dstDir string, date string) error {
 			if err != nil {
 				return nil, errorx.NewError("ReadShRawTrade(%s) error: %s", shFilepath, err)
 			}
+			day.AddSourceFile(constdef.DataTypeTrade, shFilepath)
 			logger.Info("Read Sh Raw Trade End")
 
+			day.CheckSequenceOnce(constdef.MarketSH, constdef.DataTypeTrade, func() [][]*SequenceRecord {
+				return [][]*SequenceRecord{ShRawTrade2SequenceList(shRawTradeList)}
+			}, true)
+
 			shTradeList, err := ShRawTrade2TradeList(date, shRawTradeList)
 			if err != nil {
 				return nil, errorx.NewError("ShRawTrade2Trade(%s) error: %s", shFilepath, err)
@@ -323,50 +398,44 @@ func MergeRawTrade(srcDir string, dstDir string, date string) error {
 			return shTradeList, nil
 		}
 	}()
+	if err != nil {
+		return nil, err
+	}
 
 	// 读取和处理深圳数据
 	logger.Info("Read Sz Raw Trade Begin")
 	szRawTradeList, err := ManualReadSzRawTrade(szFilepath)
 	if err != nil {
-		return errorx.NewError("ReadSzRawTrade(%s) error: %s", szFilepath, err)
+		return nil, errorx.NewError("ReadSzRawTrade(%s) error: %s", szFilepath, err)
 	}
+	day.AddSourceFile(constdef.DataTypeTrade, szFilepath)
 	logger.Info("Read Sz Raw Trade End")
 
+	// 深市 ApplSeqNum 在委托和成交之间共用，这里只读了成交文件，不检查缺失
+	day.CheckSequenceOnce(constdef.MarketSZ, constdef.DataTypeTrade, func() [][]*SequenceRecord {
+		return [][]*SequenceRecord{SzRawTrade2SequenceList(szRawTradeList)}
+	}, false)
+
 	szTradeList, err := SzRawTrade2TradeList(date, szRawTradeList)
 	if err != nil {
-		return errorx.NewError("SzRawTrade2Trade(%s) error: %s", szFilepath, err)
+		return nil, errorx.NewError("SzRawTrade2Trade(%s) error: %s", szFilepath, err)
 	}
 	logger.Info("Convert Sz Raw Trade End")
 
+	// 去重
+	shTradeList, shDropped := DedupTradeList(shTradeList, currentDate.Gte(shNewTradeStartDay))
+	szTradeList, szDropped := DedupTradeList(szTradeList, true)
+	logDedup(constdef.DataTypeTrade, date, shDropped+szDropped)
+	SetRunReportCount(RunReportTradeDuplicate, int64(shDropped+szDropped))
+
 	// 排序
 	tradeList := SortTradeRaw(shTradeList, szTradeList)
 	logger.Info("Convert All Raw Trade End")
 
-	//
-	//logger.Info("Write Trade.parquet Begin")
-	//if err := WriteParquet(dstDir, date, tradeList); err != nil {
-	//	return errorx.NewError("WriteParquet(%s) date(%s) error: %v", dstDir, date, err)
-	//}
-	//logger.Info("Write Trade.parquet End")
+	CheckTradeTickSize(date, tradeList)
+	day.addSeenTradeList(tradeList)
 
-	// 根据 output_mode 选择写入方式
-	if config.Cfg.IsPerDay() {
-		logger.Info("Write AllTrade.parquet Begin")
-		if err := WriteTradeParquet(dstDir, date, tradeList); err != nil {
-			return errorx.NewError("WriteTradeParquet(%s) date(%s) error: %v", dstDir, date, err)
-		}
-		logger.Info("Write AllTrade.parquet End")
-	} else {
-		tradeMap := GetMapTrade(tradeList)
-
-		logger.Info("Write StockTrade.parquet Begin")
-		if err := WriteStockTradeParquet(dstDir, date, tradeMap); err != nil {
-			return errorx.NewError("WriteParquet(%s) date(%s) error: %v", dstDir, date, err)
-		}
-		logger.Info("Write StockTrade.parquet End")
-	}
-
-	return nil
+	return tradeList, nil
 }
 
 func SortTradeRaw(a []*model.Trade, b []*model.Trade) []*model.Trade {
@@ -426,34 +495,29 @@ func WriteTradeGz(dstDir string, date string, mapTradeGz map[string][]*model.Tra
 	for instrumentId, list := range mapTradeGz {
 		filePath := filepath.Join(dstDir, fmt.Sprintf("%s_trade_%s.csv.gz", date, instrumentId))
 
-		file, err := os.OpenFile(filePath, os.O_RDWR|os.O_CREATE, 0755)
-		if err != nil {
-			return errorx.NewError("open file(%s): %v", filePath, err)
-		}
-		defer file.Close()
-
-		gzWriter := gzip.NewWriter(file)
-		defer gzWriter.Close()
-
-		if err := gocsv.Marshal(&list, gzWriter); err != nil {
-			return errorx.NewError("filePath(%s) gocsv.Marshal error: %v", filePath, err)
+		if err := WriteCsvGzFile(filePath, list); err != nil {
+			return err
 		}
 	}
 
 	return nil
 }
 
-func WriteTradeParquet(dstDir string, date string, tradeList []*model.Trade) error {
+func WriteTradeParquet(dstDir string, date string, tradeList []*model.Trade, sourceFileList []string) error {
 	if err := os.MkdirAll(dstDir, 0755); err != nil {
 		return errorx.NewError("MkdirAll(%s) error: %v", dstDir, err)
 	}
 
-	filepath := filepath.Join(dstDir, fmt.Sprintf("%s_trade.parquet", date))
+	filepath := filepath.Join(dstDir, layout.GetPerDayFileName(date, constdef.DataTypeTrade))
+	if config.Cfg.IsPerDayClustered() {
+		return WriteClusteredOutputFile(filepath, tradeList, sourceFileList, func(v *model.Trade) string { return v.InstrumentId },
+			func(v *model.Trade) int64 { return v.TradeTimestamp })
+	}
 
 	//创建写入器
-	pw, err := NewParquetWriter(filepath, new(model.Trade))
+	pw, err := NewOutputWriter(filepath, new(model.Trade), sourceFileList)
 	if err != nil {
-		return errorx.NewError("NewParquetWriter error: %s", err)
+		return errorx.NewError("NewOutputWriter error: %s", err)
 	}
 
 	defer func() {
@@ -475,18 +539,18 @@ func WriteTradeParquet(dstDir string, date string, tradeList []*model.Trade) err
 	return nil
 }
 
-func WriteStockTradeParquet(dstDir string, date string, mapTrader map[string][]*model.Trade) error {
+func WriteStockTradeParquet(dstDir string, date string, mapTrader map[string][]*model.Trade, sourceFileList []string) error {
 	if err := os.MkdirAll(dstDir, 0755); err != nil {
 		return errorx.NewError("MkdirAll(%s) error: %v", dstDir, err)
 	}
 
 	for instrumentId, tradeList := range mapTrader {
-		filePath := filepath.Join(dstDir, fmt.Sprintf("%s_trade_%s.parquet", date, instrumentId))
+		filePath := filepath.Join(dstDir, layout.GetPerStockFileName(date, constdef.DataTypeTrade, instrumentId))
 
 		//创建写入器
-		pw, err := NewParquetWriter(filePath, new(model.Trade))
+		pw, err := NewOutputWriter(filePath, new(model.Trade), sourceFileList)
 		if err != nil {
-			return errorx.NewError("NewParquetWriter error: %s", err)
+			return errorx.NewError("NewOutputWriter error: %s", err)
 		}
 
 		defer func() {
@@ -0,0 +1,62 @@
+package service
+
+import (
+	"data-scrubber/biz/constdef"
+	"data-scrubber/biz/model"
+	"testing"
+)
+
+// 三种成交来源的交易所原生字段映射
+func TestTradeMapping(t *testing.T) {
+	date := "20240115"
+
+	// 沪市新格式：TradeId 为 BizIndex，只保留 Type=T
+	shList, err := ShRawTrade2TradeList(date, []*model.ShRawTrade{
+		{BizIndex: 201, Channel: 1, SecurityID: "600000", TickTime: "09:30:00.000", Type: "T", BuyOrderNo: 7, SellOrderNo: 8,
+			Price: 100000, Qty: 100, TradeMoney: 1000, TickBSFlag: "B", SeqNo: 5},
+		{BizIndex: 202, Channel: 1, SecurityID: "600000", TickTime: "09:30:00.000", Type: "A", BuyOrderNo: 9, Qty: 100, TickBSFlag: "B"},
+	})
+	if err != nil {
+		t.Fatalf("ShRawTrade2TradeList error: %v", err)
+	}
+	want := model.Trade{
+		InstrumentId: "600000.SH", TradeTimestamp: mustTimeToNano(t, date, "09:30:00.000"), TradeId: 201, Price: 10, Volume: 100, Turnover: 1000,
+		Direction: constdef.DirectionBuy, BuyOrderId: 7, SellOrderId: 8, Channel: 1, BizIndex: 201, ExecType: "T", SeqNo: 5, PriceE4: 100000,
+	}
+	if len(shList) != 1 || *shList[0] != want {
+		t.Errorf("沪市新格式 shList=%+v", shList)
+	}
+
+	// 沪市旧格式：TradeId 为 TradeIndex，BizIndex 单独输出，ExecType 与新格式一致
+	oldList, err := OldShRawTrade2TradeList(date, []*model.OldShRawTrade{
+		{TradeIndex: 3, TradeChan: 2, SecurityID: "601360", TradTime: "09:25:00.000", TradPrice: 93400, TradVolume: 900, TradeMoney: 8406,
+			TradeBuyNo: 186085, TradeSellNo: 203555, TradeBSFlag: "N", BizIndex: 2767, SeqNo: 1},
+	})
+	if err != nil {
+		t.Fatalf("OldShRawTrade2TradeList error: %v", err)
+	}
+	want = model.Trade{
+		InstrumentId: "601360.SH", TradeTimestamp: mustTimeToNano(t, date, "09:25:00.000"), TradeId: 3, Price: 9.34, Volume: 900, Turnover: 8406,
+		Direction: constdef.DirectionUnknown, BuyOrderId: 186085, SellOrderId: 203555, Channel: 2, BizIndex: 2767, ExecType: "T", SeqNo: 1, PriceE4: 93400,
+	}
+	if len(oldList) != 1 || *oldList[0] != want {
+		t.Errorf("沪市旧格式 oldList=%+v", oldList)
+	}
+
+	// 深市：TradeId 为 ApplSeqNum（不是采集端的 SeqNo），只保留 ExecType=F
+	szList, err := SzRawTrade2TradeList(date, []*model.SzRawTrade{
+		{ChannelNo: 2011, ApplSeqNum: 66, BidApplSeqNum: 60, OfferApplSeqNum: 50, SecurityID: "000001", LastPx: 105000, LastQty: 200,
+			ExecType: 'F', TransactTime: "09:30:01.000", SeqNo: 9},
+		{ChannelNo: 2011, ApplSeqNum: 67, BidApplSeqNum: 61, SecurityID: "000001", LastQty: 100, ExecType: '4', TransactTime: "09:30:01.000"},
+	})
+	if err != nil {
+		t.Fatalf("SzRawTrade2TradeList error: %v", err)
+	}
+	want = model.Trade{
+		InstrumentId: "000001.SZ", TradeTimestamp: mustTimeToNano(t, date, "09:30:01.000"), TradeId: 66, Price: 10.5, Volume: 200, Turnover: 2100,
+		Direction: constdef.DirectionBuy, BuyOrderId: 60, SellOrderId: 50, Channel: 2011, ApplSeqNum: 66, ExecType: "F", SeqNo: 9, PriceE4: 105000,
+	}
+	if len(szList) != 1 || *szList[0] != want {
+		t.Errorf("深市 szList=%+v", szList)
+	}
+}
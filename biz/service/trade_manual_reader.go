@@ -137,7 +137,7 @@ func ManualReadSzRawTrade(filepath string) ([]*model.SzRawTrade, error) {
 			continue
 		}
 
-		if err := parseFloat64Field(fields, headerIndex, "LastPx", &trade.LastPx); err != nil {
+		if err := parsePriceField(fields, headerIndex, "LastPx", &trade.LastPx); err != nil {
 			logger.Error("警告: 第 %d 行 LastPx 解析错误: %v，跳过该行", lineNum, err)
 			lineNum++
 			continue
@@ -346,7 +346,7 @@ func UnzipAndManualReadShRawTrade(filepath string) ([]*model.ShRawTrade, error)
 					trade.SellOrderNo, _ = strconv.ParseInt(record[idx], 10, 64)
 				}
 				if idx, exists := columnIndex["Price"]; exists {
-					trade.Price, _ = strconv.ParseFloat(record[idx], 64)
+					trade.Price, _ = parsePriceText(record[idx])
 				}
 				if idx, exists := columnIndex["Qty"]; exists {
 					trade.Qty, _ = strconv.ParseInt(record[idx], 10, 64)
@@ -502,7 +502,7 @@ func ManualReadShRawTrade(filepath string) ([]*model.ShRawTrade, error) {
 			continue
 		}
 
-		if err := parseFloat64Field(fields, headerIndex, "Price", &trade.Price); err != nil {
+		if err := parsePriceField(fields, headerIndex, "Price", &trade.Price); err != nil {
 			logger.Error("警告: 第 %d 行 Price 解析错误: %v，跳过", lineNum, err)
 			lineNum++
 			continue
@@ -647,7 +647,7 @@ func ManualReadOldShRawTrade(filepath string, date *carbon.Carbon) ([]*model.Old
 		trade.SecurityID = getOptionalFieldValue(fields, headerIndex, "SecurityID")
 		trade.TradTime = getOptionalFieldValue(fields, headerIndex, "TradTime")
 
-		if err := parseFloat64Field(fields, headerIndex, "TradPrice", &trade.TradPrice); err != nil {
+		if err := parsePriceField(fields, headerIndex, "TradPrice", &trade.TradPrice); err != nil {
 			logger.Info("警告: 第 %d 行 TradPrice 解析错误: %v，跳过", lineNum, err)
 			lineNum++
 			continue
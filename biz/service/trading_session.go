@@ -0,0 +1,100 @@
+package service
+
+import (
+	"data-scrubber/biz/constdef"
+	"data-scrubber/biz/errorx"
+	"data-scrubber/biz/utils"
+	"strings"
+
+	"github.com/dromara/carbon/v2"
+)
+
+// 沪市 20180820 起才有收盘集合竞价，此前 14:57-15:00 仍是连续竞价
+var shCloseAuctionStartDay = carbon.Parse("20180820").StartOfDay()
+
+// 科创板 20190722 开市，同时开始盘后固定价格交易
+var starAfterHoursStartDay = carbon.Parse("20190722").StartOfDay()
+
+// TradingSession 一个交易时段，时间为当天纳秒时间戳
+// 成交时间落在 [BeginTimestamp, EndTimestamp) 内归入该时段；
+// 恰好等于 EndTimestamp 且下一个时段不从该时刻开始的（如 11:30:00.000、15:00:00.000），也归入该时段
+type TradingSession struct {
+	Phase          string
+	BeginTimestamp int64
+	EndTimestamp   int64
+	Single         bool // 集合竞价时段只有一次撮合，整段输出一根 bar
+}
+
+type tradingSessionTemplate struct {
+	phase  string
+	begin  string
+	end    string
+	single bool
+}
+
+// GetTradingSessionList 返回某个票在某天的交易时段列表（按时间升序）
+func GetTradingSessionList(instrumentId string, date string) ([]*TradingSession, error) {
+	currentDate := carbon.Parse(date).StartOfDay()
+	if currentDate.IsInvalid() {
+		return nil, errorx.NewError("date(%s) is invalid", date)
+	}
+
+	isSh := strings.HasSuffix(instrumentId, ".SH")
+
+	templateList := []*tradingSessionTemplate{
+		{phase: constdef.TradingPhaseOpenAuction, begin: "09:25:00.000", end: "09:30:00.000", single: true},
+		{phase: constdef.TradingPhaseContinuous, begin: "09:30:00.000", end: "11:30:00.000"},
+	}
+
+	if isSh && currentDate.Lt(shCloseAuctionStartDay) {
+		templateList = append(templateList,
+			&tradingSessionTemplate{phase: constdef.TradingPhaseContinuous, begin: "13:00:00.000", end: "15:00:00.000"},
+		)
+	} else {
+		templateList = append(templateList,
+			&tradingSessionTemplate{phase: constdef.TradingPhaseContinuous, begin: "13:00:00.000", end: "14:57:00.000"},
+			&tradingSessionTemplate{phase: constdef.TradingPhaseCloseAuction, begin: "14:57:00.000", end: "15:00:00.000", single: true},
+		)
+	}
+
+	// 盘后固定价格交易，目前只处理科创板
+	if isSh && strings.HasPrefix(instrumentId, "68") && currentDate.Gte(starAfterHoursStartDay) {
+		templateList = append(templateList,
+			&tradingSessionTemplate{phase: constdef.TradingPhaseAfterHours, begin: "15:05:00.000", end: "15:30:00.000"},
+		)
+	}
+
+	res := make([]*TradingSession, 0, len(templateList))
+	for _, v := range templateList {
+		begin, err := utils.TimeToNano(date, v.begin)
+		if err != nil {
+			return nil, errorx.NewError("timeToNano(%s %s) error: %v", date, v.begin, err)
+		}
+		end, err := utils.TimeToNano(date, v.end)
+		if err != nil {
+			return nil, errorx.NewError("timeToNano(%s %s) error: %v", date, v.end, err)
+		}
+		res = append(res, &TradingSession{
+			Phase:          v.phase,
+			BeginTimestamp: begin,
+			EndTimestamp:   end,
+			Single:         v.single,
+		})
+	}
+	return res, nil
+}
+
+// FindTradingSession 返回 timestamp 所属的交易时段，不在任何时段内返回 nil
+func FindTradingSession(sessionList []*TradingSession, timestamp int64) *TradingSession {
+	for _, v := range sessionList {
+		if timestamp >= v.BeginTimestamp && timestamp < v.EndTimestamp {
+			return v
+		}
+	}
+	for _, v := range sessionList {
+		if timestamp == v.EndTimestamp {
+			return v
+		}
+	}
+	return nil
+}
@@ -1,9 +1,11 @@
 package service
 
 import (
+	"data-scrubber/biz/constdef"
 	"data-scrubber/biz/errorx"
 	"data-scrubber/biz/upstream/gotushare"
 	"data-scrubber/biz/utils"
+	"strings"
 	"time"
 
 	logger "github.com/2997215859/golog"
@@ -12,6 +14,13 @@ import (
 
 var ts *gotushare.TuShare
 
+// 运行报告计数
+const (
+	RunReportSuspended                 = "suspended_instrument"         // 当天全天停牌的票数
+	RunReportSnapshotMissingPriceLimit = "snapshot_missing_price_limit" // 未停牌但 tushare 没有涨跌停价的票数
+	RunReportSuspendUnavailable        = "suspend_unavailable"          // 停牌信息拉取失败时为 1，当天的停牌标记为空
+)
+
 func GetTuShare() *gotushare.TuShare {
 	return ts
 }
@@ -43,8 +52,11 @@ func GetDateLimit(tradeDate string) ([]*PriceLimit, error) {
 
 	res := make([]*PriceLimit, 0)
 	for _, v := range rsp.Data.Items {
+		// pre_close 不是必填字段，可能为 null
+		preClose, _ := v[2].(float64)
 		res = append(res, &PriceLimit{
 			InstrumentId: v[0].(string),
+			PreClose:     preClose,
 			HighLimit:    v[3].(float64),
 			LowLimit:     v[4].(float64),
 		})
@@ -62,6 +74,7 @@ func GetStockLimit(instrumentId string) (*PriceLimit, error) {
 
 type PriceLimit struct {
 	InstrumentId string
+	PreClose     float64
 	HighLimit    float64
 	LowLimit     float64
 }
@@ -87,3 +100,180 @@ func UpdateTuShareDailyLimit(date string) error {
 	}
 	return nil
 }
+
+// Suspend 当天停牌的票
+type Suspend struct {
+	InstrumentId  string
+	SuspendType   string // constdef.SuspendTypeFull / SuspendTypeIntraday
+	SuspendTiming string // 盘中停牌时段，如 "09:30-10:30"，全天停牌为空
+}
+
+// GetDateSuspend tushare suspend_d 当天停牌（S）的票
+func GetDateSuspend(tradeDate string) ([]*Suspend, error) {
+	rsp, err := ts.SuspendD(gotushare.SuspendDRequest{TradeDate: tradeDate, SuspendType: "S"}, gotushare.SuspendDItems{}.All())
+	if err != nil {
+		return nil, errorx.NewError("GetDateSuspend err: %v", err)
+	}
+	if rsp.Code != 0 {
+		return nil, errorx.NewError("GetDateSuspend code != 0. code = %d, msg = %s", rsp.Code, rsp.Msg)
+	}
+
+	res := make([]*Suspend, 0)
+	for _, v := range gotushare.AssembleSuspendDData(rsp) {
+		suspendType := constdef.SuspendTypeFull
+		if strings.TrimSpace(v.SuspendTiming) != "" {
+			suspendType = constdef.SuspendTypeIntraday
+		}
+		res = append(res, &Suspend{
+			InstrumentId:  v.TsCode,
+			SuspendType:   suspendType,
+			SuspendTiming: strings.TrimSpace(v.SuspendTiming),
+		})
+	}
+	return res, nil
+}
+
+var mapSuspend map[string]*Suspend
+
+// GetSuspend 当天未停牌时返回 nil
+func GetSuspend(instrumentId string) *Suspend {
+	return mapSuspend[instrumentId]
+}
+
+// GetSuspendType 当天未停牌时返回 constdef.SuspendTypeNone
+func GetSuspendType(instrumentId string) string {
+	if v := GetSuspend(instrumentId); v != nil {
+		return v.SuspendType
+	}
+	return constdef.SuspendTypeNone
+}
+
+// UpdateTuShareSuspend 刷新当天的停牌信息，和涨跌停一起作为当天的参考数据
+// 停牌标记只写入日线（Daily.SuspendType）和证券主数据，快照和逐笔本身不带停牌列；失败时 mapSuspend 为空
+func UpdateTuShareSuspend(date string) error {
+	mapSuspend = make(map[string]*Suspend)
+
+	suspendList, err := retry.DoWithData(func() ([]*Suspend, error) {
+		return GetDateSuspend(date)
+	}, utils.RetryFixedOpts(3, 1*time.Minute)...)
+	if err != nil {
+		return errorx.NewError("retry GetDateSuspend error: %v", err)
+	}
+
+	fullCount := 0
+	for _, v := range suspendList {
+		mapSuspend[v.InstrumentId] = v
+		if v.SuspendType == constdef.SuspendTypeFull {
+			fullCount++
+		}
+	}
+	SetRunReportCount(RunReportSuspended, int64(fullCount))
+	logger.Info("UpdateTuShareSuspend date(%s): suspended=%d, full day=%d", date, len(suspendList), fullCount)
+	return nil
+}
+
+// GetTuShareDaily 获取某个交易日全市场的日线（未复权，vol 单位为手，amount 单位为千元）
+func GetTuShareDaily(tradeDate string) ([]*gotushare.QuotationData, error) {
+	return retry.DoWithData(func() ([]*gotushare.QuotationData, error) {
+		rsp, err := ts.Daily(gotushare.QuotationRequest{TradeDate: tradeDate}, gotushare.QuotationItems{}.All())
+		if err != nil {
+			return nil, errorx.NewError("GetTuShareDaily(%s) err: %v", tradeDate, err)
+		}
+		if rsp.Code != 0 {
+			return nil, errorx.NewError("GetTuShareDaily(%s) code != 0. code = %d, msg = %s", tradeDate, rsp.Code, rsp.Msg)
+		}
+		return gotushare.AssembleQuotationData(rsp), nil
+	}, utils.RetryFixedOpts(3, 1*time.Minute)...)
+}
+
+// GetTuShareAdjFactor 获取某个交易日全市场的复权因子，非交易日返回空列表
+func GetTuShareAdjFactor(tradeDate string) ([]*gotushare.AdjFactorData, error) {
+	return retry.DoWithData(func() ([]*gotushare.AdjFactorData, error) {
+		rsp, err := ts.AdjFactor(gotushare.QuotationRequest{TradeDate: tradeDate}, gotushare.AdjFactorItems{}.All())
+		if err != nil {
+			return nil, errorx.NewError("GetTuShareAdjFactor(%s) err: %v", tradeDate, err)
+		}
+		if rsp.Code != 0 {
+			return nil, errorx.NewError("GetTuShareAdjFactor(%s) code != 0. code = %d, msg = %s", tradeDate, rsp.Code, rsp.Msg)
+		}
+		return gotushare.AssembleAdjFactorData(rsp), nil
+	}, utils.RetryFixedOpts(3, 1*time.Minute)...)
+}
+
+// GetTuShareStockBasic 获取全部股票的基础信息，包括已退市和暂停上市的票
+func GetTuShareStockBasic() ([]*gotushare.StockBasicData, error) {
+	res := make([]*gotushare.StockBasicData, 0)
+	for _, listStatus := range []string{"L", "D", "P"} {
+		list, err := retry.DoWithData(func() ([]*gotushare.StockBasicData, error) {
+			rsp, err := ts.StockBasic(gotushare.StockBasicRequest{ListStatus: listStatus}, gotushare.StockBasicItems{}.All())
+			if err != nil {
+				return nil, errorx.NewError("GetTuShareStockBasic(%s) err: %v", listStatus, err)
+			}
+			if rsp.Code != 0 {
+				return nil, errorx.NewError("GetTuShareStockBasic(%s) code != 0. code = %d, msg = %s", listStatus, rsp.Code, rsp.Msg)
+			}
+			return gotushare.AssembleStockBasicData(rsp), nil
+		}, utils.RetryFixedOpts(3, 1*time.Minute)...)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, list...)
+	}
+	return res, nil
+}
+
+// GetTuShareNameChange 获取全部股票的历史简称变更记录
+func GetTuShareNameChange() ([]*gotushare.NameChangeData, error) {
+	return retry.DoWithData(func() ([]*gotushare.NameChangeData, error) {
+		rsp, err := ts.NameChange(gotushare.NameChangeRequest{}, gotushare.NameChangeItems{}.All())
+		if err != nil {
+			return nil, errorx.NewError("GetTuShareNameChange err: %v", err)
+		}
+		if rsp.Code != 0 {
+			return nil, errorx.NewError("GetTuShareNameChange code != 0. code = %d, msg = %s", rsp.Code, rsp.Msg)
+		}
+		return gotushare.AssembleNameChangeData(rsp), nil
+	}, utils.RetryFixedOpts(3, 1*time.Minute)...)
+}
+
+// GetTuShareDailyBasic 获取某个交易日全市场的每日指标（股本单位为万股）
+func GetTuShareDailyBasic(tradeDate string) ([]*gotushare.DailyBasicData, error) {
+	return retry.DoWithData(func() ([]*gotushare.DailyBasicData, error) {
+		rsp, err := ts.DailyBasic(gotushare.QuotationRequest{TradeDate: tradeDate}, gotushare.DailyBasicItems{}.All())
+		if err != nil {
+			return nil, errorx.NewError("GetTuShareDailyBasic(%s) err: %v", tradeDate, err)
+		}
+		if rsp.Code != 0 {
+			return nil, errorx.NewError("GetTuShareDailyBasic(%s) code != 0. code = %d, msg = %s", tradeDate, rsp.Code, rsp.Msg)
+		}
+		return gotushare.AssembleDailyBasicData(rsp), nil
+	}, utils.RetryFixedOpts(3, 1*time.Minute)...)
+}
+
+// GetTuShareMarginDetail 获取某个交易日的融资融券明细，tushare 在下一个交易日早上才更新
+func GetTuShareMarginDetail(tradeDate string) ([]*gotushare.MarginDetailData, error) {
+	return retry.DoWithData(func() ([]*gotushare.MarginDetailData, error) {
+		rsp, err := ts.MarginDetail(gotushare.MarginDetailRequest{TradeDate: tradeDate}, gotushare.MarginDetailItems{}.All())
+		if err != nil {
+			return nil, errorx.NewError("GetTuShareMarginDetail(%s) err: %v", tradeDate, err)
+		}
+		if rsp.Code != 0 {
+			return nil, errorx.NewError("GetTuShareMarginDetail(%s) code != 0. code = %d, msg = %s", tradeDate, rsp.Code, rsp.Msg)
+		}
+		return gotushare.AssembleMarginDetailData(rsp), nil
+	}, utils.RetryFixedOpts(3, 1*time.Minute)...)
+}
+
+// GetTuShareMargin 获取某个交易日沪深两市的融资融券汇总，用来判断当天的融资融券明细是否已经发布
+func GetTuShareMargin(tradeDate string) ([]*gotushare.MarginData, error) {
+	return retry.DoWithData(func() ([]*gotushare.MarginData, error) {
+		rsp, err := ts.Margin(gotushare.MarginRequest{TradeDate: tradeDate}, gotushare.MarginItems{}.All())
+		if err != nil {
+			return nil, errorx.NewError("GetTuShareMargin(%s) err: %v", tradeDate, err)
+		}
+		if rsp.Code != 0 {
+			return nil, errorx.NewError("GetTuShareMargin(%s) code != 0. code = %d, msg = %s", tradeDate, rsp.Code, rsp.Msg)
+		}
+		return gotushare.AssembleMarginData(rsp), nil
+	}, utils.RetryFixedOpts(3, 1*time.Minute)...)
+}
@@ -0,0 +1,97 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// ErrPricePrecision 价格文本的小数位超过了要求的 scale（末尾的 0 不算）
+var ErrPricePrecision = errors.New("price precision exceeds scale")
+
+// ParsePrice 把十进制价格文本精确解析成 价格×10^scale 的整数，不经过浮点数
+// 如 ParsePrice("10.180", 4) = 101800，ParsePrice("35.0100", 4) = 350100
+func ParsePrice(text string, scale int) (int64, error) {
+	s := strings.TrimSpace(text)
+	negative := false
+	if s != "" && (s[0] == '-' || s[0] == '+') {
+		negative = s[0] == '-'
+		s = s[1:]
+	}
+	intPart, fracPart, _ := strings.Cut(s, ".")
+	if intPart == "" && fracPart == "" {
+		return 0, fmt.Errorf("invalid price %q", text)
+	}
+	fracPart = strings.TrimRight(fracPart, "0")
+	if len(fracPart) > scale {
+		return 0, fmt.Errorf("price %q: %w", text, ErrPricePrecision)
+	}
+
+	var res int64
+	for _, digits := range []string{intPart, fracPart + strings.Repeat("0", scale-len(fracPart))} {
+		for i := 0; i < len(digits); i++ {
+			c := digits[i]
+			if c < '0' || c > '9' {
+				return 0, fmt.Errorf("invalid price %q", text)
+			}
+			if res > (math.MaxInt64-int64(c-'0'))/10 {
+				return 0, fmt.Errorf("price %q out of range", text)
+			}
+			res = res*10 + int64(c-'0')
+		}
+	}
+	if negative {
+		res = -res
+	}
+	return res, nil
+}
+
+// PriceToInt64 把 float64 价格转成 价格×factor 的整数，factor 为 10^scale
+// 价格由 ParsePrice 的结果换算而来时（小数位不超过 scale），四舍五入能精确还原
+func PriceToInt64(price float64, factor float64) int64 {
+	return int64(math.Round(price * factor))
+}
+
+// ScalePrice 把 价格×10^fromScale 的整数换成 价格×10^toScale，缩小时按整数四舍五入（远离 0），不经过浮点数
+func ScalePrice(value int64, fromScale int, toScale int) int64 {
+	if toScale >= fromScale {
+		return value * int64(math.Pow10(toScale-fromScale))
+	}
+	divisor := int64(math.Pow10(fromScale - toScale))
+	if value < 0 {
+		return -((-value + divisor/2) / divisor)
+	}
+	return (value + divisor/2) / divisor
+}
+
+// TickScale GetTickSize 返回值的小数位数，最小变动单位以 0.0001 元为单位
+const TickScale = 4
+
+// GetTickSize 返回证券的最小价格变动单位（×10^TickScale），未知品种返回 0 表示不检查
+// A 股 0.01 元；基金（ETF、LOF 等）和沪市 B 股 0.001；深市 B 股 0.01 港元；债券、指数等不检查
+func GetTickSize(instrumentId string) int64 {
+	code, market, ok := strings.Cut(instrumentId, ".")
+	if !ok || len(code) != 6 {
+		return 0
+	}
+	switch market {
+	case "SH":
+		switch {
+		case strings.HasPrefix(code, "6"):
+			return 100
+		case strings.HasPrefix(code, "900"):
+			return 10
+		case strings.HasPrefix(code, "5"):
+			return 10
+		}
+	case "SZ":
+		switch {
+		case strings.HasPrefix(code, "00"), strings.HasPrefix(code, "30"), strings.HasPrefix(code, "200"):
+			return 100
+		case strings.HasPrefix(code, "15"), strings.HasPrefix(code, "16"), strings.HasPrefix(code, "18"):
+			return 10
+		}
+	}
+	return 0
+}
@@ -1,8 +1,68 @@
 package utils
 
-import "testing"
+import (
+	"data-scrubber/biz/constdef"
+	"testing"
+)
 
 func TestTime(t *testing.T) {
 	a, err := TimeToNano("20240115", "06:00:00.940")
 	t.Log(a, err)
 }
+
+func TestTimeToNano_ExchangeLocation(t *testing.T) {
+	// 09:30:00 北京时间 = 01:30:00 UTC，与运行机器的 TZ 无关
+	ns, err := TimeToNano("20240115", "09:30:00.120")
+	if err != nil {
+		t.Fatalf("TimeToNano error: %v", err)
+	}
+	if want := int64(1705282200120000000); ns != want {
+		t.Errorf("TimeToNano=%d, 期望%d", ns, want)
+	}
+	if s := NsToTimeString(ns); s != "2024-01-15 09:30:00.120000000" {
+		t.Errorf("NsToTimeString=%s", s)
+	}
+}
+
+func TestEncodeTimestamp(t *testing.T) {
+	ns, _ := TimeToNano("20240115", "09:30:00.120")
+	if v := EncodeTimestamp(ns, constdef.TimestampEncodingUtcNanos); v != ns {
+		t.Errorf("utc_nanos=%d", v)
+	}
+	if v := EncodeTimestamp(ns, constdef.TimestampEncodingLocalNanos); v != ns+8*3600*1e9 {
+		t.Errorf("local_nanos=%d", v)
+	}
+	if v := EncodeTimestamp(ns, constdef.TimestampEncodingHHMMSSmmm); v != 93000120 {
+		t.Errorf("hhmmssmmm=%d", v)
+	}
+	for _, encoding := range []string{constdef.TimestampEncodingUtcNanos, constdef.TimestampEncodingLocalNanos, constdef.TimestampEncodingHHMMSSmmm} {
+		if v, err := DecodeTimestamp(EncodeTimestamp(ns, encoding), encoding, "20240115"); err != nil || v != ns {
+			t.Errorf("DecodeTimestamp(%s)=%d, %v", encoding, v, err)
+		}
+	}
+	if v := EncodeTimestamp(0, constdef.TimestampEncodingHHMMSSmmm); v != 0 {
+		t.Errorf("缺失时间戳应保持 0，实际 %d", v)
+	}
+}
+
+func TestParsePrice(t *testing.T) {
+	for text, want := range map[string]int64{"10.180": 101800, "35.0100": 350100, "0": 0, "12": 120000, ".5": 5000, "-1.2": -12000, "9.99990000": 99999} {
+		if v, err := ParsePrice(text, 4); err != nil || v != want {
+			t.Errorf("ParsePrice(%q)=%d, %v, 期望 %d", text, v, err, want)
+		}
+	}
+	for _, text := range []string{"", ".", "1.00001", "1e3", "abc", "99999999999999999999"} {
+		if v, err := ParsePrice(text, 4); err == nil {
+			t.Errorf("ParsePrice(%q)=%d, 期望报错", text, v)
+		}
+	}
+	if v, _ := ParsePrice("10.180", 4); PriceToInt64(float64(v)/1e4, 1e4) != v {
+		t.Errorf("PriceToInt64 round trip")
+	}
+	if ScalePrice(100500, 4, 2) != 1005 || ScalePrice(100050, 4, 2) != 1001 || ScalePrice(-100050, 4, 2) != -1001 || ScalePrice(350100, 4, 6) != 35010000 {
+		t.Errorf("ScalePrice")
+	}
+	if GetTickSize("600000.SH") != 100 || GetTickSize("510300.SH") != 10 || GetTickSize("000001.SZ") != 100 || GetTickSize("019547.SH") != 0 {
+		t.Errorf("GetTickSize")
+	}
+}
@@ -1,24 +1,32 @@
 package utils
 
 import (
+	"data-scrubber/biz/constdef"
 	"fmt"
 	"time"
 )
 
+// ExchangeLocation 沪深交易所所在时区，只加载一次；
+// 运行环境没有 tzdata 时退回固定 UTC+8（中国不实行夏令时，两者等价）
+var ExchangeLocation = loadExchangeLocation()
+
+func loadExchangeLocation() *time.Location {
+	loc, err := time.LoadLocation("Asia/Shanghai")
+	if err != nil {
+		return time.FixedZone("CST", 8*3600)
+	}
+	return loc
+}
+
 // TimeToNano 转换20250403 09:15:00.040格式的时间为纳秒时间戳
+// 时间按交易所时区（Asia/Shanghai）解析，与运行机器的 TZ 无关
 func TimeToNano(date string, timeStr string) (int64, error) {
 	// 定义时间格式布局
 	layout := "20060102 15:04:05.000"
 
-	// 获取本地时区
-	loc, err := time.LoadLocation("Local")
-	if err != nil {
-		return 0, fmt.Errorf("load local timezone error: %v", err)
-	}
-
 	str := fmt.Sprintf("%s %s", date, timeStr)
 	// 解析时间字符串
-	t, err := time.ParseInLocation(layout, str, loc)
+	t, err := time.ParseInLocation(layout, str, ExchangeLocation)
 	if err != nil {
 		return 0, fmt.Errorf("time parse(%s) error: %v", str, err)
 	}
@@ -28,6 +36,43 @@ func TimeToNano(date string, timeStr string) (int64, error) {
 }
 
 func NsToTimeString(ns int64) string {
-	t := time.Unix(0, ns)
+	t := time.Unix(0, ns).In(ExchangeLocation)
 	return t.Format("2006-01-02 15:04:05.000000000")
 }
+
+// EncodeTimestamp 将 UTC 纳秒时间戳转换为输出编码，见 constdef.TimestampEncoding*；0 表示缺失，原样返回
+func EncodeTimestamp(ns int64, encoding string) int64 {
+	if ns == 0 {
+		return 0
+	}
+	switch encoding {
+	case constdef.TimestampEncodingLocalNanos:
+		_, offset := time.Unix(0, ns).In(ExchangeLocation).Zone()
+		return ns + int64(offset)*int64(time.Second)
+	case constdef.TimestampEncodingHHMMSSmmm:
+		t := time.Unix(0, ns).In(ExchangeLocation)
+		return int64(t.Hour())*10000000 + int64(t.Minute())*100000 + int64(t.Second())*1000 + int64(t.Nanosecond()/int(time.Millisecond))
+	}
+	return ns
+}
+
+// DecodeTimestamp EncodeTimestamp 的逆变换，hhmmssmmm 需要交易日 date（YYYYMMDD）；0 表示缺失，原样返回
+func DecodeTimestamp(v int64, encoding string, date string) (int64, error) {
+	if v == 0 {
+		return 0, nil
+	}
+	switch encoding {
+	case constdef.TimestampEncodingLocalNanos:
+		t := time.Unix(0, v).UTC()
+		return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), ExchangeLocation).UnixNano(), nil
+	case constdef.TimestampEncodingHHMMSSmmm:
+		day, err := time.ParseInLocation("20060102", date, ExchangeLocation)
+		if err != nil {
+			return 0, fmt.Errorf("date parse(%s) error: %v", date, err)
+		}
+		hour, minute, second, millisecond := v/10000000, v/100000%100, v/1000%100, v%1000
+		return day.Add(time.Duration(hour)*time.Hour + time.Duration(minute)*time.Minute +
+			time.Duration(second)*time.Second + time.Duration(millisecond)*time.Millisecond).UnixNano(), nil
+	}
+	return v, nil
+}
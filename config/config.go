@@ -2,8 +2,12 @@ package config
 
 import (
 	"data-scrubber/biz/constdef"
+	"data-scrubber/biz/errorx"
 	"encoding/json"
 	"os"
+	"path/filepath"
+	"slices"
+	"strings"
 
 	logger "github.com/2997215859/golog"
 )
@@ -17,7 +21,98 @@ type Config struct {
 	DataTypeList []string `json:"data_type_list"`
 	DateSort     string   `json:"date_sort"`
 	Sort         bool     `json:"sort"`
-	OutputMode   string   `json:"output_mode"` // "per_stock"（默认，按票分文件）或 "per_day"（每天一个文件）
+	OutputMode   string   `json:"output_mode"` // "per_stock"（默认，按票分文件）/ "per_day"（每天一个文件）/ "per_day_clustered"（每天一个文件，按票聚簇）
+
+	OutputLayout      string `json:"output_layout"`       // "legacy"（默认）/ "hive"（按 date/market 分区，文件内部仍按 output_mode 组织行顺序）
+	OutputBucketCount int    `json:"output_bucket_count"` // hive 布局下按票哈希分桶数，0 表示不分桶
+	OutputFormat      string `json:"output_format"`       // "parquet"（默认）/ "arrow" / "csv.gz" / "both"（parquet + csv.gz）
+
+	BarIntervalList []string `json:"bar_interval_list"` // K 线周期，如 ["1s", "1m", "5m"]，默认 ["1m"]
+	BarFillMode     string   `json:"bar_fill_mode"`     // "none" / "empty"（默认）/ "forward"
+
+	ReconcilePriceTolerance  float64 `json:"reconcile_price_tolerance"`  // 日线对账价格绝对误差，默认 0.001
+	ReconcileVolumeTolerance float64 `json:"reconcile_volume_tolerance"` // 日线对账成交量/额相对误差，默认 0.001
+
+	ShRestoreOrderQty   bool `json:"sh_restore_order_qty"`  // 沪市新格式委托还原原始委托量（加回进入时立即成交的部分），并合成全部成交委托的新增记录；order_lifecycle 始终还原
+	OrderEffectivePrice bool `json:"order_effective_price"` // 填充委托的 EffectivePrice（市价/本方最优取首笔成交价或盘口价），需额外读取成交和快照
+
+	TimestampEncoding string `json:"timestamp_encoding"` // "utc_nanos"（默认）/ "local_nanos" / "hhmmssmmm"
+
+	SchemaProfile    string                    `json:"schema_profile"`     // 所有数据类型默认的 profile："full"（默认）/ "standard" / "minimal" 或 schema_profile_def 中的自定义名字
+	SchemaProfileMap map[string]string         `json:"schema_profile_map"` // 按 data type 指定 profile，如 {"snapshot": "minimal"}
+	SchemaProfileDef map[string]*SchemaProfile `json:"schema_profile_def"` // 自定义 profile，和内置 profile 同名时覆盖内置
+
+	ParquetCompression      string `json:"parquet_compression"`       // "snappy"（默认）/ "zstd" / "gzip" / "none"，压缩级别固定为编码器默认级别
+	ParquetCompressionLevel *int   `json:"parquet_compression_level"` // 不支持：parquet-go 无法设置压缩级别，配置了直接报错，避免误以为生效
+	ParquetRowGroupSizeMB   int64  `json:"parquet_row_group_size_mb"` // 默认 128
+	ParquetPageSizeKB       int64  `json:"parquet_page_size_kb"`      // 默认 8
+	ParquetWriterParallel   int64  `json:"parquet_writer_parallel"`   // 写入 goroutine 数，默认 4
+	ParquetDecimalPrice     bool   `json:"parquet_decimal_price"`     // 价格列写成 INT64 DECIMAL(18, scale)
+	ParquetDecimalScale     int    `json:"parquet_decimal_scale"`     // DECIMAL 小数位数，默认 4
+
+	PriceEncoding string `json:"price_encoding"`  // "float64"（默认）/ "int64"：所有输出格式的价格列写成 价格×10^price_scale 的整数
+	PriceScale    int    `json:"price_scale"`     // int64 价格的小数位数，默认 4（即 ×10000），写入文件元数据
+	TickSizeCheck bool   `json:"tick_size_check"` // 检查成交、委托、快照价格是否落在最小价格变动单位上
+
+	QueryInstrumentList []string `json:"query_instrument_list"` // query 子命令的票列表，为空表示全部
+	QueryTimeStart      string   `json:"query_time_start"`      // query 日内时间窗口起点（交易所本地时间，如 "09:30:00"），包含；空表示不限
+	QueryTimeEnd        string   `json:"query_time_end"`        // query 日内时间窗口终点，不包含；空表示不限
+	QueryOutputDir      string   `json:"query_output_dir"`      // query 结果目录，每种数据类型一个文件
+	QueryMerged         bool     `json:"query_merged"`          // true 时归并结果整体写成一个 query_tick 文件（model.Tick 行），不按数据类型拆分
+
+	AdjustType        string `json:"adjust_type"`          // "none"（默认）/ "qfq"（前复权）/ "hfq"（后复权），bar 和 daily 额外输出复权后的 <type>_<adjust_type>
+	AdjustBaseDate    string `json:"adjust_base_date"`     // 前复权基准日 YYYYMMDD，adjust_type 为 qfq 时必填，否则每次运行的基准不同；非交易日时向前取最近的交易日
+	AdjustPriceColumn bool   `json:"adjust_price_column"`  // adjust_type 不为 none 时，trade 和 snapshot 附加 AdjFactor 和复权价格列
+	AdjFactorCacheDir string `json:"adj_factor_cache_dir"` // 复权因子本地缓存目录，每天一个 JSON 文件，默认 dst_dir/reference/adj_factor
+
+	TickOrder string `json:"tick_order"` // tick 事件流按 "local"（默认，本地接收时间）或 "exchange"（交易所时间）排序
+
+	ServeAddr string `json:"serve_addr"` // serve 子命令的 HTTP 监听地址，默认 ":8080"
+
+	ReplayInstrumentList []string `json:"replay_instrument_list"` // replay 子命令回放的票，必填，最多 200 个
+	ReplaySpeed          string   `json:"replay_speed"`           // 初始回放速度："1"（默认）、"10" 等倍数，"max" 为不等待尽快发送
+	ReplayTcpAddr        string   `json:"replay_tcp_addr"`        // 换行分隔 JSON 的 TCP 监听地址，默认 "127.0.0.1:9001"，对外提供时显式配置
+	ReplayWsAddr         string   `json:"replay_ws_addr"`         // WebSocket 监听地址，默认 "127.0.0.1:9002"
+	ReplayWsOriginList   []string `json:"replay_ws_origin_list"`  // 允许跨域连接 WebSocket 的 Origin，如 "http://localhost:3000"；为空时只接受同源和不带 Origin 的客户端
+}
+
+// SchemaProfile 输出列的投影，列名和类型在不同 profile 间保持不变，只是多或少
+type SchemaProfile struct {
+	ColumnList        []string `json:"column_list"`         // 只输出这些列，为空表示全部
+	ExcludeColumnList []string `json:"exclude_column_list"` // 不输出的列
+	BookDepth         int      `json:"book_depth"`          // 快照盘口档数 5 或 10，0 表示 10
+}
+
+var builtinSchemaProfileMap = map[string]*SchemaProfile{
+	constdef.SchemaProfileFull: {},
+	constdef.SchemaProfileStandard: {
+		ExcludeColumnList: []string{"SeqNo", "LocalTimestamp"},
+	},
+	constdef.SchemaProfileMinimal: {
+		ExcludeColumnList: []string{"SeqNo", "LocalTimestamp", "Channel", "BizIndex", "ApplSeqNum", "ExecType"},
+		BookDepth:         5,
+	},
+}
+
+// GetSchemaProfileName data type 使用的 profile 名
+func (c *Config) GetSchemaProfileName(dataType string) string {
+	if name, ok := c.SchemaProfileMap[dataType]; ok && name != "" {
+		return name
+	}
+	if c.SchemaProfile == "" {
+		return constdef.SchemaProfileFull
+	}
+	return c.SchemaProfile
+}
+
+// GetSchemaProfile 按名字查找 profile，自定义优先；不存在时返回 false
+func (c *Config) GetSchemaProfile(dataType string) (*SchemaProfile, bool) {
+	name := c.GetSchemaProfileName(dataType)
+	if profile, ok := c.SchemaProfileDef[name]; ok && profile != nil {
+		return profile, true
+	}
+	profile, ok := builtinSchemaProfileMap[name]
+	return profile, ok
 }
 
 func (c *Config) GetOutputMode() string {
@@ -27,8 +122,181 @@ func (c *Config) GetOutputMode() string {
 	return c.OutputMode
 }
 
+// IsPerDay per_day 和 per_day_clustered 的目录结构、文件名相同，只是文件内的行顺序不同
 func (c *Config) IsPerDay() bool {
-	return c.GetOutputMode() == constdef.OutputModePerDay
+	return c.GetOutputMode() == constdef.OutputModePerDay || c.IsPerDayClustered()
+}
+
+func (c *Config) IsPerDayClustered() bool {
+	return c.GetOutputMode() == constdef.OutputModePerDayClustered
+}
+
+func (c *Config) GetOutputLayout() string {
+	if c.OutputLayout == "" {
+		return constdef.OutputLayoutLegacy
+	}
+	return c.OutputLayout
+}
+
+func (c *Config) IsHiveLayout() bool {
+	return c.GetOutputLayout() == constdef.OutputLayoutHive
+}
+
+func (c *Config) GetOutputFormat() string {
+	if c.OutputFormat == "" {
+		return constdef.OutputFormatParquet
+	}
+	return c.OutputFormat
+}
+
+func (c *Config) GetBarIntervalList() []string {
+	if len(c.BarIntervalList) == 0 {
+		return []string{"1m"}
+	}
+	return c.BarIntervalList
+}
+
+func (c *Config) GetBarFillMode() string {
+	if c.BarFillMode == "" {
+		return constdef.BarFillEmpty
+	}
+	return c.BarFillMode
+}
+
+func (c *Config) GetReconcilePriceTolerance() float64 {
+	if c.ReconcilePriceTolerance <= 0 {
+		return 0.001
+	}
+	return c.ReconcilePriceTolerance
+}
+
+func (c *Config) GetReconcileVolumeTolerance() float64 {
+	if c.ReconcileVolumeTolerance <= 0 {
+		return 0.001
+	}
+	return c.ReconcileVolumeTolerance
+}
+
+func (c *Config) GetTimestampEncoding() string {
+	if c.TimestampEncoding == "" {
+		return constdef.TimestampEncodingUtcNanos
+	}
+	return c.TimestampEncoding
+}
+
+func (c *Config) GetParquetCompression() string {
+	if c.ParquetCompression == "" {
+		return constdef.ParquetCompressionSnappy
+	}
+	return c.ParquetCompression
+}
+
+func (c *Config) GetParquetRowGroupSize() int64 {
+	if c.ParquetRowGroupSizeMB <= 0 {
+		return 128 * 1024 * 1024
+	}
+	return c.ParquetRowGroupSizeMB * 1024 * 1024
+}
+
+func (c *Config) GetParquetPageSize() int64 {
+	if c.ParquetPageSizeKB <= 0 {
+		return 8 * 1024
+	}
+	return c.ParquetPageSizeKB * 1024
+}
+
+func (c *Config) GetParquetWriterParallel() int64 {
+	if c.ParquetWriterParallel <= 0 {
+		return 4
+	}
+	return c.ParquetWriterParallel
+}
+
+func (c *Config) GetParquetDecimalScale() int {
+	if c.ParquetDecimalScale <= 0 {
+		return 4
+	}
+	return c.ParquetDecimalScale
+}
+
+func (c *Config) GetPriceEncoding() string {
+	if c.PriceEncoding == "" {
+		return constdef.PriceEncodingFloat64
+	}
+	return c.PriceEncoding
+}
+
+func (c *Config) IsInt64Price() bool {
+	return c.GetPriceEncoding() == constdef.PriceEncodingInt64
+}
+
+func (c *Config) GetPriceScale() int {
+	if c.PriceScale <= 0 {
+		return 4
+	}
+	return c.PriceScale
+}
+
+func (c *Config) GetAdjustType() string {
+	if c.AdjustType == "" {
+		return constdef.AdjustTypeNone
+	}
+	return c.AdjustType
+}
+
+func (c *Config) IsAdjust() bool {
+	return c.GetAdjustType() != constdef.AdjustTypeNone
+}
+
+// IsAdjustPriceColumn 未开启时 trade 和 snapshot 的复权列在写入时去掉
+func (c *Config) IsAdjustPriceColumn() bool {
+	return c.AdjustPriceColumn && c.IsAdjust()
+}
+
+func (c *Config) GetAdjustBaseDate() string {
+	return c.AdjustBaseDate
+}
+
+func (c *Config) GetAdjFactorCacheDir() string {
+	if c.AdjFactorCacheDir == "" {
+		return filepath.Join(c.DstDir, "reference", "adj_factor")
+	}
+	return c.AdjFactorCacheDir
+}
+
+func (c *Config) GetTickOrder() string {
+	if c.TickOrder == "" {
+		return constdef.TickOrderLocal
+	}
+	return c.TickOrder
+}
+
+func (c *Config) GetServeAddr() string {
+	if c.ServeAddr == "" {
+		return ":8080"
+	}
+	return c.ServeAddr
+}
+
+func (c *Config) GetReplaySpeed() string {
+	if c.ReplaySpeed == "" {
+		return "1"
+	}
+	return c.ReplaySpeed
+}
+
+func (c *Config) GetReplayTcpAddr() string {
+	if c.ReplayTcpAddr == "" {
+		return "127.0.0.1:9001"
+	}
+	return c.ReplayTcpAddr
+}
+
+func (c *Config) GetReplayWsAddr() string {
+	if c.ReplayWsAddr == "" {
+		return "127.0.0.1:9002"
+	}
+	return c.ReplayWsAddr
 }
 
 var Cfg *Config
@@ -55,11 +323,56 @@ func ReadConfig(filepath string) *Config {
 	if err := json.Unmarshal(data, &config); err != nil {
 		logger.Fatal("json.Unmarshal(%s) error: %v", filepath, err)
 	}
+	if err := config.Validate(); err != nil {
+		logger.Fatal("config_file(%s) %v", filepath, err)
+	}
 
 	Cfg = config
 	return config
 }
 
+// checkEnum 枚举配置项只能取 allowList 中的值
+func checkEnum(key string, value string, allowList ...string) error {
+	if slices.Contains(allowList, value) {
+		return nil
+	}
+	return errorx.NewError("unknown %s(%s), must be one of %s", key, value, strings.Join(allowList, "/"))
+}
+
+// Validate 枚举配置项写错时在启动时报错，不在写文件时才失败或默默按默认值处理
+// （如 timestamp_encoding 写错会把 UTC 纳秒标记成本地时间，读出来整体偏移 8 小时）
+func (c *Config) Validate() error {
+	enumList := []struct {
+		key       string
+		value     string
+		allowList []string
+	}{
+		{"output_mode", c.GetOutputMode(), []string{constdef.OutputModePerStock, constdef.OutputModePerDay, constdef.OutputModePerDayClustered}},
+		{"output_layout", c.GetOutputLayout(), []string{constdef.OutputLayoutLegacy, constdef.OutputLayoutHive}},
+		{"output_format", c.GetOutputFormat(), []string{constdef.OutputFormatParquet, constdef.OutputFormatArrow, constdef.OutputFormatCsvGz, constdef.OutputFormatBoth}},
+		{"timestamp_encoding", c.GetTimestampEncoding(), []string{constdef.TimestampEncodingUtcNanos, constdef.TimestampEncodingLocalNanos, constdef.TimestampEncodingHHMMSSmmm}},
+		{"parquet_compression", c.GetParquetCompression(), []string{constdef.ParquetCompressionSnappy, constdef.ParquetCompressionZstd, constdef.ParquetCompressionGzip, constdef.ParquetCompressionNone}},
+		// price_encoding 决定所有输出文件价格列的类型，写错时不按 float64 默默输出
+		{"price_encoding", c.GetPriceEncoding(), []string{constdef.PriceEncodingFloat64, constdef.PriceEncodingInt64}},
+		{"bar_fill_mode", c.GetBarFillMode(), []string{constdef.BarFillNone, constdef.BarFillEmpty, constdef.BarFillForward}},
+		{"tick_order", c.GetTickOrder(), []string{constdef.TickOrderLocal, constdef.TickOrderExchange}},
+		{"adjust_type", c.GetAdjustType(), []string{constdef.AdjustTypeNone, constdef.AdjustTypeForward, constdef.AdjustTypeBackward}},
+	}
+	for _, v := range enumList {
+		if err := checkEnum(v.key, v.value, v.allowList...); err != nil {
+			return err
+		}
+	}
+	if c.ParquetCompressionLevel != nil {
+		return errorx.NewError("parquet_compression_level is not supported, %s uses the encoder's default level", c.GetParquetCompression())
+	}
+	// 前复权以基准日的因子为 1，不指定时每次运行的基准不同
+	if c.GetAdjustType() == constdef.AdjustTypeForward && c.AdjustBaseDate == "" {
+		return errorx.NewError("adjust_type(%s) requires adjust_base_date", constdef.AdjustTypeForward)
+	}
+	return nil
+}
+
 func InitConfig(filepath string) *Config {
 	config := ReadConfig(filepath)
 
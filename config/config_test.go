@@ -0,0 +1,32 @@
+package config
+
+import (
+	"data-scrubber/biz/constdef"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	if err := (&Config{}).Validate(); err != nil {
+		t.Fatalf("default config should pass, got %v", err)
+	}
+	badList := []*Config{
+		{TimestampEncoding: "local_nano"},
+		{OutputFormat: "parquet_gz"},
+		{OutputMode: "per_days"},
+		{OutputLayout: "hives"},
+		{ParquetCompression: "lz4"},
+		{BarFillMode: "ffill"},
+		{PriceEncoding: "int"},
+		{AdjustType: constdef.AdjustTypeForward},
+		{ParquetCompression: constdef.ParquetCompressionZstd, ParquetCompressionLevel: new(int)},
+	}
+	for _, c := range badList {
+		if err := c.Validate(); err == nil {
+			t.Errorf("config %+v should be rejected", *c)
+		}
+	}
+	good := &Config{TimestampEncoding: constdef.TimestampEncodingLocalNanos, ParquetCompression: constdef.ParquetCompressionZstd, OutputMode: constdef.OutputModePerDayClustered}
+	if err := good.Validate(); err != nil {
+		t.Errorf("valid config rejected: %v", err)
+	}
+}
@@ -2,9 +2,15 @@ package main
 
 import (
 	"data-scrubber/biz/constdef"
+	"data-scrubber/biz/model"
+	"data-scrubber/biz/reader"
+	"data-scrubber/biz/replay"
+	"data-scrubber/biz/server"
 	"data-scrubber/biz/service"
 	"data-scrubber/biz/utils"
 	"data-scrubber/config"
+	"fmt"
+	"os"
 	"path/filepath"
 	"slices"
 
@@ -39,10 +45,19 @@ func RunDaily(currentDate *carbon.Carbon, cfg *config.Config) {
 		return
 	}
 
+	service.ResetRunReport(date)
+	defer func() {
+		if err := service.WriteRunReport(cfg.DstDir); err != nil {
+			logger.Error("date(%s) WriteRunReport error: %v", date, err)
+		}
+	}()
+	// 当天各 data type 共用的清洗上下文
+	day := service.NewDayContext(cfg.SrcDir, date)
+
 	// rootdir / snapshot / datedir / date_snapshot.csv
 	if slices.Contains(cfg.DataTypeList, constdef.DataTypeSnapshot) {
 		logger.Info("Process Date(%s) Snapshot Begin", date)
-		if err := service.MergeRawSnapshot(cfg.SrcDir, cfg.DstDir, date); err != nil {
+		if err := service.MergeRawSnapshot(day, cfg.DstDir); err != nil {
 			logger.Error("date(%s) MergeRawSnapshot error: %v", date, err)
 		}
 		logger.Info("Process Date(%s) Snapshot End", date)
@@ -50,7 +65,7 @@ func RunDaily(currentDate *carbon.Carbon, cfg *config.Config) {
 
 	if slices.Contains(cfg.DataTypeList, constdef.DataTypeTrade) {
 		logger.Info("Process Date(%s) Trade Begin", date)
-		if err := service.MergeRawTrade(cfg.SrcDir, cfg.DstDir, date); err != nil {
+		if err := service.MergeRawTrade(day, cfg.DstDir); err != nil {
 			logger.Error("date(%s) MergeRawTrade error: %v", date, err)
 		}
 		logger.Info("Process Date(%s) Trade End", date)
@@ -58,7 +73,7 @@ func RunDaily(currentDate *carbon.Carbon, cfg *config.Config) {
 
 	if slices.Contains(cfg.DataTypeList, constdef.DataTypeOrder) {
 		logger.Info("Process Date(%s) Order Begin", date)
-		if err := service.MergeRawOrder(cfg.SrcDir, cfg.DstDir, date); err != nil {
+		if err := service.MergeRawOrder(day, cfg.DstDir); err != nil {
 			logger.Error("date(%s) MergeRawOrder error: %v", date, err)
 		}
 		logger.Info("Process Date(%s) Order End", date)
@@ -66,16 +81,224 @@ func RunDaily(currentDate *carbon.Carbon, cfg *config.Config) {
 
 	if slices.Contains(cfg.DataTypeList, constdef.DataTypeOrderQueue) {
 		logger.Info("Process Date(%s) OrderQueue Begin", date)
-		if err := service.MergeRawOrderQueue(cfg.SrcDir, cfg.DstDir, date); err != nil {
+		if err := service.MergeRawOrderQueue(day, cfg.DstDir); err != nil {
 			logger.Error("date(%s) MergeRawOrderQueue error: %v", date, err)
 		}
 		logger.Info("Process Date(%s) OrderQueue End", date)
 	}
+
+	if slices.Contains(cfg.DataTypeList, constdef.DataTypeBar) {
+		logger.Info("Process Date(%s) Bar Begin", date)
+		if err := service.MergeRawBar(day, cfg.DstDir); err != nil {
+			logger.Error("date(%s) MergeRawBar error: %v", date, err)
+		}
+		logger.Info("Process Date(%s) Bar End", date)
+	}
+
+	if slices.Contains(cfg.DataTypeList, constdef.DataTypeDaily) {
+		logger.Info("Process Date(%s) Daily Begin", date)
+		if err := service.MergeRawDaily(day, cfg.DstDir); err != nil {
+			logger.Error("date(%s) MergeRawDaily error: %v", date, err)
+		}
+		logger.Info("Process Date(%s) Daily End", date)
+	}
+
+	if slices.Contains(cfg.DataTypeList, constdef.DataTypeOrderLifecycle) {
+		logger.Info("Process Date(%s) OrderLifecycle Begin", date)
+		if err := service.MergeRawOrderLifecycle(day, cfg.DstDir); err != nil {
+			logger.Error("date(%s) MergeRawOrderLifecycle error: %v", date, err)
+		}
+		logger.Info("Process Date(%s) OrderLifecycle End", date)
+	}
+
+	if slices.Contains(cfg.DataTypeList, constdef.DataTypeTick) {
+		logger.Info("Process Date(%s) Tick Begin", date)
+		if err := service.MergeRawTick(day, cfg.DstDir); err != nil {
+			logger.Error("date(%s) MergeRawTick error: %v", date, err)
+		}
+		logger.Info("Process Date(%s) Tick End", date)
+	}
+
+	if slices.Contains(cfg.DataTypeList, constdef.DataTypeInstrument) {
+		logger.Info("Process Date(%s) Instrument Begin", date)
+		if err := service.MergeRawInstrument(day, cfg.DstDir); err != nil {
+			logger.Error("date(%s) MergeRawInstrument error: %v", date, err)
+		}
+		logger.Info("Process Date(%s) Instrument End", date)
+	}
+}
+
+// RunValidate 只做逐笔序号完整性检查
+func RunValidate(currentDate *carbon.Carbon, cfg *config.Config) {
+	date := currentDate.Format("Ymd")
+	dateDir := filepath.Join(cfg.SrcDir, date)
+	if !utils.Exists(dateDir) {
+		logger.Warn("date(%s) not exists", date)
+		return
+	}
+
+	logger.Info("Process Date(%s) Validate Begin", date)
+	if err := service.ValidateSequence(cfg.SrcDir, cfg.DstDir, date); err != nil {
+		logger.Error("date(%s) ValidateSequence error: %v", date, err)
+	}
+	logger.Info("Process Date(%s) Validate End", date)
+}
+
+// RunQuery 从 dst_dir 的清洗输出中按 query_* 配置做多日、多票合并查询，data_type_list 指定数据类型，
+// 结果按时间归并后每种数据类型写一个文件 query_output_dir/query_<type>.parquet（格式按 output_format）；
+// query_merged 时保持归并顺序写成一个 query_tick.parquet
+func RunQuery(dateList []*carbon.Carbon, cfg *config.Config) {
+	ds, err := reader.Open(cfg.DstDir)
+	if err != nil {
+		logger.Error("reader.Open(%s) error: %v", cfg.DstDir, err)
+		return
+	}
+	if err := os.MkdirAll(cfg.QueryOutputDir, 0755); err != nil {
+		logger.Error("MkdirAll(%s) error: %v", cfg.QueryOutputDir, err)
+		return
+	}
+
+	query := &reader.Query{
+		DataTypeList:   cfg.DataTypeList,
+		InstrumentList: cfg.QueryInstrumentList,
+		TimeStart:      cfg.QueryTimeStart,
+		TimeEnd:        cfg.QueryTimeEnd,
+	}
+	for _, currentDate := range dateList {
+		query.DateList = append(query.DateList, currentDate.Format("Ymd"))
+	}
+
+	writerMap := make(map[string]service.OutputWriter)
+	defer func() {
+		for dataType, w := range writerMap {
+			if err := w.Close(); err != nil {
+				logger.Error("query close %s output error: %v", dataType, err)
+			}
+		}
+	}()
+	getWriter := func(dataType string, schema interface{}) (service.OutputWriter, error) {
+		if w, ok := writerMap[dataType]; ok {
+			return w, nil
+		}
+		w, err := service.NewOutputWriter(filepath.Join(cfg.QueryOutputDir, fmt.Sprintf("query_%s.parquet", dataType)), schema, nil)
+		if err != nil {
+			return nil, err
+		}
+		writerMap[dataType] = w
+		return w, nil
+	}
+
+	logger.Info("Query Begin")
+	count := 0
+	for record, err := range ds.Query(query) {
+		if err != nil {
+			logger.Error("Query error: %v", err)
+			return
+		}
+		row, dataType := record.Row(), record.DataType
+		if cfg.QueryMerged {
+			row, dataType = recordToTick(record), constdef.DataTypeTick
+		}
+		w, err := getWriter(dataType, row)
+		if err != nil {
+			logger.Error("query %s NewOutputWriter error: %v", dataType, err)
+			return
+		}
+		if err := w.Write(row); err != nil {
+			logger.Error("query %s write error: %v", dataType, err)
+			return
+		}
+		count++
+	}
+	logger.Info("Query End, %d records written to %s", count, cfg.QueryOutputDir)
+}
+
+// recordToTick 合并导出时把各类型的记录转成统一的 tick 行
+func recordToTick(record *reader.Record) *model.Tick {
+	switch record.DataType {
+	case constdef.DataTypeTrade:
+		return service.TradeToTick(record.Trade)
+	case constdef.DataTypeOrder:
+		return service.OrderToTick(record.Order)
+	case constdef.DataTypeSnapshot:
+		return service.SnapshotToTick(record.Snapshot)
+	}
+	return service.OrderQueueToTick(record.OrderQueue)
+}
+
+// RunServe 在 serve_addr 上提供 dst_dir 的只读 HTTP 接口，不看日期配置
+func RunServe(cfg *config.Config) {
+	ds, err := reader.Open(cfg.DstDir)
+	if err != nil {
+		logger.Error("reader.Open(%s) error: %v", cfg.DstDir, err)
+		return
+	}
+	if err := server.NewServer(ds).ListenAndServe(cfg.GetServeAddr()); err != nil {
+		logger.Error("serve error: %v", err)
+	}
+}
+
+// RunReplay 按 replay_* 配置在 TCP 和 WebSocket 上回放 dateList 的行情，data_type_list 中不能按行读取的类型忽略
+func RunReplay(dateList []*carbon.Carbon, cfg *config.Config) {
+	ds, err := reader.Open(cfg.DstDir)
+	if err != nil {
+		logger.Error("reader.Open(%s) error: %v", cfg.DstDir, err)
+		return
+	}
+	opt := &replay.Options{InstrumentList: cfg.ReplayInstrumentList, Speed: cfg.GetReplaySpeed(), OriginList: cfg.ReplayWsOriginList}
+	for _, dataType := range cfg.DataTypeList {
+		if slices.Contains(reader.ReadableDataTypeList, dataType) {
+			opt.DataTypeList = append(opt.DataTypeList, dataType)
+		}
+	}
+	if len(opt.DataTypeList) == 0 {
+		logger.Error("replay data_type_list(%v) has no readable data type", cfg.DataTypeList)
+		return
+	}
+	for _, currentDate := range dateList {
+		opt.DateList = append(opt.DateList, currentDate.Format("Ymd"))
+	}
+	slices.Sort(opt.DateList)
+
+	s, err := replay.NewServer(ds, opt)
+	if err != nil {
+		logger.Error("replay_instrument_list error: %v", err)
+		return
+	}
+	go func() {
+		if err := s.ListenWebSocket(cfg.GetReplayWsAddr()); err != nil {
+			logger.Error("replay websocket error: %v", err)
+		}
+	}()
+	if err := s.ListenTcp(cfg.GetReplayTcpAddr()); err != nil {
+		logger.Error("replay tcp error: %v", err)
+	}
 }
 
 func main() {
 	cfg := config.InitConfig(GetConfigFilePath())
 
+	// 子命令：data-scrubber -c xxx.json [run|validate|query|serve|replay]，默认 run
+	command := pflag.Arg(0)
+	if command == "" {
+		command = constdef.CommandRun
+	}
+	var runDate func(currentDate *carbon.Carbon, cfg *config.Config)
+	switch command {
+	case constdef.CommandRun:
+		runDate = RunDaily
+	case constdef.CommandValidate:
+		runDate = RunValidate
+	case constdef.CommandQuery, constdef.CommandReplay:
+	case constdef.CommandServe:
+		config.PrintVersionInfo()
+		RunServe(cfg)
+		return
+	default:
+		logger.Error("unknown command(%s)", command)
+		return
+	}
+
 	service.InitTuShare()
 
 	config.PrintVersionInfo()
@@ -91,14 +314,15 @@ func main() {
 		return
 	}
 
+	dateList := make([]*carbon.Carbon, 0)
 	if cfg.DateList == nil {
 		if cfg.DateSort != "desc" {
 			for currentDate := startDate; currentDate.Lte(endDate); currentDate = currentDate.AddDay() {
-				RunDaily(currentDate, cfg)
+				dateList = append(dateList, currentDate)
 			}
 		} else {
 			for currentDate := endDate; currentDate.Gte(startDate); currentDate = currentDate.SubDay() {
-				RunDaily(currentDate, cfg)
+				dateList = append(dateList, currentDate)
 			}
 		}
 	} else {
@@ -108,10 +332,22 @@ func main() {
 				logger.Error("cfg.DateList.(%s) is invalid", date)
 				continue
 			}
-			RunDaily(currentDate, cfg)
+			dateList = append(dateList, currentDate)
 		}
 	}
 
+	if command == constdef.CommandQuery {
+		RunQuery(dateList, cfg)
+		return
+	}
+	if command == constdef.CommandReplay {
+		RunReplay(dateList, cfg)
+		return
+	}
+	for _, currentDate := range dateList {
+		runDate(currentDate, cfg)
+	}
+
 	//service.ExampleUsage()
 
 }